@@ -0,0 +1,300 @@
+// Contains the download of remote directory trees into tar and zip archives
+// and the upload of archives as remote directory trees.
+
+package ftps_qftp_client
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat is the format of the archives written by DownloadArchive and
+// read by UploadArchive.
+type ArchiveFormat int8
+
+const (
+	// Uncompressed tar archive
+	Tar ArchiveFormat = iota
+	// Zip archive with the files compressed by deflate
+	Zip
+)
+
+// Writes the entries of a remote tree into an archive.
+type archiveWriter interface {
+	// Writes the header of the entry with the path relative to the root of
+	// the archive and returns the writer of its content, nil for none
+	create(name string, entry *Entry) (io.Writer, error)
+	Close() error
+}
+
+// DownloadArchive walks the remote tree below remoteRoot and streams its
+// directories, files and links into an archive of the format written to w,
+// so a snapshot of a remote directory needs no local files. The paths in the
+// archive are relative to remoteRoot, e.g. "docs/a.txt" for the file
+// /pub/docs/a.txt below /pub. The files are retrieved one after another on
+// the connection. A file, which can not be retrieved completely, fails the
+// download, the archive written so far is incomplete then.
+func DownloadArchive(conn ConnectionI, remoteRoot string, w io.Writer, format ArchiveFormat) error {
+	var archive archiveWriter
+	switch format {
+	case Tar:
+		archive = tarWriter{tar.NewWriter(w)}
+	case Zip:
+		archive = zipWriter{zip.NewWriter(w)}
+	default:
+		return errors.New("Unknown archive format " + strconv.Itoa(int(format)) + ".")
+	}
+
+	err := Walk(conn, remoteRoot, func(remotePath string, entry *Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type == EntryTypeLink && entry.Target == "" {
+			// The listing does not contain the target
+			return nil
+		}
+		content, err := archive.create(relativeRemotePath(remoteRoot, remotePath), entry)
+		if err != nil || entry.Type != EntryTypeFile {
+			return err
+		}
+		return archiveFile(conn, remotePath, int64(entry.Size), content)
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// Retrieves the remote file with the size of its entry into the archive.
+func archiveFile(conn ConnectionI, remotePath string, size int64, content io.Writer) error {
+	reader, err := conn.Retr(remotePath)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(content, reader, size)
+	closeErr := reader.Close()
+	if err == io.EOF {
+		err = errors.New("The file " + remotePath + " is shorter than listed, it was changed while archived.")
+	}
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Returns the permissions of the entry or, if the listing does not contain
+// them, the usual ones of its type.
+func archiveMode(entry *Entry) os.FileMode {
+	switch {
+	case entry.Mode != 0:
+		return entry.Mode
+	case entry.IsDir():
+		return 0755
+	case entry.Type == EntryTypeLink:
+		return 0777
+	}
+	return 0644
+}
+
+// Returns the modification time of the entry or, if the listing does not
+// contain it, the current time.
+func archiveTime(entry *Entry) time.Time {
+	if entry.Time.IsZero() {
+		return time.Now()
+	}
+	return entry.Time
+}
+
+// Writes a tar archive.
+type tarWriter struct {
+	*tar.Writer
+}
+
+func (w tarWriter) create(name string, entry *Entry) (io.Writer, error) {
+	header := &tar.Header{Name: name, Mode: int64(archiveMode(entry).Perm()), ModTime: archiveTime(entry),
+		Uname: entry.Owner, Gname: entry.Group}
+	switch {
+	case entry.IsDir():
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+	case entry.Type == EntryTypeLink:
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = entry.Target
+	default:
+		header.Typeflag = tar.TypeReg
+		header.Size = int64(entry.Size)
+	}
+	if err := w.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	return w.Writer, nil
+}
+
+// Writes a zip archive.
+type zipWriter struct {
+	*zip.Writer
+}
+
+func (w zipWriter) create(name string, entry *Entry) (io.Writer, error) {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: archiveTime(entry)}
+	mode := archiveMode(entry).Perm()
+	switch {
+	case entry.IsDir():
+		header.Name += "/"
+		header.Method = zip.Store
+		mode |= os.ModeDir
+	case entry.Type == EntryTypeLink:
+		mode |= os.ModeSymlink
+	}
+	header.SetMode(mode)
+	content, err := w.CreateHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Type == EntryTypeLink {
+		// The content of a link is its target
+		_, err = io.WriteString(content, entry.Target)
+	}
+	return content, err
+}
+
+// UploadArchive reads an archive of the format from r and creates its
+// directories and files below remoteRoot, e.g. for deployments. The
+// directories of the paths are created, if the archive does not contain
+// them. Links and other special files are skipped, as FTP can not create
+// them. Paths leaving remoteRoot, e.g. "../a.txt", fail the upload, in zip
+// archives before anything is stored. A zip archive is spooled to a
+// temporary file, as its directory is at the end.
+func UploadArchive(conn ConnectionI, r io.Reader, remoteRoot string, format ArchiveFormat) error {
+	uploader := &archiveUploader{conn: conn, remoteRoot: remoteRoot, created: make(map[string]bool)}
+	switch format {
+	case Tar:
+		return uploader.uploadTar(tar.NewReader(r))
+	case Zip:
+		file, err := ioutil.TempFile("", "archive")
+		if err != nil {
+			return errors.New("Error while creating the temporary file for the archive. " + err.Error())
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+		size, err := io.Copy(file, r)
+		if err != nil {
+			return errors.New("Error while reading the archive. " + err.Error())
+		}
+		archive, err := zip.NewReader(file, size)
+		if err != nil {
+			return err
+		}
+		return uploader.uploadZip(archive)
+	}
+	return errors.New("Unknown archive format " + strconv.Itoa(int(format)) + ".")
+}
+
+// Creates the entries of an archive at the server.
+type archiveUploader struct {
+	conn       ConnectionI
+	remoteRoot string
+	created    map[string]bool // remote directories known to exist
+}
+
+// Stores the entries of the tar archive one after another, as it is read.
+func (u *archiveUploader) uploadTar(archive *tar.Reader) error {
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = u.makeDir(header.Name)
+		case tar.TypeReg:
+			err = u.store(header.Name, archive)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Checks the paths of the zip archive and stores its entries.
+func (u *archiveUploader) uploadZip(archive *zip.Reader) error {
+	for _, file := range archive.File {
+		if _, err := u.remotePath(file.Name); err != nil {
+			return err
+		}
+	}
+	for _, file := range archive.File {
+		var err error
+		switch mode := file.Mode(); {
+		case mode.IsDir():
+			err = u.makeDir(file.Name)
+		case mode.IsRegular():
+			var content io.ReadCloser
+			if content, err = file.Open(); err == nil {
+				err = u.store(file.Name, content)
+				content.Close()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates the remote directory of the path in the archive.
+func (u *archiveUploader) makeDir(name string) error {
+	remotePath, err := u.remotePath(name)
+	if err != nil {
+		return err
+	}
+	return u.mkdirAll(remotePath)
+}
+
+// Stores the content as the remote file of the path in the archive.
+func (u *archiveUploader) store(name string, content io.Reader) error {
+	remotePath, err := u.remotePath(name)
+	if err != nil {
+		return err
+	}
+	if err = u.mkdirAll(path.Dir(remotePath)); err != nil {
+		return err
+	}
+	if err = u.conn.Stor(remotePath, content); err != nil {
+		return errors.New("Error while storing " + remotePath + ". " + err.Error())
+	}
+	return nil
+}
+
+// Creates the remote directory and its parents, if not done before.
+func (u *archiveUploader) mkdirAll(remotePath string) error {
+	if u.created[remotePath] {
+		return nil
+	}
+	if err := MkdirAll(u.conn, remotePath); err != nil {
+		return err
+	}
+	u.created[remotePath] = true
+	return nil
+}
+
+// Returns the remote path of a path in the archive. Absolute paths and paths
+// leaving the root are refused, so an archive can not overwrite other files.
+func (u *archiveUploader) remotePath(name string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errors.New("The path " + name + " of the archive leaves the remote directory.")
+	}
+	return path.Join(u.remoteRoot, cleaned), nil
+}
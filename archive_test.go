@@ -0,0 +1,143 @@
+package ftps_qftp_client
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// Returns the remote tree of the archive tests.
+func newArchiveServer() *memoryServer {
+	server := newMemoryServer()
+	server.dirs["/pub"] = true
+	server.dirs["/pub/sub"] = true
+	server.files["/pub/a.txt"] = []byte("file a")
+	server.files["/pub/sub/b.txt"] = []byte("file b in sub")
+	server.files["/other.txt"] = []byte("not below the root")
+	return server
+}
+
+var expectedArchive = map[string]string{
+	"a.txt":     "file a",
+	"sub/":      "",
+	"sub/b.txt": "file b in sub",
+}
+
+func TestDownloadArchiveTar(t *testing.T) {
+	var archive bytes.Buffer
+	if err := DownloadArchive(&memoryConn{server: newArchiveServer()}, "/pub", &archive, Tar); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := make(map[string]string)
+	reader := tar.NewReader(&archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[header.Name] = string(content)
+		if header.Name == "sub/" && (header.Typeflag != tar.TypeDir || header.Mode != 0755) {
+			t.Errorf("directory has the type %c and the mode %o", header.Typeflag, header.Mode)
+		}
+	}
+	if !reflect.DeepEqual(entries, expectedArchive) {
+		t.Errorf("archive contains %q, want %q", entries, expectedArchive)
+	}
+}
+
+func TestDownloadArchiveZip(t *testing.T) {
+	var archive bytes.Buffer
+	if err := DownloadArchive(&memoryConn{server: newArchiveServer()}, "/pub", &archive, Zip); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]string)
+	for _, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[file.Name] = string(content)
+	}
+	if !reflect.DeepEqual(entries, expectedArchive) {
+		t.Errorf("archive contains %q, want %q", entries, expectedArchive)
+	}
+}
+
+func TestDownloadArchiveErrors(t *testing.T) {
+	conn := &memoryConn{server: newArchiveServer()}
+	if err := DownloadArchive(conn, "/pub", ioutil.Discard, ArchiveFormat(7)); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if err := DownloadArchive(conn, "/missing", ioutil.Discard, Tar); err == nil {
+		t.Error("missing root archived")
+	}
+}
+
+func TestUploadArchive(t *testing.T) {
+	for _, format := range []ArchiveFormat{Tar, Zip} {
+		var archive bytes.Buffer
+		if err := DownloadArchive(&memoryConn{server: newArchiveServer()}, "/pub", &archive, format); err != nil {
+			t.Fatal(err)
+		}
+
+		server := newMemoryServer()
+		if err := UploadArchive(&memoryConn{server: server}, &archive, "/deploy", format); err != nil {
+			t.Fatalf("format %d: %v", format, err)
+		}
+		if !server.dirs["/deploy/sub"] {
+			t.Errorf("format %d: directory not created", format)
+		}
+		if string(server.files["/deploy/a.txt"]) != "file a" || string(server.files["/deploy/sub/b.txt"]) != "file b in sub" {
+			t.Errorf("format %d: uploaded %q", format, server.files)
+		}
+	}
+}
+
+func TestUploadArchiveLeavingRoot(t *testing.T) {
+	var tarArchive bytes.Buffer
+	tw := tar.NewWriter(&tarArchive)
+	tw.WriteHeader(&tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Size: 4, Mode: 0644})
+	tw.Write([]byte("evil"))
+	tw.Close()
+
+	var zipArchive bytes.Buffer
+	zw := zip.NewWriter(&zipArchive)
+	content, _ := zw.Create("good.txt")
+	content.Write([]byte("good"))
+	content, _ = zw.Create("sub/../../evil.txt")
+	content.Write([]byte("evil"))
+	zw.Close()
+
+	for format, archive := range map[ArchiveFormat]*bytes.Buffer{Tar: &tarArchive, Zip: &zipArchive} {
+		server := newMemoryServer()
+		server.dirs["/deploy"] = true
+		if err := UploadArchive(&memoryConn{server: server}, archive, "/deploy", format); err == nil {
+			t.Errorf("format %d: path leaving the root accepted", format)
+		}
+		if len(server.files) != 0 {
+			t.Errorf("format %d: stored %q", format, server.files)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Contains the pooled buffers used to copy the data of transfers.
+
+package ftps_qftp_client
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultBufferSize is the size of the buffers used to copy the data of
+// transfers, if no other size is set for a connection.
+const DefaultBufferSize = 256 * 1024
+
+// BufferPool provides reusable buffers of one size to copy the data of
+// transfers. The buffers are shared by all connections using the same size.
+type BufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// Pools of buffers by their size
+var bufferPools sync.Map
+
+// BufferPoolOfSize returns the pool of buffers with the size. A size <= 0
+// returns the one of DefaultBufferSize.
+func BufferPoolOfSize(size int) *BufferPool {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	if pool, available := bufferPools.Load(size); available {
+		return pool.(*BufferPool)
+	}
+	pool := &BufferPool{size: size}
+	pool.pool.New = func() interface{} {
+		buf := make([]byte, size)
+		return &buf
+	}
+	actual, _ := bufferPools.LoadOrStore(size, pool)
+	return actual.(*BufferPool)
+}
+
+// Size returns the size of the buffers of the pool.
+func (p *BufferPool) Size() int {
+	return p.size
+}
+
+// Copy copies from src to dst until EOF or an error like io.Copy, but with a
+// buffer of the pool. The data is always copied through the buffer, even if
+// dst implements io.ReaderFrom or src io.WriterTo, so the size of the reads
+// and writes is the size of the buffers.
+func (p *BufferPool) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := p.pool.Get().(*[]byte)
+	defer p.pool.Put(buf)
+	// Hide ReadFrom and WriteTo from io.CopyBuffer
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// CopyFast copies from src to dst until EOF or an error like io.Copy. If src
+// implements io.WriterTo or dst io.ReaderFrom, it is used for the copy, so
+// optimizations like sendfile and splice of the streams and files are taken.
+// Otherwise the data is copied through a buffer of the pool.
+func (p *BufferPool) CopyFast(dst io.Writer, src io.Reader) (int64, error) {
+	buf := p.pool.Get().(*[]byte)
+	defer p.pool.Put(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// Returns the pool of the buffer size of the connection, if it reports one
+// with BufferSize, otherwise the pool of DefaultBufferSize.
+func connBufferPool(conn ConnectionI) *BufferPool {
+	if sized, ok := conn.(interface{ BufferSize() int }); ok {
+		return BufferPoolOfSize(sized.BufferSize())
+	}
+	return BufferPoolOfSize(DefaultBufferSize)
+}
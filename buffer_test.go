@@ -0,0 +1,73 @@
+package ftps_qftp_client
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// Records the largest buffer passed to Read.
+type bufferSizeReader struct {
+	reader  io.Reader
+	maxRead int
+}
+
+func (r *bufferSizeReader) Read(buf []byte) (int, error) {
+	if len(buf) > r.maxRead {
+		r.maxRead = len(buf)
+	}
+	return r.reader.Read(buf)
+}
+
+func TestBufferPoolOfSize(t *testing.T) {
+	if BufferPoolOfSize(0) != BufferPoolOfSize(DefaultBufferSize) {
+		t.Error("Size 0 doesn't return the pool of the default size")
+	}
+	pool := BufferPoolOfSize(1024)
+	if pool != BufferPoolOfSize(1024) {
+		t.Error("Same size returned different pools")
+	}
+	if pool.Size() != 1024 {
+		t.Errorf("Pool has size %d, expected 1024", pool.Size())
+	}
+}
+
+func TestBufferPoolCopy(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	reader := &bufferSizeReader{reader: bytes.NewReader(data)}
+	// bytes.Buffer implements io.ReaderFrom, which must not be used
+	var written bytes.Buffer
+	n, err := BufferPoolOfSize(4096).Copy(&written, reader)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("Copy returned %d, %v", n, err)
+	}
+	if !bytes.Equal(written.Bytes(), data) {
+		t.Error("Copied data differs")
+	}
+	if reader.maxRead != 4096 {
+		t.Errorf("Read with buffers of %d bytes, expected 4096", reader.maxRead)
+	}
+}
+
+// Records whether ReadFrom was called.
+type readFromWriter struct {
+	bytes.Buffer
+	readFrom bool
+}
+
+func (w *readFromWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.readFrom = true
+	return w.Buffer.ReadFrom(r)
+}
+
+func TestBufferPoolCopyFast(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	var written readFromWriter
+	n, err := BufferPoolOfSize(4096).CopyFast(&written, &bufferSizeReader{reader: bytes.NewReader(data)})
+	if err != nil || n != int64(len(data)) || !bytes.Equal(written.Bytes(), data) {
+		t.Fatalf("CopyFast returned %d, %v", n, err)
+	}
+	if !written.readFrom {
+		t.Error("CopyFast didn't use ReadFrom of the writer")
+	}
+}
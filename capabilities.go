@@ -0,0 +1,44 @@
+// Contains the optional commands of servers preferred by the helpers.
+
+package ftps_qftp_client
+
+import (
+	"github.com/attenberger/ftps_qftp-client/internal/ftputil"
+)
+
+// Capabilities describes the optional commands announced by a server with
+// FEAT. The helpers like Walk and the resumption of transfers prefer them
+// over heuristics based on LIST.
+type Capabilities struct {
+	MLSD bool // machine readable listings with MLSD (RFC 3659), announced as MLST
+	MLST bool // machine readable facts of a single file or directory with MLST (RFC 3659)
+	Size bool // size of files with SIZE (RFC 3659)
+	MDTM bool // modification time of files with MDTM (RFC 3659)
+	MFMT bool // setting the modification time of files with MFMT
+	Hash bool // checksums of files with HASH
+}
+
+// CapabilitiesFromFeatures derives the Capabilities from the features
+// returned by FEAT.
+func CapabilitiesFromFeatures(features map[string]string) Capabilities {
+	has := func(name string) bool {
+		_, available := ftputil.LookupFeature(features, name)
+		return available
+	}
+	return Capabilities{
+		MLSD: has("MLST") || has("MLSD"),
+		MLST: has("MLST"),
+		Size: has("SIZE"),
+		MDTM: has("MDTM"),
+		MFMT: has("MFMT"),
+		Hash: has("HASH"),
+	}
+}
+
+// Lists the directory with MLSD, if the server supports it, otherwise with LIST.
+func listDir(conn ConnectionI, dir string) ([]*Entry, error) {
+	if conn.Capabilities().MLSD {
+		return conn.MachineList(dir)
+	}
+	return conn.List(dir)
+}
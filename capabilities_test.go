@@ -0,0 +1,65 @@
+package ftps_qftp_client
+
+import (
+	"testing"
+)
+
+func TestCapabilitiesFromFeatures(t *testing.T) {
+	capabilities := CapabilitiesFromFeatures(map[string]string{"mlst": "size*;type*;", "SIZE": "", "MDTM": ""})
+	expected := Capabilities{MLSD: true, MLST: true, Size: true, MDTM: true}
+	if capabilities != expected {
+		t.Errorf("CapabilitiesFromFeatures = %+v, want %+v", capabilities, expected)
+	}
+}
+
+// mlsdConn lists directories only with MLSD.
+type mlsdConn struct {
+	memoryConn
+	listings map[string][]string
+}
+
+func (c *mlsdConn) Capabilities() Capabilities {
+	return Capabilities{MLSD: true}
+}
+
+func (c *mlsdConn) List(path string) ([]*Entry, error) {
+	panic("LIST used although MLSD is supported")
+}
+
+func (c *mlsdConn) MachineList(path string) ([]*Entry, error) {
+	var entries []*Entry
+	for _, line := range c.listings[path] {
+		entry, err := ParseListLine(line)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func TestWalkPrefersMLSD(t *testing.T) {
+	conn := &mlsdConn{listings: map[string][]string{
+		"/pub": {
+			"type=cdir;modify=20150813224845; /pub",
+			"type=pdir;modify=20150813224845; /",
+			"type=dir;modify=20150813224845; sub",
+		},
+		"/pub/sub": {
+			"type=cdir;modify=20150813224845; /pub/sub",
+			"type=file;size=951;modify=20150813175250; welcome.msg",
+		},
+	}}
+
+	var visited []string
+	err := Walk(conn, "/pub", func(path string, entry *Entry, err error) error {
+		visited = append(visited, path)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) != 2 || visited[0] != "/pub/sub" || visited[1] != "/pub/sub/welcome.msg" {
+		t.Errorf("visited %v", visited)
+	}
+}
@@ -0,0 +1,88 @@
+// Contains the checksums of files used to verify transfers.
+
+package ftps_qftp_client
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned, if the checksum of the transfered file at
+// the server differs from the one of the local file. IsTransientError
+// classifies it as transient, so the transfer is retried with MaxRetries.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Checksum of a file
+type Checksum struct {
+	Algorithm string // name as used by the HASH command, e.g. "SHA-256" or "MD5"
+	Value     string // hexadecimal digest
+}
+
+// Matches reports whether both checksums are computed with the same algorithm
+// and have the same value.
+func (c Checksum) Matches(other Checksum) bool {
+	return strings.EqualFold(c.Algorithm, other.Algorithm) && strings.EqualFold(c.Value, other.Value)
+}
+
+// NewHash returns a hash for the algorithm with its name used by the HASH
+// command. Supported are MD5, SHA-1, SHA-256, SHA-512 and CRC32.
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToUpper(algorithm) {
+	case "MD5":
+		return md5.New(), nil
+	case "SHA-1":
+		return sha1.New(), nil
+	case "SHA-256":
+		return sha256.New(), nil
+	case "SHA-512":
+		return sha512.New(), nil
+	case "CRC32":
+		return crc32.NewIEEE(), nil
+	}
+	return nil, errors.New("Unsupported checksum algorithm " + algorithm + ".")
+}
+
+// FileChecksum computes the checksum of the local file with the algorithm.
+func FileChecksum(localPath string, algorithm string) (Checksum, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return Checksum{}, err
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return Checksum{}, err
+	}
+	defer file.Close()
+	if _, err = io.Copy(h, file); err != nil {
+		return Checksum{}, err
+	}
+	return Checksum{Algorithm: algorithm, Value: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Compares the checksum of the remote file computed by the server with the one
+// of the local file using the same algorithm.
+func verifyChecksum(conn ConnectionI, localPath string, remotePath string) error {
+	remote, err := conn.Checksum(remotePath)
+	if err != nil {
+		return errors.New("Error while requesting the checksum of " + remotePath + ". " + err.Error())
+	}
+	local, err := FileChecksum(localPath, remote.Algorithm)
+	if err != nil {
+		return errors.New("Error while computing the checksum of " + localPath + ". " + err.Error())
+	}
+	if !local.Matches(remote) {
+		return fmt.Errorf("Transfer of %s failed, %s %s at the server instead of %s. %w",
+			localPath, remote.Algorithm, remote.Value, local.Value, ErrChecksumMismatch)
+	}
+	return nil
+}
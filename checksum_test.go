@@ -0,0 +1,83 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// corruptingConn stores the first file with a wrong last byte.
+type corruptingConn struct {
+	memoryConn
+	corrupt *bool
+}
+
+func (c *corruptingConn) Stor(path string, r io.Reader) error {
+	if err := c.memoryConn.Stor(path, r); err != nil || !*c.corrupt {
+		return err
+	}
+	*c.corrupt = false
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	data := c.server.files[path]
+	data[len(data)-1]++
+	return nil
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	localFile, err := ioutil.TempFile("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(localFile.Name())
+	localFile.WriteString("verified content")
+	localFile.Close()
+
+	server := newMemoryServer()
+	corrupt := true
+	openConn := func() (ConnectionI, error) {
+		return &corruptingConn{memoryConn: memoryConn{server: server}, corrupt: &corrupt}, nil
+	}
+
+	task := NewTransferTask(Store, localFile.Name(), "verified.txt")
+	task.VerifyChecksum = true
+	results := NewTransferScheduler(1, openConn).Run(context.Background(), []TransferTask{task})
+	if !errors.Is(results[0].Err, ErrChecksumMismatch) {
+		t.Errorf("corrupt transfer failed with %v, want %v", results[0].Err, ErrChecksumMismatch)
+	}
+
+	corrupt = true
+	task.MaxRetries = 1
+	results = NewTransferScheduler(1, openConn).Run(context.Background(), []TransferTask{task})
+	if results[0].Err != nil || results[0].Attempts != 2 {
+		t.Errorf("err = %v after %d attempts, want success after 2", results[0].Err, results[0].Attempts)
+	}
+}
+
+func TestFileChecksum(t *testing.T) {
+	localPath := filepath.Join(os.TempDir(), "checksumtest")
+	if err := ioutil.WriteFile(localPath, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(localPath)
+
+	tests := map[string]string{
+		"MD5":     "900150983cd24fb0d6963f7d28e17f72",
+		"SHA-1":   "a9993e364706816aba3e25717850c26c9cd0d89d",
+		"SHA-256": "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		"CRC32":   "352441c2",
+	}
+	for algorithm, expected := range tests {
+		checksum, err := FileChecksum(localPath, algorithm)
+		if err != nil || !checksum.Matches(Checksum{Algorithm: algorithm, Value: expected}) {
+			t.Errorf("%s checksum = %v, %v, want %s", algorithm, checksum, err, expected)
+		}
+	}
+	if _, err := FileChecksum(localPath, "SHA-3"); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+}
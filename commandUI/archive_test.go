@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client/ftps"
+	"github.com/attenberger/ftps_qftp-client/ftps/ftptest"
+)
+
+func TestDownloadArchive(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddDir("/pub")
+	server.AddDir("/pub/sub")
+	server.AddFile("/pub/a.txt", []byte("file a"))
+	server.AddFile("/pub/sub/b.txt", []byte("file b"))
+	conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Quit()
+	if err = conn.Login("anonymous", "anonymous"); err != nil {
+		t.Fatal(err)
+	}
+
+	localpath := filepath.Join(t.TempDir(), "pub.zip")
+	if err = downloadArchive(conn, "/pub", localpath, &uiOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.OpenReader(localpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "a.txt sub/ sub/b.txt" {
+		t.Errorf("archive contains %q", names)
+	}
+
+	// The incomplete archive of a failed download is removed
+	localpath = filepath.Join(t.TempDir(), "missing.tar")
+	if err = downloadArchive(conn, "/missing", localpath, &uiOptions{}); exitStatus(err) != exitTransfer {
+		t.Errorf("got %v with the exit status %d", err, exitStatus(err))
+	}
+	if _, err = os.Stat(localpath); !os.IsNotExist(err) {
+		t.Errorf("incomplete archive was kept: %v", err)
+	}
+}
+
+func TestUploadArchive(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddDir("/deploy")
+	conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Quit()
+	if err = conn.Login("anonymous", "anonymous"); err != nil {
+		t.Fatal(err)
+	}
+
+	localpath := filepath.Join(t.TempDir(), "site.zip")
+	file, err := os.Create(localpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	content, _ := archive.Create("site/index.html")
+	content.Write([]byte("<html></html>"))
+	archive.Close()
+	file.Close()
+
+	if err = uploadArchive(conn, localpath, "/deploy"); err != nil {
+		t.Fatal(err)
+	}
+	if !server.IsDir("/deploy/site") {
+		t.Error("directory of the archive not created")
+	}
+	if data, _ := server.File("/deploy/site/index.html"); string(data) != "<html></html>" {
+		t.Errorf("uploaded %q", data)
+	}
+}
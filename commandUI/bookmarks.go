@@ -0,0 +1,197 @@
+// Bookmarks of the configuration file ~/.qftprc. Each bookmark is a section
+// with the name in brackets followed by its settings, e.g.
+//
+//	# Server at work
+//	[work]
+//	protocol = quic
+//	host = ftp.example.org
+//	port = 2120
+//	cert = certs/work.pem
+//	fingerprint = 3F:A0:...
+//	insecure = false
+//	user = alice
+//	dir = /pub/incoming
+//	encoding = iso-8859-1
+//
+// Empty lines and lines starting with "#" are ignored. Relative paths of
+// certificates are relative to the home directory. The trust of the
+// certificate is chosen like with the flags, see trust.go.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Name of the configuration file in the home directory
+const configFileName = ".qftprc"
+
+// bookmark contains the settings to connect to a server. Empty settings are
+// not set.
+type bookmark struct {
+	protocol    string
+	host        string
+	port        int
+	cert        string
+	fingerprint string // SHA-256 fingerprint of the certificate
+	insecure    bool   // accept any certificate
+	user        string
+	dir         string // remote directory to change to after the login
+	encoding    string
+}
+
+// Reads the bookmarks of the configuration file. A missing file contains no
+// bookmarks.
+func readBookmarks(path string) (map[string]*bookmark, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return map[string]*bookmark{}, nil
+	}
+	if err != nil {
+		return nil, errors.New("Error while opening the configuration file. " + err.Error())
+	}
+	defer file.Close()
+	bookmarks, err := parseBookmarks(file)
+	if err != nil {
+		return nil, errors.New("Error in the configuration file " + path + ". " + err.Error())
+	}
+	return bookmarks, nil
+}
+
+// Parses the sections of a configuration file.
+func parseBookmarks(r io.Reader) (map[string]*bookmark, error) {
+	bookmarks := make(map[string]*bookmark)
+	var current *bookmark
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		atLine := "Line " + strconv.Itoa(lineNumber) + ": "
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" || strings.ContainsAny(name, " \t") {
+				return nil, errors.New(atLine + "The name of a bookmark must not be empty or contain whitespaces.")
+			}
+			if _, exists := bookmarks[name]; exists {
+				return nil, errors.New(atLine + "The bookmark " + name + " is defined twice.")
+			}
+			current = &bookmark{}
+			bookmarks[name] = current
+			continue
+		}
+		if current == nil {
+			return nil, errors.New(atLine + "Settings must follow the name of a bookmark in brackets.")
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New(atLine + "Expected a setting like \"host = example.org\".")
+		}
+		if err := current.set(strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])); err != nil {
+			return nil, errors.New(atLine + err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return bookmarks, nil
+}
+
+// Sets the setting with the key to the value.
+func (b *bookmark) set(key string, value string) error {
+	switch key {
+	case "protocol":
+		if _, known := defaultPorts[value]; !known {
+			return errors.New("The protocol has to be tcp or quic.")
+		}
+		b.protocol = value
+	case "host":
+		b.host = value
+	case "port":
+		port, err := strconv.Atoi(value)
+		if err != nil || port <= 0 || port > 65535 {
+			return errors.New("The port has to be a number from 1 to 65535.")
+		}
+		b.port = port
+	case "cert":
+		b.cert = value
+	case "fingerprint":
+		if _, err := parseFingerprint(value); err != nil {
+			return err
+		}
+		b.fingerprint = value
+	case "insecure":
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("insecure has to be true or false.")
+		}
+		b.insecure = insecure
+	case "user":
+		b.user = value
+	case "dir":
+		b.dir = value
+	case "encoding":
+		b.encoding = value
+	default:
+		return errors.New("Unknown setting " + key + ".")
+	}
+	return nil
+}
+
+// Returns the settings of the bookmark, where the settings of override are
+// used, if they are set.
+func (b *bookmark) merge(override *bookmark) *bookmark {
+	merged := *b
+	if override.protocol != "" {
+		merged.protocol = override.protocol
+	}
+	if override.host != "" {
+		merged.host = override.host
+	}
+	if override.port != 0 {
+		merged.port = override.port
+	}
+	if override.cert != "" {
+		merged.cert = override.cert
+	}
+	if override.fingerprint != "" {
+		merged.fingerprint = override.fingerprint
+	}
+	if override.insecure {
+		merged.insecure = true
+	}
+	if override.user != "" {
+		merged.user = override.user
+	}
+	if override.dir != "" {
+		merged.dir = override.dir
+	}
+	if override.encoding != "" {
+		merged.encoding = override.encoding
+	}
+	return &merged
+}
+
+// Checks the settings needed to connect and sets the defaults of the
+// settings not set.
+func (b *bookmark) complete() error {
+	if b.protocol == "" {
+		b.protocol = protocolTCP
+	}
+	if _, known := defaultPorts[b.protocol]; !known {
+		return errors.New("Please set the protocol with -protocol to tcp or quic")
+	}
+	if b.host == "" {
+		b.host = "localhost"
+	}
+	if b.port == 0 {
+		b.port = defaultPorts[b.protocol]
+	}
+	return nil
+}
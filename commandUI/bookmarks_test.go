@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBookmarks(t *testing.T) {
+	config := "# Servers\n" +
+		"[work]\n" +
+		"protocol = quic\n" +
+		"host = ftp.example.org\n" +
+		"port = 2000\n" +
+		"cert = certs/work.pem\n" +
+		"user = alice\n" +
+		"dir = /pub\n" +
+		"\n" +
+		"[local]\n" +
+		"cert=local.pem\n"
+	bookmarks, err := parseBookmarks(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bookmark{protocol: protocolQUIC, host: "ftp.example.org", port: 2000, cert: "certs/work.pem",
+		user: "alice", dir: "/pub"}
+	if work := bookmarks["work"]; work == nil || *work != expected {
+		t.Errorf("got %+v for work, expected %+v", work, expected)
+	}
+
+	local := bookmarks["local"].merge(&bookmark{user: "bob"})
+	if err = local.complete(); err != nil {
+		t.Fatal(err)
+	}
+	expected = bookmark{protocol: protocolTCP, host: "localhost", port: 2121, cert: "local.pem", user: "bob"}
+	if *local != expected {
+		t.Errorf("got %+v for local, expected %+v", local, expected)
+	}
+	if bookmarks["local"].user != "" {
+		t.Error("merge changed the bookmark")
+	}
+
+	for _, invalid := range []string{"host = a\n", "[a]\nport = x\n", "[a]\ncolor = red\n", "[a]\n[a]\n", "[a]\nhost\n"} {
+		if _, err = parseBookmarks(strings.NewReader(invalid)); err == nil {
+			t.Errorf("no error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+// Connection, whose server computes a fixed checksum
+type checksumConn struct {
+	connection
+	checksum ftps_qftp_client.Checksum
+}
+
+func (c *checksumConn) Checksum(path string) (ftps_qftp_client.Checksum, error) {
+	return c.checksum, nil
+}
+
+func TestCompareChecksum(t *testing.T) {
+	localpath := filepath.Join(t.TempDir(), "a.txt")
+	if err := ioutil.WriteFile(localpath, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conn := &checksumConn{checksum: ftps_qftp_client.Checksum{Algorithm: "MD5",
+		Value: "900150983CD24FB0D6963F7D28E17F72"}}
+
+	var out bytes.Buffer
+	if err := compareChecksum(&out, conn, localpath, "a.txt"); err != nil {
+		t.Errorf("got %v for the same checksum", err)
+	}
+	if !strings.HasPrefix(out.String(), "  MATCH    MD5 900150983cd24fb0d6963f7d28e17f72") {
+		t.Errorf("got %q for the same checksum", out.String())
+	}
+
+	out.Reset()
+	conn.checksum.Value = "00"
+	if err := compareChecksum(&out, conn, localpath, "a.txt"); err == nil {
+		t.Error("no error for different checksums")
+	}
+	if !strings.HasPrefix(out.String(), "  MISMATCH MD5") || !strings.Contains(out.String(), "remote 00 a.txt") {
+		t.Errorf("got %q for different checksums", out.String())
+	}
+}
@@ -0,0 +1,35 @@
+// Colors of the output on a terminal. They are disabled with -no-color, by
+// the environment variable NO_COLOR (https://no-color.org) or if the output
+// is no terminal.
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Escape sequences of the colors
+const (
+	colorReset = "\x1b[0m"
+	colorDir   = "\x1b[1;34m" // bold blue
+	colorLink  = "\x1b[36m"   // cyan
+	colorError = "\x1b[31m"   // red
+)
+
+// Checks whether the output is colored.
+func colorEnabled(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Returns the text in the color, if enabled is set.
+func colorize(text string, color string, enabled bool) string {
+	if !enabled {
+		return text
+	}
+	return color + text + colorReset
+}
@@ -0,0 +1,869 @@
+// Commands of the userinterface, which are the same for both protocols.
+
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/attenberger/ftps_qftp-client"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Generates the registry with all supported commands of the userinterface
+// for the protocol. The commands are not necessarily FTP-Commands. The
+// options are read, when the commands are executed.
+func generateCommandRegistry(protocol string, options *uiOptions) *commandRegistry {
+	commands := newCommandRegistry()
+
+	commands.register(&command{
+		name: "ARCHIVE", args: "<remotepath> [localpath]", minArgs: 1, maxArgs: 2,
+		description: "Download a remote directory tree into a tar archive or, with the extension .zip, a zip archive, " +
+			"to the standard output with " + streamPath + " as localpath. Without localpath the archive gets the name of the directory.",
+		handler: func(conn connection, parameters ...string) error {
+			remotepath := parameters[0]
+			name := path.Base(path.Clean(remotepath))
+			if name == "/" || name == "." {
+				name = "archive"
+			}
+			localpath := name + ".tar"
+			if len(parameters) == 2 {
+				localpath = parameters[1]
+			}
+			return downloadArchive(conn, remotepath, localpath, options)
+		},
+	})
+
+	if protocol == protocolTCP {
+		// QUIC secures all streams itself
+		commands.register(&command{
+			name: "AUTH", args: "TLS", minArgs: 1, maxArgs: 1,
+			description: "Secure the connection with TLS.",
+			handler: func(conn connection, parameters ...string) error {
+				if strings.ToUpper(parameters[0]) != "TLS" {
+					return errors.New("Just TLS authentication method is supported.")
+				}
+				return conn.AuthTLS()
+			},
+		})
+	}
+
+	commands.register(&command{
+		name: "AVBL", args: "[remotepath]", minArgs: 0, maxArgs: 1,
+		description: "Show the space available in the remote directory.",
+		handler: func(conn connection, parameters ...string) error {
+			path := "."
+			if len(parameters) == 1 {
+				path = parameters[0]
+			}
+			space, err := conn.AvailableSpace(path)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("  %d bytes available\n", space)
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "CDUP", minArgs: 0, maxArgs: 0,
+		description: "Change to the parent of the remote directory.",
+		handler: func(conn connection, parameters ...string) error {
+			return conn.ChangeDirToParent()
+		},
+	})
+
+	commands.register(&command{
+		name: "CHECKSUM", args: "<localpath> [remotepath]", minArgs: 1, maxArgs: 2,
+		description: "Compare the checksum of a local file with the one computed by the server with HASH or XMD5.",
+		handler: func(conn connection, parameters ...string) error {
+			localpath := parameters[0]
+			remotepath := filepath.Base(localpath)
+			if len(parameters) == 2 {
+				remotepath = parameters[1]
+			}
+			return compareChecksum(os.Stdout, conn, localpath, remotepath)
+		},
+	})
+
+	commands.register(&command{
+		name: "CHMOD", args: "<mode> <remotepath>", minArgs: 2, maxArgs: 2,
+		description: "Set the permissions of a remote file as octal number, e.g. 644.",
+		handler: func(conn connection, parameters ...string) error {
+			mode, err := strconv.ParseUint(parameters[0], 8, 32)
+			if err != nil || mode > 0777 {
+				return errors.New("The mode has to be an octal number from 000 to 777.")
+			}
+			return conn.Chmod(parameters[1], os.FileMode(mode))
+		},
+	})
+
+	commands.register(&command{
+		name: "CLD", args: "<localpath>", minArgs: 1, maxArgs: 1,
+		description: "Change the local directory, like LCD.",
+		handler: func(conn connection, parameters ...string) error {
+			return changeLocalDir(parameters[0])
+		},
+	})
+
+	commands.register(&command{
+		name: "COPY", args: "<from> <to>", minArgs: 2, maxArgs: 2,
+		description: "Copy a remote file on the server.",
+		handler: func(conn connection, parameters ...string) error {
+			return conn.Copy(parameters[0], parameters[1])
+		},
+	})
+
+	commands.register(&command{
+		name: "CWD", args: "<remotepath>", minArgs: 1, maxArgs: 1,
+		description: "Change the remote directory.",
+		handler: func(conn connection, parameters ...string) error {
+			return conn.ChangeDir(parameters[0])
+		},
+	})
+
+	commands.register(&command{
+		name: "DEBUG", args: "(ON|OFF)", minArgs: 1, maxArgs: 1,
+		description: "Show the commands and replies on the control connection.",
+		handler: func(conn connection, parameters ...string) error {
+			switch strings.ToUpper(parameters[0]) {
+			case "ON":
+				conn.SetCommandLogger(func(line string) {
+					fmt.Println(line)
+				})
+			case "OFF":
+				conn.SetCommandLogger(nil)
+			default:
+				return errors.New("Debug output can just be switched ON or OFF.")
+			}
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "DELE", args: "<remotepath>", minArgs: 1, maxArgs: 1,
+		description: "Delete a remote file, after a confirmation in the interactive mode.",
+		handler: func(conn connection, parameters ...string) error {
+			if confirmed, err := options.confirm("Delete the remote file " + parameters[0] + "?"); !confirmed {
+				return err
+			}
+			return conn.Delete(parameters[0])
+		},
+	})
+
+	commands.register(&command{
+		name: "FEAT", minArgs: 0, maxArgs: 0,
+		description: "Show the features supported by the server with their descriptions.",
+		handler: func(conn connection, parameters ...string) error {
+			features := conn.Features()
+			if options.jsonOutput {
+				return printJSON(features)
+			}
+			printFeatures(os.Stdout, features)
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "GET", args: "[-r] <remotepath> [localpath]", minArgs: 1, maxArgs: 3,
+		description: "Retrieve a file or with -r a directory tree from the server.",
+		handler: func(conn connection, parameters ...string) error {
+			recursive, paths, err := recursiveFlag(parameters)
+			if err != nil {
+				return err
+			}
+			remotepath := paths[0]
+			localpath := path.Base(remotepath)
+			if len(paths) == 2 {
+				localpath = paths[1]
+			}
+			if !recursive {
+				return printTransferResults(ftps_qftp_client.TransferResults{performTransfer(conn,
+					options.newTask(ftps_qftp_client.Retrieve, localpath, remotepath))})
+			}
+			results, err := ftps_qftp_client.DownloadDir(conn, remotepath, localpath)
+			if err != nil {
+				return err
+			}
+			return printTransferResults(results)
+		},
+	})
+
+	commands.register(&command{
+		name: "HELP", args: "[command]", minArgs: 0, maxArgs: 1,
+		description: "Show the available commands or the usage of one command.",
+		handler: func(conn connection, parameters ...string) error {
+			if len(parameters) == 0 {
+				commands.printHelp(os.Stdout)
+				return nil
+			}
+			cmd, available := commands.lookup(parameters[0])
+			if !available {
+				return errors.New("Command at this client not available.")
+			}
+			fmt.Println("  " + cmd.usage())
+			fmt.Println("  " + cmd.description)
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "LCD", args: "<localpath>", minArgs: 1, maxArgs: 1,
+		description: "Change the local directory and show the new one.",
+		handler: func(conn connection, parameters ...string) error {
+			return changeLocalDir(parameters[0])
+		},
+	})
+
+	commands.register(&command{
+		name: "LIST", args: "[-hStr] [remotepath]", minArgs: 0, maxArgs: unlimitedArgs,
+		description: "List the content of the remote directory, -h with units, sorted by -S size, -t time, -r reversed.",
+		handler: func(conn connection, parameters ...string) error {
+			listOptions, path, err := parseListOptions(parameters)
+			if err != nil {
+				return err
+			}
+			listOptions.color = options.color
+			entrys, err := conn.List(path)
+			if err != nil {
+				return err
+			}
+			if options.jsonOutput {
+				sortEntries(entrys, listOptions)
+				return printJSON(newJSONEntries(entrys))
+			}
+			printListing(os.Stdout, entrys, listOptions)
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "LLS", args: "[-hStr] [localpath]", minArgs: 0, maxArgs: unlimitedArgs,
+		description: "List the content of the local directory with the options of LIST.",
+		handler: func(conn connection, parameters ...string) error {
+			listOptions, path, err := parseListOptions(parameters)
+			if err != nil {
+				return err
+			}
+			listOptions.color = options.color
+			return listLocalDir(os.Stdout, path, listOptions)
+		},
+	})
+
+	commands.register(&command{
+		name: "LOGIN", args: "<username> [password]", minArgs: 1, maxArgs: 2,
+		description: "Authenticate at the server, without password it is taken from " + passwordEnv + " or prompted.",
+		handler: func(conn connection, parameters ...string) error {
+			given := ""
+			if len(parameters) == 2 {
+				given = parameters[1]
+			}
+			password, err := lookupPassword(parameters[0], given)
+			if err != nil {
+				return withStatus(exitLogin, err)
+			}
+			if err = conn.Login(parameters[0], password); err != nil {
+				return withStatus(exitLogin, err)
+			}
+			if options.loggedIn != nil {
+				options.loggedIn(parameters[0], password)
+			}
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "LOGOUT", minArgs: 0, maxArgs: 0,
+		description: "Logout the current user.",
+		handler: func(conn connection, parameters ...string) error {
+			return conn.Logout()
+		},
+	})
+
+	commands.register(&command{
+		name: "LPWD", minArgs: 0, maxArgs: 0,
+		description: "Show the current local directory.",
+		handler: func(conn connection, parameters ...string) error {
+			dir, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			fmt.Println("  " + dir)
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "MKD", args: "<remotepath>", minArgs: 1, maxArgs: 1,
+		description: "Create a remote directory.",
+		handler: func(conn connection, parameters ...string) error {
+			return conn.MakeDir(parameters[0])
+		},
+	})
+
+	commands.register(&command{
+		name: "MIRROR", args: "[-R] [--delete] [--dry-run] [--checksum[=parallel]] [--state=file [--conflicts=policy]] " +
+			"<source> [destination]", minArgs: 1, maxArgs: 8,
+		description: "Mirror a remote directory into a local one or with -R a local one to the server, " +
+			"transferring just new and changed files. --delete removes files missing at the source. " +
+			"--checksum compares modified files by their checksums with HASH or XMD5 in parallel connections, " +
+			strconv.Itoa(defaultChecksumParallel) + " by default, and skips the unchanged ones. " +
+			"--state keeps the state of the files in the file to detect the ones modified at both sides since the last run, " +
+			"--conflicts resolves them by the policy report (default), newest, local or remote.",
+		handler: func(conn connection, parameters ...string) error {
+			return mirror(os.Stdout, conn, options, parameters)
+		},
+	})
+
+	commands.register(&command{
+		name: "MTRAN", args: "<parallel> (<|>) <localpath> <remotepath> ...", minArgs: 4, maxArgs: unlimitedArgs,
+		description: "Transfer files, directory trees or the matches of wildcards like *.txt in parallel (sub)connections, " +
+			"\"<\" retrieves from and \">\" stores at the server.",
+		handler: func(conn connection, parameters ...string) error {
+			if len(parameters)%3 != 1 {
+				return errors.New("MTRAN needs at least four parameters. The first has to be the number of parallel connection, " +
+					"the rest each a triple of transferdirection, local- and remotepath. Transferdirection is indicated by \"<\" " +
+					" (retrieve from Server) and \">\" (store at server).")
+			}
+			parallelConnection, err := strconv.Atoi(parameters[0])
+			if err != nil {
+				return errors.New("Error converting number of parallel connections. " + err.Error())
+			}
+			tasks := make([]ftps_qftp_client.TransferTask, 0, (len(parameters)-1)/3)
+			for i := 1; i < len(parameters); i = i + 3 {
+				var direction ftps_qftp_client.TransferDirction
+				switch parameters[i] {
+				case "<":
+					direction = ftps_qftp_client.Retrieve
+				case ">":
+					direction = ftps_qftp_client.Store
+				default:
+					return errors.New(parameters[i] + " is not a vaild transfer direction. \"<\" or \">\" expected.")
+				}
+				tasks = append(tasks, options.newTask(direction, parameters[i+1], parameters[i+2]))
+			}
+			// The destinations of wildcards are directories
+			tasks, err = ftps_qftp_client.ExpandGlobTasks(conn, tasks)
+			if err != nil {
+				return err
+			}
+			scheduler, err := conn.NewTransferScheduler(parallelConnection)
+			if err != nil {
+				return err
+			}
+			scheduler.ExpandDirectories = true
+			table := &progressTable{}
+			scheduler.Progress = table.update
+
+			ctx, release := interruptibleContext()
+			defer release()
+			return printTransferResults(scheduler.Run(ctx, tasks))
+		},
+	})
+
+	commands.register(&command{
+		name: "NLST", args: "[remotepath]", minArgs: 0, maxArgs: 1,
+		description: "List the names in the remote directory.",
+		handler: func(conn connection, parameters ...string) error {
+			path := "."
+			if len(parameters) == 1 {
+				path = parameters[0]
+			}
+			entrys, err := conn.NameList(path)
+			if err != nil {
+				return err
+			}
+			if options.jsonOutput {
+				if entrys == nil {
+					entrys = []string{}
+				}
+				return printJSON(entrys)
+			}
+			for _, entry := range entrys {
+				fmt.Println("  " + entry)
+			}
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "NOOP", minArgs: 0, maxArgs: 0,
+		description: "Send a NOOP to keep the connection alive.",
+		handler: func(conn connection, parameters ...string) error {
+			return conn.NoOp()
+		},
+	})
+
+	commands.register(&command{
+		name: "PROMPT", minArgs: 0, maxArgs: 0,
+		description: "Toggle the interactive mode, which asks before DELE, RMD and overwriting local files with RETR.",
+		handler: func(conn connection, parameters ...string) error {
+			options.interactive = !options.interactive
+			if options.interactive {
+				fmt.Println("  Interactive mode on.")
+			} else {
+				fmt.Println("  Interactive mode off.")
+			}
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "PUT", args: "[-r] <localpath> [remotepath]", minArgs: 1, maxArgs: 3,
+		description: "Store a file or with -r a directory tree at the server.",
+		handler: func(conn connection, parameters ...string) error {
+			recursive, paths, err := recursiveFlag(parameters)
+			if err != nil {
+				return err
+			}
+			localpath := paths[0]
+			remotepath := filepath.Base(localpath)
+			if len(paths) == 2 {
+				remotepath = paths[1]
+			}
+			if !recursive {
+				return printTransferResults(ftps_qftp_client.TransferResults{performTransfer(conn,
+					options.newTask(ftps_qftp_client.Store, localpath, remotepath))})
+			}
+			results, err := ftps_qftp_client.UploadDir(conn, localpath, remotepath)
+			if err != nil {
+				return err
+			}
+			return printTransferResults(results)
+		},
+	})
+
+	commands.register(&command{
+		name: "QUIT", minArgs: 0, maxArgs: 0,
+		description: "Close the connection and exit.",
+		handler: func(conn connection, parameters ...string) error {
+			return conn.Quit()
+		},
+	})
+
+	commands.register(&command{
+		name: "QUOTE", args: "<command> [arguments]", minArgs: 1, maxArgs: unlimitedArgs,
+		description: "Send a command to the server and show the complete reply. Commands with a data transfer are not supported.",
+		handler: func(conn connection, parameters ...string) error {
+			return sendRawCommand(conn, parameters)
+		},
+	})
+
+	commands.register(&command{
+		name: "PWD", minArgs: 0, maxArgs: 0,
+		description: "Show the current remote directory.",
+		handler: func(conn connection, parameters ...string) error {
+			currentdir, err := conn.CurrentDir()
+			if err != nil {
+				return err
+			}
+			fmt.Println("  " + currentdir)
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "RAW", args: "<command> [arguments]", minArgs: 1, maxArgs: unlimitedArgs,
+		description: "Send a command to the server like QUOTE.",
+		handler: func(conn connection, parameters ...string) error {
+			return sendRawCommand(conn, parameters)
+		},
+	})
+
+	commands.register(&command{
+		name: "REGET", args: "<remotepath> [localpath]", minArgs: 1, maxArgs: 2,
+		description: "Continue the retrieve of a file, whose start is in the local file.",
+		handler: func(conn connection, parameters ...string) error {
+			remotepath := parameters[0]
+			localpath := path.Base(remotepath)
+			if len(parameters) == 2 {
+				localpath = parameters[1]
+			}
+			return resumeTransfer(conn, options.newTask(ftps_qftp_client.Retrieve, localpath, remotepath))
+		},
+	})
+
+	commands.register(&command{
+		name: "RENAME", args: "<from> <to>", minArgs: 2, maxArgs: 2,
+		description: "Rename a remote file. Names with whitespaces have to be quoted.",
+		handler: func(conn connection, parameters ...string) error {
+			return conn.Rename(parameters[0], parameters[1])
+		},
+	})
+
+	commands.register(&command{
+		name: "REPUT", args: "<localpath> [remotepath]", minArgs: 1, maxArgs: 2,
+		description: "Continue the store of a file, whose start is in the remote file.",
+		handler: func(conn connection, parameters ...string) error {
+			localpath := parameters[0]
+			remotepath := filepath.Base(localpath)
+			if len(parameters) == 2 {
+				remotepath = parameters[1]
+			}
+			return resumeTransfer(conn, options.newTask(ftps_qftp_client.Store, localpath, remotepath))
+		},
+	})
+
+	commands.register(&command{
+		name: "RETR", args: "[-z] [localpath] <remotepath>", minArgs: 1, maxArgs: 3,
+		description: "Retrieve a file from the server, to the standard output with " + streamPath + " as localpath. " +
+			"Without localpath the file gets the name of the remote file. -z decompresses a file compressed with gzip.",
+		handler: func(conn connection, parameters ...string) error {
+			gzipped, parameters, err := gzipFlag(parameters)
+			if err != nil {
+				return withStatus(exitUsage, err)
+			}
+			remotepath := parameters[len(parameters)-1]
+			localpath := path.Base(remotepath)
+			if gzipped {
+				localpath = strings.TrimSuffix(localpath, gzipExtension)
+			}
+			if len(parameters) == 2 {
+				localpath = parameters[0]
+			}
+
+			// The progress is not mixed with the data of the file
+			var file io.Writer = os.Stdout
+			if localpath != streamPath {
+				if _, err := os.Stat(localpath); err == nil {
+					confirmed, err := options.confirm("Overwrite the local file " + localpath + "?")
+					if !confirmed {
+						return err
+					}
+				}
+				localFile, err := os.Create(localpath)
+				if err != nil {
+					return errors.New("Error while creating the local file. " + err.Error())
+				}
+				defer localFile.Close()
+				file = localFile
+			}
+
+			reader, err := conn.Retr(remotepath)
+			if err != nil {
+				return withStatus(exitTransfer, err)
+			}
+			size := int64(-1)
+			if sized, ok := reader.(ftps_qftp_client.SizedReader); ok {
+				size = sized.Size()
+			}
+			bar := newProgressBar(os.Stderr, remotepath, size)
+			var data io.Reader = &progressReader{reader: reader, bar: bar}
+			if gzipped {
+				if data, err = gzip.NewReader(data); err != nil {
+					bar.finish()
+					reader.Close()
+					return withStatus(exitTransfer, errors.New("Error while decompressing the file. "+err.Error()))
+				}
+			}
+			_, err = io.Copy(file, data)
+			bar.finish()
+			if err != nil {
+				errortext := "Error while writing file to local file. " + err.Error()
+				err = reader.Close()
+				if err != nil {
+					errortext = errortext + " Error while closing reader from server. " + err.Error()
+				}
+				return withStatus(exitTransfer, errors.New(errortext))
+			}
+			err = reader.Close()
+			if err != nil {
+				return withStatus(exitTransfer, errors.New(" Error while closing reader from server. "+err.Error()))
+			}
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "RMD", args: "<remotepath>", minArgs: 1, maxArgs: 1,
+		description: "Remove a remote directory, after a confirmation in the interactive mode.",
+		handler: func(conn connection, parameters ...string) error {
+			if confirmed, err := options.confirm("Remove the remote directory " + parameters[0] + "?"); !confirmed {
+				return err
+			}
+			return conn.RemoveDir(parameters[0])
+		},
+	})
+
+	commands.register(&command{
+		name: "STOR", args: "[-z] <localpath> [remotepath]", minArgs: 1, maxArgs: 3,
+		description: "Store a file at the server, from the standard input with " + streamPath + " as localpath. " +
+			"Without remotepath the file gets the name of the local file. -z compresses the file with gzip, " +
+			"without remotepath the name gets the extension " + gzipExtension + ".",
+		handler: func(conn connection, parameters ...string) error {
+			gzipped, parameters, err := gzipFlag(parameters)
+			if err != nil {
+				return withStatus(exitUsage, err)
+			}
+			localpath := parameters[0]
+			remotepath := filepath.Base(localpath)
+			if gzipped {
+				remotepath += gzipExtension
+			}
+			if len(parameters) == 2 {
+				remotepath = parameters[1]
+			} else if localpath == streamPath {
+				return errors.New("The remotepath is needed to store the standard input.")
+			}
+
+			var bar *progressBar
+			var file io.Reader
+			if localpath == streamPath {
+				// The output is kept free for the data of other commands
+				file = os.Stdin
+				bar = newProgressBar(os.Stderr, "standard input", -1)
+			} else {
+				localFile, err := os.Open(localpath)
+				if err != nil {
+					return errors.New("Error while opening the local file. " + err.Error())
+				}
+				defer localFile.Close()
+				size := int64(-1)
+				if info, err := localFile.Stat(); err == nil {
+					size = info.Size()
+				}
+				file = localFile
+				bar = newProgressBar(os.Stderr, localpath, size)
+			}
+			var data io.Reader = &progressReader{reader: file, bar: bar}
+			if gzipped {
+				compressed := ftps_qftp_client.CompressGzip(data)
+				defer compressed.Close()
+				data = compressed
+			}
+			err = conn.Stor(remotepath, data)
+			bar.finish()
+			if err != nil {
+				return withStatus(exitTransfer, errors.New("Error while writing file to server. "+err.Error()))
+			}
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "TYPE", args: "(A|I)", minArgs: 1, maxArgs: 1,
+		description: "Set the transfer type to ASCII (A) or binary (I).",
+		handler: func(conn connection, parameters ...string) error {
+			switch strings.ToUpper(parameters[0]) {
+			case "A":
+				return conn.SetTransferType(ftps_qftp_client.ASCII)
+			case "I":
+				return conn.SetTransferType(ftps_qftp_client.Binary)
+			}
+			return errors.New("Just the transfer types A and I are supported.")
+		},
+	})
+
+	commands.register(&command{
+		name: "UNARCHIVE", args: "<localpath> [remotepath]", minArgs: 1, maxArgs: 2,
+		description: "Upload the directories and files of a tar archive or, with the extension .zip, a zip archive " +
+			"into the remote directory, from the standard input with " + streamPath + " as localpath.",
+		handler: func(conn connection, parameters ...string) error {
+			remotepath := "."
+			if len(parameters) == 2 {
+				remotepath = parameters[1]
+			}
+			return uploadArchive(conn, parameters[0], remotepath)
+		},
+	})
+
+	return commands
+}
+
+// Sends the parameters of QUOTE joined by spaces as command and shows the
+// complete reply. Negative replies are returned as error, so the commands
+// of -e stop.
+func sendRawCommand(conn connection, parameters []string) error {
+	reply, err := conn.SendCommand("%s", strings.Join(parameters, " "))
+	if err != nil {
+		return err
+	}
+	for _, line := range reply.Lines {
+		fmt.Println("  " + line)
+	}
+	if ftps_qftp_client.IsTransient(reply.Code) || ftps_qftp_client.IsPermanent(reply.Code) {
+		return errors.New("The server refused the command with the code " + strconv.Itoa(reply.Code) + ".")
+	}
+	return nil
+}
+
+// Prints MATCH or MISMATCH with the checksum of the remote file computed by
+// the server and the one of the local file using the same algorithm. A
+// mismatch is returned as error, so scripts with -e stop.
+func compareChecksum(w io.Writer, conn connection, localpath string, remotepath string) error {
+	remote, err := conn.Checksum(remotepath)
+	if err != nil {
+		return errors.New("Error while requesting the checksum of the remote file. " + err.Error())
+	}
+	local, err := ftps_qftp_client.FileChecksum(localpath, remote.Algorithm)
+	if err != nil {
+		return errors.New("Error while computing the checksum of the local file. " + err.Error())
+	}
+	if !local.Matches(remote) {
+		fmt.Fprintf(w, "  MISMATCH %s\n  local  %s %s\n  remote %s %s\n", remote.Algorithm, local.Value, localpath,
+			remote.Value, remotepath)
+		return errors.New("The checksums of " + localpath + " and " + remotepath + " differ.")
+	}
+	fmt.Fprintf(w, "  MATCH    %s %s\n", remote.Algorithm, local.Value)
+	return nil
+}
+
+// Downloads the remote tree into the local archive, whose format is chosen by
+// its extension, or as tar archive to the standard output. An incomplete
+// archive is removed.
+func downloadArchive(conn connection, remotepath string, localpath string, options *uiOptions) error {
+	format := ftps_qftp_client.Tar
+	if strings.EqualFold(filepath.Ext(localpath), ".zip") {
+		format = ftps_qftp_client.Zip
+	}
+	if localpath == streamPath {
+		return withStatus(exitTransfer, ftps_qftp_client.DownloadArchive(conn, remotepath, os.Stdout, format))
+	}
+
+	if _, err := os.Stat(localpath); err == nil {
+		confirmed, err := options.confirm("Overwrite the local file " + localpath + "?")
+		if !confirmed {
+			return err
+		}
+	}
+	file, err := os.Create(localpath)
+	if err != nil {
+		return errors.New("Error while creating the local file. " + err.Error())
+	}
+	err = ftps_qftp_client.DownloadArchive(conn, remotepath, file, format)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = errors.New("Error while writing the local file. " + closeErr.Error())
+	}
+	if err != nil {
+		os.Remove(localpath)
+		return withStatus(exitTransfer, err)
+	}
+	return nil
+}
+
+// Uploads the local archive, whose format is chosen by its extension, or a
+// tar archive from the standard input into the remote directory.
+func uploadArchive(conn connection, localpath string, remotepath string) error {
+	var r io.Reader = os.Stdin
+	format := ftps_qftp_client.Tar
+	if localpath != streamPath {
+		if strings.EqualFold(filepath.Ext(localpath), ".zip") {
+			format = ftps_qftp_client.Zip
+		}
+		file, err := os.Open(localpath)
+		if err != nil {
+			return errors.New("Error while opening the local file. " + err.Error())
+		}
+		defer file.Close()
+		r = file
+	}
+	return withStatus(exitTransfer, ftps_qftp_client.UploadArchive(conn, r, remotepath, format))
+}
+
+// Local path of RETR and STOR for the standard output and input
+const streamPath = "-"
+
+// Extension of the files compressed by STOR -z
+const gzipExtension = ".gz"
+
+// Splits the parameters of RETR and STOR into the flag -z and one or two
+// paths.
+func gzipFlag(parameters []string) (bool, []string, error) {
+	gzipped := len(parameters) > 0 && parameters[0] == "-z"
+	if gzipped {
+		parameters = parameters[1:]
+	}
+	if len(parameters) < 1 || len(parameters) > 2 {
+		return false, nil, errors.New("One or two paths are expected, optionally after the flag -z.")
+	}
+	return gzipped, parameters, nil
+}
+
+// Splits the parameters of GET and PUT into the flag -r and one or two paths.
+func recursiveFlag(parameters []string) (bool, []string, error) {
+	recursive := len(parameters) > 0 && parameters[0] == "-r"
+	if recursive {
+		parameters = parameters[1:]
+	}
+	if len(parameters) < 1 || len(parameters) > 2 {
+		return false, nil, errors.New("One or two paths are expected, optionally after the flag -r.")
+	}
+	return recursive, parameters, nil
+}
+
+// Continues the transfer of the task with REST after the part of the file,
+// which is already at the destination. The sizes of the local and the
+// remote file are compared by the policy OverwriteResume, a complete file
+// is skipped.
+func resumeTransfer(conn connection, task ftps_qftp_client.TransferTask) error {
+	task.Overwrite = ftps_qftp_client.OverwriteResume
+	return printTransferResults(ftps_qftp_client.TransferResults{performTransfer(conn, task)})
+}
+
+// Performs the task on the connection and repeats it up to MaxRetries times
+// after transient errors. After ErrServiceClosing the connection is unusable,
+// so the transfer is not repeated.
+func performTransfer(conn connection, task ftps_qftp_client.TransferTask) ftps_qftp_client.TransferResult {
+	result := ftps_qftp_client.PerformTransferTask(conn, task)
+	for attempt := 0; attempt < task.MaxRetries && ftps_qftp_client.IsTransientError(result.Err) &&
+		!errors.Is(result.Err, ftps_qftp_client.ErrServiceClosing); attempt++ {
+		fmt.Fprintln(os.Stderr, "  Retrying "+task.RemotePath+" after: "+strings.TrimSpace(result.Err.Error()))
+		result = ftps_qftp_client.PerformTransferTask(conn, task)
+	}
+	return result
+}
+
+// Prints the outcome of each task of a parallel transfer and a summary to the
+// standard error output. It returns an error if at least one transfer failed.
+func printTransferResults(results ftps_qftp_client.TransferResults) error {
+	for _, result := range results {
+		status := "OK"
+		if result.Err != nil {
+			status = "FAILED"
+		} else if result.Skipped {
+			status = "SKIPPED"
+		}
+		direction := ">"
+		if result.Task.Direction == ftps_qftp_client.Retrieve {
+			direction = "<"
+		}
+		fmt.Fprintf(os.Stderr, "  %-7s %s %s %s %12d bytes %v\n", status, direction, result.Task.LocalPath, result.Task.RemotePath,
+			result.Bytes, result.Duration)
+		if result.Err != nil {
+			fmt.Fprintln(os.Stderr, "          "+strings.TrimSpace(result.Err.Error()))
+		}
+	}
+	failed := len(results.Failed())
+	fmt.Fprintf(os.Stderr, "  %d of %d transfers successful, %d bytes transfered.\n", len(results)-failed, len(results), results.Bytes())
+	if failed > 0 {
+		return withStatus(exitTransfer, errors.New(strconv.Itoa(failed)+" transfer(s) failed."))
+	}
+	return nil
+}
+
+// Returns a context, which is cancelled when the user presses Ctrl-C.
+// The returned function must be called to release the signal handler.
+func interruptibleContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			fmt.Fprintln(os.Stderr, "Interrupted, aborting the running transfers.")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(interrupt)
+		cancel()
+	}
+}
@@ -0,0 +1,143 @@
+// Registry for the commands of the userinterface. Each command is registered
+// once with its metadata, from which the help, the validation of the number
+// of arguments and the completion of command names are generated.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/attenberger/ftps_qftp-client"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unlimited number of arguments for command.maxArgs
+const unlimitedArgs = -1
+
+// connection is implemented by the connections of FTPS and by the
+// subconnections of QUIC-FTP, so the commands are the same for both
+// protocols.
+type connection interface {
+	ftps_qftp_client.ConnectionI
+	Copy(sourcePath string, destinationPath string) error
+	SetCommandLogger(logger ftps_qftp_client.CommandLogger)
+	SetEncoding(name string) error
+	SetCommandTimeout(timeout time.Duration)
+	NewTransferScheduler(nrParallel int) (*ftps_qftp_client.TransferScheduler, error)
+	SendCommand(format string, args ...interface{}) (*ftps_qftp_client.Response, error)
+	AbsPath(path string) (string, error)
+}
+
+// command describes a command of the userinterface.
+// The commands are not necessarily FTP-Commands.
+type command struct {
+	name        string
+	args        string // specification of the arguments for the usage, e.g. "<localpath> <remotepath>"
+	minArgs     int
+	maxArgs     int // unlimitedArgs for no limit
+	description string
+	handler     func(conn connection, parameters ...string) error
+}
+
+// Usage returns the command with its argument specification.
+func (cmd *command) usage() string {
+	if cmd.args == "" {
+		return cmd.name
+	}
+	return cmd.name + " " + cmd.args
+}
+
+// Checks whether the number of parameters matches the specification of the command.
+func (cmd *command) validate(parameters []string) error {
+	if len(parameters) >= cmd.minArgs && (cmd.maxArgs == unlimitedArgs || len(parameters) <= cmd.maxArgs) {
+		return nil
+	}
+	var expected string
+	switch {
+	case cmd.maxArgs == 0:
+		expected = "accepts no parameter"
+	case cmd.minArgs == cmd.maxArgs:
+		expected = "needs " + strconv.Itoa(cmd.minArgs) + " parameter(s)"
+	case cmd.maxArgs == unlimitedArgs:
+		expected = "needs at least " + strconv.Itoa(cmd.minArgs) + " parameter(s)"
+	default:
+		expected = "needs " + strconv.Itoa(cmd.minArgs) + " to " + strconv.Itoa(cmd.maxArgs) + " parameter(s)"
+	}
+	return errors.New(cmd.name + " " + expected + ". Usage: " + cmd.usage())
+}
+
+// commandRegistry contains all commands of the userinterface by their name.
+type commandRegistry struct {
+	commands map[string]*command
+}
+
+// Creates an empty commandRegistry
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{commands: make(map[string]*command)}
+}
+
+// Adds the command to the registry. Registering a name twice is a programming error.
+func (r *commandRegistry) register(cmd *command) {
+	if _, exists := r.commands[cmd.name]; exists {
+		panic("command " + cmd.name + " registered twice")
+	}
+	r.commands[cmd.name] = cmd
+}
+
+// Returns the command with the name, the name is not case sensitive.
+func (r *commandRegistry) lookup(name string) (*command, bool) {
+	cmd, available := r.commands[strings.ToUpper(name)]
+	return cmd, available
+}
+
+// Returns the sorted names of all commands.
+func (r *commandRegistry) names() []string {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the sorted names of all commands starting with the prefix.
+func (r *commandRegistry) complete(prefix string) []string {
+	prefix = strings.ToUpper(prefix)
+	var candidates []string
+	for _, name := range r.names() {
+		if strings.HasPrefix(name, prefix) {
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
+
+// Writes the usage and description of all commands.
+func (r *commandRegistry) printHelp(w io.Writer) {
+	fmt.Fprintln(w, "  Available commands:")
+	for _, name := range r.names() {
+		cmd := r.commands[name]
+		fmt.Fprintf(w, "  %-40s %s\n", cmd.usage(), cmd.description)
+	}
+}
+
+// Validates the parameters and runs the command with the name.
+func (r *commandRegistry) execute(conn connection, name string, parameters ...string) error {
+	cmd, available := r.lookup(name)
+	if !available {
+		candidates := r.complete(name)
+		if name != "" && len(candidates) > 0 {
+			return withStatus(exitUsage, errors.New("Command at this client not available. Did you mean: "+
+				strings.Join(candidates, ", ")+"?"))
+		}
+		return withStatus(exitUsage, errors.New("Command at this client not available."))
+	}
+	if err := cmd.validate(parameters); err != nil {
+		return withStatus(exitUsage, err)
+	}
+	return cmd.handler(conn, parameters...)
+}
@@ -0,0 +1,58 @@
+// Credentials of the user, which are given by the flags, the environment or
+// entered at a prompt without echo.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Environment variable with the password, which is used if -pass is not set.
+// Unlike the flag, it is not visible in the list of processes.
+const passwordEnv = "QFTP_PASSWORD"
+
+// Returns the password of the user: the given one, otherwise the one of the
+// environment variable QFTP_PASSWORD, otherwise the one entered at a prompt.
+func lookupPassword(user string, given string) (string, error) {
+	if given != "" {
+		return given, nil
+	}
+	if password, set := os.LookupEnv(passwordEnv); set {
+		return password, nil
+	}
+	return promptPassword(user)
+}
+
+// Reads the password from the terminal without showing it.
+func promptPassword(user string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("No password given for " + user + ", set it with -pass or " + passwordEnv + ".")
+	}
+	fmt.Print("Password for " + user + ": ")
+	password, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", errors.New("Error while reading the password. " + err.Error())
+	}
+	return string(password), nil
+}
+
+// Logs in the user given by the flags. FTPS connections are secured with TLS
+// before, so the password is not sent in plain text.
+func login(conn connection, protocol string, user string, password string) error {
+	password, err := lookupPassword(user, password)
+	if err != nil {
+		return err
+	}
+	if protocol == protocolTCP {
+		if err = conn.AuthTLS(); err != nil {
+			return err
+		}
+	}
+	return conn.Login(user, password)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLookupPassword(t *testing.T) {
+	old, wasSet := os.LookupEnv(passwordEnv)
+	defer func() {
+		if wasSet {
+			os.Setenv(passwordEnv, old)
+		} else {
+			os.Unsetenv(passwordEnv)
+		}
+	}()
+
+	os.Setenv(passwordEnv, "fromenv")
+	password, err := lookupPassword("user", "given")
+	if err != nil || password != "given" {
+		t.Errorf("got %q, %v, expected the given password", password, err)
+	}
+	password, err = lookupPassword("user", "")
+	if err != nil || password != "fromenv" {
+		t.Errorf("got %q, %v, expected the password of %s", password, err, passwordEnv)
+	}
+}
@@ -0,0 +1,59 @@
+// Exit statuses of the client, so scripts using -e can distinguish the
+// causes of failures.
+
+package main
+
+import (
+	"errors"
+	"net/textproto"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+const (
+	exitFailure  = 1 // a command failed for another reason
+	exitUsage    = 2 // invalid flags, unknown commands or wrong parameters, like the package flag
+	exitConnect  = 3 // the connection could not be opened or dropped
+	exitLogin    = 4 // the login was refused or no password given
+	exitTransfer = 5 // a transfer failed
+)
+
+// statusError is an error, which causes a certain exit status.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// Marks the error with the exit status, nil stays nil.
+func withStatus(status int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &statusError{status: status, err: err}
+}
+
+// Returns the exit status for the error of a command. Replies with 530 are
+// login failures, also of other commands than LOGIN, and connections closed
+// by the server are connection failures.
+func exitStatus(err error) int {
+	var marked *statusError
+	if errors.As(err, &marked) {
+		return marked.status
+	}
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code == ftps_qftp_client.StatusNotLoggedIn {
+		return exitLogin
+	}
+	if errors.Is(err, ftps_qftp_client.ErrServiceClosing) {
+		return exitConnect
+	}
+	return exitFailure
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+func TestExitStatus(t *testing.T) {
+	commands := generateCommandRegistry(protocolTCP, &uiOptions{})
+	unknown := commands.execute(nil, "XUNKNOWN")
+	missing := commands.execute(nil, "CWD")
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{errors.New("other"), exitFailure},
+		{unknown, exitUsage},
+		{missing, exitUsage},
+		{withStatus(exitConnect, errors.New("refused")), exitConnect},
+		{fmt.Errorf("wrapped %w", withStatus(exitTransfer, errors.New("failed"))), exitTransfer},
+		{&textproto.Error{Code: ftps_qftp_client.StatusNotLoggedIn, Msg: "Login incorrect."}, exitLogin},
+		{&textproto.Error{Code: ftps_qftp_client.StatusFileUnavailable, Msg: "No such file."}, exitFailure},
+		{fmt.Errorf("%w 421", ftps_qftp_client.ErrServiceClosing), exitConnect},
+	}
+	for _, test := range tests {
+		if status := exitStatus(test.err); status != test.status {
+			t.Errorf("exitStatus(%v) = %d, want %d", test.err, status, test.status)
+		}
+	}
+	if withStatus(exitUsage, nil) != nil {
+		t.Error("withStatus marked nil as an error")
+	}
+}
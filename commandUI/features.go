@@ -0,0 +1,54 @@
+// Output of the features announced by the server with FEAT.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Explanations of the well-known features
+var featureExplanations = map[string]string{
+	"AUTH":      "secured connections (RFC 4217)",
+	"AVBL":      "available space of directories",
+	"CLNT":      "name of the client",
+	"EPRT":      "extended active mode for IPv6 (RFC 2428)",
+	"EPSV":      "extended passive mode for IPv6 (RFC 2428)",
+	"HASH":      "checksums of files",
+	"LANG":      "languages of the replies (RFC 2640)",
+	"MDTM":      "modification times of files (RFC 3659)",
+	"MFMT":      "setting the modification times of files",
+	"MLST":      "machine-readable listings with MLST and MLSD (RFC 3659)",
+	"MULTIPLEX": "multiplexed transfers on a subconnection (QUIC-FTP)",
+	"PBSZ":      "protection buffer size of secured connections (RFC 4217)",
+	"PROT":      "protection of the data connections (RFC 4217)",
+	"REST":      "restart of transfers at an offset (RFC 3659)",
+	"SITE":      "site-specific commands",
+	"SIZE":      "sizes of files (RFC 3659)",
+	"TVFS":      "paths separated by slashes (RFC 3659)",
+	"UTF8":      "paths in UTF-8 (RFC 2640)",
+}
+
+// Writes the features sorted by name with their descriptions sent by the
+// server and the explanations of the well-known features in aligned columns.
+func printFeatures(w io.Writer, features map[string]string) {
+	names := make([]string, 0, len(features))
+	nameWidth, descriptionWidth := 0, 0
+	for name, description := range features {
+		names = append(names, name)
+		if len(name) > nameWidth {
+			nameWidth = len(name)
+		}
+		if len(description) > descriptionWidth {
+			descriptionWidth = len(description)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line := fmt.Sprintf("  %-*s  %-*s  %s", nameWidth, name, descriptionWidth, features[name],
+			featureExplanations[strings.ToUpper(name)])
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
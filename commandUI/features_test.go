@@ -0,0 +1,18 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintFeatures(t *testing.T) {
+	var out bytes.Buffer
+	printFeatures(&out, map[string]string{"UTF8": "", "AUTH": "TLS", "REST": "STREAM", "XCRC": ""})
+	expected := "  AUTH  TLS     secured connections (RFC 4217)\n" +
+		"  REST  STREAM  restart of transfers at an offset (RFC 3659)\n" +
+		"  UTF8          paths in UTF-8 (RFC 2640)\n" +
+		"  XCRC\n"
+	if out.String() != expected {
+		t.Errorf("printFeatures wrote\n%s\nexpected\n%s", out.String(), expected)
+	}
+}
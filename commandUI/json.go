@@ -0,0 +1,71 @@
+// Output of the commands as JSON for scripts and other programs, which is
+// enabled with -json. Each output is a single line.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/internal/ftputil"
+	"os"
+	"time"
+)
+
+// Entry of LIST as JSON. The fields not listed by the server are omitted.
+type jsonEntry struct {
+	Name   string     `json:"name"`
+	Type   string     `json:"type"`
+	Size   uint64     `json:"size"`
+	Time   *time.Time `json:"time,omitempty"`
+	Mode   string     `json:"mode,omitempty"` // octal permission bits, e.g. "644"
+	Perm   string     `json:"perm,omitempty"`
+	Owner  string     `json:"owner,omitempty"`
+	Group  string     `json:"group,omitempty"`
+	Target string     `json:"target,omitempty"`
+}
+
+// Converts the entries of LIST.
+func newJSONEntries(entries []*ftps_qftp_client.Entry) []jsonEntry {
+	converted := make([]jsonEntry, 0, len(entries))
+	for _, entry := range entries {
+		e := jsonEntry{Name: entry.Name, Type: entryTypeName(entry.Type), Size: entry.Size, Perm: entry.Perm,
+			Owner: entry.Owner, Group: entry.Group, Target: entry.Target}
+		if !entry.Time.IsZero() {
+			entryTime := entry.Time
+			e.Time = &entryTime
+		}
+		if entry.Mode != 0 {
+			e.Mode = ftputil.FormatFileMode(entry.Mode)
+		}
+		converted = append(converted, e)
+	}
+	return converted
+}
+
+// Returns the name of the type of an entry in JSON.
+func entryTypeName(entryType ftps_qftp_client.EntryType) string {
+	switch entryType {
+	case ftps_qftp_client.EntryTypeFile:
+		return "file"
+	case ftps_qftp_client.EntryTypeFolder:
+		return "dir"
+	case ftps_qftp_client.EntryTypeLink:
+		return "link"
+	}
+	return "unknown"
+}
+
+// Writes the value as a line of JSON to the standard output.
+func printJSON(v interface{}) error {
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
+
+// Writes the error as a line of JSON to the standard error output.
+func printJSONError(err error) error {
+	return json.NewEncoder(os.Stderr).Encode(jsonError{Error: err.Error()})
+}
+
+// Error of a command as JSON
+type jsonError struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+func TestJSONEntries(t *testing.T) {
+	entries := []*ftps_qftp_client.Entry{
+		{Name: "a.txt", Type: ftps_qftp_client.EntryTypeFile, Size: 12, Mode: 0644,
+			Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{Name: "bin", Type: ftps_qftp_client.EntryTypeLink, Mode: 0755 | os.ModeSetuid, Target: "usr/bin"},
+	}
+	encoded, err := json.Marshal(newJSONEntries(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"name":"a.txt","type":"file","size":12,"time":"2020-01-02T03:04:05Z","mode":"644"},` +
+		`{"name":"bin","type":"link","size":0,"mode":"4755","target":"usr/bin"}]`
+	if string(encoded) != expected {
+		t.Errorf("got %s, expected %s", encoded, expected)
+	}
+}
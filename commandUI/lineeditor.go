@@ -0,0 +1,381 @@
+// Line editor of the interactive session. On a terminal the line can be
+// edited with the arrow keys and the keys of Emacs, e.g. Ctrl-A and Ctrl-E.
+// Up and down browse the history, Ctrl-R searches it backwards. The history
+// is saved in ~/.qftp_history, so it is available in the next session.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Name of the history file in the home directory
+const historyFileName = ".qftp_history"
+
+// Number of lines kept in the history
+const maxHistory = 1000
+
+// Keys of the line editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyCtrlK     = 11
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// lineEditor reads the command lines from the standard input.
+type lineEditor struct {
+	in          *bufio.Reader
+	history     []string
+	historyFile string // empty to not save the history
+}
+
+// Creates a lineEditor with the history of the file. The history is not
+// saved, if historyFile is empty.
+func newLineEditor(historyFile string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(os.Stdin), historyFile: historyFile}
+	if historyFile != "" {
+		e.history = loadHistory(historyFile)
+	}
+	return e
+}
+
+// Reads the lines of the history file. Files with more than maxHistory lines
+// are shortened.
+func loadHistory(path string) []string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var history []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			history = append(history, line)
+		}
+	}
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+		ioutil.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0600)
+	}
+	return history
+}
+
+// Reads a line after showing the prompt. Without a terminal, e.g. if the
+// commands are piped to the client, the line is read without editing.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Print(prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+	return editLine(e.in, os.Stdout, prompt, e.history)
+}
+
+// Adds the line to the history and appends it to the history file. Empty
+// lines and repetitions of the last line are skipped.
+func (e *lineEditor) add(line string) error {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return nil
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	if e.historyFile == "" {
+		return nil
+	}
+	file, err := os.OpenFile(e.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(line + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Line being edited and the position of the cursor in it
+type lineState struct {
+	out    io.Writer
+	prompt string
+	line   []rune
+	pos    int
+}
+
+// Replaces the line and moves the cursor to its end.
+func (s *lineState) set(line string) {
+	s.line = []rune(line)
+	s.pos = len(s.line)
+}
+
+// Draws the prompt and the line and places the cursor.
+func (s *lineState) refresh() {
+	fmt.Fprintf(s.out, "\r%s%s\x1b[K", s.prompt, string(s.line))
+	if back := len(s.line) - s.pos; back > 0 {
+		fmt.Fprintf(s.out, "\x1b[%dD", back)
+	}
+}
+
+// Inserts the character at the cursor.
+func (s *lineState) insert(r rune) {
+	s.line = append(s.line, 0)
+	copy(s.line[s.pos+1:], s.line[s.pos:])
+	s.line[s.pos] = r
+	s.pos++
+}
+
+// Removes the character at the cursor.
+func (s *lineState) delete() {
+	if s.pos < len(s.line) {
+		s.line = append(s.line[:s.pos], s.line[s.pos+1:]...)
+	}
+}
+
+// Reads and edits a line from the keys of in, which are read from a terminal
+// in raw mode. The line is drawn on out. The history is browsed with up and
+// down and searched with Ctrl-R. Ctrl-C discards the line, Ctrl-D on an empty
+// line returns io.EOF.
+func editLine(in *bufio.Reader, out io.Writer, prompt string, history []string) (string, error) {
+	s := &lineState{out: out, prompt: prompt}
+	index := len(history) // entry of the history shown, len(history) for the new line
+	newLine := ""         // new line, while the history is shown
+	older := func() {
+		if index > 0 {
+			if index == len(history) {
+				newLine = string(s.line)
+			}
+			index--
+			s.set(history[index])
+		}
+	}
+	newer := func() {
+		if index < len(history) {
+			index++
+			if index == len(history) {
+				s.set(newLine)
+			} else {
+				s.set(history[index])
+			}
+		}
+	}
+
+	s.refresh()
+	for {
+		r, _, err := in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(out, "\r\n")
+			return string(s.line), nil
+		case keyCtrlC:
+			fmt.Fprint(out, "^C\r\n")
+			return "", nil
+		case keyCtrlD:
+			if len(s.line) == 0 {
+				fmt.Fprint(out, "\r\n")
+				return "", io.EOF
+			}
+			s.delete()
+		case keyBackspace, keyCtrlH:
+			if s.pos > 0 {
+				s.pos--
+				s.delete()
+			}
+		case keyCtrlA:
+			s.pos = 0
+		case keyCtrlE:
+			s.pos = len(s.line)
+		case keyCtrlB:
+			if s.pos > 0 {
+				s.pos--
+			}
+		case keyCtrlF:
+			if s.pos < len(s.line) {
+				s.pos++
+			}
+		case keyCtrlK:
+			s.line = s.line[:s.pos]
+		case keyCtrlU:
+			s.line = s.line[s.pos:]
+			s.pos = 0
+		case keyCtrlP:
+			older()
+		case keyCtrlN:
+			newer()
+		case keyCtrlR:
+			accepted, err := s.search(in, history)
+			if err != nil {
+				return "", err
+			}
+			if accepted {
+				s.refresh()
+				fmt.Fprint(out, "\r\n")
+				return string(s.line), nil
+			}
+		case keyEscape:
+			key, err := readEscape(in)
+			if err != nil {
+				return "", err
+			}
+			switch key {
+			case "A":
+				older()
+			case "B":
+				newer()
+			case "C":
+				if s.pos < len(s.line) {
+					s.pos++
+				}
+			case "D":
+				if s.pos > 0 {
+					s.pos--
+				}
+			case "H", "1~", "7~":
+				s.pos = 0
+			case "F", "4~", "8~":
+				s.pos = len(s.line)
+			case "3~":
+				s.delete()
+			}
+		default:
+			if r >= ' ' {
+				s.insert(r)
+			}
+		}
+		s.refresh()
+	}
+}
+
+// Searches the history backwards for lines containing the typed text, till
+// the search is accepted with Enter, cancelled with Ctrl-G or Ctrl-C or left
+// with another key. Ctrl-R shows the next older line. The line found is
+// taken into the line state, unless the search is cancelled.
+func (s *lineState) search(in *bufio.Reader, history []string) (bool, error) {
+	original := string(s.line)
+	var query []rune
+	match := -1 // entry of the history found, -1 for none
+	failed := false
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(history[i], string(query)) {
+				match = i
+				failed = false
+				return
+			}
+		}
+		failed = true
+	}
+	take := func() {
+		if match >= 0 {
+			s.set(history[match])
+		} else {
+			s.set(original)
+		}
+	}
+
+	for {
+		shown := ""
+		if match >= 0 {
+			shown = history[match]
+		}
+		label := "reverse-i-search"
+		if failed {
+			label = "failed " + label
+		}
+		fmt.Fprintf(s.out, "\r(%s)`%s': %s\x1b[K", label, string(query), shown)
+
+		r, _, err := in.ReadRune()
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case r == keyCtrlR:
+			if match < 0 {
+				find(len(history) - 1)
+			} else {
+				find(match - 1)
+			}
+		case r == keyBackspace || r == keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(history) - 1)
+			}
+		case r == keyCtrlG || r == keyCtrlC:
+			s.set(original)
+			return false, nil
+		case r == '\r' || r == '\n':
+			take()
+			return true, nil
+		case r == keyEscape:
+			if _, err = readEscape(in); err != nil {
+				return false, err
+			}
+			take()
+			return false, nil
+		case r < ' ':
+			take()
+			return false, nil
+		default:
+			query = append(query, r)
+			if match < 0 {
+				find(len(history) - 1)
+			} else {
+				find(match)
+			}
+		}
+	}
+}
+
+// Reads the rest of an escape sequence after the escape key and returns its
+// final part, e.g. "A" for the arrow up ("\x1b[A") or "3~" for delete.
+func readEscape(in *bufio.Reader) (string, error) {
+	r, _, err := in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	if r != '[' && r != 'O' {
+		// Alt with a key
+		return string(r), nil
+	}
+	var sequence []rune
+	for {
+		r, _, err = in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		sequence = append(sequence, r)
+		if r >= 0x40 && r <= 0x7e {
+			return string(sequence), nil
+		}
+	}
+}
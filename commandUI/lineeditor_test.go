@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEditLine(t *testing.T) {
+	history := []string{"LIST /a", "CWD /b", "LIST /c"}
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"PWD\r", "PWD"},
+		{"PD\x1b[DW\r", "PWD"},                    // left and insert
+		{"XPWD\x01\x1b[3~\r", "PWD"},              // home and delete
+		{"PWDX\x7f\r", "PWD"},                     // backspace
+		{"\x1b[A\r", "LIST /c"},                   // up
+		{"\x1b[A\x1b[A\x1b[A\x1b[A\r", "LIST /a"}, // up beyond the oldest line
+		{"NOOP\x1b[A\x1b[B\r", "NOOP"},            // down back to the new line
+		{"\x12LIST\r", "LIST /c"},                 // search
+		{"\x12LIST\x12\r", "LIST /a"},             // next older match
+		{"\x12CWD\x1b[C\x7fc\r", "CWD /c"},        // leave the search and edit
+		{"PWD\x12CWD\x07\r", "PWD"},               // cancel the search
+		{"LIST\x03", ""},                          // discard
+	}
+	for _, test := range tests {
+		line, err := editLine(bufio.NewReader(strings.NewReader(test.keys)), ioutil.Discard, "> ", history)
+		if err != nil || line != test.expected {
+			t.Errorf("got %q, %v for %q, expected %q", line, err, test.keys, test.expected)
+		}
+	}
+
+	if _, err := editLine(bufio.NewReader(strings.NewReader("\x04")), ioutil.Discard, "> ", history); err != io.EOF {
+		t.Errorf("got %v for Ctrl-D, expected io.EOF", err)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFileName)
+	e := &lineEditor{historyFile: path}
+	for _, line := range []string{"PWD", "PWD", "", historyEntry("login user secret")} {
+		if err := e.add(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := loadHistory(path)
+	if strings.Join(history, "|") != "PWD|login user" {
+		t.Errorf("got history %q", history)
+	}
+}
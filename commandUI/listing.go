@@ -0,0 +1,143 @@
+// Formatting of the directory listings of LIST and LLS. The options are
+// given before the path like in ls, also combined like -hS:
+//
+//	-h  sizes in KiB, MiB, GiB and TiB
+//	-S  sorted by size, the largest first
+//	-t  sorted by modification time, the newest first
+//	-r  reversed order
+//
+// Without -S and -t the entries are sorted by name.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/attenberger/ftps_qftp-client"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Layout of the modification times in listings
+const listTimeLayout = "2006-01-02 15:04"
+
+// Options of a listing
+type listOptions struct {
+	human   bool
+	sortBy  byte // 'S' for the size, 't' for the modification time, 0 for the name
+	reverse bool
+	color   bool // color the names of directories and links
+}
+
+// Splits the leading options of LIST and LLS from the path. It returns "."
+// without a path.
+func parseListOptions(parameters []string) (listOptions, string, error) {
+	var options listOptions
+	for len(parameters) > 0 && strings.HasPrefix(parameters[0], "-") && len(parameters[0]) > 1 {
+		for _, option := range parameters[0][1:] {
+			switch option {
+			case 'h':
+				options.human = true
+			case 'S', 't':
+				options.sortBy = byte(option)
+			case 'r':
+				options.reverse = true
+			default:
+				return options, "", errors.New("Unknown option -" + string(option) + ", -h, -S, -t and -r are supported.")
+			}
+		}
+		parameters = parameters[1:]
+	}
+	switch len(parameters) {
+	case 0:
+		return options, ".", nil
+	case 1:
+		return options, parameters[0], nil
+	}
+	return options, "", errors.New("Just one path is expected after the options.")
+}
+
+// Sorts the entries by the option.
+func sortEntries(entries []*ftps_qftp_client.Entry, options listOptions) {
+	less := func(i, j int) bool { return entries[i].Name < entries[j].Name }
+	switch options.sortBy {
+	case 'S':
+		less = func(i, j int) bool {
+			if entries[i].Size != entries[j].Size {
+				return entries[i].Size > entries[j].Size
+			}
+			return entries[i].Name < entries[j].Name
+		}
+	case 't':
+		less = func(i, j int) bool {
+			if !entries[i].Time.Equal(entries[j].Time) {
+				return entries[i].Time.After(entries[j].Time)
+			}
+			return entries[i].Name < entries[j].Name
+		}
+	}
+	if options.reverse {
+		forward := less
+		less = func(i, j int) bool { return forward(j, i) }
+	}
+	sort.SliceStable(entries, less)
+}
+
+// Writes the entries sorted by the options with aligned columns of the
+// type, the size, the modification time and the name.
+func printListing(w io.Writer, entries []*ftps_qftp_client.Entry, options listOptions) {
+	sortEntries(entries, options)
+	sizes := make([]string, len(entries))
+	sizeWidth := 0
+	for i, entry := range entries {
+		if options.human {
+			sizes[i] = formatSize(entry.Size)
+		} else {
+			sizes[i] = strconv.FormatUint(entry.Size, 10)
+		}
+		if len(sizes[i]) > sizeWidth {
+			sizeWidth = len(sizes[i])
+		}
+	}
+	for i, entry := range entries {
+		var typeChar string
+		name := entry.Name
+		switch entry.Type {
+		case ftps_qftp_client.EntryTypeFile:
+			typeChar = "-"
+		case ftps_qftp_client.EntryTypeFolder:
+			typeChar = "d"
+			name = colorize(name, colorDir, options.color)
+		case ftps_qftp_client.EntryTypeLink:
+			typeChar = "l"
+			name = colorize(name, colorLink, options.color)
+		default:
+			typeChar = "?"
+		}
+		modTime := strings.Repeat(" ", len(listTimeLayout))
+		if !entry.Time.IsZero() {
+			modTime = entry.Time.Format(listTimeLayout)
+		}
+		if entry.Target != "" {
+			name = name + " -> " + entry.Target
+		}
+		fmt.Fprintf(w, "  %s %*s %s %s\n", typeChar, sizeWidth, sizes[i], modTime, name)
+	}
+}
+
+// Formats the size with the largest binary unit, e.g. "1.5 KiB".
+func formatSize(size uint64) string {
+	if size < 1024 {
+		return strconv.FormatUint(size, 10) + " B"
+	}
+	value := float64(size) / 1024
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + units[unit]
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+func TestParseListOptions(t *testing.T) {
+	options, path, err := parseListOptions([]string{"-hS", "-r", "/pub"})
+	if err != nil || path != "/pub" || options != (listOptions{human: true, sortBy: 'S', reverse: true}) {
+		t.Errorf("got %+v, %q, %v", options, path, err)
+	}
+	options, path, err = parseListOptions(nil)
+	if err != nil || path != "." || options != (listOptions{}) {
+		t.Errorf("got %+v, %q, %v without parameters", options, path, err)
+	}
+	for _, invalid := range [][]string{{"-x"}, {"a", "b"}} {
+		if _, _, err = parseListOptions(invalid); err == nil {
+			t.Errorf("no error for %q", invalid)
+		}
+	}
+}
+
+func TestPrintListing(t *testing.T) {
+	base := time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC)
+	entries := func() []*ftps_qftp_client.Entry {
+		return []*ftps_qftp_client.Entry{
+			{Name: "b", Size: 1536, Time: base},
+			{Name: "a", Size: 10, Time: base.Add(time.Hour)},
+			{Name: "c", Size: 3 * 1024 * 1024, Type: ftps_qftp_client.EntryTypeFolder},
+		}
+	}
+	names := func(output string) string {
+		var names []string
+		for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+			names = append(names, line[len(line)-1:])
+		}
+		return strings.Join(names, "")
+	}
+
+	for _, test := range []struct {
+		options  listOptions
+		expected string
+	}{
+		{listOptions{}, "abc"},
+		{listOptions{sortBy: 'S'}, "cba"},
+		{listOptions{sortBy: 't'}, "abc"},
+		{listOptions{sortBy: 't', reverse: true}, "cba"},
+	} {
+		var output bytes.Buffer
+		printListing(&output, entries(), test.options)
+		if got := names(output.String()); got != test.expected {
+			t.Errorf("got the order %s for %+v, expected %s", got, test.options, test.expected)
+		}
+	}
+
+	var output bytes.Buffer
+	printListing(&output, entries(), listOptions{human: true})
+	expected := "  -    10 B 2020-05-01 13:30 a\n" +
+		"  - 1.5 KiB 2020-05-01 12:30 b\n" +
+		"  d 3.0 MiB                  c\n"
+	if output.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", output.String(), expected)
+	}
+}
+
+func TestPrintListingColor(t *testing.T) {
+	entries := []*ftps_qftp_client.Entry{
+		{Name: "dir", Type: ftps_qftp_client.EntryTypeFolder},
+		{Name: "file"},
+		{Name: "link", Type: ftps_qftp_client.EntryTypeLink, Target: "file"},
+	}
+	var output bytes.Buffer
+	printListing(&output, entries, listOptions{color: true})
+	for _, part := range []string{colorDir + "dir" + colorReset, " file\n", colorLink + "link" + colorReset + " -> file"} {
+		if !strings.Contains(output.String(), part) {
+			t.Errorf("%q does not contain %q", output.String(), part)
+		}
+	}
+}
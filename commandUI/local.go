@@ -0,0 +1,57 @@
+// Commands of the local filesystem.
+
+package main
+
+import (
+	"fmt"
+	"github.com/attenberger/ftps_qftp-client"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Changes the local directory and shows the new one.
+func changeLocalDir(path string) error {
+	if err := os.Chdir(path); err != nil {
+		return err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fmt.Println("  Local directory: " + dir)
+	return nil
+}
+
+// Writes the entries of the local directory like LIST. A file is listed by
+// itself.
+func listLocalDir(w io.Writer, path string, options listOptions) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	infos := []os.FileInfo{info}
+	dir := filepath.Dir(path)
+	if info.IsDir() {
+		if infos, err = ioutil.ReadDir(path); err != nil {
+			return err
+		}
+		dir = path
+	}
+	entries := make([]*ftps_qftp_client.Entry, 0, len(infos))
+	for _, info := range infos {
+		entry := &ftps_qftp_client.Entry{Name: info.Name(), Type: ftps_qftp_client.EntryTypeFile,
+			Size: uint64(info.Size()), Time: info.ModTime()}
+		switch {
+		case info.IsDir():
+			entry.Type = ftps_qftp_client.EntryTypeFolder
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.Type = ftps_qftp_client.EntryTypeLink
+			entry.Target, _ = os.Readlink(filepath.Join(dir, info.Name()))
+		}
+		entries = append(entries, entry)
+	}
+	printListing(w, entries, options)
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListLocalDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if err := listLocalDir(&output, dir, listOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d entries, expected 3:\n%s", len(lines), output.String())
+	}
+	for i, expected := range []string{"  - ", "  l ", "  d "} {
+		if !strings.HasPrefix(lines[i], expected) {
+			t.Errorf("got %q, expected the prefix %q", lines[i], expected)
+		}
+	}
+	if !strings.Contains(lines[0], " 5 ") {
+		t.Errorf("The size is missing in %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "link -> file") {
+		t.Errorf("The target of the link is missing in %q", lines[1])
+	}
+
+	output.Reset()
+	if err := listLocalDir(&output, filepath.Join(dir, "file"), listOptions{}); err != nil || !strings.HasSuffix(output.String(), " file\n") {
+		t.Errorf("got %q, %v for a file", output.String(), err)
+	}
+}
@@ -0,0 +1,316 @@
+// Commandline for the FTP-Client to access an FTP-Server either over FTPS
+// (-protocol tcp) or over QUIC-FTP (-protocol quic). Further arguments for
+// starting the client are -cert, -host and -port to specify the servers
+// TLS-/X.509-certificate (filename), his hostname and controlport. Without
+// -cert the certificate is checked with the certificates of the system.
+// -fingerprint accepts just the certificate with the SHA-256 fingerprint,
+// -insecure any certificate for tests.
+// With -encoding the paths are converted for servers not using UTF-8.
+//
+// With -user the client logs in after connecting, FTPS connections are
+// secured with TLS before. The password is taken from -pass, from the
+// environment variable QFTP_PASSWORD or entered at a prompt without echo.
+// With -dir the client changes to the remote directory after the login.
+//
+// Frequent servers can be saved as bookmarks in ~/.qftprc, see bookmarks.go.
+// With -bookmark the client connects to a bookmark, the other flags override
+// its settings. The command OPEN connects to another bookmark. After the
+// connection dropped, RECONNECT connects again to the same server, logs in
+// with the credentials of the last login and returns to the remote directory.
+//
+// RETR and STOR stream a file from the standard input or to the standard
+// output with the local path "-", e.g. -e "LOGIN user; STOR - backup.tar".
+// The progress and the results of transfers, confirmations and the errors are
+// written to the standard error output, so they are never mixed with the
+// data of a file on the standard output. Without the second
+// path RETR and STOR name the file like the source, e.g. "STOR /tmp/a.txt"
+// stores the file a.txt in the remote directory.
+//
+// With -i the client asks before DELE, RMD and overwriting local files with
+// RETR like the classic ftp client, PROMPT toggles this interactive mode.
+//
+// On a terminal directories, links and errors are colored, unless -no-color
+// is given or the environment variable NO_COLOR is set.
+//
+// With -timeout the client waits for each reply of the server just for the
+// given time, a connection without reply is unusable then. -retries repeats
+// transfers failed with transient errors, e.g. replies with 4xx. With
+// -keepalive the interactive session sends NOOP, while it is idle.
+//
+// -rate limits the bandwidth of each transfer, also by time of day, e.g.
+// -rate 08:00-18:00=512K,0 throttles the transfers to 512 KiB/s during
+// business hours and transfers with full bandwidth otherwise, see
+// ftps_qftp_client.ParseRateSchedule. A running transfer changes its rate,
+// when a window starts or ends.
+//
+// With -json LIST, NLST and FEAT print a line of JSON and the errors are
+// printed as {"error": "..."}, so the client can be used by scripts with -e.
+//
+// Arguments with spaces are quoted like in a shell, see tokenize.go.
+//
+// In the interactive session the lines are edited like in a shell, see
+// lineeditor.go. The history is saved in ~/.qftp_history.
+//
+// QUEUE collects transfers, which START runs in the background with parallel
+// connections, while further commands are entered. STATUS shows their
+// progress and CANCEL stops them.
+//
+// With -e the commands separated by ";" are executed without an interactive
+// session, e.g. -e "LOGIN user password; STOR a b; QUIT". The client stops at
+// the first failed command and quits the connection at the end, if the
+// commands do not. Local paths relate to the current directory of the shell,
+// while an interactive session starts in the home directory. The exit status shows the cause of a failure:
+//
+//	1  a command failed for another reason
+//	2  invalid flags, unknown commands or wrong parameters
+//	3  the connection could not be opened or dropped
+//	4  the login was refused or no password given
+//	5  a transfer failed
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/ftpq"
+	"github.com/attenberger/ftps_qftp-client/ftps"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values of the flag -protocol
+const (
+	protocolTCP  = "tcp"  // FTPS
+	protocolQUIC = "quic" // QUIC-FTP
+)
+
+// Default control ports of the protocols
+var defaultPorts = map[string]int{
+	protocolTCP:  2121,
+	protocolQUIC: 2120,
+}
+
+func main() {
+	// Parse commandline flags
+	var (
+		name     = flag.String("bookmark", "", "Bookmark of ~/"+configFileName+" to connect to, the other flags override its settings")
+		protocol = flag.String("protocol", "", "Protocol, tcp for FTPS or quic for QUIC-FTP (default tcp)")
+		port     = flag.Int("port", 0, "Port (default 2121 for tcp, 2120 for quic)")
+		host     = flag.String("host", "", "Hostname (default localhost)")
+		cert     = flag.String("cert", "", "Path to server certificate for TLS (default the certificates of the system)")
+		pin      = flag.String("fingerprint", "", "SHA-256 fingerprint of the server certificate to accept, e.g. 3F:A0:...")
+		insecure = flag.Bool("insecure", false, "Accept any server certificate, just for tests")
+		encoding = flag.String("encoding", "", "Encoding of the paths at the server, e.g. iso-8859-1 (default UTF-8)")
+		username = flag.String("user", "", "User to log in after connecting")
+		password = flag.String("pass", "", "Password of -user (default QFTP_PASSWORD or a prompt)")
+		dir      = flag.String("dir", "", "Remote directory to change to after the login")
+		jsonOut  = flag.Bool("json", false, "Print the output of LIST, NLST and FEAT and the errors as JSON")
+		noColor  = flag.Bool("no-color", false, "Print without colors, like with the environment variable NO_COLOR")
+		prompt   = flag.Bool("i", false, "Interactive mode, ask before DELE, RMD and overwriting local files with RETR")
+		timeout  = flag.Duration("timeout", 0, "Limit for connecting and for each reply of the server, e.g. 1m (default 30s for connecting, no limit for replies)")
+		retries  = flag.Int("retries", 0, "Number of further attempts of transfers after transient errors")
+		alive    = flag.Duration("keepalive", 0, "Interval of NOOP to keep an idle interactive session alive, e.g. 5m (default none)")
+		rate     = flag.String("rate", "", "Bandwidth of each transfer in bytes per second, also by time of day, e.g. 08:00-18:00=512K,0 (default no limit)")
+		execute  = flag.String("e", "", "Commands separated by \";\" to execute instead of an interactive session")
+	)
+	flag.Parse()
+
+	// set working directory, the commands of -e keep the one of the shell
+	currentUser, err := user.Current()
+	if err != nil {
+		log.Fatalf("Unable to read the current user, to find out the local home directory.")
+	}
+	if *execute == "" {
+		if err = os.Chdir(currentUser.HomeDir); err != nil {
+			exit(exitFailure, "Error changing the working directory to "+currentUser.HomeDir+". "+err.Error())
+		}
+	}
+
+	bookmarks, err := readBookmarks(filepath.Join(currentUser.HomeDir, configFileName))
+	if err != nil {
+		exit(exitUsage, err.Error())
+	}
+	settings := &bookmark{}
+	if *name != "" {
+		b, available := bookmarks[*name]
+		if !available {
+			exit(exitUsage, "Unknown bookmark "+*name+" in ~/"+configFileName)
+		}
+		settings = b
+	}
+	settings = settings.merge(&bookmark{protocol: *protocol, host: *host, port: *port, cert: *cert,
+		fingerprint: *pin, insecure: *insecure, user: *username, dir: *dir, encoding: *encoding})
+	if err = settings.complete(); err != nil {
+		exit(exitUsage, err.Error())
+	}
+	var schedule *ftps_qftp_client.RateSchedule
+	if *rate != "" {
+		if schedule, err = ftps_qftp_client.ParseRateSchedule(*rate); err != nil {
+			exit(exitUsage, err.Error())
+		}
+	}
+
+	// setup ftp connection
+	if settings.user != "" {
+		if *password, err = lookupPassword(settings.user, *password); err != nil {
+			exit(exitLogin, err.Error())
+		}
+	}
+	conn, closeConn, err := connect(settings, *password, *timeout)
+	if err != nil {
+		exit(exitStatus(err), err.Error())
+	}
+	// The answers to confirmations are read like the commands
+	editor := newLineEditor(filepath.Join(currentUser.HomeDir, historyFileName))
+	s := newSession(settings.protocol, conn, closeConn, bookmarks,
+		&uiOptions{jsonOutput: *jsonOut, interactive: *prompt, color: colorEnabled(*noColor), ask: editor.readLine,
+			timeout: *timeout, retries: *retries, keepAlive: *alive, rateSchedule: schedule})
+	s.remember(settings, *password)
+	defer s.close()
+
+	if *execute != "" {
+		if err = s.executeCommands(*execute); err != nil {
+			// Exit skips the deferred calls
+			s.close()
+			os.Exit(exitStatus(err))
+		}
+		return
+	}
+
+	if *alive > 0 {
+		stopKeepAlive := s.keepAlive(*alive)
+		defer stopKeepAlive()
+	}
+	for {
+		// Read Command from Commandline
+		line, err := editor.readLine("> ")
+		if err == io.EOF {
+			s.conn.Quit()
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error while reading command: "+err.Error())
+			continue
+		}
+		if err = editor.add(historyEntry(line)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error while saving the history. "+err.Error())
+		}
+
+		// Execute Command
+		quit, err := s.executeLine(line)
+		if err != nil {
+			s.printError(err)
+		}
+		if quit {
+			s.queue.wait()
+			return
+		}
+	}
+}
+
+// Prints the message and exits with the status.
+func exit(status int, message string) {
+	fmt.Fprintln(os.Stderr, message)
+	os.Exit(status)
+}
+
+// Returns the line as it is saved in the history. The password of LOGIN is
+// removed.
+func historyEntry(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) > 2 && strings.ToUpper(fields[0]) == "LOGIN" {
+		return fields[0] + " " + fields[1]
+	}
+	return line
+}
+
+// Executes a command line and reports whether it was QUIT. Empty lines are
+// skipped.
+func (s *session) executeLine(line string) (bool, error) {
+	args, err := splitCommandLine(line)
+	if err != nil || len(args) == 0 {
+		return false, err
+	}
+	return s.execute(args)
+}
+
+// Executes the command with the arguments and reports whether it was QUIT.
+func (s *session) execute(args []string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	name := strings.ToUpper(args[0])
+	err := s.commands.execute(s.conn, name, args[1:]...)
+	s.lastUse = time.Now()
+	return name == "QUIT", err
+}
+
+// Executes the commands separated by ";" till one fails and returns its
+// error. The connection is quit at the end, if no QUIT was executed. The
+// transfers started with START are awaited.
+func (s *session) executeCommands(script string) error {
+	commands, err := splitScript(script)
+	if err != nil {
+		err = withStatus(exitUsage, err)
+		s.printError(err)
+		s.conn.Quit()
+		return err
+	}
+	defer s.queue.wait()
+	for _, args := range commands {
+		quit, err := s.execute(args)
+		if err != nil {
+			s.printError(err)
+			s.conn.Quit()
+			return err
+		}
+		if quit {
+			return nil
+		}
+	}
+	return s.conn.Quit()
+}
+
+// Time to open a connection without -timeout
+const defaultDialTimeout = 30 * time.Second
+
+// Opens the connection of the protocol to the server. For QUIC-FTP the
+// commands are sent on a subconnection of the QUIC session. The returned
+// function closes the QUIC session at the end.
+func dial(protocol string, addr string, tlsConfig *tls.Config, timeout time.Duration) (connection, func(), error) {
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+	switch protocol {
+	case protocolTCP:
+		conn, err := ftps.DialTLSConfig(addr, timeout, tlsConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The standard output is kept free for the data of RETR -
+		fmt.Fprintln(os.Stderr, strconv.Itoa(ftps.StatusReady)+" "+conn.Welcome())
+		return conn, func() {}, nil
+	case protocolQUIC:
+		conn, err := ftpq.DialTLSConfig(addr, tlsConfig, ftpq.NewQUICConfig(timeout))
+		if err != nil {
+			return nil, nil, err
+		}
+		subConn, greeting, err := conn.GetNewSubConn()
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		// The standard output is kept free for the data of RETR -
+		fmt.Fprintln(os.Stderr, greeting)
+		return subConn, func() { conn.Close() }, nil
+	}
+	return nil, nil, errors.New("Unknown protocol " + protocol + ".")
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client/ftps"
+	"github.com/attenberger/ftps_qftp-client/ftps/ftptest"
+)
+
+func TestExecuteCommands(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddDir("/incoming")
+
+	dial := func() *session {
+		conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newSession(protocolTCP, conn, func() {}, nil, &uiOptions{})
+	}
+
+	if err = dial().executeCommands("LOGIN anonymous anonymous; MKD /incoming/new;; CWD /incoming/new"); err != nil {
+		t.Fatal(err)
+	}
+	if !server.IsDir("/incoming/new") {
+		t.Error("The directory was not created")
+	}
+
+	// The commands after a failed one are skipped
+	err = dial().executeCommands("LOGIN anonymous anonymous; CWD /missing; MKD /incoming/skipped; QUIT")
+	if err == nil {
+		t.Error("The failed CWD was not reported")
+	}
+	if server.IsDir("/incoming/skipped") {
+		t.Error("The command after the failed one was executed")
+	}
+}
+
+func TestExecuteCommandsStreaming(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddDir("/incoming")
+	server.AddFile("/incoming/in.txt", []byte("retrieved"))
+
+	stdin, err := ioutil.TempFile(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin.WriteString("stored")
+	stdin.Seek(0, io.SeekStart)
+	stdout, err := ioutil.TempFile(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	defer func() {
+		os.Stdin, os.Stdout = oldStdin, oldStdout
+	}()
+
+	conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSession(protocolTCP, conn, func() {}, nil, &uiOptions{})
+	// The progress of the following STOR is not mixed into the retrieved data
+	err = s.executeCommands("LOGIN anonymous anonymous; STOR - /incoming/out.txt; RETR - /incoming/in.txt; STOR " +
+		stdin.Name() + " /incoming/copy.txt")
+	os.Stdin, os.Stdout = oldStdin, oldStdout
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := server.File("/incoming/out.txt"); string(data) != "stored" {
+		t.Errorf("got %q from the standard input, expected %q", data, "stored")
+	}
+	if data, _ := ioutil.ReadFile(stdout.Name()); string(data) != "retrieved" {
+		t.Errorf("got %q on the standard output, expected %q", data, "retrieved")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	dial := func() *session {
+		conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newSession(protocolTCP, conn, func() {}, nil, &uiOptions{})
+	}
+	if err = dial().executeCommands("LOGIN anonymous anonymous; QUOTE FEAT; RAW NOOP"); err != nil {
+		t.Error(err)
+	}
+	if err = dial().executeCommands("LOGIN anonymous anonymous; QUOTE XUNKNOWN argument"); err == nil ||
+		!strings.Contains(err.Error(), "code 5") {
+		t.Errorf("got %v for the refused command", err)
+	}
+}
+
+func TestTransferDefaultNames(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddDir("/incoming")
+	server.AddFile("/incoming/in.txt", []byte("retrieved"))
+
+	dir := t.TempDir()
+	if err = ioutil.WriteFile(filepath.Join(dir, "up.txt"), []byte("stored"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workingDir)
+
+	conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSession(protocolTCP, conn, func() {}, nil, &uiOptions{})
+	err = s.executeCommands("LOGIN anonymous anonymous; CWD /incoming; LCD " + dir +
+		"; STOR " + filepath.Join(dir, "up.txt") + "; RETR /incoming/in.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := server.File("/incoming/up.txt"); string(data) != "stored" {
+		t.Errorf("got %q in the remote file, expected %q", data, "stored")
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "in.txt")); string(data) != "retrieved" {
+		t.Errorf("got %q in the local file, expected %q", data, "retrieved")
+	}
+
+	if err = s.commands.execute(s.conn, "STOR", streamPath); err == nil {
+		t.Error("no error for STOR of the standard input without remotepath")
+	}
+}
+
+func TestTransferGzip(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddDir("/incoming")
+
+	dir := t.TempDir()
+	if err = ioutil.WriteFile(filepath.Join(dir, "up.txt"), []byte("compressed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workingDir)
+
+	conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSession(protocolTCP, conn, func() {}, nil, &uiOptions{})
+	// The compressed file gets the extension .gz at the server and loses it locally
+	retrieveDir := t.TempDir()
+	err = s.executeCommands("LOGIN anonymous anonymous; CWD /incoming; STOR -z " + filepath.Join(dir, "up.txt") +
+		"; LCD " + retrieveDir + "; RETR -z up.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := server.File("/incoming/up.txt.gz"); len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		t.Errorf("got %q in the remote file, expected gzip data", data)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(retrieveDir, "up.txt")); string(data) != "compressed" {
+		t.Errorf("got %q in the decompressed file, expected %q", data, "compressed")
+	}
+	if err = s.commands.execute(s.conn, "STOR", "-z"); exitStatus(err) != exitUsage {
+		t.Errorf("got %v for STOR -z without localpath", err)
+	}
+}
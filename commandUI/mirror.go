@@ -0,0 +1,184 @@
+// Mirroring of directory trees with the command MIRROR.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+// Options of MIRROR
+type mirrorOptions struct {
+	reverse   bool   // mirror the local directory to the server
+	delete    bool   // delete the files missing at the source
+	dryRun    bool   // just print the operations
+	checksum  int    // parallel connections comparing the checksums of modified files, 0 for none
+	state     string // file of the state detecting conflicts, empty for none
+	conflicts ftps_qftp_client.ConflictPolicy
+}
+
+// Parallel connections of MIRROR --checksum without a number
+const defaultChecksumParallel = 4
+
+// Policies of MIRROR --conflicts by their names
+var conflictPolicies = map[string]ftps_qftp_client.ConflictPolicy{
+	"report": ftps_qftp_client.ConflictReport,
+	"newest": ftps_qftp_client.ConflictNewestWins,
+	"local":  ftps_qftp_client.ConflictLocalWins,
+	"remote": ftps_qftp_client.ConflictRemoteWins,
+}
+
+// Splits the parameters of MIRROR into the options and the source and
+// destination. Without destination the directory of the other side gets the
+// name of the source, e.g. "MIRROR /pub" mirrors into the local directory pub.
+func parseMirrorOptions(parameters []string) (mirrorOptions, string, string, error) {
+	var options mirrorOptions
+	conflicts := ""
+	for len(parameters) > 0 && strings.HasPrefix(parameters[0], "-") && len(parameters[0]) > 1 {
+		// Options with a value have the form --option=value
+		option, value := parameters[0], ""
+		if i := strings.Index(option, "="); i >= 0 {
+			option, value = option[:i], option[i+1:]
+		}
+		switch {
+		case parameters[0] == "-R":
+			options.reverse = true
+		case parameters[0] == "--delete":
+			options.delete = true
+		case parameters[0] == "--dry-run":
+			options.dryRun = true
+		case parameters[0] == "--checksum":
+			options.checksum = defaultChecksumParallel
+		case option == "--checksum":
+			var err error
+			if options.checksum, err = strconv.Atoi(value); err != nil || options.checksum < 1 {
+				return options, "", "", errors.New("The number of parallel connections of --checksum has to be positive.")
+			}
+		case option == "--state" && value != "":
+			options.state = value
+		case option == "--conflicts":
+			policy, known := conflictPolicies[value]
+			if !known {
+				return options, "", "", errors.New("Unknown conflict policy " + value +
+					", report, newest, local and remote are supported.")
+			}
+			options.conflicts, conflicts = policy, value
+		default:
+			return options, "", "", errors.New("Unknown option " + parameters[0] +
+				", -R, --delete, --dry-run, --checksum, --state and --conflicts are supported.")
+		}
+		parameters = parameters[1:]
+	}
+	if conflicts != "" && options.state == "" {
+		return options, "", "", errors.New("--conflicts needs the state file of the last run set with --state.")
+	}
+	switch len(parameters) {
+	case 1:
+		if options.reverse {
+			return options, parameters[0], filepath.Base(parameters[0]), nil
+		}
+		return options, parameters[0], path.Base(parameters[0]), nil
+	case 2:
+		return options, parameters[0], parameters[1], nil
+	}
+	return options, "", "", errors.New("A source and optionally a destination are expected after the options.")
+}
+
+// Mirrors the remote directory into the local one or with -R the local one
+// into the remote one. With --dry-run the operations are just printed. With
+// --checksum modified files of the same size are compared by their checksums
+// in parallel connections and skipped, if the content is the same. With
+// --state the files modified at both sides since the last run are resolved
+// by the policy of --conflicts and the state is saved for the next run. The
+// transfers are limited like set with -rate.
+func mirror(w io.Writer, conn connection, ui *uiOptions, parameters []string) error {
+	options, source, destination, err := parseMirrorOptions(parameters)
+	if err != nil {
+		return withStatus(exitUsage, err)
+	}
+	direction := ftps_qftp_client.Retrieve
+	localDir, remoteDir := destination, source
+	if options.reverse {
+		direction = ftps_qftp_client.Store
+		localDir, remoteDir = source, destination
+	}
+	plan, err := ftps_qftp_client.PlanMirror(conn, direction, localDir, remoteDir, options.delete)
+	if err != nil {
+		return err
+	}
+	if options.checksum > 0 {
+		// The connections are opened like the ones of parallel transfers
+		scheduler, err := conn.NewTransferScheduler(options.checksum)
+		if err != nil {
+			return err
+		}
+		skipped, err := plan.SkipUnchanged(scheduler.OpenConn, options.checksum)
+		if err != nil {
+			return errors.New("Error while opening the connections to compare checksums. " + err.Error())
+		}
+		if skipped > 0 {
+			fmt.Fprintln(w, "  "+strconv.Itoa(skipped)+" modified file(s) skipped, the checksums are the same.")
+		}
+	}
+	var state *ftps_qftp_client.MirrorState
+	if options.state != "" {
+		if state, err = ftps_qftp_client.OpenMirrorState(options.state); err != nil {
+			return err
+		}
+		for _, conflict := range plan.ResolveConflicts(conn, state, options.conflicts) {
+			printConflict(w, conflict)
+		}
+	}
+
+	for i, task := range plan.Tasks {
+		plan.Tasks[i] = ui.configure(task)
+	}
+
+	if options.dryRun {
+		for _, operation := range plan.Operations() {
+			fmt.Fprintln(w, "  "+operation)
+		}
+		fmt.Fprintln(w, "  "+strconv.Itoa(len(plan.Tasks))+" transfers and "+strconv.Itoa(len(plan.Delete))+
+			" deletions planned.")
+		return nil
+	}
+	results, deleted := plan.Perform(conn)
+	for _, result := range deleted {
+		if result.Err != nil {
+			fmt.Fprintln(w, "  FAILED  delete "+result.Path+": "+strings.TrimSpace(result.Err.Error()))
+		} else {
+			fmt.Fprintln(w, "  DELETED "+result.Path)
+		}
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(w, "  "+destination+" is up to date.")
+	} else if err = printTransferResults(results); err != nil {
+		return err
+	}
+	if failed := deleted.Failed(); len(failed) > 0 {
+		return errors.New(strconv.Itoa(len(failed)) + " deletion(s) failed.")
+	}
+	if state != nil {
+		return plan.SaveState(conn, state)
+	}
+	return nil
+}
+
+// Prints a file modified at both sides and how it is resolved.
+func printConflict(w io.Writer, conflict ftps_qftp_client.MirrorConflict) {
+	resolution := "not transferred"
+	switch conflict.Resolution {
+	case ftps_qftp_client.Store:
+		resolution = "the local version is kept"
+	case ftps_qftp_client.Retrieve:
+		resolution = "the remote version is kept"
+	}
+	fmt.Fprintln(w, "  CONFLICT "+conflict.RemotePath+" was modified locally and at the server, "+resolution+".")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/ftps"
+	"github.com/attenberger/ftps_qftp-client/ftps/ftptest"
+)
+
+func TestParseMirrorOptions(t *testing.T) {
+	options, source, destination, err := parseMirrorOptions([]string{"-R", "--delete", "/tmp/site"})
+	if err != nil || options != (mirrorOptions{reverse: true, delete: true}) || source != "/tmp/site" || destination != "site" {
+		t.Errorf("got %+v, %q, %q, %v", options, source, destination, err)
+	}
+	options, source, destination, err = parseMirrorOptions([]string{"--dry-run", "/pub", "copy"})
+	if err != nil || options != (mirrorOptions{dryRun: true}) || source != "/pub" || destination != "copy" {
+		t.Errorf("got %+v, %q, %q, %v", options, source, destination, err)
+	}
+	options, _, _, err = parseMirrorOptions([]string{"--checksum", "/pub"})
+	if err != nil || options != (mirrorOptions{checksum: defaultChecksumParallel}) {
+		t.Errorf("got %+v, %v", options, err)
+	}
+	options, _, _, err = parseMirrorOptions([]string{"--checksum=2", "/pub"})
+	if err != nil || options != (mirrorOptions{checksum: 2}) {
+		t.Errorf("got %+v, %v", options, err)
+	}
+	options, _, _, err = parseMirrorOptions([]string{"--state=/tmp/pub.state", "--conflicts=newest", "/pub"})
+	if err != nil || options != (mirrorOptions{state: "/tmp/pub.state", conflicts: ftps_qftp_client.ConflictNewestWins}) {
+		t.Errorf("got %+v, %v", options, err)
+	}
+	for _, invalid := range [][]string{{"-x", "a"}, {"--delete"}, {"a", "b", "c"}, {"--checksum=0", "a"},
+		{"--conflicts=local", "a"}, {"--state=s", "--conflicts=oldest", "a"}, {"--state", "a"}} {
+		if _, _, _, err = parseMirrorOptions(invalid); err == nil {
+			t.Errorf("no error for %q", invalid)
+		}
+	}
+}
+
+func TestMirror(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddDir("/pub")
+	server.AddFile("/pub/a.txt", []byte("mirrored"))
+	conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Quit()
+	if err = conn.Login("anonymous", "anonymous"); err != nil {
+		t.Fatal(err)
+	}
+	localDir := filepath.Join(t.TempDir(), "copy")
+
+	var out bytes.Buffer
+	if err = mirror(&out, conn, &uiOptions{}, []string{"--dry-run", "/pub", localDir}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "RETR /pub/a.txt -> "+filepath.Join(localDir, "a.txt")) {
+		t.Errorf("got %q for the dry run", out.String())
+	}
+	if _, err = os.Stat(localDir); !os.IsNotExist(err) {
+		t.Error("the dry run created the local directory")
+	}
+
+	// The server computes no checksums, so the files are transferred anyway
+	out.Reset()
+	statePath := filepath.Join(t.TempDir(), "pub.state")
+	err = mirror(&out, conn, &uiOptions{}, []string{"--checksum=2", "--state=" + statePath, "/pub", localDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(localDir, "a.txt")); string(data) != "mirrored" {
+		t.Errorf("got %q in the mirrored file", data)
+	}
+	state, err := ftps_qftp_client.OpenMirrorState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file, recorded := state.File("a.txt"); !recorded || file.Size != int64(len("mirrored")) {
+		t.Errorf("recorded %+v", file)
+	}
+}
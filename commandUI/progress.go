@@ -0,0 +1,171 @@
+// Display of the progress of transfers on the terminal, which is updated in
+// place.
+
+package main
+
+import (
+	"fmt"
+	"github.com/attenberger/ftps_qftp-client"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Width of the bars in characters
+const barWidth = 20
+
+// Shows the progress of a single transfer as a line, which is redrawn in place.
+type progressBar struct {
+	out      io.Writer
+	name     string
+	total    int64 // size of the file, 0 or -1 if unknown
+	bytes    int64
+	started  time.Time
+	lastDraw time.Time
+}
+
+// Creates the bar of a transfer starting now, which is drawn on out.
+func newProgressBar(out io.Writer, name string, total int64) *progressBar {
+	return &progressBar{out: out, name: name, total: total, started: time.Now()}
+}
+
+// Adds transfered bytes, the line is redrawn at most every ProgressInterval.
+func (bar *progressBar) add(n int64) {
+	bar.bytes += n
+	if time.Since(bar.lastDraw) >= ftps_qftp_client.ProgressInterval {
+		bar.draw()
+	}
+}
+
+// Redraws the line of the bar.
+func (bar *progressBar) draw() {
+	bar.lastDraw = time.Now()
+	fmt.Fprintf(bar.out, "\r\033[2K  %s", progressLine(bar.name, bar.bytes, bar.total, time.Since(bar.started)))
+}
+
+// Draws the final state and ends the line.
+func (bar *progressBar) finish() {
+	bar.draw()
+	fmt.Fprintln(bar.out)
+}
+
+// Passes the data read to the bar of the transfer.
+type progressReader struct {
+	reader io.Reader
+	bar    *progressBar
+}
+
+// Read implements the io.Reader interface.
+func (r *progressReader) Read(buf []byte) (int, error) {
+	n, err := r.reader.Read(buf)
+	r.bar.add(int64(n))
+	return n, err
+}
+
+// Formats the progress of a transfer: the bytes, the bar with the percentage
+// of the total, the rate and the estimated remaining time (ETA). Without a
+// total the bar and the remaining time are left out.
+func progressLine(name string, bytes int64, total int64, elapsed time.Duration) string {
+	line := fmt.Sprintf("%-30s %12d bytes", name, bytes)
+	if total > 0 {
+		percent := bytes * 100 / total
+		if percent > 100 {
+			percent = 100
+		}
+		filled := int(percent) * barWidth / 100
+		line += fmt.Sprintf(" [%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), percent)
+	}
+	rate := float64(0)
+	if elapsed > 0 {
+		rate = float64(bytes) / elapsed.Seconds()
+	}
+	line += " " + formatRate(rate)
+	if total > 0 && rate > 0 && bytes < total {
+		line += " ETA " + formatDuration(time.Duration(float64(total-bytes)/rate*float64(time.Second)))
+	}
+	return line
+}
+
+// Formats a rate in megabytes per second.
+func formatRate(bytesPerSecond float64) string {
+	return fmt.Sprintf("%7.2f MB/s", bytesPerSecond/1e6)
+}
+
+// Formats a duration as minutes and seconds, with hours if it is longer.
+func formatDuration(d time.Duration) string {
+	seconds := int64(d.Round(time.Second) / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// Shows the progress of a parallel transfer as table on the standard error
+// output, which is redrawn in place. Each task is shown like by a progressBar.
+type progressTable struct {
+	printedLines int
+	started      map[int]time.Time     // start of the running and finished tasks by their index
+	durations    map[int]time.Duration // durations of the finished tasks by their index
+}
+
+// Names of the states of a transfer task
+var taskStateText = map[ftps_qftp_client.TaskState]string{
+	ftps_qftp_client.TaskPending:   "pending",
+	ftps_qftp_client.TaskRunning:   "running",
+	ftps_qftp_client.TaskSucceeded: "done",
+	ftps_qftp_client.TaskFailed:    "failed",
+}
+
+// Redraws the table with the progress, can be used as TransferScheduler.Progress.
+func (table *progressTable) update(progress ftps_qftp_client.TransferProgress) {
+	if table.started == nil {
+		table.started = make(map[int]time.Time)
+		table.durations = make(map[int]time.Duration)
+	}
+	if table.printedLines > 0 {
+		// Move the cursor up to the first line of the table
+		fmt.Fprintf(os.Stderr, "\033[%dA", table.printedLines)
+	}
+	for i, task := range progress.Tasks {
+		if task.State != ftps_qftp_client.TaskPending {
+			if _, running := table.started[i]; !running {
+				table.started[i] = time.Now()
+			}
+		}
+		if task.State == ftps_qftp_client.TaskSucceeded || task.State == ftps_qftp_client.TaskFailed {
+			if _, finished := table.durations[i]; !finished {
+				table.durations[i] = time.Since(table.started[i])
+			}
+		}
+		var taskElapsed time.Duration
+		if duration, finished := table.durations[i]; finished {
+			taskElapsed = duration
+		} else if start, running := table.started[i]; running {
+			taskElapsed = time.Since(start)
+		}
+		fmt.Fprintf(os.Stderr, "\033[2K  %-8s %s\n", taskStateText[task.State],
+			progressLine(task.Task.LocalPath, task.Bytes, task.Task.Size, taskElapsed))
+	}
+	fmt.Fprintf(os.Stderr, "\033[2K  %d of %d tasks completed, %d failed, %d bytes transfered, %s.\n",
+		progress.CompletedTasks, progress.TotalTasks, progress.FailedTasks, progress.Bytes, formatRate(rateSince(table.started, progress.Bytes)))
+	table.printedLines = len(progress.Tasks) + 1
+}
+
+// Returns the overall rate of the bytes since the first task started.
+func rateSince(started map[int]time.Time, bytes int64) float64 {
+	var first time.Time
+	for _, start := range started {
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+	}
+	if first.IsZero() {
+		return 0
+	}
+	elapsed := time.Since(first).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) / elapsed
+}
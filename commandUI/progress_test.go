@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressLine(t *testing.T) {
+	line := progressLine("file", 2000000, 8000000, 2*time.Second)
+	for _, part := range []string{"2000000 bytes", "[#####---------------]  25%", "1.00 MB/s", "ETA 0:06"} {
+		if !strings.Contains(line, part) {
+			t.Errorf("%q does not contain %q", line, part)
+		}
+	}
+
+	// Without the size just the bytes and the rate are shown
+	line = progressLine("file", 500, -1, time.Second)
+	if strings.Contains(line, "%") || strings.Contains(line, "ETA") || !strings.Contains(line, "0.00 MB/s") {
+		t.Errorf("Unexpected progress of a file without size %q", line)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for _, test := range []struct {
+		duration time.Duration
+		expected string
+	}{
+		{1500 * time.Millisecond, "0:02"},
+		{61 * time.Second, "1:01"},
+		{3723 * time.Second, "1:02:03"},
+	} {
+		if formatted := formatDuration(test.duration); formatted != test.expected {
+			t.Errorf("formatDuration(%v) = %s, expected %s", test.duration, formatted, test.expected)
+		}
+	}
+}
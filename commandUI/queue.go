@@ -0,0 +1,236 @@
+// Queue of transfers, which are collected with QUEUE and run in the
+// background with START, while further commands can be entered.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+// transferQueue contains the queued transfers of a session and the state of
+// the run started with START. Its methods can be called while a run is in
+// the background.
+type transferQueue struct {
+	mutex    sync.Mutex
+	pending  []ftps_qftp_client.TransferTask // queued, but not yet started
+	cancel   func()                          // cancels the running run, nil while none runs
+	done     chan struct{}                   // closed at the end of the last run
+	progress ftps_qftp_client.TransferProgress
+	results  ftps_qftp_client.TransferResults // of the last finished run
+}
+
+// Creates an empty queue.
+func newTransferQueue() *transferQueue {
+	done := make(chan struct{})
+	close(done)
+	return &transferQueue{done: done}
+}
+
+// Appends the task to the pending transfers.
+func (q *transferQueue) add(task ftps_qftp_client.TransferTask) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending = append(q.pending, task)
+}
+
+// Starts the pending transfers in the background with up to parallel
+// connections. The tasks queued meanwhile are started by the next START.
+// At the end a summary is written to out.
+func (q *transferQueue) start(conn connection, parallel int, out io.Writer) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.cancel != nil {
+		return errors.New("The queue is already running, see STATUS.")
+	}
+	if len(q.pending) == 0 {
+		return errors.New("The queue is empty, add transfers with QUEUE.")
+	}
+	scheduler, err := conn.NewTransferScheduler(parallel)
+	if err != nil {
+		return err
+	}
+	scheduler.ExpandDirectories = true
+	scheduler.Progress = func(progress ftps_qftp_client.TransferProgress) {
+		q.mutex.Lock()
+		q.progress = progress
+		q.mutex.Unlock()
+	}
+
+	tasks := q.pending
+	q.pending = nil
+	q.progress = ftps_qftp_client.TransferProgress{TotalTasks: len(tasks)}
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	q.done = make(chan struct{})
+	go func(done chan struct{}) {
+		results := scheduler.Run(ctx, tasks)
+		cancel()
+		q.mutex.Lock()
+		q.results = results
+		q.cancel = nil
+		q.mutex.Unlock()
+		failed := len(results.Failed())
+		fmt.Fprintf(out, "  Queue finished: %d of %d transfers successful, %d bytes transfered.\n",
+			len(results)-failed, len(results), results.Bytes())
+		close(done)
+	}(q.done)
+	return nil
+}
+
+// Writes the progress of the running transfers or the results of the last
+// run and the pending transfers.
+func (q *transferQueue) status(w io.Writer) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	switch {
+	case q.cancel != nil:
+		for _, task := range q.progress.Tasks {
+			fmt.Fprintf(w, "  %-8s %s\n", taskStateText[task.State],
+				progressLine(task.Task.LocalPath, task.Bytes, task.Task.Size, 0))
+		}
+		fmt.Fprintf(w, "  Running: %d of %d tasks completed, %d failed, %d bytes transfered.\n",
+			q.progress.CompletedTasks, q.progress.TotalTasks, q.progress.FailedTasks, q.progress.Bytes)
+	case q.results != nil:
+		failed := len(q.results.Failed())
+		fmt.Fprintf(w, "  Last run: %d of %d transfers successful, %d bytes transfered.\n",
+			len(q.results)-failed, len(q.results), q.results.Bytes())
+		for _, result := range q.results {
+			if result.Err != nil {
+				fmt.Fprintln(w, "  FAILED   "+result.Task.RemotePath+": "+strings.TrimSpace(result.Err.Error()))
+			}
+		}
+	}
+	q.printPending(w)
+}
+
+// Writes the pending transfers with their numbers for CANCEL. The mutex has
+// to be held.
+func (q *transferQueue) printPending(w io.Writer) {
+	if len(q.pending) == 0 {
+		fmt.Fprintln(w, "  No transfers queued.")
+		return
+	}
+	for i, task := range q.pending {
+		if task.Direction == ftps_qftp_client.Retrieve {
+			fmt.Fprintf(w, "  %3d  GET %s -> %s\n", i+1, task.RemotePath, task.LocalPath)
+		} else {
+			fmt.Fprintf(w, "  %3d  PUT %s -> %s\n", i+1, task.LocalPath, task.RemotePath)
+		}
+	}
+}
+
+// Removes the pending transfer with the number shown by QUEUE or, with the
+// number 0, cancels the running transfers.
+func (q *transferQueue) cancelTask(number int) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if number == 0 {
+		if q.cancel == nil {
+			return errors.New("No transfers are running.")
+		}
+		q.cancel()
+		return nil
+	}
+	if number < 1 || number > len(q.pending) {
+		return errors.New("There is no queued transfer " + strconv.Itoa(number) + ".")
+	}
+	q.pending = append(q.pending[:number-1], q.pending[number:]...)
+	return nil
+}
+
+// Waits till the last run is finished.
+func (q *transferQueue) wait() {
+	q.mutex.Lock()
+	done := q.done
+	q.mutex.Unlock()
+	<-done
+}
+
+// Registers the commands of the queue.
+func registerQueueCommands(commands *commandRegistry, queue *transferQueue, options *uiOptions) {
+	commands.register(&command{
+		name: "CANCEL", args: "[number]", minArgs: 0, maxArgs: 1,
+		description: "Cancel the running queued transfers or remove the queued transfer with the number.",
+		handler: func(conn connection, parameters ...string) error {
+			number := 0
+			if len(parameters) == 1 {
+				var err error
+				if number, err = strconv.Atoi(parameters[0]); err != nil || number < 1 {
+					return withStatus(exitUsage, errors.New("The number of a queued transfer is expected."))
+				}
+			}
+			return queue.cancelTask(number)
+		},
+	})
+
+	commands.register(&command{
+		name: "QUEUE", args: "[(GET|PUT) <source> [destination]]", minArgs: 0, maxArgs: 3,
+		description: "Queue a transfer of a file or directory tree to start it with START, without parameters list the queue.",
+		handler: func(conn connection, parameters ...string) error {
+			if len(parameters) == 0 {
+				queue.mutex.Lock()
+				defer queue.mutex.Unlock()
+				queue.printPending(os.Stdout)
+				return nil
+			}
+			if len(parameters) < 2 {
+				return withStatus(exitUsage, errors.New("GET or PUT and a source are expected."))
+			}
+			source := parameters[1]
+			var task ftps_qftp_client.TransferTask
+			switch strings.ToUpper(parameters[0]) {
+			case "GET":
+				destination := path.Base(source)
+				if len(parameters) == 3 {
+					destination = parameters[2]
+				}
+				task = options.newTask(ftps_qftp_client.Retrieve, destination, source)
+			case "PUT":
+				destination := filepath.Base(source)
+				if len(parameters) == 3 {
+					destination = parameters[2]
+				}
+				task = options.newTask(ftps_qftp_client.Store, source, destination)
+			default:
+				return withStatus(exitUsage, errors.New(parameters[0]+" is no transfer, GET or PUT expected."))
+			}
+			queue.add(task)
+			return nil
+		},
+	})
+
+	commands.register(&command{
+		name: "START", args: "[parallel]", minArgs: 0, maxArgs: 1,
+		description: "Start the queued transfers in the background with parallel connections, one by default.",
+		handler: func(conn connection, parameters ...string) error {
+			parallel := 1
+			if len(parameters) == 1 {
+				var err error
+				if parallel, err = strconv.Atoi(parameters[0]); err != nil || parallel < 1 {
+					return withStatus(exitUsage, errors.New("The number of parallel connections has to be positive."))
+				}
+			}
+			return queue.start(conn, parallel, os.Stderr)
+		},
+	})
+
+	commands.register(&command{
+		name: "STATUS", minArgs: 0, maxArgs: 0,
+		description: "Show the progress of the queued transfers.",
+		handler: func(conn connection, parameters ...string) error {
+			queue.status(os.Stdout)
+			return nil
+		},
+	})
+}
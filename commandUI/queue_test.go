@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client/ftps"
+	"github.com/attenberger/ftps_qftp-client/ftps/ftptest"
+)
+
+func TestTransferQueue(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddDir("/incoming")
+	server.AddFile("/incoming/in.txt", []byte("retrieved"))
+	dir := t.TempDir()
+	if err = ioutil.WriteFile(filepath.Join(dir, "up.txt"), []byte("stored"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSession(protocolTCP, conn, func() {}, nil, &uiOptions{})
+	defer conn.Quit()
+	for _, line := range []string{"LOGIN anonymous anonymous",
+		"QUEUE GET /incoming/in.txt " + filepath.Join(dir, "in.txt"),
+		"QUEUE PUT " + filepath.Join(dir, "up.txt") + " /incoming/up.txt",
+		"QUEUE GET /incoming/in.txt " + filepath.Join(dir, "removed.txt")} {
+		if _, err = s.executeLine(line); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+	}
+	for _, line := range []string{"QUEUE MOVE a b", "CANCEL 4", "CANCEL"} {
+		if _, err = s.executeLine(line); err == nil {
+			t.Errorf("no error for %s", line)
+		}
+	}
+	if _, err = s.executeLine("CANCEL 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	s.queue.status(&out)
+	if !strings.Contains(out.String(), "  1  GET /incoming/in.txt") || strings.Contains(out.String(), "removed.txt") {
+		t.Errorf("got the status %q", out.String())
+	}
+
+	if _, err = s.executeLine("START 2"); err != nil {
+		t.Fatal(err)
+	}
+	s.queue.wait()
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "in.txt")); string(data) != "retrieved" {
+		t.Errorf("got %q in the retrieved file", data)
+	}
+	if data, _ := server.File("/incoming/up.txt"); string(data) != "stored" {
+		t.Errorf("got %q in the stored file", data)
+	}
+	out.Reset()
+	s.queue.status(&out)
+	if !strings.Contains(out.String(), "Last run: 2 of 2 transfers successful") {
+		t.Errorf("got the status %q after the run", out.String())
+	}
+	if _, err = s.executeLine("START"); err == nil {
+		t.Error("no error for START of the empty queue")
+	}
+}
@@ -0,0 +1,262 @@
+// Session of the userinterface, whose connection can be replaced by the one
+// to a bookmark with OPEN.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+// session contains the current connection and the commands of its protocol.
+type session struct {
+	protocol  string
+	conn      connection
+	closeConn func() // closes the QUIC session of conn
+	commands  *commandRegistry
+	bookmarks map[string]*bookmark
+	options   *uiOptions
+	mutex     sync.Mutex // held while a command or a keep-alive is executed
+	lastUse   time.Time  // end of the last command
+	server    *bookmark  // settings of the connection for RECONNECT, nil if unknown
+	user      string     // user of the last successful login, empty for none
+	password  string     // password of the last successful login
+	queue     *transferQueue
+}
+
+// uiOptions are the options of the userinterface, which are shared by the
+// commands.
+type uiOptions struct {
+	jsonOutput  bool // print the output of the commands and the errors as JSON
+	interactive bool // ask before destructive commands, toggled with PROMPT
+	color       bool // color listings and errors
+	// Limit for opening the connection and for the replies to commands, 0
+	// for the default of the connection and no limit of the commands
+	timeout   time.Duration
+	retries   int           // further attempts of transfers after transient errors
+	keepAlive time.Duration // interval of NOOP while the session is idle, 0 for none
+	// Bandwidth of the transfers by time of day, nil for no limit
+	rateSchedule *ftps_qftp_client.RateSchedule
+	// Shows the question and reads the answer of the user
+	ask func(question string) (string, error)
+	// Called after a successful LOGIN with the credentials, nil for none
+	loggedIn func(user string, password string)
+}
+
+// Asks the question in the interactive mode and reports whether the user
+// answered with yes. Without the interactive mode the question is confirmed.
+// A refusal is shown, so the command can return without a message.
+func (o *uiOptions) confirm(question string) (bool, error) {
+	if !o.interactive {
+		return true, nil
+	}
+	answer, err := o.ask(question + " [y/N] ")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	fmt.Fprintln(os.Stderr, "  Not confirmed, skipped.")
+	return false, nil
+}
+
+// Creates a task, which is retried and limited like set with -retries and
+// -rate.
+func (o *uiOptions) newTask(direction ftps_qftp_client.TransferDirction, localpath string,
+	remotepath string) ftps_qftp_client.TransferTask {
+	return o.configure(ftps_qftp_client.NewTransferTask(direction, localpath, remotepath))
+}
+
+// Sets the retries and the bandwidth of the options in the task.
+func (o *uiOptions) configure(task ftps_qftp_client.TransferTask) ftps_qftp_client.TransferTask {
+	task.MaxRetries = o.retries
+	task.RateSchedule = o.rateSchedule
+	return task
+}
+
+// Creates a session with the connection of the protocol.
+func newSession(protocol string, conn connection, closeConn func(), bookmarks map[string]*bookmark,
+	options *uiOptions) *session {
+	s := &session{bookmarks: bookmarks, options: options, queue: newTransferQueue()}
+	s.setConnection(protocol, conn, closeConn)
+	options.loggedIn = func(user string, password string) {
+		s.user = user
+		s.password = password
+	}
+	return s
+}
+
+// Records the settings of the connection and the credentials of its login
+// for RECONNECT.
+func (s *session) remember(settings *bookmark, password string) {
+	s.server = settings
+	s.user = settings.user
+	s.password = password
+}
+
+// Replaces the connection and generates the commands of its protocol.
+func (s *session) setConnection(protocol string, conn connection, closeConn func()) {
+	s.protocol = protocol
+	s.conn = conn
+	s.closeConn = closeConn
+	s.commands = generateCommandRegistry(protocol, s.options)
+	registerQueueCommands(s.commands, s.queue, s.options)
+	s.commands.register(&command{
+		name: "OPEN", args: "<bookmark>", minArgs: 1, maxArgs: 1,
+		description: "Quit the connection and connect to a bookmark of ~/" + configFileName + ".",
+		handler: func(conn connection, parameters ...string) error {
+			return s.open(parameters[0])
+		},
+	})
+	s.commands.register(&command{
+		name: "RECONNECT", minArgs: 0, maxArgs: 0,
+		description: "Connect again after the connection dropped, log in like before and change to the last remote directory.",
+		handler: func(conn connection, parameters ...string) error {
+			return s.reconnect()
+		},
+	})
+}
+
+// Connects to the bookmark with the name. The current connection is just
+// quit, if the new one could be opened.
+func (s *session) open(name string) error {
+	b, available := s.bookmarks[name]
+	if !available {
+		names := make([]string, 0, len(s.bookmarks))
+		for name := range s.bookmarks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return errors.New("Unknown bookmark " + name + ", ~/" + configFileName + " contains no bookmarks.")
+		}
+		return errors.New("Unknown bookmark " + name + ". Available: " + strings.Join(names, ", "))
+	}
+	settings := *b
+	if err := settings.complete(); err != nil {
+		return errors.New("The bookmark " + name + " is incomplete. " + err.Error())
+	}
+	password := ""
+	if settings.user != "" {
+		var err error
+		if password, err = lookupPassword(settings.user, ""); err != nil {
+			return err
+		}
+	}
+	conn, closeConn, err := connect(&settings, password, s.options.timeout)
+	if err != nil {
+		return err
+	}
+	s.conn.Quit()
+	s.closeConn()
+	s.setConnection(settings.protocol, conn, closeConn)
+	s.remember(&settings, password)
+	return nil
+}
+
+// Closes the current connection and opens a new one to the same server. The
+// user of the last login is logged in again and the remote directory of the
+// old connection is restored, if the client still knows it.
+func (s *session) reconnect() error {
+	if s.server == nil {
+		return errors.New("The server of the connection is unknown, use OPEN instead.")
+	}
+	settings := *s.server
+	settings.user = s.user
+	// The connection tracks its directory, so no PWD is sent on a dropped one
+	if dir, err := s.conn.AbsPath("."); err == nil {
+		settings.dir = dir
+	}
+	s.conn.Quit()
+	s.closeConn()
+
+	conn, closeConn, err := connect(&settings, s.password, s.options.timeout)
+	if err != nil {
+		// The old connection stays, so RECONNECT can be repeated
+		s.closeConn = func() {}
+		return err
+	}
+	s.setConnection(settings.protocol, conn, closeConn)
+	if settings.dir != "" {
+		fmt.Println("  Reconnected in " + settings.dir)
+	} else {
+		fmt.Println("  Reconnected.")
+	}
+	return nil
+}
+
+// Prints the error of a command, as JSON with -json.
+func (s *session) printError(err error) {
+	if s.options.jsonOutput {
+		printJSONError(err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, colorize(err.Error(), colorError, s.options.color))
+}
+
+// Sends a NOOP every interval, while no command was executed for the interval,
+// so the server does not close the idle connection. The returned function
+// stops the keep-alive. Errors are reported by the next command.
+func (s *session) keepAlive(interval time.Duration) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			s.mutex.Lock()
+			if time.Since(s.lastUse) >= interval {
+				s.conn.NoOp()
+				s.lastUse = time.Now()
+			}
+			s.mutex.Unlock()
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// Closes the QUIC session of the current connection.
+func (s *session) close() {
+	s.closeConn()
+}
+
+// Opens the connection to the server of the bookmark, logs in its user with
+// the password or the one of lookupPassword and changes to its directory.
+func connect(b *bookmark, password string, timeout time.Duration) (connection, func(), error) {
+	tlsConfig, err := newTLSConfig(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, closeConn, err := dial(b.protocol, b.host+":"+strconv.Itoa(b.port), tlsConfig, timeout)
+	if err != nil {
+		return nil, nil, withStatus(exitConnect, errors.New("Error opening connection to server: "+err.Error()))
+	}
+	conn.SetCommandTimeout(timeout)
+	err = conn.SetEncoding(b.encoding)
+	if err == nil && b.user != "" {
+		err = withStatus(exitLogin, login(conn, b.protocol, b.user, password))
+	}
+	if err == nil && b.dir != "" {
+		err = conn.ChangeDir(b.dir)
+	}
+	if err != nil {
+		conn.Quit()
+		closeConn()
+		return nil, nil, err
+	}
+	return conn, closeConn, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/ftps"
+	"github.com/attenberger/ftps_qftp-client/ftps/ftptest"
+)
+
+func TestConfirm(t *testing.T) {
+	var asked []string
+	answer := ""
+	options := &uiOptions{ask: func(question string) (string, error) {
+		asked = append(asked, question)
+		return answer, nil
+	}}
+
+	if confirmed, err := options.confirm("Delete?"); !confirmed || err != nil || len(asked) != 0 {
+		t.Errorf("got %v, %v and asked %q without the interactive mode", confirmed, err, asked)
+	}
+
+	options.interactive = true
+	for _, test := range []struct {
+		answer    string
+		confirmed bool
+	}{{"y", true}, {" Yes ", true}, {"", false}, {"n", false}, {"yess", false}} {
+		answer = test.answer
+		if confirmed, err := options.confirm("Delete?"); confirmed != test.confirmed || err != nil {
+			t.Errorf("got %v, %v for the answer %q", confirmed, err, test.answer)
+		}
+	}
+	if len(asked) != 5 || asked[0] != "Delete? [y/N] " {
+		t.Errorf("asked %q", asked)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Quit()
+
+	noops := make(chan string, 10)
+	conn.SetCommandLogger(func(line string) {
+		if line == "> NOOP" {
+			noops <- line
+		}
+	})
+	s := newSession(protocolTCP, conn, func() {}, nil, &uiOptions{})
+	stop := s.keepAlive(20 * time.Millisecond)
+	select {
+	case <-noops:
+	case <-time.After(5 * time.Second):
+		t.Error("no NOOP was sent while the session was idle")
+	}
+	stop()
+}
+
+func TestNewTask(t *testing.T) {
+	schedule := &ftps_qftp_client.RateSchedule{Default: 1024}
+	options := &uiOptions{retries: 3, rateSchedule: schedule}
+	task := options.newTask(ftps_qftp_client.Store, "a", "b")
+	if task.MaxRetries != 3 || task.RateSchedule != schedule || task.LocalPath != "a" || task.RemotePath != "b" {
+		t.Errorf("got %+v", task)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddDir("/incoming")
+	host, port, err := net.SplitHostPort(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, _ := strconv.Atoi(port)
+
+	conn, err := ftps.DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSession(protocolTCP, conn, func() {}, nil, &uiOptions{})
+	defer s.close()
+	if _, err = s.execute([]string{"RECONNECT"}); err == nil {
+		t.Error("no error for RECONNECT without a known server")
+	}
+
+	s.remember(&bookmark{protocol: protocolTCP, host: host, port: portNumber, cert: server.CertFile()}, "")
+	for _, line := range []string{"LOGIN anonymous anonymous", "CWD /incoming", "RECONNECT"} {
+		if _, err = s.executeLine(line); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+	}
+	if s.conn == connection(conn) {
+		t.Fatal("RECONNECT kept the old connection")
+	}
+	if dir, err := s.conn.AbsPath("."); err != nil || dir != "/incoming" {
+		t.Errorf("got the directory %q, %v after RECONNECT", dir, err)
+	}
+	if s.user != "anonymous" || s.password != "anonymous" {
+		t.Errorf("got the credentials %q, %q after RECONNECT", s.user, s.password)
+	}
+	if _, err = s.executeLine("LIST"); err != nil {
+		t.Errorf("LIST failed after RECONNECT: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Splitting of command lines into arguments like a shell. Arguments are
+// separated by whitespaces, which are kept in quotes or after a backslash:
+//
+//	RENAME "old name.txt" new\ name.txt
+//
+// In single quotes all characters are taken literally, in double quotes a
+// backslash escapes just a double quote or another backslash.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Splits the line into the command and its arguments.
+func splitCommandLine(line string) ([]string, error) {
+	commands, err := tokenize(line, false)
+	if err != nil || len(commands) == 0 {
+		return nil, err
+	}
+	return commands[0], nil
+}
+
+// Splits the commands of a script, which are separated by semicolons outside
+// of quotes. Empty commands are skipped.
+func splitScript(script string) ([][]string, error) {
+	return tokenize(script, true)
+}
+
+// Splits the input into arguments and, if separateCommands is set, into
+// commands at each semicolon.
+func tokenize(input string, separateCommands bool) ([][]string, error) {
+	var commands [][]string
+	var args []string
+	var current strings.Builder
+	inArgument := false // also true for empty quoted arguments
+	endArgument := func() {
+		if inArgument {
+			args = append(args, current.String())
+			current.Reset()
+			inArgument = false
+		}
+	}
+	endCommand := func() {
+		endArgument()
+		if len(args) > 0 {
+			commands = append(commands, args)
+			args = nil
+		}
+	}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, errors.New("The line ends with an escaping backslash.")
+			}
+			i++
+			current.WriteRune(runes[i])
+			inArgument = true
+		case r == '\'':
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, errors.New("The single quote is not closed.")
+			}
+			current.WriteString(string(runes[i+1 : end]))
+			inArgument = true
+			i = end
+		case r == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+				}
+				current.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, errors.New("The double quote is not closed.")
+			}
+			inArgument = true
+		case r == ';' && separateCommands:
+			endCommand()
+		case unicode.IsSpace(r):
+			endArgument()
+		default:
+			current.WriteRune(r)
+			inArgument = true
+		}
+	}
+	endCommand()
+	return commands, nil
+}
+
+// Returns the index of the first r in runes from the index from on, -1 if
+// there is none.
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
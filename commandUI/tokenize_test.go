@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{"", nil},
+		{"  PWD  ", []string{"PWD"}},
+		{"RENAME a  b", []string{"RENAME", "a", "b"}},
+		{`RENAME "old name.txt" new\ name.txt`, []string{"RENAME", "old name.txt", "new name.txt"}},
+		{`STOR 'a "b"' "c \"d\" \\ \e"`, []string{"STOR", `a "b"`, `c "d" \ \e`}},
+		{`MKD "" x''y`, []string{"MKD", "", "xy"}},
+		{"CWD a;b", []string{"CWD", "a;b"}},
+	}
+	for _, test := range tests {
+		args, err := splitCommandLine(test.line)
+		if err != nil || !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("got %q, %v for %q, expected %q", args, err, test.line, test.expected)
+		}
+	}
+
+	for _, invalid := range []string{`CWD "a`, "CWD 'a", `CWD a\`} {
+		if _, err := splitCommandLine(invalid); err == nil {
+			t.Errorf("no error for %q", invalid)
+		}
+	}
+}
+
+func TestSplitScript(t *testing.T) {
+	commands, err := splitScript(`LOGIN a b; ; MKD "x;y";QUIT`)
+	expected := [][]string{{"LOGIN", "a", "b"}, {"MKD", "x;y"}, {"QUIT"}}
+	if err != nil || !reflect.DeepEqual(commands, expected) {
+		t.Errorf("got %q, %v, expected %q", commands, err, expected)
+	}
+}
@@ -0,0 +1,90 @@
+// Trust of the server certificate. The certificate is checked with the
+// certificates of the system, unless a certificate file, a fingerprint or
+// the insecure mode is chosen.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// Returns the TLS configuration for the server of the settings. The insecure
+// mode takes precedence over the fingerprint and the fingerprint over the
+// certificate file. Only the insecure mode skips the verification.
+func newTLSConfig(settings *bookmark) (*tls.Config, error) {
+	switch {
+	case settings.insecure:
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	case settings.fingerprint != "":
+		fingerprint, err := parseFingerprint(settings.fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		return pinnedTLSConfig(fingerprint), nil
+	case settings.cert != "":
+		return certificateTLSConfig(settings.cert, settings.host)
+	}
+	return &tls.Config{ServerName: settings.host}, nil
+}
+
+// Returns a TLS configuration, which verifies the certificate of the server
+// with the certificates in the PEM file instead of the ones of the system,
+// including the name of the host.
+func certificateTLSConfig(certfile string, host string) (*tls.Config, error) {
+	certificates, err := ioutil.ReadFile(certfile)
+	if err != nil {
+		return nil, errors.New("Error while reading the certificate " + certfile + ". " + err.Error())
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(certificates) {
+		return nil, errors.New("The file " + certfile + " contains no certificate in PEM format.")
+	}
+	return &tls.Config{RootCAs: rootCAs, ServerName: host}, nil
+}
+
+// Parses a SHA-256 fingerprint in hexadecimal, whose bytes may be separated
+// by colons, e.g. "3F:A0:...".
+func parseFingerprint(text string) ([]byte, error) {
+	fingerprint, err := hex.DecodeString(strings.Replace(text, ":", "", -1))
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, errors.New("The fingerprint has to be the SHA-256 hash of the certificate as 64 hexadecimal digits.")
+	}
+	return fingerprint, nil
+}
+
+// Formats the SHA-256 fingerprint of the certificate like openssl, e.g.
+// "3F:A0:...".
+func formatFingerprint(certificate []byte) string {
+	sum := sha256.Sum256(certificate)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = strings.ToUpper(hex.EncodeToString([]byte{b}))
+	}
+	return strings.Join(parts, ":")
+}
+
+// Returns a TLS configuration, which just accepts the certificate of the
+// server with the SHA-256 fingerprint. The chain and the name are not checked.
+func pinnedTLSConfig(fingerprint []byte) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("The server sent no certificate.")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(sum[:], fingerprint) {
+				return errors.New("The fingerprint of the server certificate " + formatFingerprint(rawCerts[0]) +
+					" does not match.")
+			}
+			return nil
+		},
+	}
+}
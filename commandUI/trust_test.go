@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client/ftps"
+	"github.com/attenberger/ftps_qftp-client/ftps/ftptest"
+)
+
+func TestPinnedTLSConfig(t *testing.T) {
+	server, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	certificate, err := ioutil.ReadFile(server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certificate)
+	if block == nil {
+		t.Fatal("No certificate in " + server.CertFile())
+	}
+	fingerprint := formatFingerprint(block.Bytes)
+
+	authTLS := func(settings *bookmark) error {
+		tlsConfig, err := newTLSConfig(settings)
+		if err != nil {
+			return err
+		}
+		conn, err := ftps.DialTLSConfig(server.Addr(), 5*time.Second, tlsConfig)
+		if err != nil {
+			return err
+		}
+		defer conn.Quit()
+		return conn.AuthTLS()
+	}
+
+	if err = authTLS(&bookmark{fingerprint: fingerprint}); err != nil {
+		t.Errorf("The pinned certificate was refused: %v", err)
+	}
+	if err = authTLS(&bookmark{fingerprint: strings.ToLower(strings.Replace(fingerprint, ":", "", -1))}); err != nil {
+		t.Errorf("The fingerprint without colons was refused: %v", err)
+	}
+	other := "00" + fingerprint[2:]
+	if fingerprint[:2] == "00" {
+		other = "01" + fingerprint[2:]
+	}
+	if err = authTLS(&bookmark{fingerprint: other}); err == nil {
+		t.Error("Another certificate than the pinned one was accepted")
+	}
+	if err = authTLS(&bookmark{fingerprint: other, insecure: true}); err != nil {
+		t.Errorf("The certificate was refused in the insecure mode: %v", err)
+	}
+	if _, err = newTLSConfig(&bookmark{fingerprint: "3F:A0"}); err == nil {
+		t.Error("No error for a short fingerprint")
+	}
+
+	// The certificate file is a root of the verification, not a license for any certificate
+	if err = authTLS(&bookmark{cert: server.CertFile(), host: "127.0.0.1"}); err != nil {
+		t.Errorf("The certificate of the file was refused: %v", err)
+	}
+	if err = authTLS(&bookmark{cert: server.CertFile(), host: "ftp.example.com"}); err == nil {
+		t.Error("The certificate was accepted for another host")
+	}
+	otherServer, err := ftptest.NewServer("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherServer.Close()
+	if err = authTLS(&bookmark{cert: otherServer.CertFile(), host: "127.0.0.1"}); err == nil {
+		t.Error("A certificate not in the file was accepted")
+	}
+	if _, err = newTLSConfig(&bookmark{cert: fingerprint}); err == nil {
+		t.Error("No error for a missing certificate file")
+	}
+}
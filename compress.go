@@ -0,0 +1,24 @@
+// Contains the compression of stored files with gzip.
+
+package ftps_qftp_client
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// CompressGzip returns a reader of the data of r compressed with gzip, e.g.
+// to store it with Stor. The data is compressed in a goroutine, which stops
+// at the end of r or when the reader is closed.
+func CompressGzip(r io.Reader) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		compressor := gzip.NewWriter(writer)
+		_, err := io.Copy(compressor, r)
+		if err == nil {
+			err = compressor.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
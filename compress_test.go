@@ -0,0 +1,70 @@
+package ftps_qftp_client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGzipTransfer(t *testing.T) {
+	localDir := t.TempDir()
+	content := strings.Repeat("compressible line\n", 1000)
+	localPath := filepath.Join(localDir, "file.txt")
+	if err := ioutil.WriteFile(localPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := newMemoryServer()
+	conn := &memoryConn{server: server}
+
+	task := NewTransferTask(Store, localPath, "file.txt.gz")
+	task.Gzip = true
+	result := PerformTransferTask(conn, task)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	stored := server.files["file.txt.gz"]
+	if result.Bytes != int64(len(stored)) || len(stored) >= len(content) {
+		t.Errorf("stored %d compressed bytes of %d, result has %d", len(stored), len(content), result.Bytes)
+	}
+	decompressor, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(decompressor); err != nil || string(data) != content {
+		t.Errorf("stored file decompresses to %d bytes, %v", len(data), err)
+	}
+
+	retrieved := filepath.Join(localDir, "retrieved.txt")
+	task = NewTransferTask(Retrieve, retrieved, "file.txt.gz")
+	task.Gzip = true
+	if result = PerformTransferTask(conn, task); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Bytes != int64(len(stored)) {
+		t.Errorf("retrieved %d bytes, want the %d compressed ones", result.Bytes, len(stored))
+	}
+	if data, err := ioutil.ReadFile(retrieved); err != nil || string(data) != content {
+		t.Errorf("retrieved %d bytes, %v", len(data), err)
+	}
+}
+
+func TestGzipTransferErrors(t *testing.T) {
+	localDir := t.TempDir()
+	server := newMemoryServer()
+	server.files["plain.txt"] = []byte("not compressed")
+	conn := &memoryConn{server: server}
+
+	task := NewTransferTask(Retrieve, filepath.Join(localDir, "plain.txt"), "plain.txt")
+	task.Gzip = true
+	if result := PerformTransferTask(conn, task); result.Err == nil {
+		t.Error("uncompressed file decompressed")
+	}
+
+	task.Offset = 5
+	if result := PerformTransferTask(conn, task); result.Err == nil || !strings.Contains(result.Err.Error(), "resumed") {
+		t.Errorf("compressed transfer resumed: %v", result.Err)
+	}
+}
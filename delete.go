@@ -0,0 +1,41 @@
+// Contains the results of deleting several files at once.
+
+package ftps_qftp_client
+
+import "errors"
+
+// DeleteResult is the result of deleting a file with DeleteAll of the
+// connections.
+type DeleteResult struct {
+	Path string
+	Err  error // nil if the file was deleted
+}
+
+// DeleteResults contains the results of DeleteAll in the order of the paths.
+type DeleteResults []DeleteResult
+
+// Failed returns the paths of all files, which were not deleted.
+func (results DeleteResults) Failed() []string {
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result.Path)
+		}
+	}
+	return failed
+}
+
+// Err combines the errors of all files, which were not deleted. It returns
+// nil if all files were deleted.
+func (results DeleteResults) Err() error {
+	errorMessage := ""
+	for _, result := range results {
+		if result.Err != nil {
+			errorMessage = errorMessage + "\n" + result.Path + ": " + result.Err.Error()
+		}
+	}
+	if errorMessage == "" {
+		return nil
+	}
+	return errors.New(errorMessage)
+}
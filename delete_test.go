@@ -0,0 +1,19 @@
+package ftps_qftp_client
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeleteResults(t *testing.T) {
+	results := DeleteResults{{Path: "a"}, {Path: "b", Err: errors.New("550 No such file")}, {Path: "c"}}
+	if failed := results.Failed(); len(failed) != 1 || failed[0] != "b" {
+		t.Errorf("Failed() = %v", failed)
+	}
+	if err := results.Err(); err == nil || err.Error() != "\nb: 550 No such file" {
+		t.Errorf("Err() = %v", err)
+	}
+	if err := results[:1].Err(); err != nil {
+		t.Errorf("Err() without failures = %v", err)
+	}
+}
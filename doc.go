@@ -0,0 +1,21 @@
+// Package ftps_qftp_client contains the parts of the FTP client, which are
+// independent of the transport: the entries of directory listings and their
+// parsers, the interface implemented by the connections of both transports
+// and the scheduler for parallel transfers.
+//
+// The repository is organized in the following packages:
+//
+//	ftps_qftp_client  core protocol types and helpers (this package)
+//	ftps              FTP over TCP connections secured with TLS (FTPS)
+//	ftps/ftptest      in-process FTPS server for tests
+//	ftpq              FTP over the streams of a QUIC-connection (QUIC-FTP)
+//	ftpq/ftpqtest     in-memory QUIC-FTP server for tests
+//	commandUI         commandline client for FTPS and QUIC-FTP
+//	internal/...      implementation details shared by the transports
+//
+// The exported identifiers of ftps_qftp_client, ftps, ftptest, ftpq and
+// ftpqtest form the public API. The repository is not yet split into
+// versioned modules, so no compatibility between revisions is promised.
+// Everything below internal is not part of the API and may change at any
+// time, e.g. when the QUIC implementation is replaced.
+package ftps_qftp_client
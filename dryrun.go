@@ -0,0 +1,69 @@
+// Contains the dry run of transfers, which reports the operations of the
+// transfers without performing them.
+
+package ftps_qftp_client
+
+import (
+	"strconv"
+)
+
+// DryRunLogger receives the operations a dry run would perform, one per call,
+// e.g. "STOR /home/user/file.txt -> /incoming/file.txt".
+type DryRunLogger func(operation string)
+
+// Passes the operation to the logger, if one is set.
+func (logger DryRunLogger) log(operation string) {
+	if logger != nil {
+		logger(operation)
+	}
+}
+
+// Returns the operations performed for the task.
+func taskOperations(task TransferTask) []string {
+	var operations []string
+	var transfer string
+	switch task.Direction {
+	case Store:
+		transfer = "STOR " + task.LocalPath + " -> " + task.RemotePath
+	case Retrieve:
+		transfer = "RETR " + task.RemotePath + " -> " + task.LocalPath
+	default:
+		transfer = "Unknown direction " + strconv.Itoa(int(task.Direction)) + " " + task.LocalPath + " " + task.RemotePath
+	}
+	if task.Offset > 0 {
+		transfer += " from byte " + strconv.FormatInt(task.Offset, 10)
+	}
+	operations = append(operations, transfer)
+	if task.VerifyChecksum {
+		operations = append(operations, "Verify checksum of "+task.RemotePath)
+	}
+	if task.DeleteSourceAfterSuccess {
+		if task.Direction == Retrieve {
+			operations = append(operations, "DELE "+task.RemotePath)
+		} else {
+			operations = append(operations, "Delete local "+task.LocalPath)
+		}
+	}
+	return operations
+}
+
+// Reports the operations of the tasks to the DryRunLog of the scheduler
+// instead of performing them. Tasks completed according to the journal are
+// skipped. The OverwritePolicy is not applied, as it depends on the
+// destinations at the time of the transfer.
+func (s *TransferScheduler) dryRun(tasks []TransferTask) TransferResults {
+	results := make(TransferResults, len(tasks))
+	for i, task := range tasks {
+		results[i] = TransferResult{Task: task, Skipped: true, Destination: task.LocalPath}
+		if task.Direction == Store {
+			results[i].Destination = task.RemotePath
+		}
+		if s.Journal.Completed(task) {
+			continue
+		}
+		for _, operation := range taskOperations(task) {
+			s.DryRunLog.log(operation)
+		}
+	}
+	return results
+}
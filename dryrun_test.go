@@ -0,0 +1,71 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTransferSchedulerDryRun(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.dirs["/remote"] = true
+	server.files["/remote/a.txt"] = []byte("remote a")
+
+	upload := filepath.Join(localDir, "upload")
+	if err = os.MkdirAll(filepath.Join(upload, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(upload, "sub", "c.txt"), []byte("local c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	download := filepath.Join(localDir, "download")
+	moveTask := NewTransferTask(Retrieve, download, "/remote")
+	moveTask.DeleteSourceAfterSuccess = true
+	tasks := []TransferTask{moveTask, NewTransferTask(Store, upload, "/uploaded")}
+
+	var operations []string
+	scheduler := NewTransferScheduler(2, server.opener())
+	scheduler.ExpandDirectories = true
+	scheduler.DryRun = true
+	scheduler.DryRunLog = func(operation string) {
+		operations = append(operations, operation)
+	}
+	results := scheduler.Run(context.Background(), tasks)
+
+	if err = results.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if !result.Skipped {
+			t.Errorf("task %s not skipped", result.Task.LocalPath)
+		}
+	}
+	expected := []string{
+		"Create local directory " + download,
+		"MKD /uploaded",
+		"MKD /uploaded/sub",
+		"RETR /remote/a.txt -> " + filepath.Join(download, "a.txt"),
+		"DELE /remote/a.txt",
+		"STOR " + filepath.Join(upload, "sub", "c.txt") + " -> /uploaded/sub/c.txt",
+	}
+	if !reflect.DeepEqual(operations, expected) {
+		t.Errorf("operations %q, want %q", operations, expected)
+	}
+
+	if _, err = os.Stat(download); !os.IsNotExist(err) {
+		t.Error("local directory created by the dry run")
+	}
+	if len(server.files) != 1 || server.dirs["/uploaded"] {
+		t.Error("remote files changed by the dry run")
+	}
+}
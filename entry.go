@@ -2,8 +2,10 @@ package ftps_qftp_client
 
 import (
 	"errors"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,11 +20,17 @@ const (
 )
 
 // Entry describes a file and is returned by List().
+// The fields are only set, if the server lists them.
 type Entry struct {
-	Name string
-	Type EntryType
-	Size uint64
-	Time time.Time
+	Name   string
+	Type   EntryType
+	Size   uint64
+	Time   time.Time
+	Mode   os.FileMode // permission bits including setuid, setgid and sticky
+	Perm   string      // permissions of the user as perm fact of RFC 3659, e.g. "adfr"
+	Owner  string
+	Group  string
+	Target string // target of a link
 }
 
 func (e *Entry) SetSize(str string) (err error) {
@@ -30,9 +38,93 @@ func (e *Entry) SetSize(str string) (err error) {
 	return
 }
 
+// SetMode sets the Mode from the permissions of ls, e.g. "rwxr-sr-t".
+func (e *Entry) SetMode(str string) error {
+	if len(str) != 9 {
+		return errors.New("Invalid permission format")
+	}
+	var mode os.FileMode
+	for i, c := range str {
+		bit := os.FileMode(1) << uint(8-i)
+		switch {
+		case c == rune("rwxrwxrwx"[i]):
+			mode |= bit
+		case c == '-':
+		case i%3 == 2 && (c == 's' || c == 't'): // executable with special bit
+			mode |= bit | specialModeBit(i)
+		case i%3 == 2 && (c == 'S' || c == 'T'):
+			mode |= specialModeBit(i)
+		default:
+			return errors.New("Invalid permission format")
+		}
+	}
+	e.Mode = mode
+	return nil
+}
+
+// Returns the setuid, setgid or sticky bit for the execute position of ls.
+func specialModeBit(position int) os.FileMode {
+	switch position {
+	case 2:
+		return os.ModeSetuid
+	case 5:
+		return os.ModeSetgid
+	}
+	return os.ModeSticky
+}
+
+// Month names of non-English locales used by servers in LIST lines,
+// in lower case and without trailing dot.
+var (
+	monthNamesMutex sync.RWMutex
+	monthNames      = map[string]time.Month{
+		// German
+		"jän": time.January, "mär": time.March, "mrz": time.March, "mai": time.May,
+		"okt": time.October, "dez": time.December,
+		// French
+		"janv": time.January, "févr": time.February, "fév": time.February, "mars": time.March,
+		"avr": time.April, "juin": time.June, "juil": time.July, "août": time.August,
+		"déc": time.December,
+		// Spanish, Italian and Portuguese
+		"ene": time.January, "gen": time.January, "fev": time.February, "abr": time.April,
+		"mag": time.May, "giu": time.June, "lug": time.July, "ago": time.August,
+		"set": time.September, "ott": time.October, "out": time.October, "dic": time.December,
+		// Dutch
+		"mrt": time.March, "mei": time.May,
+	}
+)
+
+// RegisterMonthName adds the name of a month in a further locale, which is
+// accepted in LIST lines. The name is not case sensitive and a trailing dot is
+// ignored. It is safe for concurrent use.
+func RegisterMonthName(name string, month time.Month) {
+	monthNamesMutex.Lock()
+	defer monthNamesMutex.Unlock()
+	monthNames[strings.TrimSuffix(strings.ToLower(name), ".")] = month
+}
+
+// Returns the English abbreviation of the month with the name in any
+// registered locale, e.g. "Dec" for "déc.".
+func englishMonth(name string) string {
+	monthNamesMutex.RLock()
+	defer monthNamesMutex.RUnlock()
+	if month, available := monthNames[strings.TrimSuffix(strings.ToLower(name), ".")]; available {
+		return month.String()[:3]
+	}
+	return name
+}
+
+// Maximal difference between the time zones of client and server
+const maxZoneDifference = 26 * time.Hour
+
+// SetTime sets the Time from the month, day and year or time of the day of ls.
+// ls lists the time of the day instead of the year for files modified within
+// the last six months, for those the year is guessed. Times are regarded as UTC.
 func (e *Entry) SetTime(fields []string) (err error) {
+	fields = []string{englishMonth(fields[0]), fields[1], fields[2]}
 	var timeStr string
-	if strings.Contains(fields[2], ":") { // this year
+	recent := strings.Contains(fields[2], ":")
+	if recent { // this year
 		thisYear, _, _ := time.Now().Date()
 		timeStr = fields[1] + " " + fields[0] + " " + strconv.Itoa(thisYear)[2:4] + " " + fields[2] + " GMT"
 	} else { // not this year
@@ -42,5 +134,52 @@ func (e *Entry) SetTime(fields []string) (err error) {
 		timeStr = fields[1] + " " + fields[0] + " " + fields[2][2:4] + " 00:00 GMT"
 	}
 	e.Time, err = time.Parse("_2 Jan 06 15:04 MST", timeStr)
+	if err == nil && recent && e.Time.After(time.Now().Add(maxZoneDifference)) {
+		// Modified at the end of last year, e.g. a file of December listed in January
+		e.Time = e.Time.AddDate(-1, 0, 0)
+	}
 	return
 }
+
+// IsDir reports whether the entry is a directory.
+func (e *Entry) IsDir() bool {
+	return e.Type == EntryTypeFolder
+}
+
+// IsRegular reports whether the entry is a regular file.
+func (e *Entry) IsRegular() bool {
+	return e.Type == EntryTypeFile
+}
+
+// IsLink reports whether the entry is a link.
+func (e *Entry) IsLink() bool {
+	return e.Type == EntryTypeLink
+}
+
+// FileInfo returns an os.FileInfo describing the entry, e.g. to create headers
+// of archives with tar.FileInfoHeader. Its Sys method returns the entry.
+func (e *Entry) FileInfo() os.FileInfo {
+	return entryFileInfo{entry: e}
+}
+
+// Adapter from Entry to os.FileInfo
+type entryFileInfo struct {
+	entry *Entry
+}
+
+func (fi entryFileInfo) Name() string       { return fi.entry.Name }
+func (fi entryFileInfo) Size() int64        { return int64(fi.entry.Size) }
+func (fi entryFileInfo) ModTime() time.Time { return fi.entry.Time }
+func (fi entryFileInfo) IsDir() bool        { return fi.entry.IsDir() }
+func (fi entryFileInfo) Sys() interface{}   { return fi.entry }
+
+// Mode returns the permission bits of the entry together with its type.
+func (fi entryFileInfo) Mode() os.FileMode {
+	switch fi.entry.Type {
+	case EntryTypeFolder:
+		return fi.entry.Mode | os.ModeDir
+	case EntryTypeLink:
+		return fi.entry.Mode | os.ModeSymlink
+	}
+	return fi.entry.Mode
+}
@@ -0,0 +1,34 @@
+package ftps_qftp_client
+
+import (
+	"archive/tar"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEntryFileInfo(t *testing.T) {
+	modified := time.Date(2015, time.August, 13, 17, 52, 50, 0, time.UTC)
+	entry := &Entry{Name: "pub", Type: EntryTypeFolder, Time: modified, Mode: 0755}
+	info := entry.FileInfo()
+	if !info.IsDir() || info.Mode() != os.ModeDir|0755 || info.Name() != "pub" || !info.ModTime().Equal(modified) {
+		t.Errorf("FileInfo of %+v: dir %v, mode %v, name %s, time %v", entry, info.IsDir(), info.Mode(), info.Name(), info.ModTime())
+	}
+	if info.Sys() != entry {
+		t.Error("Sys() does not return the entry")
+	}
+
+	link := &Entry{Name: "bin", Type: EntryTypeLink, Mode: 0777, Target: "usr/bin"}
+	header, err := tar.FileInfoHeader(link.FileInfo(), link.Target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Typeflag != tar.TypeSymlink || header.Linkname != "usr/bin" || header.Name != "bin" {
+		t.Errorf("tar header of link = %+v", header)
+	}
+
+	file := &Entry{Name: "welcome.msg", Type: EntryTypeFile, Size: 951}
+	if !file.IsRegular() || file.IsDir() || file.IsLink() || file.FileInfo().Size() != 951 {
+		t.Errorf("helpers of %+v return wrong values", file)
+	}
+}
@@ -0,0 +1,65 @@
+// Contains the classification of errors returned by the connections.
+
+package ftps_qftp_client
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+)
+
+// ErrServiceClosing is returned by all calls on a connection, after the server
+// replied with 421 or closed the control connection unexpectedly. The
+// connection is unusable, a new one has to be opened.
+var ErrServiceClosing = errors.New("Service not available, the server closed the control connection.")
+
+// ErrBusy is returned, if a command is sent on a connection, which still waits
+// for the replies to a command of another goroutine or for the end of a
+// transfer, e.g. the reader returned by Retr is not yet closed. A connection
+// or a subconnection must not be used by several goroutines at the same time.
+var ErrBusy = errors.New("The connection is busy with another command.")
+
+// Reports whether the error is a reply with 550, with which servers refuse
+// commands for files and directories not existing.
+func isNotFound(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code == StatusFileUnavailable
+}
+
+// Reports whether the error is a reply, with which servers refuse commands
+// they do not implement.
+func isNotImplemented(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && (protoErr.Code == StatusBadCommand || protoErr.Code == StatusNotImplemented ||
+		protoErr.Code == StatusNotImplementedParameter)
+}
+
+// IsTransientError reports whether the operation failed with an error, which
+// may not occur again if the operation is retried: replies with a 4xx code,
+// timeouts, reset streams, connections closed unexpectedly (ErrServiceClosing)
+// and transfers failed with ErrChecksumMismatch.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return IsTransient(protoErr.Code)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// Streams reset by the peer (e.g. QUIC stream errors)
+	var canceledErr interface{ Canceled() bool }
+	if errors.As(err, &canceledErr) && canceledErr.Canceled() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.Is(err, ErrChecksumMismatch) ||
+		errors.Is(err, ErrServiceClosing)
+}
@@ -0,0 +1,196 @@
+// Contains the expansion of transfer tasks for directories into tasks for
+// all files in the directory trees.
+
+package ftps_qftp_client
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandDirectoryTasks replaces each task, whose source is a directory, by tasks
+// for all files in the directory tree. The source of store tasks is walked
+// locally, the one of retrieve tasks remotely on the connection. The
+// directories of the trees are created at the destination, existing ones are
+// kept. The expanded tasks keep the options of the directory task except
+// its Offset.
+func ExpandDirectoryTasks(conn ConnectionI, tasks []TransferTask) ([]TransferTask, error) {
+	return expandDirectoryTasks(conn, tasks, false, nil)
+}
+
+// DownloadDir retrieves the remote directory tree into the local directory on
+// the connection, one file after the other. The directories are created like
+// by ExpandDirectoryTasks, a remote path, which is no directory, is retrieved
+// as a single file. It returns a result for each file, the error is the one
+// of listing the tree. For parallel connections a TransferScheduler with
+// ExpandDirectories can be used instead.
+func DownloadDir(conn ConnectionI, remoteDir string, localDir string) (TransferResults, error) {
+	return transferDir(conn, NewTransferTask(Retrieve, localDir, remoteDir))
+}
+
+// UploadDir stores the local directory tree in the remote directory on the
+// connection like DownloadDir.
+func UploadDir(conn ConnectionI, localDir string, remoteDir string) (TransferResults, error) {
+	return transferDir(conn, NewTransferTask(Store, localDir, remoteDir))
+}
+
+// Expands the task for a directory and performs the tasks of its files.
+func transferDir(conn ConnectionI, task TransferTask) (TransferResults, error) {
+	tasks, err := ExpandDirectoryTasks(conn, []TransferTask{task})
+	if err != nil {
+		return nil, err
+	}
+	results := make(TransferResults, len(tasks))
+	for i, fileTask := range tasks {
+		results[i] = PerformTransferTask(conn, fileTask)
+	}
+	return results, nil
+}
+
+// Expands the tasks like ExpandDirectoryTasks. With dryRun the directories
+// are not created, but passed to the logger.
+func expandDirectoryTasks(conn ConnectionI, tasks []TransferTask, dryRun bool, logger DryRunLogger) ([]TransferTask, error) {
+	expanded := make([]TransferTask, 0, len(tasks))
+	for _, task := range tasks {
+		var err error
+		switch task.Direction {
+		case Store:
+			expanded, err = expandStoreTask(conn, task, expanded, dryRun, logger)
+		case Retrieve:
+			expanded, err = expandRetrieveTask(conn, task, expanded, dryRun, logger)
+		default:
+			expanded = append(expanded, task)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// Appends the tasks to store the local directory tree of the task or the task
+// itself, if its local path is no directory.
+func expandStoreTask(conn ConnectionI, task TransferTask, expanded []TransferTask, dryRun bool, logger DryRunLogger) ([]TransferTask, error) {
+	info, err := os.Stat(task.LocalPath)
+	if err != nil || !info.IsDir() {
+		// Errors are reported by the transfer of the task
+		return append(expanded, task), nil
+	}
+
+	err = filepath.Walk(task.LocalPath, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(task.LocalPath, localPath)
+		if err != nil {
+			return err
+		}
+		remotePath := path.Join(task.RemotePath, filepath.ToSlash(relativePath))
+		if info.IsDir() {
+			if dryRun {
+				logger.log("MKD " + remotePath)
+				return nil
+			}
+			// The directory may already exist, then storing its files shows
+			// whether it is usable. Missing parents are created for the root.
+			if relativePath == "." {
+				MkdirAll(conn, remotePath)
+			} else {
+				conn.MakeDir(remotePath)
+			}
+			return nil
+		}
+		fileTask := task
+		fileTask.LocalPath = localPath
+		fileTask.RemotePath = remotePath
+		fileTask.Size = info.Size()
+		fileTask.Offset = 0
+		expanded = append(expanded, fileTask)
+		return nil
+	})
+	return expanded, err
+}
+
+// Appends the tasks to retrieve the remote directory tree of the task or the
+// task itself, if its remote path is no directory.
+func expandRetrieveTask(conn ConnectionI, task TransferTask, expanded []TransferTask, dryRun bool, logger DryRunLogger) ([]TransferTask, error) {
+	isDir, err := isRemoteDir(conn, task.RemotePath)
+	if err != nil {
+		return nil, err
+	}
+	if !isDir {
+		return append(expanded, task), nil
+	}
+
+	err = makeLocalDir(task.LocalPath, dryRun, logger)
+	if err != nil {
+		return nil, err
+	}
+	err = Walk(conn, task.RemotePath, func(remotePath string, entry *Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath := relativeRemotePath(task.RemotePath, remotePath)
+		localPath := filepath.Join(task.LocalPath, filepath.FromSlash(relativePath))
+		switch entry.Type {
+		case EntryTypeFolder:
+			return makeLocalDir(localPath, dryRun, logger)
+		case EntryTypeFile:
+			fileTask := task
+			fileTask.LocalPath = localPath
+			fileTask.RemotePath = remotePath
+			fileTask.Size = int64(entry.Size)
+			fileTask.Offset = 0
+			expanded = append(expanded, fileTask)
+		}
+		return nil
+	})
+	return expanded, err
+}
+
+// Returns the path of remotePath relative to the remote directory root, of
+// which it is a part. Paths below "." are joined without a prefix, so the
+// relative path of "a.txt" below "." is "a.txt".
+func relativeRemotePath(root, remotePath string) string {
+	root = path.Clean(root)
+	remotePath = path.Clean(remotePath)
+	if remotePath == root {
+		return "."
+	}
+	if root == "." {
+		return remotePath
+	}
+	if root != "/" {
+		root += "/"
+	}
+	return strings.TrimPrefix(remotePath, root)
+}
+
+// Checks whether the remote path is a directory by changing into it.
+// The current directory of the connection is kept. A refusal with 550 means
+// no directory, other errors are returned.
+func isRemoteDir(conn ConnectionI, remotePath string) (bool, error) {
+	currentDir, err := conn.CurrentDir()
+	if err != nil {
+		return false, err
+	}
+	if err = conn.ChangeDir(remotePath); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, conn.ChangeDir(currentDir)
+}
+
+// Creates the local directory and its parents. With dryRun it is passed to the
+// logger instead.
+func makeLocalDir(localPath string, dryRun bool, logger DryRunLogger) error {
+	if dryRun {
+		logger.log("Create local directory " + localPath)
+		return nil
+	}
+	return os.MkdirAll(localPath, 0755)
+}
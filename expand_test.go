@@ -0,0 +1,148 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransferSchedulerExpandDirectories(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.dirs["/remote"] = true
+	server.dirs["/remote/sub"] = true
+	server.files["/remote/a.txt"] = []byte("remote a")
+	server.files["/remote/sub/b.txt"] = []byte("remote b")
+
+	upload := filepath.Join(localDir, "upload")
+	if err = os.MkdirAll(filepath.Join(upload, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(upload, "sub", "c.txt"), []byte("local c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []TransferTask{
+		NewTransferTask(Retrieve, filepath.Join(localDir, "download"), "/remote"),
+		NewTransferTask(Store, upload, "/uploaded"),
+	}
+	scheduler := NewTransferScheduler(2, server.opener())
+	scheduler.ExpandDirectories = true
+	results := scheduler.Run(context.Background(), tasks)
+
+	if err = results.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("Run returned %d results, want one for each of the 3 files", len(results))
+	}
+	data, err := ioutil.ReadFile(filepath.Join(localDir, "download", "sub", "b.txt"))
+	if err != nil || string(data) != "remote b" {
+		t.Errorf("retrieved %q, %v", data, err)
+	}
+	if !server.dirs["/uploaded/sub"] {
+		t.Error("remote directory /uploaded/sub not created")
+	}
+	if string(server.files["/uploaded/sub/c.txt"]) != "local c" {
+		t.Errorf("stored %q", server.files["/uploaded/sub/c.txt"])
+	}
+}
+
+func TestExpandDirectoryTasksCurrentDir(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.dirs["."] = true
+	server.dirs["sub"] = true
+	server.files["alpha.txt"] = []byte("alpha")
+	server.files["sub/beta.txt"] = []byte("beta")
+
+	conn, _ := server.opener()()
+	tasks, err := ExpandDirectoryTasks(conn, []TransferTask{NewTransferTask(Retrieve, localDir, ".")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"alpha.txt":    filepath.Join(localDir, "alpha.txt"),
+		"sub/beta.txt": filepath.Join(localDir, "sub", "beta.txt"),
+	}
+	if len(tasks) != len(want) {
+		t.Fatalf("expanded to %d tasks, want %d", len(tasks), len(want))
+	}
+	for _, task := range tasks {
+		if task.LocalPath != want[task.RemotePath] {
+			t.Errorf("%s is retrieved to %s, want %s", task.RemotePath, task.LocalPath, want[task.RemotePath])
+		}
+	}
+}
+
+func TestRelativeRemotePath(t *testing.T) {
+	tests := []struct{ root, remotePath, want string }{
+		{".", "alpha.txt", "alpha.txt"},
+		{".", "sub/beta.txt", "sub/beta.txt"},
+		{"/", "/alpha.txt", "alpha.txt"},
+		{"/remote/", "/remote/sub/a.txt", "sub/a.txt"},
+		{"remote", "remote", "."},
+	}
+	for _, test := range tests {
+		if got := relativeRemotePath(test.root, test.remotePath); got != test.want {
+			t.Errorf("relativeRemotePath(%q, %q) = %q, want %q", test.root, test.remotePath, got, test.want)
+		}
+	}
+}
+
+func TestDownloadUploadDir(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.dirs["/remote"] = true
+	server.dirs["/remote/sub"] = true
+	server.files["/remote/a.txt"] = []byte("remote a")
+	server.files["/remote/sub/b.txt"] = []byte("remote b")
+	conn, _ := server.opener()()
+
+	download := filepath.Join(localDir, "download")
+	results, err := DownloadDir(conn, "/remote", download)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results.Err() != nil {
+		t.Fatalf("DownloadDir returned %v", results)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(download, "sub", "b.txt"))
+	if err != nil || string(data) != "remote b" {
+		t.Errorf("Retrieved %q, %v", data, err)
+	}
+
+	results, err = UploadDir(conn, download, "/copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results.Err() != nil {
+		t.Fatalf("UploadDir returned %v", results)
+	}
+	if string(server.files["/copy/sub/b.txt"]) != "remote b" || !server.dirs["/copy/sub"] {
+		t.Errorf("Stored the files %v", server.files)
+	}
+
+	// A missing directory is retrieved like a file, which fails
+	results, err = DownloadDir(conn, "/missing", filepath.Join(localDir, "missing"))
+	if err != nil || len(results.Failed()) != 1 {
+		t.Errorf("DownloadDir of a missing directory returned %v, %v", results, err)
+	}
+}
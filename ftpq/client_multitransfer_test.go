@@ -1,15 +1,10 @@
-// You need a FTPS-Server running to run the test.
-// The FTPS-Server must accept connections on the
-// IPv4 and IPv6 address.
-// Replace the constants according your FTPS-Server.
-// (The most relevant are in client_test.go.)
-// The root directory of your FTPS-Server must contain
-// the directory "incoming".
+// The tests run against the server of newTestServer in client_test.go.
 
-package ftpq
+package ftpq_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -18,7 +13,10 @@ import (
 	"strconv"
 	"strings"
 	"testing"
-	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/ftpq"
+	"github.com/attenberger/ftps_qftp-client/ftpq/ftpqtest"
 )
 
 const (
@@ -41,21 +39,18 @@ func TestMultiTransfer(t *testing.T) {
 }
 
 func testMultiTransfer(t *testing.T, nrParallelConnections int) {
-	if testing.Short() {
-		t.Skip("skipping test in short mode.")
-	}
+	server := newTestServer()
+	defer server.Close()
 
-	err := prepareTestdata()
+	err := prepareTestdata(server)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
 	finishedChan := make(chan error)
 
-	c, err := DialTimeout(serverIPv4+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
-	if err != nil {
-		t.Error(err)
-	}
+	c := server.Dial()
+	defer c.Close()
 
 	currentSub, _, err := c.GetNewSubConn()
 	if err != nil {
@@ -88,18 +83,55 @@ func testMultiTransfer(t *testing.T, nrParallelConnections int) {
 		}
 	}
 
-	err = checkResult()
+	err = checkResult(server)
 	if err != nil {
 		t.Error(err)
 	}
 }
 
-func prepareTestdata() error {
+// The subconnections of MultipleTransfer are logged in like the one of the
+// test and start in its current directory.
+func TestMultipleTransfer(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
 
-	c, err := DialTimeout(serverIPv4+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
+	err := prepareTestdata(server)
 	if err != nil {
-		return err
+		t.Fatal(err)
+	}
+
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+	err = subC.ChangeDir(remoteTestDirectory)
+	if err != nil {
+		t.Error(err)
+	}
+
+	tasks := make([]ftps_qftp_client.TransferTask, 0)
+	for _, filenumber := range initialLocalFileNumbers {
+		tasks = append(tasks, ftps_qftp_client.NewTransferTask(ftps_qftp_client.Store, strconv.Itoa(filenumber)+".txt", strconv.Itoa(filenumber)+".txt"))
+	}
+	for _, filenumber := range initialRemoteFileNumbers {
+		tasks = append(tasks, ftps_qftp_client.NewTransferTask(ftps_qftp_client.Retrieve, strconv.Itoa(filenumber)+".txt", strconv.Itoa(filenumber)+".txt"))
+	}
+	results, err := subC.MultipleTransfer(context.Background(), tasks, 4)
+	if err != nil {
+		t.Error(err)
+	} else if err = results.Err(); err != nil {
+		t.Error(err)
+	}
+	subC.Quit()
+
+	err = checkResult(server)
+	if err != nil {
+		t.Error(err)
 	}
+}
+
+func prepareTestdata(server *ftpqtest.Server) error {
+
+	c := server.Dial()
+	defer c.Close()
 	subC, _, err := c.GetNewSubConn()
 	if err != nil {
 		return err
@@ -124,7 +156,7 @@ func prepareTestdata() error {
 		return errors.New("The local test directory already exists.")
 	}
 
-	err = os.Mkdir(localTestDirectory, os.ModeDir)
+	err = os.Mkdir(localTestDirectory, 0755)
 	if err != nil {
 		return errors.New("The local test directory can not be created. " + err.Error())
 	}
@@ -164,7 +196,7 @@ func prepareTestdata() error {
 	return nil
 }
 
-func multipleTransfer(subC *ServerSubConn, store bool, fileNrs []int, result chan error) {
+func multipleTransfer(subC *ftpq.ServerSubConn, store bool, fileNrs []int, result chan error) {
 
 	err := subC.Login(username, password)
 	if err != nil {
@@ -213,12 +245,10 @@ func multipleTransfer(subC *ServerSubConn, store bool, fileNrs []int, result cha
 	result <- nil
 }
 
-func checkResult() error {
+func checkResult(server *ftpqtest.Server) error {
 
-	c, err := DialTimeout(serverIPv4+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
-	if err != nil {
-		return err
-	}
+	c := server.Dial()
+	defer c.Close()
 
 	subC, _, err := c.GetNewSubConn()
 	if err != nil {
@@ -0,0 +1,157 @@
+// The tests run against the server of newTestServer in client_test.go.
+
+package ftpq_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+func TestServiceClosing(t *testing.T) {
+	server := newTestServer()
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+
+	server.Close()
+	err := subC.NoOp()
+	if !errors.Is(err, ftps_qftp_client.ErrServiceClosing) {
+		t.Fatalf("NoOp returned %v, want ErrServiceClosing", err)
+	}
+	// Following calls fail without sending the command
+	if _, err = subC.CurrentDir(); !errors.Is(err, ftps_qftp_client.ErrServiceClosing) {
+		t.Errorf("CurrentDir returned %v, want ErrServiceClosing", err)
+	}
+}
+
+func TestBusy(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.AddFile("/incoming/test", []byte(testData))
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+
+	// The reply to RETR is awaited, till the reader is closed
+	r, err := subC.Retr("/incoming/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = subC.NoOp(); !errors.Is(err, ftps_qftp_client.ErrBusy) {
+		t.Errorf("NoOp during a transfer returned %v, want ErrBusy", err)
+	}
+	if err = r.Close(); err != nil {
+		t.Error(err)
+	}
+	if err = subC.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCommandLogger(t *testing.T) {
+	const secret = "s3cr3t"
+	server := newTestServer()
+	defer server.Close()
+	c := server.Dial()
+	defer c.Close()
+	subC, _, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	subC.SetCommandLogger(func(line string) {
+		lines = append(lines, line)
+	})
+	err = subC.Login(username, secret)
+	if err == nil || strings.Contains(err.Error(), secret) {
+		t.Errorf("Login with a wrong password returned %v", err)
+	}
+	if len(lines) != 4 || lines[0] != "> USER "+username || !strings.HasPrefix(lines[2], "> PASS ") {
+		t.Errorf("Logged %q", lines)
+	}
+	for _, line := range lines {
+		if strings.Contains(line, secret) {
+			t.Errorf("The password is logged in %q", line)
+		}
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+	before := subC.CommandStats().Commands
+
+	response, err := subC.SendCommand("FEAT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != 211 || len(response.Lines) != 6 || response.Body()[0] != "MULTIPLEX" {
+		t.Errorf("Unexpected response %+v", response)
+	}
+	if response, err = subC.SendCommand("SITE HELP"); err != nil || response.Code != 502 {
+		t.Errorf("Unsupported command replied %+v, %v", response, err)
+	}
+	if stats := subC.CommandStats(); stats.Commands != before+2 || stats.MaxTime < stats.LastTime {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestAbsPath(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+
+	pwd := 0
+	subC.SetCommandLogger(func(line string) {
+		if line == "> PWD" {
+			pwd++
+		}
+	})
+	if err := subC.ChangeDir("incoming"); err != nil {
+		t.Fatal(err)
+	}
+	for relative, expected := range map[string]string{
+		".":             "/incoming",
+		"a/../b.txt":    "/incoming/b.txt",
+		"..":            "/",
+		"/pub//a.txt":   "/pub/a.txt",
+		"mydir/sub/../": "/incoming/mydir",
+	} {
+		if abs, err := subC.AbsPath(relative); err != nil || abs != expected {
+			t.Errorf("AbsPath(%q) returned %q, %v, expected %q", relative, abs, err, expected)
+		}
+	}
+	if err := subC.ChangeDirToParent(); err != nil {
+		t.Error(err)
+	}
+	if abs, err := subC.AbsPath("incoming"); err != nil || abs != "/incoming" {
+		t.Errorf("AbsPath after CDUP returned %q, %v", abs, err)
+	}
+	if pwd > 1 {
+		t.Errorf("PWD was sent %d times", pwd)
+	}
+}
+
+// The server announces neither SITE CHMOD nor AVBL and supports no SITE QUOTA.
+func TestUnsupportedSiteCommands(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+
+	if err := subC.Chmod("/incoming", 0755|os.ModeDir); err == nil {
+		t.Error("Chmod succeeded although SITE CHMOD is not announced")
+	}
+	if space, err := subC.AvailableSpace("/incoming"); err == nil {
+		t.Errorf("AvailableSpace returned %d without AVBL and SITE QUOTA", space)
+	}
+	if err := subC.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,11 +1,10 @@
-// You need a FTPS-Server running to run the test.
-// The FTPS-Server must accept connections on the
-// IPv4 and IPv6 address.
-// Replace the constants according your FTPS-Server.
-// The root directory of your FTPS-Server must contain
-// the directory "incoming".
+// Most tests run against the in-memory server of the package ftpqtest. As
+// ftpqtest uses this package, they are in the package ftpq_test.
+// Just TestConnIPv6 and TestConnect need a QUIC-FTP-Server running, which
+// accepts connections on the IPv4 and IPv6 address. Replace the constants
+// according your QUIC-FTP-Server.
 
-package ftpq
+package ftpq_test
 
 import (
 	"bytes"
@@ -14,6 +13,9 @@ import (
 	"strconv"
 	"testing"
 	"time"
+
+	"github.com/attenberger/ftps_qftp-client/ftpq"
+	"github.com/attenberger/ftps_qftp-client/ftpq/ftpqtest"
 )
 
 // Replace them with your specific data.
@@ -28,15 +30,35 @@ const (
 	password          = "anonymous"
 )
 
-func TestConn(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping test in short mode.")
-	}
+// Starts an in-memory server, whose root directory contains the directory
+// "incoming". It must be closed after the test.
+func newTestServer() *ftpqtest.Server {
+	server := ftpqtest.NewServer(username, password)
+	server.AddDir("/incoming")
+	return server
+}
 
-	c, err := DialTimeout(serverIPv4+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
+// Connects a subconnection to the server and logs in.
+func newTestSubConn(t *testing.T, server *ftpqtest.Server) (*ftpq.ServerConn, *ftpq.ServerSubConn) {
+	c := server.Dial()
+	subC, _, err := c.GetNewSubConn()
 	if err != nil {
+		c.Close()
 		t.Fatal(err)
 	}
+	if err = subC.Login(username, password); err != nil {
+		c.Close()
+		t.Fatal(err)
+	}
+	return c, subC
+}
+
+func TestConn(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	c := server.Dial()
+	defer c.Close()
 	subC, _, err := c.GetNewSubConn()
 	if err != nil {
 		t.Fatal(err)
@@ -157,7 +179,7 @@ func TestConnIPv6(t *testing.T) {
 		t.Skip("skipping test in short mode.")
 	}
 
-	c, err := DialTimeout(serverIPv6+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
+	c, err := ftpq.DialTimeout(serverIPv6+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -180,7 +202,7 @@ func TestConnIPv6(t *testing.T) {
 	err = subC.Logout()
 	if err != nil {
 		if protoErr := err.(*textproto.Error); protoErr != nil {
-			if protoErr.Code != StatusNotImplemented {
+			if protoErr.Code != ftpq.StatusNotImplemented {
 				t.Error(err)
 			}
 		} else {
@@ -197,7 +219,7 @@ func TestConnect(t *testing.T) {
 		t.Skip("skipping test in short mode.")
 	}
 
-	c, err := Connect(serverIPv4+":"+strconv.Itoa(servercontrolport), serverCertificate)
+	c, err := ftpq.Connect(serverIPv4+":"+strconv.Itoa(servercontrolport), serverCertificate)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -214,7 +236,7 @@ func TestTimeout(t *testing.T) {
 		t.Skip("skipping test in short mode.")
 	}
 
-	c, err := DialTimeout(serverIPv4+":94286", 1*time.Second, serverCertificate)
+	c, err := ftpq.DialTimeout(serverIPv4+":94286", 1*time.Second, serverCertificate)
 	if err == nil {
 		t.Fatal("expected timeout, got nil error")
 		subC, _, err := c.GetNewSubConn()
@@ -226,14 +248,11 @@ func TestTimeout(t *testing.T) {
 }
 
 func TestWrongLogin(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping test in short mode.")
-	}
+	server := newTestServer()
+	defer server.Close()
 
-	c, err := DialTimeout(serverIPv4+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
-	if err != nil {
-		t.Fatal(err)
-	}
+	c := server.Dial()
+	defer c.Close()
 	subC, _, err := c.GetNewSubConn()
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,180 @@
+// The tests run against the server of newTestServer in client_test.go.
+
+package ftpq_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+func TestTransferTypeASCII(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.AddFile("/incoming/dos.txt", []byte("line 1\r\nline 2\r\n"))
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+
+	if err := subC.SetTransferType(ftps_qftp_client.ASCII); err != nil {
+		t.Fatal(err)
+	}
+	r, err := subC.Retr("/incoming/dos.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "line 1\nline 2\n" {
+		t.Errorf("Retrieved %q, %v", data, err)
+	}
+	if err = subC.Stor("/incoming/unix.txt", strings.NewReader("a\nb\n")); err != nil {
+		t.Error(err)
+	}
+	if data, _ := server.File("/incoming/unix.txt"); string(data) != "a\r\nb\r\n" {
+		t.Errorf("Stored %q in ASCII mode", data)
+	}
+
+	if err = subC.SetTransferType(ftps_qftp_client.Binary); err != nil {
+		t.Fatal(err)
+	}
+	if err = subC.Stor("/incoming/binary.txt", strings.NewReader("a\nb\n")); err != nil {
+		t.Error(err)
+	}
+	if data, _ := server.File("/incoming/binary.txt"); string(data) != "a\nb\n" {
+		t.Errorf("Stored %q in binary mode", data)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	// "ä" in ISO 8859-1
+	server.AddFile("/incoming/\xe4.txt", []byte(testData))
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+
+	if err := subC.SetEncoding("iso-8859-1"); err != nil {
+		t.Fatal(err)
+	}
+	names, err := subC.NameList("/incoming")
+	if err != nil || len(names) != 1 || names[0] != "ä.txt" {
+		t.Errorf("NameList returned %q, %v", names, err)
+	}
+	if err = subC.Stor("/incoming/ö.txt", strings.NewReader(testData)); err != nil {
+		t.Error(err)
+	}
+	if _, stored := server.File("/incoming/\xf6.txt"); !stored {
+		t.Error("The path was not converted to ISO 8859-1")
+	}
+	if err = subC.SetEncoding("no-such-encoding"); err == nil {
+		t.Error("No error for an unknown encoding")
+	}
+}
+
+func TestReceiveProgress(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.AddFile("/incoming/test", []byte(testData))
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+	subC.SetRetrSize(true)
+
+	r, err := subC.Retr("/incoming/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := r.(ftps_qftp_client.SizedReader).Size(); size != int64(len(testData)) {
+		t.Errorf("Size returned %d", size)
+	}
+	if _, err = io.ReadFull(r, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	progress := r.(ftps_qftp_client.ReceiveProgress)
+	if progress.BytesReceived() != 4 || progress.ReceiveState() != ftps_qftp_client.ReceiveReset {
+		t.Errorf("Closed reader received %d bytes, state %d", progress.BytesReceived(), progress.ReceiveState())
+	}
+
+	// Resumed at the offset of the bytes received
+	r, err = subC.RetrFrom("/incoming/test", uint64(progress.BytesReceived()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, implemented := r.(io.WriterTo); !implemented {
+		t.Error("The reader does not implement io.WriterTo")
+	}
+	var buf bytes.Buffer
+	if _, err = io.Copy(&buf, r); err != nil || buf.String() != testData[4:] {
+		t.Errorf("Retrieved %q, %v", buf.String(), err)
+	}
+	if err = r.Close(); err != nil {
+		t.Error(err)
+	}
+	progress = r.(ftps_qftp_client.ReceiveProgress)
+	if progress.BytesReceived() != int64(len(testData)-4) || progress.ReceiveState() != ftps_qftp_client.ReceiveFinished {
+		t.Errorf("Finished reader received %d bytes, state %d", progress.BytesReceived(), progress.ReceiveState())
+	}
+}
+
+func TestBufferSize(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+
+	if subC.BufferSize() != ftps_qftp_client.DefaultBufferSize {
+		t.Errorf("Default buffer size %d", subC.BufferSize())
+	}
+	subC.SetBufferSize(7)
+	if subC.BufferSize() != 7 {
+		t.Errorf("Buffer size %d after SetBufferSize(7)", subC.BufferSize())
+	}
+	// The reader hides io.WriterTo, so the data is copied through the small buffer
+	data := strings.Repeat(testData, 10)
+	if err := subC.Stor("/incoming/test", struct{ io.Reader }{strings.NewReader(data)}); err != nil {
+		t.Error(err)
+	}
+	if stored, _ := server.File("/incoming/test"); string(stored) != data {
+		t.Errorf("Stored %q", stored)
+	}
+}
+
+func TestTouchTruncate(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.AddFile("/incoming/test", []byte(testData))
+	c, subC := newTestSubConn(t, server)
+	defer c.Close()
+
+	if err := ftps_qftp_client.Touch(subC, "/incoming/lock"); err != nil {
+		t.Error(err)
+	}
+	if data, created := server.File("/incoming/lock"); !created || len(data) != 0 {
+		t.Errorf("Touch created %q, %v", data, created)
+	}
+	if err := ftps_qftp_client.Truncate(subC, "/incoming/test", 4); err != nil {
+		t.Error(err)
+	}
+	if data, _ := server.File("/incoming/test"); string(data) != testData[:4] {
+		t.Errorf("Truncated to %q", data)
+	}
+	if err := ftps_qftp_client.Truncate(subC, "/incoming/test", 6); err != nil {
+		t.Error(err)
+	}
+	if data, _ := server.File("/incoming/test"); string(data) != testData[:4]+"\x00\x00" {
+		t.Errorf("Extended to %q", data)
+	}
+
+	// Without MLST the entry is taken from the listing of the parent
+	entry, err := ftps_qftp_client.Stat(subC, "/incoming/test")
+	if err != nil || entry.Name != "test" || entry.Size != 6 || entry.Type != ftps_qftp_client.EntryTypeFile {
+		t.Errorf("Stat returned %+v, %v", entry, err)
+	}
+	if _, err = ftps_qftp_client.Stat(subC, "/incoming/missing"); err == nil {
+		t.Error("No error for a missing file")
+	}
+}
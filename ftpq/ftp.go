@@ -1,13 +1,17 @@
-// Package ftp implements a FTP client as described in RFC 959.
+// Package ftpq implements a FTP client as described in RFC 959, which uses
+// streams of a QUIC-connection instead of TCP connections (QUIC-FTP).
 package ftpq
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"errors"
+	"fmt"
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/internal/ftputil"
 	"github.com/lucas-clemente/quic-go"
-	"io/ioutil"
+	"net"
 	"net/textproto"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -16,16 +20,31 @@ import (
 const (
 	MaxStreamsPerSession = 3      // like default in vsftpd // but separate limit for uni- and bidirectional streams
 	MaxStreamFlowControl = 212992 // like OpenSuse TCP /proc/sys/net/core/rmem_max
-	KeepAlive            = true
 )
 
+// KeepAlive enables the keep-alive of the QUIC session. The QUIC layer sends
+// PING frames, while the session is idle, independent of the control
+// streams. So a session is kept alive, also while a long transfer owns the
+// control stream of its subconnection, and no NOOP has to be sent meanwhile.
+// The used version of quic-go does not support datagrams (RFC 9221), so
+// lighter keep-alive messages than PING frames are not possible.
+const KeepAlive = true
+
+// ErrSubConnLimit is returned by GetNewSubConn, if as many subconnections are
+// open as set with SetMaxSubConns.
+var ErrSubConnLimit = errors.New("The limit of open subconnections is reached.")
+
 // ServerConn represents the connection to a remote FTP server.
 type ServerConn struct {
 	dataRetriveStreams    map[quic.StreamID]quic.ReceiveStream
+	subConns              map[*ServerSubConn]bool // open subconnections
+	maxSubConns           int                     // limit of the open subconnections, 0 for none
 	quicSession           quic.Session
 	structAccessMutex     sync.Mutex
 	dataStreamAcceptMutex sync.Mutex
 	dataStreamOpenMutex   sync.Mutex
+	closingErr            error // error after the server closed the service, nil while usable
+	closingErrMutex       sync.Mutex
 }
 
 // Connect is an alias to Dial, for backward compatibility
@@ -44,45 +63,57 @@ func Dial(addr string, certfile string) (*ServerConn, error) {
 // an authenticated user.
 func DialTimeout(addr string, timeout time.Duration, certfile string) (*ServerConn, error) {
 
-	tlsConfig, err := generateTLSConfig(certfile)
+	return DialConfig(addr, certfile, NewQUICConfig(timeout))
+}
+
+// DialConfig initializes the connection like DialTimeout, but dials the QUIC
+// session with the configuration, e.g. one returned by NewQUICConfig with
+// larger flow control windows for bulk transfers. The used version of quic-go
+// neither stores address validation tokens nor TLS sessions for later
+// connections, so each connection performs a complete handshake.
+func DialConfig(addr string, certfile string, quicConfig *quic.Config) (*ServerConn, error) {
+	tlsConfig, err := ftputil.TLSConfig(certfile)
 	if err != nil {
 		return nil, err
 	}
+	return DialTLSConfig(addr, tlsConfig, quicConfig)
+}
 
-	quicConfig := generateQUICConfig(timeout)
-
+// DialTLSConfig initializes the connection like DialConfig, but secures the
+// QUIC session with the TLS configuration instead of one trusting the
+// certificate of a file, e.g. with one using the certificates of the system
+// or checking the fingerprint of the certificate.
+func DialTLSConfig(addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (*ServerConn, error) {
 	quicSession, err := quic.DialAddr(addr, tlsConfig, quicConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	c := &ServerConn{
+	return NewConn(quicSession), nil
+}
+
+// NewConn creates the connection to a FTP server from an established QUIC
+// session, e.g. one dialed with a configuration of its own or the in-memory
+// session of the test server of the package ftpqtest.
+func NewConn(quicSession quic.Session) *ServerConn {
+	return &ServerConn{
 		dataRetriveStreams: make(map[quic.StreamID]quic.ReceiveStream),
+		subConns:           make(map[*ServerSubConn]bool),
 		quicSession:        quicSession,
 		structAccessMutex:  sync.Mutex{},
 	}
-
-	return c, nil
 }
 
-// Generates from the specified certifiate file a tls configuration
-func generateTLSConfig(certfile string) (*tls.Config, error) {
-	tlsConfig := &tls.Config{}
-	tlsConfig.InsecureSkipVerify = true
-	certficate, err := ioutil.ReadFile(certfile)
-	if err != nil {
-		return tlsConfig, err
-	}
-	rootCAs := x509.NewCertPool()
-	if !rootCAs.AppendCertsFromPEM([]byte(certficate)) {
-		return tlsConfig, errors.New("ERROR: Fehler beim parsen des Serverzertifikats.\n")
-	}
-	tlsConfig.RootCAs = rootCAs
-	return tlsConfig, nil
-}
-
-// Generates a quic configuration
-func generateQUICConfig(timeout time.Duration) *quic.Config {
+// NewQUICConfig returns the configuration of the QUIC sessions dialed by
+// DialTimeout with the handshake timeout. The fields can be changed before
+// it is passed to DialConfig, e.g. MaxReceiveStreamFlowControlWindow and
+// MaxReceiveConnectionFlowControlWindow, which limit the data in flight of
+// the streams and of the session. The used version of quic-go always uses
+// its Cubic congestion control, there is no choice of another controller or
+// of the initial congestion window. Its maximal packet size is fixed to 1252
+// bytes for IPv4 and 1232 bytes for IPv6, larger packets on links with jumbo
+// frames and the path MTU discovery (DPLPMTUD) are not supported.
+func NewQUICConfig(timeout time.Duration) *quic.Config {
 	config := &quic.Config{}
 	config.ConnectionIDLength = 4
 	config.HandshakeTimeout = timeout
@@ -94,15 +125,61 @@ func generateQUICConfig(timeout time.Duration) *quic.Config {
 	return config
 }
 
+// ConnectionState returns the state of the QUIC session, e.g. the
+// certificates of the server.
+func (c *ServerConn) ConnectionState() quic.ConnectionState {
+	return c.quicSession.ConnectionState()
+}
+
+// RemoteAddr returns the address of the server of the QUIC session.
+func (c *ServerConn) RemoteAddr() net.Addr {
+	return c.quicSession.RemoteAddr()
+}
+
+// LocalAddr returns the local address of the QUIC session.
+func (c *ServerConn) LocalAddr() net.Addr {
+	return c.quicSession.LocalAddr()
+}
+
+// Returns the error after the server closed the service or the QUIC session
+// was closed, nil while the connection is usable.
+func (c *ServerConn) closing() error {
+	c.closingErrMutex.Lock()
+	defer c.closingErrMutex.Unlock()
+	if c.closingErr == nil && c.quicSession.Context().Err() != nil {
+		// The streams of a closed session fail with errors of the QUIC layer
+		c.closingErr = fmt.Errorf("%w The QUIC session is closed.", ftps_qftp_client.ErrServiceClosing)
+	}
+	return c.closingErr
+}
+
+// Marks the connection as closed by the server. It returns the error
+// for all following calls on all subconnections.
+func (c *ServerConn) setClosing(err error) error {
+	c.closingErrMutex.Lock()
+	defer c.closingErrMutex.Unlock()
+	if c.closingErr == nil {
+		c.closingErr = err
+	}
+	return c.closingErr
+}
+
 // Opens a new subconnection (stream) in the quic-Connection.
 // It returns the subconnection the server-greeting and in case th occured error.
+// The subconnection is tracked till it is quit or closed, its ID identifies it
+// within the session. If the limit of SetMaxSubConns is reached,
+// ErrSubConnLimit is returned.
 func (c *ServerConn) GetNewSubConn() (*ServerSubConn, string, error) {
 	c.structAccessMutex.Lock()
+	if c.maxSubConns > 0 && len(c.subConns) >= c.maxSubConns {
+		c.structAccessMutex.Unlock()
+		return nil, "", ErrSubConnLimit
+	}
 
 	// Open Controlstream
 	controlStreamRaw, err := c.quicSession.OpenStreamSync()
-	c.structAccessMutex.Unlock()
 	if err != nil {
+		c.structAccessMutex.Unlock()
 		return nil, "", err
 	}
 
@@ -111,20 +188,106 @@ func (c *ServerConn) GetNewSubConn() (*ServerSubConn, string, error) {
 	subC := &ServerSubConn{
 		serverConnection: c,
 		controlStream:    controlStream,
+		controlStreamRaw: controlStreamRaw,
 		features:         make(map[string]string),
 	}
+	// Counted against the limit from now on
+	c.subConns[subC] = true
+	c.structAccessMutex.Unlock()
 
 	code, message, err := subC.cmd(StatusReady, "HELLO")
 	if err != nil {
-		subC.Quit()
+		subC.discard()
 		return nil, "", err
 	}
 
 	err = subC.Feat()
 	if err != nil {
-		subC.Quit()
+		subC.discard()
 		return nil, "", err
 	}
 
 	return subC, strconv.Itoa(code) + " " + message, nil
 }
+
+// Removes a subconnection, which was quit or closed.
+func (c *ServerConn) removeSubConn(subC *ServerSubConn) {
+	c.structAccessMutex.Lock()
+	delete(c.subConns, subC)
+	c.structAccessMutex.Unlock()
+}
+
+// SubConns returns the open subconnections ordered by their IDs, including
+// the ones still being set up by GetNewSubConn.
+func (c *ServerConn) SubConns() []*ServerSubConn {
+	c.structAccessMutex.Lock()
+	subConns := make([]*ServerSubConn, 0, len(c.subConns))
+	for subC := range c.subConns {
+		subConns = append(subConns, subC)
+	}
+	c.structAccessMutex.Unlock()
+	sort.Slice(subConns, func(i, j int) bool {
+		return subConns[i].ID() < subConns[j].ID()
+	})
+	return subConns
+}
+
+// SetMaxSubConns limits the number of open subconnections, 0 for no limit.
+// Each subconnection uses a bidirectional stream for its control stream.
+// Servers limit the number of these streams of a session, e.g. to
+// MaxStreamsPerSession. Without a limit of the client GetNewSubConn then
+// blocks, till the server allows a further stream. With the limit of the
+// server GetNewSubConn fails with ErrSubConnLimit instead. Open
+// subconnections above a lower limit are kept.
+func (c *ServerConn) SetMaxSubConns(max int) {
+	c.structAccessMutex.Lock()
+	c.maxSubConns = max
+	c.structAccessMutex.Unlock()
+}
+
+// AvailableSubConns returns the number of subconnections, which can be
+// opened till the limit of SetMaxSubConns is reached, -1 without a limit.
+func (c *ServerConn) AvailableSubConns() int {
+	c.structAccessMutex.Lock()
+	defer c.structAccessMutex.Unlock()
+	if c.maxSubConns <= 0 {
+		return -1
+	}
+	if available := c.maxSubConns - len(c.subConns); available > 0 {
+		return available
+	}
+	return 0
+}
+
+// QuitSubConns quits all open subconnections, the QUIC session stays open
+// for new ones. Subconnections, which cannot be quit, e.g. as they are busy,
+// are closed. The first error of QUIT is returned.
+func (c *ServerConn) QuitSubConns() error {
+	var firstErr error
+	for _, subC := range c.SubConns() {
+		if err := subC.Quit(); err != nil {
+			subC.Close()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Close closes the control streams of all subconnections and the QUIC session
+// without sending QUIT, e.g. if the server does not respond. Blocked calls on
+// the subconnections return with an error. The connection is not usable afterwards.
+func (c *ServerConn) Close() error {
+	c.structAccessMutex.Lock()
+	subConns := make([]*ServerSubConn, 0, len(c.subConns))
+	for subC := range c.subConns {
+		subConns = append(subConns, subC)
+	}
+	c.structAccessMutex.Unlock()
+
+	for _, subC := range subConns {
+		subC.Close()
+	}
+	return c.quicSession.CloseWithError(ErrorCodeClosed, errors.New("Connection closed by the client."))
+}
@@ -1,30 +1,68 @@
 package ftpq
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/internal/ftputil"
 	"github.com/lucas-clemente/quic-go"
+	"golang.org/x/text/encoding"
 	"io"
 	"net/textproto"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Errorcode to cancel streams, when a subconnection is closed without QUIT
+const ErrorCodeClosed = quic.ErrorCode(0)
+
 // ServerConn represents a subconnection to a remote FTP server
 // with one QUIC-controlstream and optional one QUIC-datastream
 type ServerSubConn struct {
-	serverConnection *ServerConn
-	controlStream    *textproto.Conn
-	features         map[string]string
+	serverConnection  *ServerConn
+	controlStream     *textproto.Conn
+	controlStreamRaw  quic.Stream
+	features          map[string]string
+	username          string
+	password          string
+	dataReceiveStream quic.ReceiveStream // data stream of the last retrieve
+	dataSendStream    quic.SendStream    // data stream of the last store
+	dataStreamMutex   sync.Mutex
+	serverLocation    *time.Location                // time zone of the listed times, nil for UTC
+	retrSize          bool                          // request the size of files with SIZE before retrieving them
+	bufferSize        int                           // size of the buffers copying the data of transfers, 0 for the default
+	commandTimeout    time.Duration                 // time to wait for a reply, 0 for no limit
+	maxLineLength     int                           // maximal length of lines of listings, 0 for the default
+	transferType      ftps_qftp_client.TransferType // representation type of transfers
+	closingErr        error                         // error of a closed control stream, nil while usable
+	closingErrMutex   sync.Mutex
+	busy              int32                          // 1 while a command waits for its replies, accessed atomically
+	loginHook         ftps_qftp_client.LoginHook     // continues the login after intermediate replies, nil for USER and PASS only
+	commandLogger     ftps_qftp_client.CommandLogger // receives the dialogue on the control connection, nil for none
+	currentDir        string                         // current directory tracked by the client, empty if unknown
+	encoding          encoding.Encoding              // encoding of paths and listings at the server, nil for UTF-8
+	timer             ftps_qftp_client.CommandTimer  // timings of the replies to the commands
+	hooks             ftps_qftp_client.SessionHooks  // called on the events of the session
 }
 
 // response represent a data-connection
 type response struct {
-	conn quic.ReceiveStream
-	c    *ServerSubConn
+	conn   quic.ReceiveStream
+	c      *ServerSubConn
+	reader io.Reader // converts the data of conn, nil to read it unchanged
+	size   int64     // bytes sent by the server, -1 if unknown
+	path   string    // retrieved file for the hooks, empty for listings
+	ftps_qftp_client.ReceiveCounter
+}
+
+// ID returns the ID of the control stream, which identifies the subconnection
+// within its QUIC session.
+func (subC *ServerSubConn) ID() quic.StreamID {
+	return subC.controlStreamRaw.StreamID()
 }
 
 // Dummy function to have the same interface as the FTPS-Client
@@ -37,37 +75,65 @@ func (subC *ServerSubConn) AuthTLS() error {
 // "anonymous"/"anonymous" is a common user/password scheme for FTP servers
 // that allows anonymous read-only accounts.
 func (subC *ServerSubConn) Login(user, password string) error {
-	code, message, err := subC.cmd(-1, "USER %s", user)
+	// Known before sending, so echoed passwords are masked
+	subC.password = password
+	reply, err := subC.SendCommand("USER %s", user)
 	if err != nil {
 		return err
 	}
 
-	switch code {
-	case StatusLoggedIn:
-	case StatusUserOK:
-		_, _, err = subC.cmd(StatusLoggedIn, "PASS %s", password)
+	// Continue while the server replies with 3xx
+	passwordSent := false
+	for ftps_qftp_client.IsPositiveIntermediate(reply.Code) {
+		command := ""
+		if subC.loginHook != nil {
+			command, err = subC.loginHook(reply)
+			if err != nil {
+				return err
+			}
+		}
+		if command == "" {
+			if reply.Code != StatusUserOK || passwordSent {
+				return &textproto.Error{Code: reply.Code, Msg: subC.redact(reply.Message)}
+			}
+			command = "PASS " + password
+			passwordSent = true
+		}
+		reply, err = subC.SendCommand("%s", command)
 		if err != nil {
 			return err
 		}
-	default:
-		return errors.New(message)
+	}
+	if reply.Code != StatusLoggedIn && reply.Code != StatusCommandNotImplemented {
+		return &textproto.Error{Code: reply.Code, Msg: subC.redact(reply.Message)}
 	}
 
-	// Switch to binary mode
-	_, _, err = subC.cmd(StatusCommandOK, "TYPE I")
+	subC.username = user
+	// The server changes to the home directory of the user
+	subC.currentDir = ""
+
+	// Switch to the transfer type, binary unless set otherwise
+	_, _, err = subC.cmd(StatusCommandOK, "TYPE %s", subC.transferType)
 	if err != nil {
 		return err
 	}
 
-	// logged, check features again
-	if err = subC.Feat(); err != nil {
+	// logged, servers may announce further features to authenticated users
+	if err = subC.RefreshFeatures(); err != nil {
 		subC.Quit()
 		return err
 	}
 
+	subC.hooks.LoggedIn(user)
 	return nil
 }
 
+// SetLoginHook sets the hook, which continues the following logins after
+// intermediate replies of the server, nil to send only USER and PASS.
+func (subC *ServerSubConn) SetLoginHook(hook ftps_qftp_client.LoginHook) {
+	subC.loginHook = hook
+}
+
 // feat issues a FEAT FTP command to list the additional commands supported by
 // the remote FTP server.
 // FEAT is described in RFC 2389
@@ -83,25 +149,7 @@ func (subC *ServerSubConn) Feat() error {
 		return nil
 	}
 
-	lines := strings.Split(message, "\n")
-	for _, line := range lines {
-		if !strings.HasPrefix(line, " ") {
-			continue
-		}
-
-		line = strings.TrimSpace(line)
-		featureElements := strings.SplitN(line, " ", 2)
-
-		command := featureElements[0]
-
-		var commandDesc string
-		if len(featureElements) == 2 {
-			commandDesc = featureElements[1]
-		}
-
-		subC.features[command] = commandDesc
-	}
-
+	ftputil.ParseFeatures(message, subC.features)
 	return nil
 }
 
@@ -110,6 +158,25 @@ func (subC *ServerSubConn) Features() map[string]string {
 	return subC.features
 }
 
+// RefreshFeatures discards the known features and requests them again with
+// the FEAT command, e.g. after the authentication.
+func (subC *ServerSubConn) RefreshFeatures() error {
+	subC.features = make(map[string]string)
+	return subC.Feat()
+}
+
+// Capabilities returns the optional commands announced by the server with FEAT.
+func (subC *ServerSubConn) Capabilities() ftps_qftp_client.Capabilities {
+	return ftps_qftp_client.CapabilitiesFromFeatures(subC.features)
+}
+
+// HasFeature reports whether the server announced the feature and returns its
+// description, e.g. "SHA-1;SHA-256*" for HASH. The name is not case sensitive.
+func (subC *ServerSubConn) HasFeature(name string) (bool, string) {
+	description, available := ftputil.LookupFeature(subC.features, name)
+	return available, description
+}
+
 // openNewDataSendStream creates a new FTP data stream to send.
 func (subC *ServerSubConn) getNewDataSendStream() (quic.SendStream, error) {
 	subC.serverConnection.dataStreamOpenMutex.Lock()
@@ -122,6 +189,35 @@ func (subC *ServerSubConn) Exec(expected int, format string, args ...interface{}
 	return subC.cmd(expected, format, args...)
 }
 
+// SendCommand sends a command and returns the complete reply of the server
+// including all lines of a multiline reply. The code of the reply is not
+// checked, so it can be used for commands not supported by the client. The
+// code can be classified with ftps_qftp_client.IsPositiveCompletion and the
+// further functions of the package.
+func (subC *ServerSubConn) SendCommand(format string, args ...interface{}) (*ftps_qftp_client.Response, error) {
+	err := subC.send(format, args...)
+	if err != nil {
+		return nil, err
+	}
+	subC.setReplyDeadline()
+	code, message, lines, err := ftputil.ReadReply(&subC.controlStream.Reader)
+	subC.controlStreamRaw.SetReadDeadline(time.Time{})
+	duration := subC.timer.Replied()
+	atomic.StoreInt32(&subC.busy, 0)
+	message = ftputil.DecodeString(subC.encoding, message)
+	for i := range lines {
+		lines[i] = ftputil.DecodeString(subC.encoding, lines[i])
+	}
+	subC.log("< " + subC.redact(strings.Join(lines, "\n")))
+	if ftputil.IsServiceClosing(code, err) {
+		return nil, subC.setClosing(code, subC.redact(message), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ftps_qftp_client.Response{Code: code, Message: message, Lines: lines, Duration: duration}, nil
+}
+
 // cmdDataReceiveStreamFrom executes a command which require a FTP data stream to receive data.
 // Issues a REST FTP command to specify the number of bytes to skip for the transfer.
 func (subC *ServerSubConn) cmdDataReceiveStreamFrom(offset uint64, format string, args ...interface{}) (quic.ReceiveStream, error) {
@@ -132,33 +228,37 @@ func (subC *ServerSubConn) cmdDataReceiveStreamFrom(offset uint64, format string
 		}
 	}
 
-	_, err := subC.controlStream.Cmd(format, args...)
+	err := subC.send(format, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	code, msg, err := subC.controlStream.ReadResponse(-1)
+	_, msg, err := subC.readTransferStart()
 	if err != nil {
 		return nil, err
 	}
-	if code != StatusAlreadyOpen && code != StatusAboutToSend {
-		return nil, &textproto.Error{Code: code, Msg: msg}
-	}
+	// The transfer has started, it is aborted on errors to end the command
 	msgParts := strings.SplitN(msg, " ", 2)
 	if len(msgParts) != 2 {
+		subC.abort()
 		return nil, errors.New("Returnmessage must contain the stream id separated by a blank.")
 	}
 	streamIDUint64, err := strconv.ParseInt(msgParts[0], 10, 64)
 	if err != nil || streamIDUint64 < 0 || streamIDUint64%4 != 3 {
+		subC.abort()
 		return nil, errors.New("Stream ID has not a valid value for a unidirectional stream from the server.")
 	}
 	streamID := quic.StreamID(streamIDUint64)
 
 	stream, err := subC.getDataRetriveStream(streamID)
 	if err != nil {
+		subC.abort()
 		return nil, err
 	}
 
+	subC.dataStreamMutex.Lock()
+	subC.dataReceiveStream = stream
+	subC.dataStreamMutex.Unlock()
 	return stream, nil
 }
 
@@ -184,22 +284,21 @@ func (subC *ServerSubConn) cmdDataSendStreamFrom(offset uint64, format string, a
 	} else {
 		format = formatParts[0] + fmt.Sprintf(" %d ", stream.StreamID()) + formatParts[1]
 	}
-	_, err = subC.controlStream.Cmd(format, args...)
+	err = subC.send(format, args...)
 	if err != nil {
 		stream.Close()
 		return nil, err
 	}
 
-	code, msg, err := subC.controlStream.ReadResponse(-1)
+	_, _, err = subC.readTransferStart()
 	if err != nil {
 		stream.Close()
 		return nil, err
 	}
-	if code != StatusAlreadyOpen && code != StatusAboutToSend {
-		stream.Close()
-		return nil, &textproto.Error{Code: code, Msg: msg}
-	}
 
+	subC.dataStreamMutex.Lock()
+	subC.dataSendStream = stream
+	subC.dataStreamMutex.Unlock()
 	return stream, nil
 }
 
@@ -225,224 +324,172 @@ func (subC *ServerSubConn) getDataRetriveStream(streamID quic.StreamID) (quic.Re
 	}
 }
 
-var errUnsupportedListLine = errors.New("Unsupported LIST line")
-
-// parseRFC3659ListLine parses the style of directory line defined in RFC 3659.
-func parseRFC3659ListLine(line string) (*ftps_qftp_client.Entry, error) {
-	iSemicolon := strings.Index(line, ";")
-	iWhitespace := strings.Index(line, " ")
-
-	if iSemicolon < 0 || iSemicolon > iWhitespace {
-		return nil, errUnsupportedListLine
-	}
-
-	e := &ftps_qftp_client.Entry{
-		Name: line[iWhitespace+1:],
+// NameList issues an NLST FTP command.
+func (subC *ServerSubConn) NameList(path string) (entries []string, err error) {
+	conn, err := subC.cmdDataReceiveStreamFrom(0, "NLST %s", path)
+	if err != nil {
+		return
 	}
 
-	for _, field := range strings.Split(line[:iWhitespace-1], ";") {
-		i := strings.Index(field, "=")
-		if i < 1 {
-			return nil, errUnsupportedListLine
-		}
-
-		key := field[:i]
-		value := field[i+1:]
+	r := &response{conn: conn, c: subC, reader: ftputil.NewDecodingReader(subC.encoding, conn), size: -1}
+	defer r.Close()
 
-		switch key {
-		case "modify":
-			var err error
-			e.Time, err = time.Parse("20060102150405", value)
-			if err != nil {
-				return nil, err
-			}
-		case "type":
-			switch value {
-			case "dir", "cdir", "pdir":
-				e.Type = ftps_qftp_client.EntryTypeFolder
-			case "file":
-				e.Type = ftps_qftp_client.EntryTypeFile
-			}
-		case "size":
-			e.SetSize(value)
-		}
+	scanner := ftps_qftp_client.NewLineScanner(r, subC.maxLineLength)
+	for scanner.Scan() {
+		entries = append(entries, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return entries, err
 	}
-	return e, nil
+	return
 }
 
-// parseLsListLine parses a directory line in a format based on the output of
-// the UNIX ls command.
-func parseLsListLine(line string) (*ftps_qftp_client.Entry, error) {
-	fields := strings.Fields(line)
-	if len(fields) >= 7 && fields[1] == "folder" && fields[2] == "0" {
-		e := &ftps_qftp_client.Entry{
-			Type: ftps_qftp_client.EntryTypeFolder,
-			Name: strings.Join(fields[6:], " "),
-		}
-		if err := e.SetTime(fields[3:6]); err != nil {
-			return nil, err
-		}
-
-		return e, nil
+// List issues a LIST FTP command.
+func (subC *ServerSubConn) List(path string) (entries []*ftps_qftp_client.Entry, err error) {
+	scanner, err := subC.ListStream(path)
+	if err != nil {
+		return
 	}
+	defer scanner.Close()
 
-	if fields[1] == "0" {
-		e := &ftps_qftp_client.Entry{
-			Type: ftps_qftp_client.EntryTypeFile,
-			Name: strings.Join(fields[7:], " "),
-		}
-
-		if err := e.SetSize(fields[2]); err != nil {
-			return nil, err
-		}
-		if err := e.SetTime(fields[4:7]); err != nil {
-			return nil, err
-		}
-
-		return e, nil
+	for scanner.Next() {
+		entries = append(entries, scanner.Entry())
 	}
-
-	if len(fields) < 9 {
-		return nil, errUnsupportedListLine
+	if err := scanner.Err(); err != nil {
+		return nil, err
 	}
+	return
+}
 
-	e := &ftps_qftp_client.Entry{}
-	switch fields[0][0] {
-	case '-':
-		e.Type = ftps_qftp_client.EntryTypeFile
-		if err := e.SetSize(fields[4]); err != nil {
-			return nil, err
-		}
-	case 'd':
-		e.Type = ftps_qftp_client.EntryTypeFolder
-	case 'l':
-		e.Type = ftps_qftp_client.EntryTypeLink
-	default:
-		return nil, errors.New("Unknown entry type")
+// ListLenient issues a LIST FTP command like List, but returns also the lines
+// of the listing, which could not be parsed, instead of dropping them. If the
+// transfer fails, the entries and lines read till then are returned with the
+// error.
+func (subC *ServerSubConn) ListLenient(path string) (entries []*ftps_qftp_client.Entry, unparsed []string, err error) {
+	scanner, err := subC.ListStream(path)
+	if err != nil {
+		return
 	}
+	defer scanner.Close()
+	scanner.SetKeepUnparsed(true)
 
-	if err := e.SetTime(fields[5:8]); err != nil {
-		return nil, err
+	for scanner.Next() {
+		entries = append(entries, scanner.Entry())
 	}
-
-	e.Name = strings.Join(fields[8:], " ")
-	return e, nil
+	return entries, scanner.Unparsed(), scanner.Err()
 }
 
-var dirTimeFormats = []string{
-	"01-02-06  03:04PM",
-	"2006-01-02  15:04",
+// ListStream issues a LIST FTP command like List, but returns the entries one
+// by one while they are received. The scanner has to be closed, before
+// further commands are issued.
+func (subC *ServerSubConn) ListStream(path string) (*ftps_qftp_client.EntryScanner, error) {
+	return subC.listStream("LIST", path)
 }
 
-// parseDirListLine parses a directory line in a format based on the output of
-// the MS-DOS DIR command.
-func parseDirListLine(line string) (*ftps_qftp_client.Entry, error) {
-	e := &ftps_qftp_client.Entry{}
-	var err error
-
-	// Try various time formats that DIR might use, and stop when one works.
-	for _, format := range dirTimeFormats {
-		e.Time, err = time.Parse(format, line[:len(format)])
-		if err == nil {
-			line = line[len(format):]
-			break
-		}
-	}
+// MachineList issues a MLSD FTP command (RFC 3659) and returns the entries in
+// the machine readable format of the directory. The current and the parent
+// directory are returned with the names "." and "..".
+func (subC *ServerSubConn) MachineList(path string) (entries []*ftps_qftp_client.Entry, err error) {
+	scanner, err := subC.listStream("MLSD", path)
 	if err != nil {
-		// None of the time formats worked.
-		return nil, errUnsupportedListLine
+		return
 	}
+	defer scanner.Close()
 
-	line = strings.TrimLeft(line, " ")
-	if strings.HasPrefix(line, "<DIR>") {
-		e.Type = ftps_qftp_client.EntryTypeFolder
-		line = strings.TrimPrefix(line, "<DIR>")
-	} else {
-		space := strings.Index(line, " ")
-		if space == -1 {
-			return nil, errUnsupportedListLine
-		}
-		e.Size, err = strconv.ParseUint(line[:space], 10, 64)
-		if err != nil {
-			return nil, errUnsupportedListLine
-		}
-		e.Type = ftps_qftp_client.EntryTypeFile
-		line = line[space:]
+	for scanner.Next() {
+		entries = append(entries, scanner.Entry())
 	}
-
-	e.Name = strings.TrimLeft(line, " ")
-	return e, nil
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return
 }
 
-var listLineParsers = []func(line string) (*ftps_qftp_client.Entry, error){
-	parseRFC3659ListLine,
-	parseLsListLine,
-	parseDirListLine,
+// MachineEntry issues a MLST FTP command (RFC 3659) and returns the entry of
+// the file or directory at the path.
+func (subC *ServerSubConn) MachineEntry(path string) (*ftps_qftp_client.Entry, error) {
+	_, message, err := subC.cmd(StatusRequestedFileActionOK, "MLST %s", path)
+	if err != nil {
+		return nil, err
+	}
+	return ftps_qftp_client.ParseMachineEntry(message)
 }
 
-// parseListLine parses the various non-standard format returned by the LIST
-// FTP command.
-func parseListLine(line string) (*ftps_qftp_client.Entry, error) {
-	for _, f := range listLineParsers {
-		e, err := f(line)
-		if err == errUnsupportedListLine {
-			// Try another format.
-			continue
-		}
-		return e, err
+// Issues the listing command for the path and returns a scanner for the entries.
+func (subC *ServerSubConn) listStream(command string, path string) (*ftps_qftp_client.EntryScanner, error) {
+	conn, err := subC.cmdDataReceiveStreamFrom(0, "%s %s", command, path)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errUnsupportedListLine
+	scanner := ftps_qftp_client.NewEntryScanner(&response{conn: conn, c: subC, reader: ftputil.NewDecodingReader(subC.encoding, conn), size: -1}, subC.location())
+	scanner.SetMaxLineLength(subC.maxLineLength)
+	return scanner, nil
 }
 
-// NameList issues an NLST FTP command.
-func (subC *ServerSubConn) NameList(path string) (entries []string, err error) {
-	conn, err := subC.cmdDataReceiveStreamFrom(0, "NLST %s", path)
+// ListRecursive issues a "LIST -R" FTP command, which is supported by many
+// servers, and returns the entries of the whole tree below the path with one
+// command instead of one LIST for each directory.
+func (subC *ServerSubConn) ListRecursive(path string) ([]*ftps_qftp_client.PathEntry, error) {
+	conn, err := subC.cmdDataReceiveStreamFrom(0, "LIST -R %s", path)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	r := &response{conn, subC}
-	defer subC.controlStream.ReadResponse(StatusClosingDataConnection)
+	r := &response{conn: conn, c: subC, reader: ftputil.NewDecodingReader(subC.encoding, conn), size: -1}
+	defer r.Close()
+	return ftps_qftp_client.ParseRecursiveListing(r, path, subC.location(), subC.maxLineLength)
+}
 
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		entries = append(entries, scanner.Text())
-	}
-	if err = scanner.Err(); err != nil {
-		return entries, err
-	}
-	return
+// SetMaxLineLength sets the maximal length of the lines of listings returned
+// by NameList, List and ListStream. Longer lines fail with a
+// ftps_qftp_client.LineTooLongError. With maxLength <= 0
+// ftps_qftp_client.DefaultMaxLineLength is used.
+func (subC *ServerSubConn) SetMaxLineLength(maxLength int) {
+	subC.maxLineLength = maxLength
 }
 
-// List issues a LIST FTP command.
-func (subC *ServerSubConn) List(path string) (entries []*ftps_qftp_client.Entry, err error) {
-	conn, err := subC.cmdDataReceiveStreamFrom(0, "LIST %s", path)
-	if err != nil {
-		return
-	}
+// SetBufferSize sets the size of the buffers copying the data of the files
+// stored by Stor and StorFrom and of the files retrieved by a
+// ftps_qftp_client.TransferScheduler. The buffers are reused from a pool.
+// Stor and StorFrom copy without a buffer, if the data stream implements
+// io.ReaderFrom or the reader io.WriterTo.
+// With size <= 0 ftps_qftp_client.DefaultBufferSize is used.
+func (subC *ServerSubConn) SetBufferSize(size int) {
+	subC.bufferSize = size
+}
 
-	r := &response{conn, subC}
-	defer subC.controlStream.ReadResponse(StatusClosingDataConnection)
+// SetCommandTimeout sets the time, the subconnection waits for a reply to a
+// command like ftps.ServerConn.SetCommandTimeout. The replies to multiplexed
+// transfers are awaited without a limit.
+// With timeout <= 0 the subconnection waits without a limit, the default.
+func (subC *ServerSubConn) SetCommandTimeout(timeout time.Duration) {
+	subC.commandTimeout = timeout
+}
 
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		entry, err := parseListLine(line)
-		if err == nil {
-			entries = append(entries, entry)
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-	return
+// SetRetrSize sets, whether Retr and RetrFrom request the size of the file
+// with SIZE before retrieving it. The returned reader implements
+// ftps_qftp_client.SizedReader and reports the size, except in ASCII mode,
+// in which the size at the server differs from the one received.
+func (subC *ServerSubConn) SetRetrSize(enabled bool) {
+	subC.retrSize = enabled
+}
+
+// BufferSize returns the size of the buffers copying the data of transfers.
+func (subC *ServerSubConn) BufferSize() int {
+	return ftps_qftp_client.BufferPoolOfSize(subC.bufferSize).Size()
 }
 
 // ChangeDir issues a CWD FTP command, which changes the current directory to
 // the specified path.
 func (subC *ServerSubConn) ChangeDir(path string) error {
 	_, _, err := subC.cmd(StatusRequestedFileActionOK, "CWD %s", path)
-	return err
+	if err != nil {
+		return err
+	}
+	if subC.currentDir != "" || ftps_qftp_client.IsAbsPath(path) {
+		subC.currentDir = ftps_qftp_client.JoinPath(subC.currentDir, path)
+	}
+	return nil
 }
 
 // ChangeDirToParent issues a CDUP FTP command, which changes the current
@@ -450,7 +497,13 @@ func (subC *ServerSubConn) ChangeDir(path string) error {
 // with a path set to "..".
 func (subC *ServerSubConn) ChangeDirToParent() error {
 	_, _, err := subC.cmd(StatusRequestedFileActionOK, "CDUP")
-	return err
+	if err != nil {
+		return err
+	}
+	if subC.currentDir != "" {
+		subC.currentDir = ftps_qftp_client.JoinPath(subC.currentDir, "..")
+	}
+	return nil
 }
 
 // CurrentDir issues a PWD FTP command, which Returns the path of the current
@@ -461,14 +514,35 @@ func (subC *ServerSubConn) CurrentDir() (string, error) {
 		return "", err
 	}
 
-	start := strings.Index(msg, "\"")
-	end := strings.LastIndex(msg, "\"")
-
-	if start == -1 || end == -1 {
-		return "", errors.New("Unsuported PWD response format")
+	dir, err := ftputil.ParseCurrentDir(msg)
+	if err != nil {
+		return "", err
 	}
+	subC.currentDir = dir
+	return dir, nil
+}
 
-	return msg[start+1 : end], nil
+// AbsPath returns the absolute remote path of the path relative to the
+// current directory. The current directory is tracked by the client, so PWD
+// is only issued if it is unknown, e.g. after the login. Servers with TVFS
+// (RFC 3659) and most others use paths separated by "/" starting at the root
+// "/", for others an error is returned.
+func (subC *ServerSubConn) AbsPath(path string) (string, error) {
+	if ftps_qftp_client.IsAbsPath(path) {
+		return ftps_qftp_client.JoinPath("/", path), nil
+	}
+	dir := subC.currentDir
+	if dir == "" {
+		var err error
+		dir, err = subC.CurrentDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	if !ftps_qftp_client.IsAbsPath(dir) {
+		return "", errors.New("The current directory " + dir + " is no absolute path starting with /.")
+	}
+	return ftps_qftp_client.JoinPath(dir, path), nil
 }
 
 // Retr issues a RETR FTP command to fetch the specified file from the remote
@@ -484,12 +558,24 @@ func (subC *ServerSubConn) Retr(path string) (io.ReadCloser, error) {
 //
 // The retrive must be finialized with FinializeRetr() to cleanup the FTP data connection.
 func (subC *ServerSubConn) RetrFrom(path string, offset uint64) (io.ReadCloser, error) {
+	size := int64(-1)
+	if subC.retrSize && subC.transferType != ftps_qftp_client.ASCII {
+		// Without support of SIZE the file is retrieved with an unknown size
+		if fileSize, err := subC.FileSize(path); err == nil && fileSize >= int64(offset) {
+			size = fileSize - int64(offset)
+		}
+	}
 	conn, err := subC.cmdDataReceiveStreamFrom(offset, "RETR %s", path)
 	if err != nil {
 		return nil, err
 	}
+	subC.hooks.TransferStarted("RETR", path)
 
-	return &response{conn, subC}, nil
+	r := &response{conn: conn, c: subC, size: size, path: path}
+	if subC.transferType == ftps_qftp_client.ASCII {
+		r.reader = ftputil.NewFromNetworkReader(conn)
+	}
+	return r, nil
 }
 
 // Stor issues a STOR FTP command to store a file to the remote FTP server.
@@ -510,17 +596,37 @@ func (subC *ServerSubConn) StorFrom(path string, r io.Reader, offset uint64) err
 	if err != nil {
 		return err
 	}
+	subC.hooks.TransferStarted("STOR", path)
 
-	_, err = io.Copy(stream, r)
-	stream.Close()
+	if subC.transferType == ftps_qftp_client.ASCII {
+		r = ftputil.NewToNetworkReader(r)
+	}
+	n, err := ftps_qftp_client.BufferPoolOfSize(subC.bufferSize).CopyFast(stream, r)
 	if err != nil {
-		return err
+		// Reset the stream, so the server does not take the data as complete
+		// and replies to the incomplete transfer, which ends the command
+		stream.CancelWrite(ErrorCodeClosed)
+		subC.readFinalResponse()
+	} else {
+		stream.Close()
+		_, _, err = subC.readResponse(StatusClosingDataConnection)
 	}
-
-	_, _, err = subC.controlStream.ReadResponse(StatusClosingDataConnection)
+	subC.hooks.TransferCompleted("STOR", path, n, err)
 	return err
 }
 
+// SetTransferType issues a TYPE FTP command to set the representation type
+// of the following transfers. In ASCII mode the line endings are converted
+// between CRLF on the data connection and LF.
+func (subC *ServerSubConn) SetTransferType(transferType ftps_qftp_client.TransferType) error {
+	_, _, err := subC.cmd(StatusCommandOK, "TYPE %s", transferType)
+	if err != nil {
+		return err
+	}
+	subC.transferType = transferType
+	return nil
+}
+
 // Rename renames a file on the remote FTP server.
 func (subC *ServerSubConn) Rename(from, to string) error {
 	_, _, err := subC.cmd(StatusRequestFilePending, "RNFR %s", from)
@@ -539,6 +645,207 @@ func (subC *ServerSubConn) Delete(path string) error {
 	return err
 }
 
+// DeleteAll issues a DELE FTP command for each of the paths without waiting
+// for the replies to the previous ones, so deleting many files takes about
+// one round trip instead of one for each file. It returns a result for each
+// path in the order of the paths. If the control stream fails, the error is
+// returned and also set in the results of the paths without a reply.
+func (subC *ServerSubConn) DeleteAll(paths []string) (ftps_qftp_client.DeleteResults, error) {
+	results := make(ftps_qftp_client.DeleteResults, len(paths))
+	lines := make([]string, len(paths))
+	for i, path := range paths {
+		results[i].Path = path
+		lines[i], results[i].Err = ftputil.EncodeString(subC.encoding, "DELE "+path)
+	}
+	if !atomic.CompareAndSwapInt32(&subC.busy, 0, 1) {
+		return nil, ftps_qftp_client.ErrBusy
+	}
+	defer atomic.StoreInt32(&subC.busy, 0)
+	if err := subC.closing(); err != nil {
+		return nil, err
+	}
+
+	// The commands are written by a goroutine, while the replies are read, so
+	// the client and the server don't block each other with full buffers.
+	stop := make(chan struct{})
+	written := make(chan error, 1)
+	go func() {
+		for i, line := range lines {
+			if results[i].Err != nil {
+				continue
+			}
+			select {
+			case <-stop:
+				written <- nil
+				return
+			default:
+			}
+			subC.log("> " + line)
+			if err := subC.controlStream.PrintfLine("%s", line); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+
+	var err error
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		var code int
+		var message string
+		code, message, err = subC.readReply()
+		for err == nil && ftps_qftp_client.IsPositivePreliminary(code) {
+			code, message, err = subC.readReply()
+		}
+		if ftputil.IsServiceClosing(code, err) {
+			err = subC.setClosing(code, subC.redact(message), err)
+		}
+		if err != nil {
+			for j := i; j < len(results); j++ {
+				if results[j].Err == nil {
+					results[j].Err = err
+				}
+			}
+			break
+		}
+		if code != StatusRequestedFileActionOK {
+			results[i].Err = &textproto.Error{Code: code, Msg: subC.redact(message)}
+		}
+	}
+	close(stop)
+	if writeErr := <-written; err == nil {
+		err = writeErr
+	}
+	return results, err
+}
+
+// ModTime issues a MDTM FTP command (RFC 3659) and returns the time of the
+// last modification of the remote file in UTC.
+func (subC *ServerSubConn) ModTime(path string) (time.Time, error) {
+	_, message, err := subC.cmd(StatusFile, "MDTM %s", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ftputil.ParseModTime(message)
+}
+
+// FileSize issues a SIZE FTP command (RFC 3659) and returns the size of the
+// remote file.
+func (subC *ServerSubConn) FileSize(path string) (int64, error) {
+	_, message, err := subC.cmd(StatusFile, "SIZE %s", path)
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(message), 10, 64)
+	if err != nil {
+		return 0, errors.New("Unsupported SIZE response format")
+	}
+	return size, nil
+}
+
+// SetModTime issues a MFMT FTP command to set the time of the last
+// modification of the remote file.
+func (subC *ServerSubConn) SetModTime(path string, t time.Time) error {
+	_, _, err := subC.cmd(StatusFile, "MFMT %s %s", t.UTC().Format("20060102150405"), path)
+	return err
+}
+
+// Chmod issues a SITE CHMOD FTP command to set the permissions of the remote
+// file or directory. Besides the permission bits the setuid, setgid and
+// sticky bits of the mode are sent, e.g. "SITE CHMOD 755 path".
+func (subC *ServerSubConn) Chmod(path string, mode os.FileMode) error {
+	if !ftputil.SiteCommandAvailable(subC.features, "CHMOD") {
+		return errors.New("The server does not support SITE CHMOD.")
+	}
+	code, message, err := subC.cmd(-1, "SITE CHMOD %s %s", ftputil.FormatFileMode(mode), path)
+	if err != nil {
+		return err
+	}
+	if code < 200 || code >= 300 {
+		return &textproto.Error{Code: code, Msg: message}
+	}
+	return nil
+}
+
+// AvailableSpace returns the number of bytes, which can be stored in the
+// remote directory. It issues AVBL, if the server announces it, otherwise
+// SITE QUOTA, which is supported in the format of ProFTPD. Batch uploads can
+// use it to fail early, if the space at the server is too small.
+func (subC *ServerSubConn) AvailableSpace(path string) (int64, error) {
+	if available, _ := subC.HasFeature("AVBL"); available {
+		_, message, err := subC.cmd(StatusFile, "AVBL %s", path)
+		if err != nil {
+			return 0, err
+		}
+		space, err := strconv.ParseInt(strings.TrimSpace(message), 10, 64)
+		if err != nil {
+			return 0, errors.New("Unsupported AVBL response format")
+		}
+		return space, nil
+	}
+	if !ftputil.SiteCommandAvailable(subC.features, "QUOTA") {
+		return 0, errors.New("The server supports neither AVBL nor SITE QUOTA.")
+	}
+	code, message, err := subC.cmd(-1, "SITE QUOTA")
+	if err != nil {
+		return 0, err
+	}
+	if code < 200 || code >= 300 {
+		return 0, &textproto.Error{Code: code, Msg: message}
+	}
+	return ftputil.ParseQuota(message)
+}
+
+// SetEncoding sets the character encoding of the server for the paths in
+// commands, replies and listings, e.g. "iso-8859-1", "cp1251" or "shift-jis"
+// for legacy servers, which do not announce UTF8 in their features and
+// garble other names. With "" or "utf-8" the default UTF-8 is used again.
+// The data of transfered files is never converted.
+func (subC *ServerSubConn) SetEncoding(name string) error {
+	enc, err := ftputil.LookupEncoding(name)
+	if err != nil {
+		return err
+	}
+	subC.encoding = enc
+	return nil
+}
+
+// SetServerLocation sets the time zone, in which the server lists the times
+// of files, see ftps_qftp_client.DetectServerLocation. Without it the times
+// are regarded as UTC.
+func (subC *ServerSubConn) SetServerLocation(location *time.Location) {
+	subC.serverLocation = location
+}
+
+// Returns the location of the times listed by the server.
+func (subC *ServerSubConn) location() *time.Location {
+	if subC.serverLocation == nil {
+		return time.UTC
+	}
+	return subC.serverLocation
+}
+
+// Checksum requests the checksum of the remote file with the HASH command or,
+// if the server does not announce it in its features, with XMD5.
+func (subC *ServerSubConn) Checksum(path string) (ftps_qftp_client.Checksum, error) {
+	command := ftputil.ChecksumCommand(subC.features)
+	code, message, err := subC.cmd(-1, "%s %s", command, path)
+	if err != nil {
+		return ftps_qftp_client.Checksum{}, err
+	}
+	if code < 200 || code >= 300 {
+		return ftps_qftp_client.Checksum{}, &textproto.Error{Code: code, Msg: message}
+	}
+	algorithm, value, err := ftputil.ParseChecksum(command, message)
+	if err != nil {
+		return ftps_qftp_client.Checksum{}, err
+	}
+	return ftps_qftp_client.Checksum{Algorithm: algorithm, Value: value}, nil
+}
+
 // MakeDir issues a MKD FTP command to create the specified directory on the
 // remote FTP server.
 func (subC *ServerSubConn) MakeDir(path string) error {
@@ -564,17 +871,201 @@ func (subC *ServerSubConn) NoOp() error {
 // cmd is a helper function to execute a command and check for the expected FTP
 // return code
 func (subC *ServerSubConn) cmd(expected int, format string, args ...interface{}) (int, string, error) {
-	_, err := subC.controlStream.Cmd(format, args...)
+	err := subC.send(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return subC.readResponse(expected)
+}
+
+// send writes a command to the control stream. The subconnection is busy till the
+// final reply to the command is read, meanwhile sending further commands fails
+// with ErrBusy. After the control stream was closed it returns ErrServiceClosing.
+func (subC *ServerSubConn) send(format string, args ...interface{}) error {
+	if !atomic.CompareAndSwapInt32(&subC.busy, 0, 1) {
+		return ftps_qftp_client.ErrBusy
+	}
+	if err := subC.closing(); err != nil {
+		atomic.StoreInt32(&subC.busy, 0)
+		return err
+	}
+	line := fmt.Sprintf(format, args...)
+	subC.log("> " + ftputil.RedactCommand(line))
+	encoded, err := ftputil.EncodeString(subC.encoding, line)
+	if err != nil {
+		atomic.StoreInt32(&subC.busy, 0)
+		return errors.New(ftputil.RedactCommand(err.Error()))
+	}
+	subC.timer.Sent()
+	_, err = subC.controlStream.Cmd("%s", encoded)
 	if err != nil {
+		atomic.StoreInt32(&subC.busy, 0)
+	}
+	if ftputil.IsServiceClosing(0, err) {
+		return subC.setClosing(0, "", err)
+	}
+	return err
+}
+
+// readResponse reads the reply to a command and checks for the expected code.
+// If a final reply is expected, preliminary replies (1xx) before it are
+// skipped, as some servers send them with the progress of a command. After a
+// reply with 421 or the end of the control stream the subconnection is
+// marked as closed and ErrServiceClosing returned.
+func (subC *ServerSubConn) readResponse(expected int) (int, string, error) {
+	return subC.readResponses(expected, ftputil.ExpectsFinalReply(expected))
+}
+
+// readFinalResponse reads the final reply to a command with any code and
+// skips the preliminary replies (1xx) before it.
+func (subC *ServerSubConn) readFinalResponse() (int, string, error) {
+	return subC.readResponses(-1, true)
+}
+
+// readTransferStart reads the reply to a command opening a data stream, 125
+// or 150. Other preliminary replies before it are skipped.
+func (subC *ServerSubConn) readTransferStart() (int, string, error) {
+	code, message, err := subC.readResponse(-1)
+	for err == nil && code != StatusAlreadyOpen && code != StatusAboutToSend &&
+		ftps_qftp_client.IsPositivePreliminary(code) {
+		code, message, err = subC.readResponse(-1)
+	}
+	if err == nil && code != StatusAlreadyOpen && code != StatusAboutToSend {
+		err = &textproto.Error{Code: code, Msg: subC.redact(message)}
+	}
+	return code, message, err
+}
+
+func (subC *ServerSubConn) readResponses(expected int, skipPreliminary bool) (int, string, error) {
+	if err := subC.closing(); err != nil {
+		atomic.StoreInt32(&subC.busy, 0)
 		return 0, "", err
 	}
+	subC.setReplyDeadline()
+	code, message, err := subC.readReply()
+	for err == nil && skipPreliminary && ftps_qftp_client.IsPositivePreliminary(code) {
+		code, message, err = subC.readReply()
+	}
+	subC.controlStreamRaw.SetReadDeadline(time.Time{})
+	subC.timer.Replied()
+	if err != nil || code >= 200 {
+		// A preliminary reply (1xx) is followed by a further reply to the command
+		atomic.StoreInt32(&subC.busy, 0)
+	}
+	if ftputil.IsServiceClosing(code, err) {
+		return code, message, subC.setClosing(code, subC.redact(message), err)
+	}
+	if err == nil && !ftputil.HasExpectedCode(code, expected) {
+		// The message is returned unchanged for parsing, just copies are masked
+		err = &textproto.Error{Code: code, Msg: subC.redact(message)}
+	}
+	return code, message, err
+}
 
-	return subC.controlStream.ReadResponse(expected)
+// Reads a single reply from the control stream and logs it.
+func (subC *ServerSubConn) readReply() (int, string, error) {
+	code, message, _, err := ftputil.ReadReply(&subC.controlStream.Reader)
+	message = ftputil.DecodeString(subC.encoding, message)
+	if code != 0 {
+		subC.log("< " + strconv.Itoa(code) + " " + subC.redact(message))
+	}
+	return code, message, err
+}
+
+// Limits the time till the next reply is read to the command timeout.
+func (subC *ServerSubConn) setReplyDeadline() {
+	if subC.commandTimeout > 0 {
+		subC.controlStreamRaw.SetReadDeadline(time.Now().Add(subC.commandTimeout))
+	}
+}
+
+// abort issues an ABOR FTP command to abort the running transfer and reads its
+// replies. It is sent while the subconnection is busy with the transfer.
+func (subC *ServerSubConn) abort() error {
+	subC.log("> ABOR")
+	subC.timer.Sent()
+	_, err := subC.controlStream.Cmd("ABOR")
+	if err != nil {
+		atomic.StoreInt32(&subC.busy, 0)
+		return err
+	}
+	// 426 for the aborted transfer followed by 226, or just 226
+	code, _, err := subC.readFinalResponse()
+	if err == nil && code == StatusTransfertAborted {
+		_, _, err = subC.readFinalResponse()
+	}
+	return err
+}
+
+// Masks the password in a text for logs and errors.
+func (subC *ServerSubConn) redact(text string) string {
+	return ftputil.RedactSecret(text, subC.password)
+}
+
+// Passes the line to the command logger, if one is set.
+func (subC *ServerSubConn) log(line string) {
+	if subC.commandLogger != nil {
+		subC.commandLogger(line)
+	}
+}
+
+// SetCommandLogger sets the logger receiving the following dialogue on the
+// control stream, nil to stop logging. Credentials are masked.
+func (subC *ServerSubConn) SetCommandLogger(logger ftps_qftp_client.CommandLogger) {
+	subC.commandLogger = logger
+}
+
+// SetSessionHooks sets the hooks called on the following events of the
+// subconnection. OnConnect is called for the further subconnections opened
+// for parallel transfers, which take over the hooks.
+func (subC *ServerSubConn) SetSessionHooks(hooks ftps_qftp_client.SessionHooks) {
+	subC.hooks = hooks
+}
+
+// CommandStats returns the timings of the replies to the commands sent on
+// the control stream of the subconnection so far.
+func (subC *ServerSubConn) CommandStats() ftps_qftp_client.CommandStats {
+	return subC.timer.Stats()
+}
+
+// Returns the error of the closed control stream or QUIC session,
+// nil while the subconnection is usable.
+func (subC *ServerSubConn) closing() error {
+	if err := subC.serverConnection.closing(); err != nil {
+		return err
+	}
+	subC.closingErrMutex.Lock()
+	defer subC.closingErrMutex.Unlock()
+	return subC.closingErr
+}
+
+// Marks the control stream as closed by the server and returns the error for
+// this and all following calls. A reply with 421 closes the service for the
+// whole QUIC session, so all subconnections are marked.
+func (subC *ServerSubConn) setClosing(code int, message string, err error) error {
+	if code == StatusNotAvailable {
+		err = subC.serverConnection.setClosing(fmt.Errorf("%w %d %s", ftps_qftp_client.ErrServiceClosing, code, message))
+	} else {
+		err = fmt.Errorf("%w %v", ftps_qftp_client.ErrServiceClosing, err)
+	}
+	subC.closingErrMutex.Lock()
+	first := subC.closingErr == nil
+	if first {
+		subC.closingErr = err
+	}
+	err = subC.closingErr
+	subC.closingErrMutex.Unlock()
+	if first {
+		subC.hooks.Failed(err)
+	}
+	return err
 }
 
 // Logout issues a REIN FTP command to logout the current user.
 func (subC *ServerSubConn) Logout() error {
 	_, _, err := subC.cmd(StatusReady, "REIN")
+	subC.currentDir = ""
 	return err
 }
 
@@ -582,21 +1073,108 @@ func (subC *ServerSubConn) Logout() error {
 // remote FTP server.
 func (subC *ServerSubConn) Quit() error {
 	_, _, err := subC.cmd(StatusClosing, "QUIT")
+	if errors.Is(err, ftps_qftp_client.ErrServiceClosing) {
+		// Closed by the server, just release the stream
+		subC.serverConnection.removeSubConn(subC)
+		subC.controlStream.Close()
+		return err
+	}
 	if err != nil {
 		return err
 	}
+	subC.serverConnection.removeSubConn(subC)
 	return subC.controlStream.Close()
 }
 
+// Close cancels the control stream and the data stream of a running transfer
+// without sending QUIT. Blocked calls on the subconnection return with an error,
+// so it can be used from another goroutine to abort a transfer.
+// The subconnection is not usable afterwards.
+func (subC *ServerSubConn) Close() error {
+	subC.dataStreamMutex.Lock()
+	if subC.dataReceiveStream != nil {
+		subC.dataReceiveStream.CancelRead(ErrorCodeClosed)
+	}
+	if subC.dataSendStream != nil {
+		subC.dataSendStream.CancelWrite(ErrorCodeClosed)
+	}
+	subC.dataStreamMutex.Unlock()
+	subC.serverConnection.removeSubConn(subC)
+	subC.controlStreamRaw.CancelRead(ErrorCodeClosed)
+	return subC.controlStreamRaw.Close()
+}
+
+// Quits a subconnection, which could not be set up, and removes it from the
+// subconnections. If QUIT fails, its stream is closed.
+func (subC *ServerSubConn) discard() {
+	if subC.Quit() != nil {
+		subC.Close()
+	}
+}
+
 // Read implements the io.Reader interface on a FTP data connection.
-func (r *response) Read(buf []byte) (int, error) {
-	return r.conn.Read(buf)
+// The bytes read and the end of the data are recorded for BytesReceived
+// and ReceiveState.
+func (r *response) Read(buf []byte) (n int, err error) {
+	if r.reader != nil {
+		n, err = r.reader.Read(buf)
+	} else {
+		n, err = r.conn.Read(buf)
+	}
+	r.Count(int64(n), err)
+	return n, err
+}
+
+// Size implements the ftps_qftp_client.SizedReader interface, it returns the
+// number of bytes sent by the server, -1 if unknown.
+func (r *response) Size() int64 {
+	return r.size
 }
 
-// Close implements the io.Closer interface on a FTP data stream.
+// WriteTo implements the io.WriterTo interface on a FTP data connection, so
+// io.Copy takes the fast path of w, e.g. splice to a file. The bytes written
+// are recorded for BytesReceived, when the copy has ended.
+func (r *response) WriteTo(w io.Writer) (int64, error) {
+	var src io.Reader = r.conn
+	if r.reader != nil {
+		src = r.reader
+	}
+	n, err := ftps_qftp_client.BufferPoolOfSize(r.c.bufferSize).CopyFast(w, src)
+	if err == nil {
+		// io.Copy returns no error at the end of the data
+		err = io.EOF
+	}
+	r.Count(n, err)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface on a FTP data stream. The server
+// replies to the transfer after the end of the stream (FIN), so the reply is
+// read after the data. Like this a transfer of an empty file ends with the
+// reply 226, also if Read was never called. If the data was not read to its
+// end, the rest is not received: the stream is cancelled and the reply to the
+// interrupted transfer, 426 or 226 if the server had sent all data, is read.
 func (r *response) Close() error {
-	// data stream is unidirectional must not be closed, just the
-	// the response on the control stream need to be read
-	_, _, err := r.c.controlStream.ReadResponse(StatusClosingDataConnection)
+	running := r.ReceiveState() == ftps_qftp_client.ReceiveRunning
+	r.Interrupt()
+	var err error
+	if running {
+		// The data stream is unidirectional and must not be closed
+		r.conn.CancelRead(ErrorCodeClosed)
+		var code int
+		var message string
+		code, message, err = r.c.readFinalResponse()
+		if err == nil && code != StatusClosingDataConnection && code != StatusTransfertAborted {
+			err = &textproto.Error{Code: code, Msg: r.c.redact(message)}
+		}
+	} else {
+		_, _, err = r.c.readResponse(StatusClosingDataConnection)
+	}
+	if r.path != "" {
+		r.c.hooks.TransferCompleted("RETR", r.path, r.BytesReceived(), err)
+	}
 	return err
 }
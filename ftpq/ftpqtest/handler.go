@@ -0,0 +1,226 @@
+// Contains the handling of the commands on the control streams.
+
+package ftpqtest
+
+import (
+	"io/ioutil"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/attenberger/ftps_qftp-client/internal/testserver"
+	"github.com/lucas-clemente/quic-go"
+)
+
+// Handles the data streams of a session opened by the client for STOR.
+type sessionHandler struct {
+	session    *pipeSession
+	mutex      sync.Mutex
+	arrived    *sync.Cond                           // signaled when a stream is accepted or the session closed
+	uniStreams map[quic.StreamID]quic.ReceiveStream // accepted, but not yet used by STOR
+	closed     bool
+}
+
+func newSessionHandler(session *pipeSession) *sessionHandler {
+	h := &sessionHandler{session: session, uniStreams: make(map[quic.StreamID]quic.ReceiveStream)}
+	h.arrived = sync.NewCond(&h.mutex)
+	return h
+}
+
+// Accepts the unidirectional streams of the client till the session is closed.
+func (h *sessionHandler) acceptDataStreams() {
+	for {
+		stream, err := h.session.AcceptUniStream()
+		h.mutex.Lock()
+		if err != nil {
+			h.closed = true
+		} else {
+			h.uniStreams[stream.StreamID()] = stream
+		}
+		h.arrived.Broadcast()
+		h.mutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Waits for the unidirectional stream of the client with the ID.
+func (h *sessionHandler) dataStream(id quic.StreamID) (quic.ReceiveStream, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for {
+		if stream, available := h.uniStreams[id]; available {
+			delete(h.uniStreams, id)
+			return stream, nil
+		}
+		if h.closed {
+			return nil, errSessionClosed
+		}
+		h.arrived.Wait()
+	}
+}
+
+// State of a control stream
+type controlStream struct {
+	conn        *textproto.Conn
+	control     *testserver.Control
+	mutex       sync.Mutex     // serializes the replies to commands and to multiplexed transfers
+	multiplexed bool           // transfers run while further commands are handled
+	transfers   sync.WaitGroup // running multiplexed transfers
+}
+
+// Sends the lines of a reply.
+func (cs *controlStream) reply(lines ...string) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	for _, line := range lines {
+		if err := cs.conn.PrintfLine("%s", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs the rest of a transfer, which sends its final reply with the ID of
+// its stream. With multiplexing it runs in its own goroutine, so further
+// commands are handled meanwhile.
+func (cs *controlStream) finish(id quic.StreamID, transfer func() string) []string {
+	if !cs.multiplexed {
+		return []string{transfer()}
+	}
+	cs.transfers.Add(1)
+	go func() {
+		defer cs.transfers.Done()
+		reply := transfer()
+		cs.reply(reply[:4] + strconv.FormatInt(int64(id), 10) + " " + reply[4:])
+	}()
+	return nil
+}
+
+// Serves the commands of a control stream till QUIT or the end of the stream.
+func (s *Server) serveControl(h *sessionHandler, stream quic.Stream) {
+	defer stream.Close()
+	cs := &controlStream{conn: textproto.NewConn(stream), control: testserver.NewControl(s.fs, s.user, s.password)}
+	// The final replies of multiplexed transfers are sent before the stream is closed
+	defer cs.transfers.Wait()
+	for {
+		line, err := cs.conn.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument := testserver.ParseCommand(line)
+		if command == "QUIT" {
+			cs.transfers.Wait()
+		}
+		if cs.reply(s.handle(h, cs, command, argument)...) != nil {
+			return
+		}
+		if command == "QUIT" {
+			return
+		}
+	}
+}
+
+// Performs the command and returns the lines of the reply. The preliminary
+// replies of transfers are sent by the transfer itself.
+func (s *Server) handle(h *sessionHandler, cs *controlStream, command, argument string) []string {
+	control := cs.control
+	switch command {
+	case "HELLO":
+		return []string{"220 ftpqtest ready."}
+	case "FEAT":
+		return []string{"211-Features:", " MULTIPLEX", " REST STREAM", " SIZE", " UTF8", "211 End"}
+	case "OPTS":
+		switch strings.ToUpper(argument) {
+		case "MULTIPLEX ON":
+			cs.multiplexed = true
+			return []string{"200 Multiplexed transfers enabled."}
+		case "MULTIPLEX OFF":
+			cs.transfers.Wait()
+			cs.multiplexed = false
+			return []string{"200 Multiplexed transfers disabled."}
+		}
+	}
+	if replies, handled := control.Handle(command, argument); handled {
+		return replies
+	}
+
+	switch command {
+	case "RETR":
+		offset := control.TakeOffset()
+		data, available := s.fs.File(control.Resolve(argument))
+		if !available || offset > int64(len(data)) {
+			return []string{"550 Failed to open file."}
+		}
+		return s.send(h, cs, data[offset:])
+	case "LIST", "NLST":
+		listing, available := control.Listing(command, argument)
+		if !available {
+			return []string{"550 Failed to list directory."}
+		}
+		return s.send(h, cs, []byte(listing))
+	case "STOR":
+		// The ID of the data stream precedes the path
+		parts := strings.SplitN(argument, " ", 2)
+		id, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || len(parts) != 2 {
+			return []string{"501 STOR requires the stream ID and the path."}
+		}
+		filePath, refused := control.StorePath(parts[1])
+		if refused != nil {
+			return refused
+		}
+		return s.receive(h, cs, quic.StreamID(id), filePath, control.TakeOffset())
+	}
+	return []string{"502 Command not implemented."}
+}
+
+// Sends the data in a new unidirectional stream, whose ID is sent in the
+// preliminary reply, and returns the final reply.
+func (s *Server) send(h *sessionHandler, cs *controlStream, data []byte) []string {
+	stream, err := h.session.OpenUniStreamSync()
+	if err != nil {
+		return []string{"425 Can't open data stream."}
+	}
+	if cs.reply("150 "+strconv.FormatInt(int64(stream.StreamID()), 10)+" Opening data stream.") != nil {
+		stream.CancelWrite(0)
+		return nil
+	}
+	return cs.finish(stream.StreamID(), func() string {
+		if _, err := stream.Write(data); err != nil {
+			stream.CancelWrite(0)
+			return "426 Connection closed; transfer aborted."
+		}
+		stream.Close()
+		return "226 Transfer complete."
+	})
+}
+
+// Receives the data of the client's stream with the ID and stores it in the
+// file from the offset on. The data received before a cancelled stream is
+// kept, so the transfer can be resumed. With multiplexing the ID is also sent
+// in the preliminary reply.
+func (s *Server) receive(h *sessionHandler, cs *controlStream, id quic.StreamID, filePath string, offset int64) []string {
+	stream, err := h.dataStream(id)
+	if err != nil {
+		return []string{"425 Can't open data stream."}
+	}
+	preliminary := "150 Ok to send data."
+	if cs.multiplexed {
+		preliminary = "150 " + strconv.FormatInt(int64(id), 10) + " Ok to send data."
+	}
+	if cs.reply(preliminary) != nil {
+		stream.CancelRead(0)
+		return nil
+	}
+	return cs.finish(id, func() string {
+		data, err := ioutil.ReadAll(stream)
+		s.fs.Store(filePath, offset, data)
+		if err != nil {
+			return "426 Connection closed; transfer aborted."
+		}
+		return "226 Transfer complete."
+	})
+}
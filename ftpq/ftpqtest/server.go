@@ -0,0 +1,91 @@
+// Package ftpqtest provides an in-memory QUIC-FTP server for tests of the
+// package ftpq and of programs using it. The server and the client are
+// connected by an in-memory QUIC session, so neither a network nor a
+// configured external server is required.
+//
+// The server supports the commands of the QUIC-FTP mapping needed by the
+// client: HELLO, FEAT, USER, PASS, REIN, QUIT, NOOP, TYPE, PWD, CWD, CDUP,
+// MKD, RMD, DELE, RNFR, RNTO, SIZE, REST, RETR, STOR, LIST and NLST. Data is
+// sent in unidirectional streams, whose IDs are passed in the replies to
+// RETR, LIST and NLST and in the arguments of STOR. After OPTS MULTIPLEX ON
+// further commands are handled while transfers are running, the replies to
+// the transfers then contain the IDs of their streams.
+package ftpqtest
+
+import (
+	"sync"
+
+	"github.com/attenberger/ftps_qftp-client/ftpq"
+	"github.com/attenberger/ftps_qftp-client/internal/testserver"
+)
+
+// Server is an in-memory QUIC-FTP server. Its file system contains just the
+// root directory "/" initially. The methods can be called while clients are
+// connected.
+type Server struct {
+	user     string
+	password string
+	fs       *testserver.FileSystem
+	mutex    sync.Mutex
+	sessions []*pipeSession
+}
+
+// NewServer creates a server, which accepts the user with the password.
+func NewServer(user, password string) *Server {
+	return &Server{user: user, password: password, fs: testserver.NewFileSystem()}
+}
+
+// AddFile creates or replaces the file at the absolute path with the data.
+// Missing parent directories are created.
+func (s *Server) AddFile(filePath string, data []byte) {
+	s.fs.AddFile(filePath, data)
+}
+
+// AddDir creates the directory at the absolute path and its missing parents.
+func (s *Server) AddDir(dirPath string) {
+	s.fs.AddDir(dirPath)
+}
+
+// File returns the content of the file at the absolute path and whether it exists.
+func (s *Server) File(filePath string) ([]byte, bool) {
+	return s.fs.File(filePath)
+}
+
+// IsDir reports whether the directory at the absolute path exists.
+func (s *Server) IsDir(dirPath string) bool {
+	return s.fs.IsDir(dirPath)
+}
+
+// Dial connects a new client to the server. Subconnections are opened with
+// GetNewSubConn of the returned connection as with a real server.
+func (s *Server) Dial() *ftpq.ServerConn {
+	client, server := newSessionPair()
+	s.mutex.Lock()
+	s.sessions = append(s.sessions, server)
+	s.mutex.Unlock()
+	go s.serve(newSessionHandler(server))
+	return ftpq.NewConn(client)
+}
+
+// Close closes the sessions of all clients.
+func (s *Server) Close() {
+	s.mutex.Lock()
+	sessions := s.sessions
+	s.sessions = nil
+	s.mutex.Unlock()
+	for _, session := range sessions {
+		session.Close()
+	}
+}
+
+// Serves the control streams of a session, each one in a goroutine.
+func (s *Server) serve(h *sessionHandler) {
+	go h.acceptDataStreams()
+	for {
+		stream, err := h.session.AcceptStream()
+		if err != nil {
+			return
+		}
+		go s.serveControl(h, stream)
+	}
+}
@@ -0,0 +1,422 @@
+package ftpqtest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/ftpq"
+)
+
+const (
+	testData = "Just some text"
+	username = "anonymous"
+	password = "anonymous"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer(username, password)
+	server.AddDir("/incoming")
+	defer server.Close()
+
+	c := server.Dial()
+	defer c.Close()
+	subC, greeting, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if greeting != "220 ftpqtest ready." {
+		t.Errorf("Unexpected greeting %q", greeting)
+	}
+	if c.RemoteAddr().String() != "server" || c.LocalAddr().String() != "client" {
+		t.Errorf("Addresses %v and %v", c.RemoteAddr(), c.LocalAddr())
+	}
+	if err = subC.Login(username, password); err != nil {
+		t.Fatal(err)
+	}
+	if err = subC.NoOp(); err != nil {
+		t.Error(err)
+	}
+	if err = subC.ChangeDir("incoming"); err != nil {
+		t.Error(err)
+	}
+	if err = subC.Stor("test", bytes.NewBufferString(testData)); err != nil {
+		t.Error(err)
+	}
+	if data, _ := server.File("/incoming/test"); string(data) != testData {
+		t.Errorf("Stored %q", data)
+	}
+
+	entries, err := subC.List(".")
+	if err != nil {
+		t.Error(err)
+	} else if len(entries) != 1 || entries[0].Name != "test" || entries[0].Size != uint64(len(testData)) {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+	if err = subC.Rename("test", "tset"); err != nil {
+		t.Error(err)
+	}
+
+	r, err := subC.RetrFrom("tset", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil || string(buf) != testData[5:] {
+		t.Errorf("Read %q, %v", buf, err)
+	}
+	if err = r.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = subC.Delete("tset"); err != nil {
+		t.Error(err)
+	}
+	if err = subC.MakeDir("mydir"); err != nil {
+		t.Error(err)
+	}
+	if err = subC.ChangeDir("mydir"); err != nil {
+		t.Error(err)
+	}
+	if dir, err := subC.CurrentDir(); err != nil || dir != "/incoming/mydir" {
+		t.Errorf("CurrentDir returned %q, %v", dir, err)
+	}
+	if err = subC.ChangeDirToParent(); err != nil {
+		t.Error(err)
+	}
+	names, err := subC.NameList("/")
+	if err != nil || !reflect.DeepEqual(names, []string{"incoming"}) {
+		t.Errorf("NameList returned %v, %v", names, err)
+	}
+	if err = subC.RemoveDir("mydir"); err != nil {
+		t.Error(err)
+	}
+	err = subC.ChangeDir("missing")
+	if protoErr, ok := err.(*textproto.Error); !ok || protoErr.Code != 550 {
+		t.Errorf("ChangeDir to a missing directory returned %v", err)
+	}
+
+	if err = subC.Quit(); err != nil {
+		t.Error(err)
+	}
+	if err = subC.NoOp(); err == nil {
+		t.Error("NoOp after Quit succeeded")
+	}
+}
+
+func TestServerWrongLogin(t *testing.T) {
+	server := NewServer(username, password)
+	defer server.Close()
+	c := server.Dial()
+	defer c.Close()
+	subC, _, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = subC.Login(username, "wrong")
+	if protoErr, ok := err.(*textproto.Error); !ok || protoErr.Code != 530 {
+		t.Errorf("Login with a wrong password returned %v", err)
+	}
+}
+
+func TestServerMultipleTransfer(t *testing.T) {
+	server := NewServer(username, password)
+	server.AddFile("/remote/a.txt", []byte("aaa"))
+	server.AddFile("/remote/b.txt", []byte("bbbb"))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "ftpqtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("ccccc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := server.Dial()
+	defer c.Close()
+	subC, _, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = subC.Login(username, password); err != nil {
+		t.Fatal(err)
+	}
+	tasks := []ftps_qftp_client.TransferTask{
+		{Direction: ftps_qftp_client.Retrieve, RemotePath: "/remote/a.txt", LocalPath: filepath.Join(dir, "a.txt")},
+		{Direction: ftps_qftp_client.Retrieve, RemotePath: "/remote/b.txt", LocalPath: filepath.Join(dir, "b.txt")},
+		{Direction: ftps_qftp_client.Store, RemotePath: "/remote/c.txt", LocalPath: filepath.Join(dir, "c.txt")},
+	}
+	results, err := subC.MultipleTransfer(context.Background(), tasks, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = results.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"a.txt": "aaa", "b.txt": "bbbb"} {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != expected {
+			t.Errorf("Retrieved %s: %q, %v", name, data, err)
+		}
+	}
+	if data, _ := server.File("/remote/c.txt"); string(data) != "ccccc" {
+		t.Errorf("Stored c.txt: %q", data)
+	}
+}
+
+// Empty files and listings are sent as streams, which end without data.
+// Closing a reader before the end of the stream must not block the reply.
+func TestServerEmptyFile(t *testing.T) {
+	server := NewServer(username, password)
+	server.AddFile("/empty", nil)
+	server.AddFile("/small", []byte(testData))
+	server.AddDir("/incoming")
+	server.AddDir("/void")
+	defer server.Close()
+
+	c := server.Dial()
+	defer c.Close()
+	subC, _, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = subC.Login(username, password); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := subC.Retr("/empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || len(data) != 0 {
+		t.Errorf("Retrieved %q, %v", data, err)
+	}
+	if err = r.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// Closed without reading the end of the stream
+	for _, path := range []string{"/empty", "/small"} {
+		r, err = subC.Retr(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = r.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = subC.Stor("/incoming/empty", bytes.NewReader(nil)); err != nil {
+		t.Error(err)
+	}
+	if data, stored := server.File("/incoming/empty"); !stored || len(data) != 0 {
+		t.Errorf("Stored %q, %v", data, stored)
+	}
+
+	names, err := subC.NameList("/void")
+	if err != nil || len(names) != 0 {
+		t.Errorf("NameList of an empty directory returned %v, %v", names, err)
+	}
+	if err = subC.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A reader closed early cancels the stream instead of receiving the rest of
+// the file, the server replies with 426 to the interrupted transfer.
+func TestServerCloseEarly(t *testing.T) {
+	server := NewServer(username, password)
+	server.AddFile("/large", bytes.Repeat([]byte(testData), 1<<20))
+	defer server.Close()
+
+	c := server.Dial()
+	defer c.Close()
+	subC, _, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = subC.Login(username, password); err != nil {
+		t.Fatal(err)
+	}
+	var replies []string
+	subC.SetCommandLogger(func(line string) {
+		if strings.HasPrefix(line, "< ") {
+			replies = append(replies, line)
+		}
+	})
+
+	r, err := subC.Retr("/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadFull(r, make([]byte, 1024)); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Error(err)
+	}
+	if len(replies) != 2 || !strings.HasPrefix(replies[1], "< 426") {
+		t.Errorf("Replies to the closed transfer %q", replies)
+	}
+
+	// The subconnection is still usable
+	if err = subC.NoOp(); err != nil {
+		t.Error(err)
+	}
+	if size, err := subC.FileSize("/large"); err != nil || size != int64(len(testData))<<20 {
+		t.Errorf("FileSize returned %d, %v", size, err)
+	}
+}
+
+func TestServerMultiplex(t *testing.T) {
+	server := NewServer(username, password)
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		server.AddFile("/remote/"+name, []byte(strings.Repeat(name, 100000)))
+	}
+	server.AddDir("/stored")
+	defer server.Close()
+
+	c := server.Dial()
+	defer c.Close()
+	subC, _, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = subC.Login(username, password); err != nil {
+		t.Fatal(err)
+	}
+	m, err := subC.Multiplex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = subC.NoOp(); err != ftps_qftp_client.ErrBusy {
+		t.Errorf("NoOp while multiplexing returned %v", err)
+	}
+
+	// All transfers are started before the first one is read
+	readers := make([]io.ReadCloser, len(names))
+	for i, name := range names {
+		readers[i], err = m.Retr("/remote/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stores sync.WaitGroup
+	for _, name := range names {
+		stores.Add(1)
+		go func(name string) {
+			defer stores.Done()
+			if err := m.Stor("/stored/"+name, strings.NewReader(name+name)); err != nil {
+				t.Error(err)
+			}
+		}(name)
+	}
+	for i, name := range names {
+		data, err := ioutil.ReadAll(readers[i])
+		if err != nil || string(data) != strings.Repeat(name, 100000) {
+			t.Errorf("Retrieved %d bytes of %s, %v", len(data), name, err)
+		}
+		if err = readers[i].Close(); err != nil {
+			t.Error(err)
+		}
+	}
+	stores.Wait()
+	for _, name := range names {
+		if data, _ := server.File("/stored/" + name); string(data) != name+name {
+			t.Errorf("Stored %q as %s", data, name)
+		}
+	}
+
+	// Closed before the end, the transfer is interrupted without an error
+	r, err := m.Retr("/remote/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadFull(r, make([]byte, 10)); err != nil {
+		t.Error(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Errorf("Closing the interrupted transfer returned %v", err)
+	}
+
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = subC.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerSubConns(t *testing.T) {
+	server := NewServer(username, password)
+	defer server.Close()
+	c := server.Dial()
+	defer c.Close()
+
+	c.SetMaxSubConns(2)
+	first, _, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID() == second.ID() {
+		t.Errorf("Both subconnections have the ID %d", first.ID())
+	}
+	if subConns := c.SubConns(); len(subConns) != 2 || subConns[0] != first || subConns[1] != second {
+		t.Errorf("SubConns returned %v", subConns)
+	}
+	if available := c.AvailableSubConns(); available != 0 {
+		t.Errorf("%d subconnections available at the limit", available)
+	}
+	if _, _, err = c.GetNewSubConn(); err != ftpq.ErrSubConnLimit {
+		t.Errorf("GetNewSubConn above the limit returned %v", err)
+	}
+
+	// A closed subconnection is no longer counted
+	if err = first.Close(); err != nil {
+		t.Error(err)
+	}
+	if available := c.AvailableSubConns(); available != 1 {
+		t.Errorf("%d subconnections available after Close, expected 1", available)
+	}
+	if _, _, err = c.GetNewSubConn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.QuitSubConns(); err != nil {
+		t.Error(err)
+	}
+	if subConns := c.SubConns(); len(subConns) != 0 {
+		t.Errorf("%d subconnections open after QuitSubConns", len(subConns))
+	}
+	if err = second.NoOp(); err == nil {
+		t.Error("NoOp after QuitSubConns succeeded")
+	}
+	// The session is still usable
+	c.SetMaxSubConns(0)
+	if c.AvailableSubConns() != -1 {
+		t.Errorf("%d subconnections available without a limit", c.AvailableSubConns())
+	}
+	third, _, err := c.GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = third.Login(username, password); err != nil {
+		t.Error(err)
+	}
+}
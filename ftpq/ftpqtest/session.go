@@ -0,0 +1,283 @@
+// Contains the in-memory QUIC session, which connects the client and the
+// server of the tests without a network.
+
+package ftpqtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// Capacity of the queues of streams opened, but not yet accepted by the peer
+const acceptQueueLength = 16
+
+// errSessionClosed is returned by the streams and sessions after the session
+// was closed by one of its ends.
+var errSessionClosed = errors.New("The in-memory QUIC session is closed.")
+
+// Error of a stream cancelled by the peer with CancelRead or CancelWrite.
+type streamError struct {
+	code quic.ErrorCode
+}
+
+func (e *streamError) Error() string {
+	return "Stream canceled with error code " + strconv.Itoa(int(e.code)) + "."
+}
+
+// Canceled implements the quic.StreamError interface.
+func (e *streamError) Canceled() bool {
+	return true
+}
+
+// ErrorCode implements the quic.StreamError interface.
+func (e *streamError) ErrorCode() quic.ErrorCode {
+	return e.code
+}
+
+// State shared by both ends of a session
+type pipeConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	mutex  sync.Mutex
+	pipes  []*io.PipeWriter // closed with the session, so blocked reads return
+}
+
+// Creates the pipe of a stream direction, which is closed with the session.
+func (c *pipeConn) newPipe() (*io.PipeReader, *io.PipeWriter) {
+	reader, writer := io.Pipe()
+	c.mutex.Lock()
+	c.pipes = append(c.pipes, writer)
+	c.mutex.Unlock()
+	if c.ctx.Err() != nil {
+		writer.CloseWithError(errSessionClosed)
+	}
+	return reader, writer
+}
+
+// Closes the session and all of its streams.
+func (c *pipeConn) close() {
+	c.cancel()
+	c.mutex.Lock()
+	pipes := c.pipes
+	c.pipes = nil
+	c.mutex.Unlock()
+	for _, pipe := range pipes {
+		pipe.CloseWithError(errSessionClosed)
+	}
+}
+
+// An end of an in-memory QUIC session. It implements quic.Session.
+type pipeSession struct {
+	conn       *pipeConn
+	peer       *pipeSession
+	name       string // address of the end
+	mutex      sync.Mutex
+	nextBidi   quic.StreamID
+	nextUni    quic.StreamID
+	streams    chan quic.Stream        // bidirectional streams opened by the peer
+	uniStreams chan quic.ReceiveStream // unidirectional streams opened by the peer
+}
+
+// Creates the connected ends of the client and of the server. Stream IDs are
+// assigned like in QUIC: the client opens bidirectional streams with the IDs
+// 0, 4, 8, ... and unidirectional ones with 2, 6, 10, ..., the server the
+// ones with 1, 5, 9, ... and 3, 7, 11, ...
+func newSessionPair() (client *pipeSession, server *pipeSession) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := &pipeConn{ctx: ctx, cancel: cancel}
+	client = &pipeSession{conn: conn, name: "client", nextBidi: 0, nextUni: 2,
+		streams: make(chan quic.Stream, acceptQueueLength), uniStreams: make(chan quic.ReceiveStream, acceptQueueLength)}
+	server = &pipeSession{conn: conn, name: "server", nextBidi: 1, nextUni: 3,
+		streams: make(chan quic.Stream, acceptQueueLength), uniStreams: make(chan quic.ReceiveStream, acceptQueueLength)}
+	client.peer = server
+	server.peer = client
+	return client, server
+}
+
+// Returns the ID for the next stream and increments it.
+func (s *pipeSession) newID(next *quic.StreamID) quic.StreamID {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := *next
+	*next += 4
+	return id
+}
+
+// AcceptStream implements quic.Session.
+func (s *pipeSession) AcceptStream() (quic.Stream, error) {
+	select {
+	case stream := <-s.streams:
+		return stream, nil
+	case <-s.conn.ctx.Done():
+		return nil, errSessionClosed
+	}
+}
+
+// AcceptUniStream implements quic.Session.
+func (s *pipeSession) AcceptUniStream() (quic.ReceiveStream, error) {
+	select {
+	case stream := <-s.uniStreams:
+		return stream, nil
+	case <-s.conn.ctx.Done():
+		return nil, errSessionClosed
+	}
+}
+
+// OpenStream implements quic.Session. Like OpenStreamSync it blocks, while
+// the peer has too many streams not yet accepted.
+func (s *pipeSession) OpenStream() (quic.Stream, error) {
+	return s.OpenStreamSync()
+}
+
+// OpenStreamSync implements quic.Session.
+func (s *pipeSession) OpenStreamSync() (quic.Stream, error) {
+	id := s.newID(&s.nextBidi)
+	inReader, inWriter := s.conn.newPipe()
+	outReader, outWriter := s.conn.newPipe()
+	local := newPipeStream(id, inReader, outWriter)
+	remote := newPipeStream(id, outReader, inWriter)
+	select {
+	case s.peer.streams <- remote:
+		return local, nil
+	case <-s.conn.ctx.Done():
+		return nil, errSessionClosed
+	}
+}
+
+// OpenUniStream implements quic.Session. Like OpenUniStreamSync it blocks,
+// while the peer has too many streams not yet accepted.
+func (s *pipeSession) OpenUniStream() (quic.SendStream, error) {
+	return s.OpenUniStreamSync()
+}
+
+// OpenUniStreamSync implements quic.Session.
+func (s *pipeSession) OpenUniStreamSync() (quic.SendStream, error) {
+	id := s.newID(&s.nextUni)
+	reader, writer := s.conn.newPipe()
+	select {
+	case s.peer.uniStreams <- newPipeStream(id, reader, nil):
+		return newPipeStream(id, nil, writer), nil
+	case <-s.conn.ctx.Done():
+		return nil, errSessionClosed
+	}
+}
+
+// LocalAddr implements quic.Session.
+func (s *pipeSession) LocalAddr() net.Addr {
+	return pipeAddr(s.name)
+}
+
+// RemoteAddr implements quic.Session.
+func (s *pipeSession) RemoteAddr() net.Addr {
+	return pipeAddr(s.peer.name)
+}
+
+// Close implements quic.Session, it closes both ends of the session.
+func (s *pipeSession) Close() error {
+	s.conn.close()
+	return nil
+}
+
+// CloseWithError implements quic.Session.
+func (s *pipeSession) CloseWithError(code quic.ErrorCode, err error) error {
+	return s.Close()
+}
+
+// Context implements quic.Session, it is cancelled when the session is closed.
+func (s *pipeSession) Context() context.Context {
+	return s.conn.ctx
+}
+
+// ConnectionState implements quic.Session. The in-memory session has no TLS.
+func (s *pipeSession) ConnectionState() quic.ConnectionState {
+	return quic.ConnectionState{}
+}
+
+// Address of an end of an in-memory session
+type pipeAddr string
+
+func (a pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a pipeAddr) String() string {
+	return string(a)
+}
+
+// Stream of an in-memory session. A unidirectional stream has just the
+// reader or the writer. Deadlines are not supported.
+type pipeStream struct {
+	id     quic.StreamID
+	reader *io.PipeReader
+	writer *io.PipeWriter
+	ctx    context.Context
+	cancel context.CancelFunc // called when the sending is finished
+}
+
+func newPipeStream(id quic.StreamID, reader *io.PipeReader, writer *io.PipeWriter) *pipeStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pipeStream{id: id, reader: reader, writer: writer, ctx: ctx, cancel: cancel}
+}
+
+// StreamID implements quic.Stream.
+func (s *pipeStream) StreamID() quic.StreamID {
+	return s.id
+}
+
+// Read implements quic.Stream.
+func (s *pipeStream) Read(buf []byte) (int, error) {
+	return s.reader.Read(buf)
+}
+
+// Write implements quic.Stream. Like QUIC it returns immediately for empty
+// data, a write on the pipe would wait for a read of the peer.
+func (s *pipeStream) Write(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	return s.writer.Write(buf)
+}
+
+// Close implements quic.Stream, the peer reads io.EOF after the data written.
+func (s *pipeStream) Close() error {
+	s.cancel()
+	return s.writer.Close()
+}
+
+// CancelRead implements quic.Stream, the writes of the peer fail.
+func (s *pipeStream) CancelRead(code quic.ErrorCode) error {
+	return s.reader.CloseWithError(&streamError{code: code})
+}
+
+// CancelWrite implements quic.Stream, the reads of the peer fail.
+func (s *pipeStream) CancelWrite(code quic.ErrorCode) error {
+	s.cancel()
+	return s.writer.CloseWithError(&streamError{code: code})
+}
+
+// Context implements quic.Stream, it is cancelled when the sending is finished.
+func (s *pipeStream) Context() context.Context {
+	return s.ctx
+}
+
+// SetReadDeadline implements quic.Stream, deadlines are ignored.
+func (s *pipeStream) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline implements quic.Stream, deadlines are ignored.
+func (s *pipeStream) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// SetDeadline implements quic.Stream, deadlines are ignored.
+func (s *pipeStream) SetDeadline(t time.Time) error {
+	return nil
+}
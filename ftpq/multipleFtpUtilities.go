@@ -0,0 +1,102 @@
+// Contains the functions for parallel transfer with multiple subconnections
+// in one QUIC-connection. Store and receive of files is possible.
+
+package ftpq
+
+import (
+	"context"
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+// MultipleTransfer issues STOR and RETR FTP commands in parallel subconnections to transfer
+// multiple files between the client and the remote FTP server.
+// The files are transfered as specified in tasks. The number of parallel
+// subconnections can be limited. nrParallel < 0 means no limit
+// The result of each task is returned in the order of the tasks. Cancelling
+// the context aborts the transfers. For further options, e.g. a dry run, use
+// NewTransferScheduler.
+func (subC *ServerSubConn) MultipleTransfer(ctx context.Context, tasks []ftps_qftp_client.TransferTask, nrParallel int) (ftps_qftp_client.TransferResults, error) {
+	scheduler, err := subC.NewTransferScheduler(nrParallel)
+	if err != nil {
+		return nil, err
+	}
+	return scheduler.Run(ctx, tasks), nil
+}
+
+// NewTransferScheduler creates a scheduler for parallel transfers, whose subconnections
+// are logged in like this subconnection and start in its current directory.
+func (subC *ServerSubConn) NewTransferScheduler(nrParallel int) (*ftps_qftp_client.TransferScheduler, error) {
+	currentdirctory, err := subC.CurrentDir()
+	if err != nil {
+		return nil, err
+	}
+	openConn := func() (ftps_qftp_client.ConnectionI, error) {
+		return subC.openParallelSubConn(currentdirctory)
+	}
+	return ftps_qftp_client.NewTransferScheduler(nrParallel, openConn), nil
+}
+
+// ParallelWalk walks the remote file tree below root like
+// ftps_qftp_client.Walk, but lists sibling directories concurrently in up to
+// nrParallel further subconnections of the QUIC-connection, which are set up
+// like for MultipleTransfer. fn is called in the same order as by Walk and
+// never concurrently.
+func (subC *ServerSubConn) ParallelWalk(root string, nrParallel int, fn ftps_qftp_client.WalkFunc) error {
+	currentdirctory, err := subC.CurrentDir()
+	if err != nil {
+		return err
+	}
+	openConn := func() (ftps_qftp_client.ConnectionI, error) {
+		return subC.openParallelSubConn(currentdirctory)
+	}
+	return ftps_qftp_client.ParallelWalk(openConn, nrParallel, root, fn)
+}
+
+// Opens a further subconnection for a parallel transfer, which is logged in
+// and in the specified directory.
+func (subC *ServerSubConn) openParallelSubConn(dirctory string) (*ServerSubConn, error) {
+	parallelSubC, _, err := subC.serverConnection.GetNewSubConn()
+	if err != nil {
+		return nil, err
+	}
+	// Take over the settings of the main subconnection
+	parallelSubC.loginHook = subC.loginHook
+	parallelSubC.commandLogger = subC.commandLogger
+	parallelSubC.transferType = subC.transferType
+	parallelSubC.maxLineLength = subC.maxLineLength
+	parallelSubC.bufferSize = subC.bufferSize
+	parallelSubC.retrSize = subC.retrSize
+	parallelSubC.serverLocation = subC.serverLocation
+	parallelSubC.encoding = subC.encoding
+	parallelSubC.hooks = subC.hooks
+	parallelSubC.hooks.Connected(subC.serverConnection.RemoteAddr().String())
+	// Login in
+	err = parallelSubC.Login(subC.username, subC.password)
+	if err != nil {
+		parallelSubC.Quit()
+		return nil, err
+	}
+	// Change to directory of the main subconnection
+	err = parallelSubC.ChangeDir(dirctory)
+	if err != nil {
+		parallelSubC.Quit()
+		return nil, err
+	}
+	return parallelSubC, nil
+}
+
+// Copy copies a remote file to another path on the server. The file is
+// retrieved on this subconnection and stored on a further subconnection of
+// the same QUIC session, so the data just passes the buffer of the client.
+func (subC *ServerSubConn) Copy(sourcePath string, destinationPath string) error {
+	currentdirctory, err := subC.CurrentDir()
+	if err != nil {
+		return err
+	}
+	destination, err := subC.openParallelSubConn(currentdirctory)
+	if err != nil {
+		return err
+	}
+	defer destination.Quit()
+	return ftps_qftp_client.Copy(subC, sourcePath, destination, destinationPath)
+}
@@ -0,0 +1,351 @@
+// Contains the multiplexed transfers on a single subconnection.
+
+package ftpq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/internal/ftputil"
+	"github.com/lucas-clemente/quic-go"
+)
+
+// Feature of servers, which handle further commands while transfers are
+// running. The preliminary and the final replies of transfers then start
+// with the ID of their data stream, e.g. "226 7 Transfer complete.".
+const featureMultiplex = "MULTIPLEX"
+
+// ErrMultiplexerClosed is returned by the transfers of a Multiplexer, after
+// it was closed.
+var ErrMultiplexerClosed = errors.New("The multiplexer is closed.")
+
+// Multiplexer runs several transfers on a single subconnection at the same
+// time, so the data streams of a QUIC connection are used without opening a
+// control stream for each transfer. The replies to the transfers are
+// assigned by the IDs of their data streams. Its methods can be called from
+// several goroutines.
+//
+// While the multiplexer is open, the subconnection is busy and its methods
+// fail with ErrBusy.
+type Multiplexer struct {
+	subC      *ServerSubConn
+	sendMutex sync.Mutex        // held from sending a command till its reply is received
+	replies   chan commandReply // replies to the commands in the order of the commands
+	stopped   chan struct{}     // closed when the replies are no longer read
+	running   sync.WaitGroup    // transfers, whose final reply was not yet received
+	mutex     sync.Mutex
+	transfers map[quic.StreamID]chan commandReply // final replies of the running transfers
+	stopping  bool                                // the replies are read till the next reply to a command
+	closed    bool
+	err       error // error of the control stream, nil while usable
+}
+
+// Reply or error received on the control stream
+type commandReply struct {
+	code    int
+	message string
+	err     error
+}
+
+// Multiplex enables multiplexed transfers with the command OPTS MULTIPLEX ON,
+// if the server announces the feature MULTIPLEX. The subconnection can be
+// used again after the multiplexer was closed.
+func (subC *ServerSubConn) Multiplex() (*Multiplexer, error) {
+	if _, available := ftputil.LookupFeature(subC.features, featureMultiplex); !available {
+		return nil, errors.New("The server does not support multiplexed transfers.")
+	}
+	_, _, err := subC.cmd(StatusCommandOK, "OPTS %s ON", featureMultiplex)
+	if err != nil {
+		return nil, err
+	}
+	if !atomic.CompareAndSwapInt32(&subC.busy, 0, 1) {
+		return nil, ftps_qftp_client.ErrBusy
+	}
+	m := &Multiplexer{subC: subC, replies: make(chan commandReply, 1), stopped: make(chan struct{}),
+		transfers: make(map[quic.StreamID]chan commandReply)}
+	go m.readReplies()
+	return m, nil
+}
+
+// Reads the replies from the control stream and passes them to the waiting
+// command or transfer, till the multiplexer is closed or the stream fails.
+func (m *Multiplexer) readReplies() {
+	defer close(m.stopped)
+	for {
+		code, message, err := m.subC.readReply()
+		if ftputil.IsServiceClosing(code, err) {
+			err = m.subC.setClosing(code, m.subC.redact(message), err)
+		}
+		if err != nil {
+			m.fail(err)
+			return
+		}
+
+		reply := commandReply{code: code, message: message}
+		id, hasID := dataStreamID(message)
+		m.mutex.Lock()
+		if transfer, running := m.transfers[id]; hasID && running && !ftps_qftp_client.IsPositivePreliminary(code) {
+			delete(m.transfers, id)
+			m.mutex.Unlock()
+			transfer <- reply
+			m.running.Done()
+			continue
+		}
+		if hasID && (code == StatusAlreadyOpen || code == StatusAboutToSend) {
+			// Registered before the final reply can be read
+			m.transfers[id] = make(chan commandReply, 1)
+			m.running.Add(1)
+		}
+		stopping := m.stopping
+		m.mutex.Unlock()
+		m.replies <- reply
+		if stopping {
+			return
+		}
+	}
+}
+
+// Passes the error of the control stream to the waiting transfers.
+func (m *Multiplexer) fail(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.err = err
+	for id, transfer := range m.transfers {
+		transfer <- commandReply{err: err}
+		delete(m.transfers, id)
+		m.running.Done()
+	}
+}
+
+// Returns the ID of the data stream at the start of the message of a reply.
+func dataStreamID(message string) (quic.StreamID, bool) {
+	field := strings.SplitN(message, " ", 2)[0]
+	id, err := strconv.ParseInt(field, 10, 64)
+	if err != nil || id < 0 || id%4 < 2 {
+		// Just unidirectional streams carry data
+		return 0, false
+	}
+	return quic.StreamID(id), true
+}
+
+// Sends a command and waits for its reply. The caller holds sendMutex.
+func (m *Multiplexer) command(format string, args ...interface{}) commandReply {
+	m.mutex.Lock()
+	err := m.err
+	if m.closed {
+		err = ErrMultiplexerClosed
+	}
+	m.mutex.Unlock()
+	if err != nil {
+		return commandReply{err: err}
+	}
+
+	line := fmt.Sprintf(format, args...)
+	m.subC.log("> " + ftputil.RedactCommand(line))
+	encoded, err := ftputil.EncodeString(m.subC.encoding, line)
+	if err != nil {
+		return commandReply{err: errors.New(ftputil.RedactCommand(err.Error()))}
+	}
+	if _, err = m.subC.controlStream.Cmd("%s", encoded); err != nil {
+		return commandReply{err: err}
+	}
+	select {
+	case reply := <-m.replies:
+		return reply
+	case <-m.stopped:
+	}
+	select {
+	case reply := <-m.replies:
+		return reply
+	default:
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return commandReply{err: m.err}
+}
+
+// Returns the channel of the final reply to the transfer of the data stream.
+func (m *Multiplexer) transfer(id quic.StreamID) chan commandReply {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.transfers[id]
+}
+
+// Checks the final reply to a transfer.
+func (m *Multiplexer) finalError(reply commandReply) error {
+	if reply.err != nil {
+		return reply.err
+	}
+	if reply.code != StatusClosingDataConnection {
+		return &textproto.Error{Code: reply.code, Msg: m.subC.redact(reply.message)}
+	}
+	return nil
+}
+
+// Retr issues a RETR FTP command to fetch the specified file from the remote
+// FTP server like ServerSubConn.Retr, but further transfers can be started
+// before the returned reader is closed.
+func (m *Multiplexer) Retr(path string) (io.ReadCloser, error) {
+	return m.RetrFrom(path, 0)
+}
+
+// RetrFrom issues a RETR FTP command like Retr, the server skips offset bytes
+// of the file.
+func (m *Multiplexer) RetrFrom(path string, offset uint64) (io.ReadCloser, error) {
+	m.sendMutex.Lock()
+	if offset != 0 {
+		reply := m.command("REST %d", offset)
+		if reply.err == nil && reply.code != StatusRequestFilePending {
+			reply.err = &textproto.Error{Code: reply.code, Msg: m.subC.redact(reply.message)}
+		}
+		if reply.err != nil {
+			m.sendMutex.Unlock()
+			return nil, reply.err
+		}
+	}
+	reply := m.command("RETR %s", path)
+	m.sendMutex.Unlock()
+	if reply.err != nil {
+		return nil, reply.err
+	}
+	id, hasID := dataStreamID(reply.message)
+	if !hasID || (reply.code != StatusAlreadyOpen && reply.code != StatusAboutToSend) {
+		return nil, &textproto.Error{Code: reply.code, Msg: m.subC.redact(reply.message)}
+	}
+	done := m.transfer(id)
+
+	stream, err := m.subC.getDataRetriveStream(id)
+	if err != nil {
+		<-done
+		return nil, err
+	}
+	m.subC.hooks.TransferStarted("RETR", path)
+	r := &multiplexResponse{stream: stream, done: done, m: m, path: path}
+	if m.subC.transferType == ftps_qftp_client.ASCII {
+		r.reader = ftputil.NewFromNetworkReader(stream)
+	}
+	return r, nil
+}
+
+// Stor issues a STOR FTP command to store the data of the reader like
+// ServerSubConn.Stor, while further transfers are running.
+func (m *Multiplexer) Stor(path string, r io.Reader) error {
+	return m.StorFrom(path, r, 0)
+}
+
+// StorFrom issues a STOR FTP command like Stor, the server stores the data
+// from offset bytes of the file on.
+func (m *Multiplexer) StorFrom(path string, r io.Reader, offset uint64) error {
+	stream, err := m.subC.getNewDataSendStream()
+	if err != nil {
+		return err
+	}
+	m.sendMutex.Lock()
+	reply := commandReply{code: StatusRequestFilePending}
+	if offset != 0 {
+		reply = m.command("REST %d", offset)
+	}
+	if reply.err == nil && reply.code == StatusRequestFilePending {
+		reply = m.command("STOR %d %s", stream.StreamID(), path)
+	} else if reply.err == nil {
+		reply.err = &textproto.Error{Code: reply.code, Msg: m.subC.redact(reply.message)}
+	}
+	m.sendMutex.Unlock()
+	if reply.err == nil && reply.code != StatusAlreadyOpen && reply.code != StatusAboutToSend {
+		reply.err = &textproto.Error{Code: reply.code, Msg: m.subC.redact(reply.message)}
+	}
+	if reply.err != nil {
+		stream.CancelWrite(ErrorCodeClosed)
+		return reply.err
+	}
+	done := m.transfer(stream.StreamID())
+	m.subC.hooks.TransferStarted("STOR", path)
+
+	if m.subC.transferType == ftps_qftp_client.ASCII {
+		r = ftputil.NewToNetworkReader(r)
+	}
+	n, err := ftps_qftp_client.BufferPoolOfSize(m.subC.bufferSize).CopyFast(stream, r)
+	if err != nil {
+		// Reset the stream, so the server does not take the data as complete
+		stream.CancelWrite(ErrorCodeClosed)
+		<-done
+	} else {
+		stream.Close()
+		err = m.finalError(<-done)
+	}
+	m.subC.hooks.TransferCompleted("STOR", path, n, err)
+	return err
+}
+
+// Close waits till the running transfers are finished and disables the
+// multiplexing with OPTS MULTIPLEX OFF. The readers returned by Retr must be
+// closed before.
+func (m *Multiplexer) Close() error {
+	m.running.Wait()
+	m.sendMutex.Lock()
+	defer m.sendMutex.Unlock()
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return ErrMultiplexerClosed
+	}
+	m.stopping = true
+	m.mutex.Unlock()
+
+	reply := m.command("OPTS %s OFF", featureMultiplex)
+	<-m.stopped
+	m.mutex.Lock()
+	m.closed = true
+	m.mutex.Unlock()
+	atomic.StoreInt32(&m.subC.busy, 0)
+	if reply.err == nil && reply.code != StatusCommandOK {
+		reply.err = &textproto.Error{Code: reply.code, Msg: m.subC.redact(reply.message)}
+	}
+	return reply.err
+}
+
+// Data stream of a multiplexed retrieve
+type multiplexResponse struct {
+	stream quic.ReceiveStream
+	reader io.Reader // converts the data of stream, nil to read it unchanged
+	done   chan commandReply
+	m      *Multiplexer
+	path   string
+	ftps_qftp_client.ReceiveCounter
+}
+
+// Read implements the io.Reader interface on a FTP data stream.
+func (r *multiplexResponse) Read(buf []byte) (n int, err error) {
+	if r.reader != nil {
+		n, err = r.reader.Read(buf)
+	} else {
+		n, err = r.stream.Read(buf)
+	}
+	r.Count(int64(n), err)
+	return n, err
+}
+
+// Close implements the io.Closer interface on a FTP data stream. Like the
+// readers of ServerSubConn.Retr a stream not read to its end is cancelled,
+// before the final reply is awaited, 426 or 226 for the interrupted transfer.
+func (r *multiplexResponse) Close() error {
+	running := r.ReceiveState() == ftps_qftp_client.ReceiveRunning
+	r.Interrupt()
+	if running {
+		r.stream.CancelRead(ErrorCodeClosed)
+	}
+	reply := <-r.done
+	if running && reply.err == nil && reply.code == StatusTransfertAborted {
+		reply.code = StatusClosingDataConnection
+	}
+	err := r.m.finalError(reply)
+	r.m.subC.hooks.TransferCompleted("RETR", r.path, r.BytesReceived(), err)
+	return err
+}
@@ -1,110 +1,60 @@
 package ftpq
 
-// FTP status codes, defined in RFC 959
-const (
-	StatusInitiating    = 100
-	StatusRestartMarker = 110
-	StatusReadyMinute   = 120
-	StatusAlreadyOpen   = 125
-	StatusAboutToSend   = 150
-
-	StatusCommandOK             = 200
-	StatusCommandNotImplemented = 202
-	StatusSystem                = 211
-	StatusDirectory             = 212
-	StatusFile                  = 213
-	StatusHelp                  = 214
-	StatusName                  = 215
-	StatusReady                 = 220
-	StatusClosing               = 221
-	StatusDataConnectionOpen    = 225
-	StatusClosingDataConnection = 226
-	StatusPassiveMode           = 227
-	StatusLongPassiveMode       = 228
-	StatusExtendedPassiveMode   = 229
-	StatusLoggedIn              = 230
-	StatusLoggedOut             = 231
-	StatusLogoutAck             = 232
-	StatusAuthTLS               = 234
-	StatusRequestedFileActionOK = 250
-	StatusPathCreated           = 257
-
-	StatusUserOK             = 331
-	StatusLoginNeedAccount   = 332
-	StatusRequestFilePending = 350
+import "github.com/attenberger/ftps_qftp-client"
 
-	StatusNotAvailable             = 421
-	StatusCanNotOpenDataConnection = 425
-	StatusTransfertAborted         = 426
-	StatusInvalidCredentials       = 430
-	StatusHostUnavailable          = 434
-	StatusFileActionIgnored        = 450
-	StatusActionAborted            = 451
-	Status452                      = 452
-
-	StatusBadCommand              = 500
-	StatusBadArguments            = 501
-	StatusNotImplemented          = 502
-	StatusBadSequence             = 503
-	StatusNotImplementedParameter = 504
-	StatusNotLoggedIn             = 530
-	StatusStorNeedAccount         = 532
-	StatusNeedTLS                 = 534
-	StatusFileUnavailable         = 550
-	StatusPageTypeUnknown         = 551
-	StatusExceededStorage         = 552
-	StatusBadFileName             = 553
+// FTP status codes. They are the ones of the package ftps_qftp_client, which
+// also classifies them, e.g. with IsPositiveCompletion.
+const (
+	StatusInitiating    = ftps_qftp_client.StatusInitiating
+	StatusRestartMarker = ftps_qftp_client.StatusRestartMarker
+	StatusReadyMinute   = ftps_qftp_client.StatusReadyMinute
+	StatusAlreadyOpen   = ftps_qftp_client.StatusAlreadyOpen
+	StatusAboutToSend   = ftps_qftp_client.StatusAboutToSend
+
+	StatusCommandOK             = ftps_qftp_client.StatusCommandOK
+	StatusCommandNotImplemented = ftps_qftp_client.StatusCommandNotImplemented
+	StatusSystem                = ftps_qftp_client.StatusSystem
+	StatusDirectory             = ftps_qftp_client.StatusDirectory
+	StatusFile                  = ftps_qftp_client.StatusFile
+	StatusHelp                  = ftps_qftp_client.StatusHelp
+	StatusName                  = ftps_qftp_client.StatusName
+	StatusReady                 = ftps_qftp_client.StatusReady
+	StatusClosing               = ftps_qftp_client.StatusClosing
+	StatusDataConnectionOpen    = ftps_qftp_client.StatusDataConnectionOpen
+	StatusClosingDataConnection = ftps_qftp_client.StatusClosingDataConnection
+	StatusPassiveMode           = ftps_qftp_client.StatusPassiveMode
+	StatusLongPassiveMode       = ftps_qftp_client.StatusLongPassiveMode
+	StatusExtendedPassiveMode   = ftps_qftp_client.StatusExtendedPassiveMode
+	StatusLoggedIn              = ftps_qftp_client.StatusLoggedIn
+	StatusLoggedOut             = ftps_qftp_client.StatusLoggedOut
+	StatusLogoutAck             = ftps_qftp_client.StatusLogoutAck
+	StatusAuthTLS               = ftps_qftp_client.StatusAuthTLS
+	StatusRequestedFileActionOK = ftps_qftp_client.StatusRequestedFileActionOK
+	StatusPathCreated           = ftps_qftp_client.StatusPathCreated
+
+	StatusUserOK             = ftps_qftp_client.StatusUserOK
+	StatusLoginNeedAccount   = ftps_qftp_client.StatusLoginNeedAccount
+	StatusRequestFilePending = ftps_qftp_client.StatusRequestFilePending
+
+	StatusNotAvailable             = ftps_qftp_client.StatusNotAvailable
+	StatusCanNotOpenDataConnection = ftps_qftp_client.StatusCanNotOpenDataConnection
+	StatusTransfertAborted         = ftps_qftp_client.StatusTransfertAborted
+	StatusInvalidCredentials       = ftps_qftp_client.StatusInvalidCredentials
+	StatusHostUnavailable          = ftps_qftp_client.StatusHostUnavailable
+	StatusFileActionIgnored        = ftps_qftp_client.StatusFileActionIgnored
+	StatusActionAborted            = ftps_qftp_client.StatusActionAborted
+	Status452                      = ftps_qftp_client.Status452
+
+	StatusBadCommand              = ftps_qftp_client.StatusBadCommand
+	StatusBadArguments            = ftps_qftp_client.StatusBadArguments
+	StatusNotImplemented          = ftps_qftp_client.StatusNotImplemented
+	StatusBadSequence             = ftps_qftp_client.StatusBadSequence
+	StatusNotImplementedParameter = ftps_qftp_client.StatusNotImplementedParameter
+	StatusNotLoggedIn             = ftps_qftp_client.StatusNotLoggedIn
+	StatusStorNeedAccount         = ftps_qftp_client.StatusStorNeedAccount
+	StatusNeedTLS                 = ftps_qftp_client.StatusNeedTLS
+	StatusFileUnavailable         = ftps_qftp_client.StatusFileUnavailable
+	StatusPageTypeUnknown         = ftps_qftp_client.StatusPageTypeUnknown
+	StatusExceededStorage         = ftps_qftp_client.StatusExceededStorage
+	StatusBadFileName             = ftps_qftp_client.StatusBadFileName
 )
-
-var statusText = map[int]string{
-	// 200
-	StatusCommandOK:             "Command okay.",
-	StatusCommandNotImplemented: "Command not implemented, superfluous at this site.",
-	StatusSystem:                "System status, or system help reply.",
-	StatusDirectory:             "Directory status.",
-	StatusFile:                  "File status.",
-	StatusHelp:                  "Help message.",
-	StatusName:                  "",
-	StatusReady:                 "Service ready for new user.",
-	StatusClosing:               "Service closing control connection.",
-	StatusDataConnectionOpen:    "Data connection open; no transfer in progress.",
-	StatusClosingDataConnection: "Closing data connection. Requested file action successful.",
-	StatusPassiveMode:           "Entering Passive Mode.",
-	StatusLongPassiveMode:       "Entering Long Passive Mode.",
-	StatusExtendedPassiveMode:   "Entering Extended Passive Mode.",
-	StatusLoggedIn:              "User logged in, proceed.",
-	StatusLoggedOut:             "User logged out; service terminated.",
-	StatusLogoutAck:             "Logout command noted, will complete when transfer done.",
-	StatusAuthTLS:               "Connection secured with TLS",
-	StatusRequestedFileActionOK: "Requested file action okay, completed.",
-	StatusPathCreated:           "Path created.",
-
-	// 300
-	StatusUserOK:             "User name okay, need password.",
-	StatusLoginNeedAccount:   "Need account for login.",
-	StatusRequestFilePending: "Requested file action pending further information.",
-
-	// 400
-	StatusNotAvailable:             "Service not available, closing control connection.",
-	StatusCanNotOpenDataConnection: "Can't open data connection.",
-	StatusTransfertAborted:         "Connection closed; transfer aborted.",
-	StatusInvalidCredentials:       "Invalid username or password.",
-	StatusHostUnavailable:          "Requested hostname unavailable.",
-	StatusFileActionIgnored:        "Requested file action not taken.",
-	StatusActionAborted:            "Requested action aborted. Local error in processing.",
-	Status452:                      "Insufficient storage space in system.",
-
-	// 500
-	StatusBadCommand:              "Command unrecognized.",
-	StatusBadArguments:            "Syntax error in parameters or arguments.",
-	StatusNotImplemented:          "Command not implemented.",
-	StatusBadSequence:             "Bad sequence of commands.",
-	StatusNotImplementedParameter: "Command not implemented for that parameter.",
-	StatusNotLoggedIn:             "Not logged in.",
-	StatusStorNeedAccount:         "Need account for storing files.",
-	StatusNeedTLS:                 "AUTH TLS requrired.",
-	StatusFileUnavailable:         "File unavailable.",
-	StatusPageTypeUnknown:         "Page type unknown.",
-	StatusExceededStorage:         "Exceeded storage allocation.",
-	StatusBadFileName:             "File name not allowed.",
-}
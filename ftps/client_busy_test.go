@@ -0,0 +1,87 @@
+package ftps
+
+import (
+	"errors"
+	"fmt"
+	"github.com/attenberger/ftps_qftp-client"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"testing"
+)
+
+func TestBusy(t *testing.T) {
+	client, server := net.Pipe()
+	c := &ServerConn{conn: textproto.NewConn(client), tcpconn: client, features: make(map[string]string)}
+	defer c.Close()
+
+	received := make(chan bool)
+	reply := make(chan bool)
+	go func() {
+		proto := textproto.NewConn(server)
+		proto.ReadLine()
+		received <- true
+		<-reply
+		proto.Writer.PrintfLine("200 NOOP ok.")
+		proto.ReadLine()
+		proto.Writer.PrintfLine("200 NOOP ok.")
+	}()
+
+	result := make(chan error)
+	go func() {
+		result <- c.NoOp()
+	}()
+
+	<-received
+	if err := c.NoOp(); !errors.Is(err, ftps_qftp_client.ErrBusy) {
+		t.Errorf("NoOp while waiting for a reply returned %v, want ErrBusy", err)
+	}
+	reply <- true
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	// Usable again after the reply
+	if err := c.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Reader failing at once
+type failingReader struct{}
+
+func (failingReader) Read(buf []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestStorFailureReleasesConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			ioutil.ReadAll(conn)
+			conn.Close()
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	commands := make(chan []string, 1)
+	c := newScriptedConn(t, map[string][]string{
+		"PASV":         {fmt.Sprintf("227 Entering Passive Mode (127,0,0,1,%d,%d).", port/256, port%256)},
+		"STOR big.txt": {"150 Ok to send data.", "426 Transfer aborted."},
+		"NOOP":         {"200 NOOP ok."},
+	}, "NOOP", commands)
+	defer c.Close()
+	c.hostname = "127.0.0.1"
+
+	if err = c.Stor("big.txt", failingReader{}); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if err = c.NoOp(); err != nil {
+		t.Errorf("NoOp after the failed store returned %v", err)
+	}
+}
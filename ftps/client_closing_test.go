@@ -0,0 +1,60 @@
+package ftps
+
+import (
+	"errors"
+	"github.com/attenberger/ftps_qftp-client"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+func TestServiceClosing(t *testing.T) {
+	client, server := net.Pipe()
+	c := &ServerConn{conn: textproto.NewConn(client), tcpconn: client, features: make(map[string]string)}
+
+	go func() {
+		proto := textproto.NewConn(server)
+		proto.ReadLine()
+		proto.Writer.PrintfLine("421 Timeout.")
+		server.Close()
+	}()
+
+	err := c.NoOp()
+	if !errors.Is(err, ftps_qftp_client.ErrServiceClosing) {
+		t.Fatalf("NoOp returned %v, want ErrServiceClosing", err)
+	}
+	if !ftps_qftp_client.IsTransientError(err) {
+		t.Error("ErrServiceClosing is not transient")
+	}
+
+	// Following calls fail without sending the command
+	if _, err = c.CurrentDir(); !errors.Is(err, ftps_qftp_client.ErrServiceClosing) {
+		t.Errorf("CurrentDir returned %v, want ErrServiceClosing", err)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	c := &ServerConn{conn: textproto.NewConn(client), tcpconn: client, features: make(map[string]string)}
+	c.SetCommandTimeout(50 * time.Millisecond)
+
+	replied := make(chan struct{})
+	go func() {
+		proto := textproto.NewConn(server)
+		proto.ReadLine()
+		proto.Writer.PrintfLine("200 NOOP ok.")
+		proto.ReadLine()
+		<-replied
+		server.Close()
+	}()
+
+	if err := c.NoOp(); err != nil {
+		t.Fatalf("NoOp returned %v before the timeout", err)
+	}
+	err := c.NoOp()
+	close(replied)
+	if !errors.Is(err, ftps_qftp_client.ErrServiceClosing) {
+		t.Errorf("NoOp returned %v without a reply, want ErrServiceClosing", err)
+	}
+}
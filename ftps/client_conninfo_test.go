@@ -0,0 +1,39 @@
+package ftps
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+func TestConnectionInfo(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	c, err := DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+
+	if welcome := c.Welcome(); welcome != "ftptest ready." {
+		t.Errorf("Welcome() = %q, want %q", welcome, "ftptest ready.")
+	}
+	if addr := c.RemoteAddr().String(); addr != server.Addr() {
+		t.Errorf("RemoteAddr() = %s, want %s", addr, server.Addr())
+	}
+	if c.LocalAddr() == nil {
+		t.Error("LocalAddr() = nil")
+	}
+	if _, secured := c.TLSConnectionState(); secured {
+		t.Error("TLSConnectionState() reports a secured connection before AuthTLS")
+	}
+
+	if err = c.AuthTLS(); err != nil {
+		t.Fatal(err)
+	}
+	state, secured := c.TLSConnectionState()
+	if !secured || !state.HandshakeComplete || state.Version < tls.VersionTLS12 || len(state.PeerCertificates) == 0 {
+		t.Errorf("TLSConnectionState() = %+v, %v after AuthTLS", state, secured)
+	}
+}
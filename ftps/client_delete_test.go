@@ -0,0 +1,63 @@
+package ftps
+
+import (
+	"net/textproto"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client/ftps/ftptest"
+)
+
+func TestDeleteAll(t *testing.T) {
+	server, err := ftptest.NewServer(username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	// More commands than fit into the buffers of the connection
+	var paths []string
+	for i := 0; i < 2000; i++ {
+		path := "/dir/file" + strconv.Itoa(i)
+		server.AddFile(path, []byte(testData))
+		paths = append(paths, path)
+	}
+	paths = append(paths[:1000], append([]string{"/dir/missing"}, paths[1000:]...)...)
+
+	c, err := DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err = c.Login(username, password); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := c.DeleteAll(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(paths) {
+		t.Fatalf("%d results for %d paths", len(results), len(paths))
+	}
+	for i, result := range results {
+		if result.Path != paths[i] {
+			t.Fatalf("result %d for %s, want %s", i, result.Path, paths[i])
+		}
+		if _, exists := server.File(result.Path); exists {
+			t.Errorf("%s not deleted", result.Path)
+		}
+	}
+	failed := results.Failed()
+	if len(failed) != 1 || failed[0] != "/dir/missing" {
+		t.Errorf("Failed() = %v", failed)
+	}
+	if protoErr, ok := results[1000].Err.(*textproto.Error); !ok || protoErr.Code != StatusFileUnavailable {
+		t.Errorf("deleting the missing file returned %v", results[1000].Err)
+	}
+
+	// The replies are in sync with the commands
+	if err = c.NoOp(); err != nil {
+		t.Error(err)
+	}
+}
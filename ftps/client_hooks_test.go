@@ -0,0 +1,90 @@
+package ftps
+
+import (
+	"bytes"
+	"github.com/attenberger/ftps_qftp-client"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionHooks(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	c, err := DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+
+	var mutex sync.Mutex
+	var events []string
+	record := func(event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	}
+	c.SetSessionHooks(ftps_qftp_client.SessionHooks{
+		OnConnect: func(addr string) {
+			record("connect " + addr)
+		},
+		OnLogin: func(user string) {
+			record("login " + user)
+		},
+		OnTransferStart: func(command string, path string) {
+			record("start " + command + " " + path)
+		},
+		OnTransferComplete: func(command string, path string, bytes int64, err error) {
+			record("complete " + command + " " + path + " " + strconv.FormatInt(bytes, 10))
+			if err != nil {
+				t.Errorf("The transfer of %s failed: %v", path, err)
+			}
+		},
+		OnError: func(err error) {
+			t.Errorf("OnError received %v", err)
+		},
+	})
+
+	if err = c.Login(username, password); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Stor("/incoming/hooks.txt", bytes.NewBufferString("hooks")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Retr("/incoming/hooks.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(r)
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Listings are no file transfers
+	if _, err = c.NameList("/incoming"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"login " + username,
+		"start STOR /incoming/hooks.txt",
+		"complete STOR /incoming/hooks.txt 5",
+		"start RETR /incoming/hooks.txt",
+		"complete RETR /incoming/hooks.txt 5",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("The hooks received %q, expected %q", events, expected)
+	}
+
+	// The further connection of Copy takes over the hooks
+	events = nil
+	if err = c.Copy("/incoming/hooks.txt", "/incoming/copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) < 2 || events[0] != "connect "+server.Addr() || events[1] != "login "+username {
+		t.Errorf("The hooks received %q for Copy", events)
+	}
+}
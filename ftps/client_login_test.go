@@ -0,0 +1,123 @@
+package ftps
+
+import (
+	"github.com/attenberger/ftps_qftp-client"
+	"net"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoginHook(t *testing.T) {
+	client, server := net.Pipe()
+	c := &ServerConn{conn: textproto.NewConn(client), tcpconn: client, features: make(map[string]string)}
+	defer c.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		proto := textproto.NewConn(server)
+		var commands []string
+		defer func() { received <- commands }()
+		for {
+			command, err := proto.ReadLine()
+			if err != nil {
+				return
+			}
+			commands = append(commands, command)
+			switch command {
+			case "USER otpuser":
+				proto.Writer.PrintfLine("331 Response to otp-md5 99 seed required.")
+			case "PASS 6789":
+				proto.Writer.PrintfLine("332 Need account for login.")
+			case "ACCT billing":
+				proto.Writer.PrintfLine("230 Logged in.")
+			case "TYPE I":
+				proto.Writer.PrintfLine("200 Type set to I.")
+			case "FEAT":
+				proto.Writer.PrintfLine("211 End")
+				return
+			default:
+				proto.Writer.PrintfLine("500 Unknown command.")
+			}
+		}
+	}()
+
+	c.SetLoginHook(func(reply *ftps_qftp_client.Response) (string, error) {
+		switch reply.Code {
+		case StatusUserOK:
+			return "PASS 6789", nil
+		case StatusLoginNeedAccount:
+			return "ACCT billing", nil
+		}
+		return "", nil
+	})
+	if err := c.Login("otpuser", "unused"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"USER otpuser", "PASS 6789", "ACCT billing", "TYPE I", "FEAT"}
+	if commands := <-received; !reflect.DeepEqual(commands, expected) {
+		t.Errorf("commands %q, want %q", commands, expected)
+	}
+}
+
+func TestCommandLoggerRedacts(t *testing.T) {
+	client, server := net.Pipe()
+	c := &ServerConn{conn: textproto.NewConn(client), tcpconn: client, features: make(map[string]string)}
+	defer c.Close()
+
+	go func() {
+		proto := textproto.NewConn(server)
+		proto.ReadLine()
+		proto.Writer.PrintfLine("331 Password required.")
+		proto.ReadLine()
+		proto.Writer.PrintfLine("530 Wrong password s3cret.")
+	}()
+
+	var log []string
+	c.SetCommandLogger(func(line string) {
+		log = append(log, line)
+	})
+	err := c.Login("user", "s3cret")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("password in error %q", err)
+	}
+
+	expected := []string{"> USER user", "< 331 Password required.", "> PASS ****", "< 530 Wrong password ****."}
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("logged %q, want %q", log, expected)
+	}
+}
+
+func TestRedactKeepsReplies(t *testing.T) {
+	commands := make(chan []string, 1)
+	c := newScriptedConn(t, map[string][]string{
+		"PWD":  {`257 "/data1" is the current directory.`},
+		"SIZE": {"550 No file 1."},
+	}, "SIZE", commands)
+	defer c.Close()
+	c.password = "1"
+
+	var log []string
+	c.SetCommandLogger(func(line string) {
+		log = append(log, line)
+	})
+	dir, err := c.CurrentDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != "/data1" {
+		t.Errorf("CurrentDir returned %q, want /data1", dir)
+	}
+	_, _, err = c.cmd(StatusFile, "SIZE")
+	if err == nil || strings.Contains(err.Error(), "1.") {
+		t.Errorf("password not masked in error %v", err)
+	}
+	if log[1] != `< 257 "/data****" is the current directory.` {
+		t.Errorf("logged %q", log[1])
+	}
+}
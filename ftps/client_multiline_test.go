@@ -105,3 +105,27 @@ func TestMultiline(t *testing.T) {
 		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
 	}
 }
+
+// Progress replies (1xx) before the final reply and multiline final replies
+// must not bring the replies out of sync with the commands.
+func TestPreliminaryReplies(t *testing.T) {
+	commands := make(chan []string, 1)
+	c := newScriptedConn(t, map[string][]string{
+		"CWD dir":  {"110 Still working", "120 Almost done", "250 Directory changed."},
+		"MKD next": {"257-Statistics", "257-1 directory created", `257 "/dir/next" created`},
+		"NOOP":     {"200 NOOP ok."},
+	}, "NOOP", commands)
+
+	if err := c.ChangeDir("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MakeDir("next"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.NoOp(); err != nil {
+		t.Fatal(err)
+	}
+	if received := <-commands; len(received) != 3 {
+		t.Errorf("server received %q", received)
+	}
+}
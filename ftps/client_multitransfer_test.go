@@ -1,16 +1,12 @@
-// You need a FTPS-Server running to run the test.
-// The FTPS-Server must accept connections on the
-// IPv4 and IPv6 address.
-// Replace the constants according your FTPS-Server.
-// (The most relevant are in client_test.go.)
-// The root directory of your FTPS-Server must contain
-// the directory "incoming".
+// The tests run against the server of newTestServer in client_test.go.
 
 package ftps
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"github.com/attenberger/ftps_qftp-client"
 	"io/ioutil"
 	"os"
 	"strconv"
@@ -47,11 +43,10 @@ func TestMultiTransferInsecure(t *testing.T) {
 }
 
 func testMultiTransfer(t *testing.T, passive bool, secure bool, nrParallelConnections int) {
-	if testing.Short() {
-		t.Skip("skipping test in short mode.")
-	}
+	server := newTestServer(t)
+	defer server.Close()
 
-	c, err := DialTimeout(serverIPv4+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
+	c, err := DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -87,9 +82,11 @@ func testMultiTransfer(t *testing.T, passive bool, secure bool, nrParallelConnec
 		t.Error(err)
 	}
 
-	err = c.MultipleTransfer(createTransferTasks(), nrParallelConnections)
+	results, err := c.MultipleTransfer(context.Background(), createTransferTasks(), nrParallelConnections)
 	if err != nil {
 		t.Error(err)
+	} else if err = results.Err(); err != nil {
+		t.Error(err)
 	}
 
 	// Check remote
@@ -192,7 +189,7 @@ func prepareTestdata(conn *ServerConn) error {
 		return errors.New("The local test directory already exists.")
 	}
 
-	err := os.Mkdir(localTestDirectory, os.ModeDir)
+	err := os.Mkdir(localTestDirectory, 0755)
 	if err != nil {
 		return errors.New("The local test directory can not be created. " + err.Error())
 	}
@@ -227,14 +224,14 @@ func prepareTestdata(conn *ServerConn) error {
 	return nil
 }
 
-func createTransferTasks() []TransferTask {
-	tasks := make([]TransferTask, 0)
+func createTransferTasks() []ftps_qftp_client.TransferTask {
+	tasks := make([]ftps_qftp_client.TransferTask, 0)
 	for _, filenumber := range initialLocalFileNumbers {
-		task := NewTransferTask(Store, strconv.Itoa(filenumber)+".txt", strconv.Itoa(filenumber)+".txt")
+		task := ftps_qftp_client.NewTransferTask(ftps_qftp_client.Store, strconv.Itoa(filenumber)+".txt", strconv.Itoa(filenumber)+".txt")
 		tasks = append(tasks, task)
 	}
 	for _, filenumber := range initialRemoteFileNumbers {
-		task := NewTransferTask(Retrieve, strconv.Itoa(filenumber)+".txt", strconv.Itoa(filenumber)+".txt")
+		task := ftps_qftp_client.NewTransferTask(ftps_qftp_client.Retrieve, strconv.Itoa(filenumber)+".txt", strconv.Itoa(filenumber)+".txt")
 		tasks = append(tasks, task)
 	}
 	return tasks
@@ -0,0 +1,72 @@
+package ftps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAbsPath(t *testing.T) {
+	commands := make(chan []string, 1)
+	c := newScriptedConn(t, map[string][]string{
+		"PWD":      {"257 \"/home/user\" is the current directory."},
+		"CWD pub":  {"250 Directory successfully changed."},
+		"CDUP":     {"250 Directory successfully changed."},
+		"CWD /srv": {"250 Directory successfully changed."},
+	}, "CWD /srv", commands)
+	defer c.Close()
+
+	tests := []struct {
+		change   func() error
+		path     string
+		expected string
+	}{
+		{nil, "file.txt", "/home/user/file.txt"},
+		{func() error { return c.ChangeDir("pub") }, "../file.txt", "/home/user/file.txt"},
+		{c.ChangeDirToParent, ".", "/home/user"},
+		{func() error { return c.ChangeDir("/srv") }, "ftp//", "/srv/ftp"},
+		{nil, "/etc/../tmp", "/tmp"},
+	}
+	for _, test := range tests {
+		if test.change != nil {
+			if err := test.change(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		abs, err := c.AbsPath(test.path)
+		if err != nil || abs != test.expected {
+			t.Errorf("AbsPath(%q) = %q, %v, want %q", test.path, abs, err, test.expected)
+		}
+	}
+	// PWD is issued only once
+	if received := <-commands; !reflect.DeepEqual(received, []string{"PWD", "CWD pub", "CDUP", "CWD /srv"}) {
+		t.Errorf("server received %q", received)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	commands := make(chan []string, 1)
+	c := newScriptedConn(t, map[string][]string{
+		"CWD B\xfccher": {"250 Directory successfully changed."},
+		"PWD":           {"257 \"/B\xfccher\" is the current directory."},
+	}, "PWD", commands)
+	defer c.Close()
+
+	if err := c.SetEncoding("iso-8859-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ChangeDir("Bücher"); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := c.CurrentDir()
+	if err != nil || dir != "/Bücher" {
+		t.Errorf("CurrentDir = %q, %v", dir, err)
+	}
+	<-commands
+
+	if err = c.ChangeDir("本"); err == nil {
+		t.Error("ChangeDir with a name not available in the encoding succeeded")
+	}
+	if err = c.SetEncoding("klingon"); err == nil {
+		t.Error("SetEncoding with an unknown encoding succeeded")
+	}
+}
@@ -0,0 +1,112 @@
+package ftps
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+func TestResponseReceiveProgress(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		server.Write([]byte("0123456789"))
+		server.Close()
+	}()
+	r := &response{conn: client}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || len(data) != 10 {
+		t.Fatalf("Read %q, %v", data, err)
+	}
+	if r.BytesReceived() != 10 || r.ReceiveState() != ftps_qftp_client.ReceiveFinished {
+		t.Errorf("Finished data: %d bytes, state %d", r.BytesReceived(), r.ReceiveState())
+	}
+
+	client, server = net.Pipe()
+	go func() {
+		server.Write([]byte("01234"))
+		client.Close()
+	}()
+	r = &response{conn: client}
+	buf := make([]byte, 5)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Read(buf); err == nil {
+		t.Fatal("Read of the closed connection succeeded")
+	}
+	var progress io.Reader = r
+	if p, ok := progress.(ftps_qftp_client.ReceiveProgress); !ok || p.BytesReceived() != 5 || p.ReceiveState() != ftps_qftp_client.ReceiveReset {
+		t.Errorf("Reset data: %d bytes, state %d", r.BytesReceived(), r.ReceiveState())
+	}
+}
+
+func TestResponseWriteTo(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		server.Write([]byte("0123456789"))
+		server.Close()
+	}()
+	r := &response{conn: client, c: &ServerConn{}}
+	var written bytes.Buffer
+	n, err := io.Copy(&written, r)
+	if err != nil || n != 10 || written.String() != "0123456789" {
+		t.Fatalf("Copy returned %d, %v, %q", n, err, written.String())
+	}
+	if r.BytesReceived() != 10 || r.ReceiveState() != ftps_qftp_client.ReceiveFinished {
+		t.Errorf("Finished data: %d bytes, state %d", r.BytesReceived(), r.ReceiveState())
+	}
+}
+
+func TestRetrSize(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		data, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		data.Write([]byte("56789"))
+		data.Close()
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	commands := make(chan []string, 1)
+	c := newScriptedConn(t, map[string][]string{
+		"SIZE a.txt": {"213 10"},
+		"EPSV":       {"229 Entering Extended Passive Mode (|||" + strconv.Itoa(port) + "|)"},
+		"REST 5":     {"350 Restart position accepted (5)."},
+		"RETR a.txt": {"150 Opening data connection.", "226 Transfer complete."},
+	}, "RETR a.txt", commands)
+	defer c.Close()
+	c.hostname = "127.0.0.1"
+	c.features["EPSV"] = ""
+	c.SetRetrSize(true)
+
+	r, err := c.RetrFrom("a.txt", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := r.(ftps_qftp_client.SizedReader).Size(); size != 5 {
+		t.Errorf("Size returned %d, expected 5", size)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || string(data) != "56789" {
+		t.Errorf("Read %q, %v", data, err)
+	}
+	if err = r.Close(); err != nil {
+		t.Error(err)
+	}
+	expected := []string{"SIZE a.txt", "EPSV", "REST 5", "RETR a.txt"}
+	if received := <-commands; !reflect.DeepEqual(received, expected) {
+		t.Errorf("Received commands %q, expected %q", received, expected)
+	}
+}
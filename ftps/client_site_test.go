@@ -0,0 +1,63 @@
+package ftps
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestChmod(t *testing.T) {
+	commands := make(chan []string, 1)
+	c := newScriptedConn(t, map[string][]string{
+		"SITE CHMOD 755 bin/run.sh": {"200 SITE CHMOD command successful."},
+		"SITE CHMOD 4755 bin/sudo":  {"550 bin/sudo: Operation not permitted."},
+	}, "SITE CHMOD 4755 bin/sudo", commands)
+	defer c.Close()
+
+	if err := c.Chmod("bin/run.sh", 0755); err != nil {
+		t.Error(err)
+	}
+	if err := c.Chmod("bin/sudo", os.ModeSetuid|0755); err == nil {
+		t.Error("Chmod refused by the server succeeded")
+	}
+	if received := <-commands; !reflect.DeepEqual(received, []string{"SITE CHMOD 755 bin/run.sh", "SITE CHMOD 4755 bin/sudo"}) {
+		t.Errorf("server received %q", received)
+	}
+
+	// Not among the announced SITE commands
+	c.features["SITE"] = "UTIME"
+	if err := c.Chmod("bin/run.sh", 0644); err == nil {
+		t.Error("Chmod succeeded although SITE CHMOD is not announced")
+	}
+}
+
+func TestAvailableSpace(t *testing.T) {
+	commands := make(chan []string, 1)
+	c := newScriptedConn(t, map[string][]string{
+		"AVBL upload": {"213 1073741824"},
+	}, "AVBL upload", commands)
+	defer c.Close()
+	c.features["AVBL"] = ""
+
+	space, err := c.AvailableSpace("upload")
+	if err != nil || space != 1073741824 {
+		t.Errorf("AvailableSpace = %d, %v", space, err)
+	}
+	<-commands
+
+	quotaCommands := make(chan []string, 1)
+	quota := newScriptedConn(t, map[string][]string{
+		"SITE QUOTA": {
+			"200-The current quota for this session are [current/limit]:",
+			"200-  Uploaded bytes:         500.00/2000.00",
+			"200 Please contact root if these entries are inaccurate",
+		},
+	}, "SITE QUOTA", quotaCommands)
+	defer quota.Close()
+
+	space, err = quota.AvailableSpace("upload")
+	if err != nil || space != 1500 {
+		t.Errorf("AvailableSpace with SITE QUOTA = %d, %v", space, err)
+	}
+	<-quotaCommands
+}
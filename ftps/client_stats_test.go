@@ -0,0 +1,34 @@
+package ftps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandStats(t *testing.T) {
+	commands := make(chan []string, 1)
+	c := newScriptedConn(t, map[string][]string{
+		"NOOP": {"200 NOOP ok."},
+		"HELP": {"214-The following commands are recognized.", " ABOR CWD", " PWD", "214 Help OK."},
+	}, "HELP", commands)
+	defer c.Close()
+
+	if err := c.NoOp(); err != nil {
+		t.Fatal(err)
+	}
+	response, err := c.SendCommand("HELP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := response.Body(); !reflect.DeepEqual(body, []string{"ABOR CWD", "PWD"}) {
+		t.Errorf("Unexpected body %q", body)
+	}
+	stats := c.CommandStats()
+	if stats.Commands != 2 {
+		t.Errorf("Stats count %d commands, expected 2", stats.Commands)
+	}
+	if stats.LastTime != response.Duration || stats.TotalTime < response.Duration {
+		t.Errorf("Stats %+v don't match the duration %v of the last reply", stats, response.Duration)
+	}
+	<-commands
+}
@@ -1,9 +1,8 @@
-// You need a FTPS-Server running to run the test.
-// The FTPS-Server must accept connections on the
-// IPv4 and IPv6 address.
-// Replace the constants according your FTPS-Server.
-// The root directory of your FTPS-Server must contain
-// the directory "incoming".
+// Most tests run against the in-process server of the package ftptest. With
+// the build tag "integration" they run against vsftpd started by the package
+// integration instead.
+// Just TestConnIPv6 needs a FTPS-Server running, which accepts connections
+// on the IPv6 address. Replace the constants according your FTPS-Server.
 
 package ftps
 
@@ -14,6 +13,8 @@ import (
 	"strconv"
 	"testing"
 	"time"
+
+	"github.com/attenberger/ftps_qftp-client/ftps/ftptest"
 )
 
 // Replace them with your specific data.
@@ -40,12 +41,41 @@ func TestConnInsecure(t *testing.T) {
 	testConn(t, false, false)
 }
 
-func testConn(t *testing.T, passive bool, secure bool) {
-	if testing.Short() {
-		t.Skip("skipping test in short mode.")
+// Server the tests run against. It is started by startTestServer, which the
+// build tag "integration" replaces with the start of a real server.
+type testServer interface {
+	Addr() string
+	CertFile() string
+	Close() error
+}
+
+var startTestServer = startInProcessServer
+
+// Starts a server, whose root directory contains the directory "incoming".
+// It must be closed after the test.
+func newTestServer(t *testing.T) testServer {
+	server, err := startTestServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// Starts an in-process server of the package ftptest.
+func startInProcessServer() (testServer, error) {
+	server, err := ftptest.NewServer(username, password)
+	if err != nil {
+		return nil, err
 	}
+	server.AddDir("/incoming")
+	return server, nil
+}
 
-	c, err := DialTimeout(serverIPv4+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
+func testConn(t *testing.T, passive bool, secure bool) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	c, err := DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -213,11 +243,10 @@ func TestConnIPv6(t *testing.T) {
 
 // TestConnect tests the legacy Connect function
 func TestConnect(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping test in short mode.")
-	}
+	server := newTestServer(t)
+	defer server.Close()
 
-	c, err := Connect(serverIPv4+":"+strconv.Itoa(servercontrolport), serverCertificate)
+	c, err := Connect(server.Addr(), server.CertFile())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -238,11 +267,10 @@ func TestTimeout(t *testing.T) {
 }
 
 func TestWrongLogin(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping test in short mode.")
-	}
+	server := newTestServer(t)
+	defer server.Close()
 
-	c, err := DialTimeout(serverIPv4+":"+strconv.Itoa(servercontrolport), 5*time.Second, serverCertificate)
+	c, err := DialTimeout(server.Addr(), 5*time.Second, server.CertFile())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1,18 +1,22 @@
-// Package ftp implements a FTP client as described in RFC 959.
+// Package ftps implements a FTP client as described in RFC 959, which
+// secures the TCP control and data connections with TLS (FTPS, RFC 4217).
 package ftps
 
 import (
-	"bufio"
 	"crypto/tls"
-	"crypto/x509"
 	"errors"
+	"fmt"
 	"github.com/attenberger/ftps_qftp-client"
+	"github.com/attenberger/ftps_qftp-client/internal/ftputil"
+	"golang.org/x/text/encoding"
 	"io"
-	"io/ioutil"
 	"net"
 	"net/textproto"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,22 +24,44 @@ import (
 type ServerConn struct {
 	conn                        *textproto.Conn
 	tcpconn                     net.Conn
+	tlsConn                     *tls.Conn // control connection secured by AuthTLS, nil before
 	tlsConfig                   *tls.Config
 	tlsSecuredControlConnection bool
 	tlsSecuredDataConnection    bool
 	hostname                    string
+	welcome                     string // message of the welcome reply
 	hostcontrolport             string
 	username                    string
 	password                    string
-	certfilename                string
 	timeout                     time.Duration
+	commandTimeout              time.Duration // time to wait for a reply, 0 for no limit
 	features                    map[string]string
+	dataConn                    net.Conn // data connection of the last transfer
+	dataConnMutex               sync.Mutex
+	serverLocation              *time.Location                // time zone of the listed times, nil for UTC
+	retrSize                    bool                          // request the size of files with SIZE before retrieving them
+	bufferSize                  int                           // size of the buffers copying the data of transfers, 0 for the default
+	maxLineLength               int                           // maximal length of lines of listings, 0 for the default
+	transferType                ftps_qftp_client.TransferType // representation type of transfers
+	closingErr                  error                         // error of a closed control connection, nil while usable
+	closingErrMutex             sync.Mutex
+	busy                        int32                          // 1 while a command waits for its replies, accessed atomically
+	loginHook                   ftps_qftp_client.LoginHook     // continues the login after intermediate replies, nil for USER and PASS only
+	commandLogger               ftps_qftp_client.CommandLogger // receives the dialogue on the control connection, nil for none
+	currentDir                  string                         // current directory tracked by the client, empty if unknown
+	encoding                    encoding.Encoding              // encoding of paths and listings at the server, nil for UTF-8
+	timer                       ftps_qftp_client.CommandTimer  // timings of the replies to the commands
+	hooks                       ftps_qftp_client.SessionHooks  // called on the events of the session
 }
 
 // response represent a data-connection
 type response struct {
-	conn net.Conn
-	c    *ServerConn
+	conn   net.Conn
+	c      *ServerConn
+	reader io.Reader // converts the data of conn, nil to read it unchanged
+	size   int64     // bytes sent by the server, -1 if unknown
+	path   string    // retrieved file for the hooks, empty for listings
+	ftps_qftp_client.ReceiveCounter
 }
 
 // Connect is an alias to Dial, for backward compatibility
@@ -53,6 +79,23 @@ func Dial(addr string, certfile string) (*ServerConn, error) {
 // It is generally followed by a call to Login() as most FTP commands require
 // an authenticated user.
 func DialTimeout(addr string, timeout time.Duration, certfile string) (*ServerConn, error) {
+	tlsConfig := &tls.Config{}
+	if certfile != "" {
+		var err error
+		tlsConfig, err = ftputil.TLSConfig(certfile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return DialTLSConfig(addr, timeout, tlsConfig)
+}
+
+// DialTLSConfig initializes the connection like DialTimeout, but AuthTLS
+// secures it with the TLS configuration instead of one trusting the
+// certificate of a file, e.g. with one using the certificates of the system
+// or checking the fingerprint of the certificate. The parallel connections
+// use the same configuration.
+func DialTLSConfig(addr string, timeout time.Duration, tlsConfig *tls.Config) (*ServerConn, error) {
 	tconn, err := net.DialTimeout("tcp", addr, timeout)
 	if err != nil {
 		return nil, err
@@ -67,27 +110,19 @@ func DialTimeout(addr string, timeout time.Duration, certfile string) (*ServerCo
 		return nil, err
 	}
 
-	var tlsConfig tls.Config
 	conn := textproto.NewConn(tconn)
-	if certfile != "" {
-		tlsConfig, err = generateTLSConfig(certfile)
-		if err != nil {
-			return nil, err
-		}
-	}
 
 	c := &ServerConn{
 		conn:            conn,
 		tcpconn:         tconn,
-		tlsConfig:       &tlsConfig,
+		tlsConfig:       tlsConfig,
 		hostname:        addr,
 		hostcontrolport: port,
-		certfilename:    certfile,
 		timeout:         timeout,
 		features:        make(map[string]string),
 	}
 
-	_, _, err = c.conn.ReadResponse(StatusReady)
+	_, c.welcome, err = c.readResponse(StatusReady)
 	if err != nil {
 		c.Quit()
 		return nil, err
@@ -102,21 +137,6 @@ func DialTimeout(addr string, timeout time.Duration, certfile string) (*ServerCo
 	return c, nil
 }
 
-// Generates from the specified certifiate file a tls configuration
-func generateTLSConfig(certfile string) (tls.Config, error) {
-	tlsConfig := tls.Config{}
-	tlsConfig.InsecureSkipVerify = true
-	certficate, err := ioutil.ReadFile(certfile)
-	if err != nil {
-		return tlsConfig, err
-	}
-	rootCAs := x509.NewCertPool()
-	if !rootCAs.AppendCertsFromPEM([]byte(certficate)) {
-		return tlsConfig, errors.New("ERROR: Fehler beim parsen des Serverzertifikats.\n")
-	}
-	return tlsConfig, nil
-}
-
 // Negotiates TLS for the connection
 func (c *ServerConn) AuthTLS() error {
 	if c.tlsConfig == nil {
@@ -128,7 +148,8 @@ func (c *ServerConn) AuthTLS() error {
 	if err != nil {
 		return errors.New("Error while AUTH TLS command. " + err.Error())
 	}
-	c.conn = textproto.NewConn(tls.Client(c.tcpconn, c.tlsConfig))
+	c.tlsConn = tls.Client(c.tcpconn, c.tlsConfig)
+	c.conn = textproto.NewConn(c.tlsConn)
 	c.tlsSecuredControlConnection = true
 
 	// Secure data connection
@@ -146,45 +167,96 @@ func (c *ServerConn) AuthTLS() error {
 	return nil
 }
 
+// TLSConnectionState returns the state of the TLS connection secured by
+// AuthTLS, e.g. the negotiated version and cipher suite and the certificates
+// of the server. It returns false, if the control connection is not secured.
+func (c *ServerConn) TLSConnectionState() (tls.ConnectionState, bool) {
+	if c.tlsConn == nil {
+		return tls.ConnectionState{}, false
+	}
+	return c.tlsConn.ConnectionState(), true
+}
+
+// Welcome returns the message of the welcome reply (220) of the server,
+// the lines of a multiline reply are separated by "\n".
+func (c *ServerConn) Welcome() string {
+	return c.welcome
+}
+
+// RemoteAddr returns the address of the server of the control connection.
+func (c *ServerConn) RemoteAddr() net.Addr {
+	return c.tcpconn.RemoteAddr()
+}
+
+// LocalAddr returns the local address of the control connection.
+func (c *ServerConn) LocalAddr() net.Addr {
+	return c.tcpconn.LocalAddr()
+}
+
 // Login authenticates the client with specified user and password.
 //
 // "anonymous"/"anonymous" is a common user/password scheme for FTP servers
 // that allows anonymous read-only accounts.
 func (c *ServerConn) Login(user, password string) error {
-	code, message, err := c.cmd(-1, "USER %s", user)
+	// Known before sending, so echoed passwords are masked
+	c.password = password
+	reply, err := c.SendCommand("USER %s", user)
 	if err != nil {
 		return err
 	}
 
-	switch code {
-	case StatusLoggedIn:
-	case StatusUserOK:
-		_, _, err = c.cmd(StatusLoggedIn, "PASS %s", password)
+	// Continue while the server replies with 3xx
+	passwordSent := false
+	for ftps_qftp_client.IsPositiveIntermediate(reply.Code) {
+		command := ""
+		if c.loginHook != nil {
+			command, err = c.loginHook(reply)
+			if err != nil {
+				return err
+			}
+		}
+		if command == "" {
+			if reply.Code != StatusUserOK || passwordSent {
+				return &textproto.Error{Code: reply.Code, Msg: c.redact(reply.Message)}
+			}
+			command = "PASS " + password
+			passwordSent = true
+		}
+		reply, err = c.SendCommand("%s", command)
 		if err != nil {
 			return err
 		}
-	default:
-		return errors.New(message)
+	}
+	if reply.Code != StatusLoggedIn && reply.Code != StatusCommandNotImplemented {
+		return &textproto.Error{Code: reply.Code, Msg: c.redact(reply.Message)}
 	}
 
 	c.username = user
-	c.password = password
+	// The server changes to the home directory of the user
+	c.currentDir = ""
 
-	// Switch to binary mode
-	_, _, err = c.cmd(StatusCommandOK, "TYPE I")
+	// Switch to the transfer type, binary unless set otherwise
+	_, _, err = c.cmd(StatusCommandOK, "TYPE %s", c.transferType)
 	if err != nil {
 		return err
 	}
 
-	// logged, check features again
-	if err = c.Feat(); err != nil {
+	// logged, servers may announce further features to authenticated users
+	if err = c.RefreshFeatures(); err != nil {
 		c.Quit()
 		return err
 	}
 
+	c.hooks.LoggedIn(user)
 	return nil
 }
 
+// SetLoginHook sets the hook, which continues the following logins after
+// intermediate replies of the server, nil to send only USER and PASS.
+func (c *ServerConn) SetLoginHook(hook ftps_qftp_client.LoginHook) {
+	c.loginHook = hook
+}
+
 // feat issues a FEAT FTP command to list the additional commands supported by
 // the remote FTP server.
 // FEAT is described in RFC 2389
@@ -200,25 +272,7 @@ func (c *ServerConn) Feat() error {
 		return nil
 	}
 
-	lines := strings.Split(message, "\n")
-	for _, line := range lines {
-		if !strings.HasPrefix(line, " ") {
-			continue
-		}
-
-		line = strings.TrimSpace(line)
-		featureElements := strings.SplitN(line, " ", 2)
-
-		command := featureElements[0]
-
-		var commandDesc string
-		if len(featureElements) == 2 {
-			commandDesc = featureElements[1]
-		}
-
-		c.features[command] = commandDesc
-	}
-
+	ftputil.ParseFeatures(message, c.features)
 	return nil
 }
 
@@ -227,6 +281,25 @@ func (c *ServerConn) Features() map[string]string {
 	return c.features
 }
 
+// RefreshFeatures discards the known features and requests them again with
+// the FEAT command, e.g. after the authentication.
+func (c *ServerConn) RefreshFeatures() error {
+	c.features = make(map[string]string)
+	return c.Feat()
+}
+
+// Capabilities returns the optional commands announced by the server with FEAT.
+func (c *ServerConn) Capabilities() ftps_qftp_client.Capabilities {
+	return ftps_qftp_client.CapabilitiesFromFeatures(c.features)
+}
+
+// HasFeature reports whether the server announced the feature and returns its
+// description, e.g. "SHA-1;SHA-256*" for HASH. The name is not case sensitive.
+func (c *ServerConn) HasFeature(name string) (bool, string) {
+	description, available := ftputil.LookupFeature(c.features, name)
+	return available, description
+}
+
 // epsv issues an "EPSV" command to get a port number for a data connection.
 func (c *ServerConn) epsv() (port int, err error) {
 	_, line, err := c.cmd(StatusExtendedPassiveMode, "EPSV")
@@ -251,16 +324,13 @@ func (c *ServerConn) pasv() (port int, err error) {
 		return
 	}
 
-	// PASV response format : 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2).
-	start := strings.Index(line, "(")
-	end := strings.LastIndex(line, ")")
-	if start == -1 || end == -1 {
-		err = errors.New("Invalid PASV response format")
+	address, err := parsePasvAddress(line)
+	if err != nil {
 		return
 	}
 
 	// We have to split the response string
-	pasvData := strings.Split(line[start+1:end], ",")
+	pasvData := strings.Split(address, ",")
 	// Let's compute the port number
 	portPart1, err1 := strconv.Atoi(pasvData[4])
 	if err1 != nil {
@@ -279,6 +349,18 @@ func (c *ServerConn) pasv() (port int, err error) {
 	return
 }
 
+// parsePasvAddress extracts the address "h1,h2,h3,h4,p1,p2" from the message of
+// a reply to the PASV command.
+func parsePasvAddress(line string) (string, error) {
+	// PASV response format : 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2).
+	start := strings.Index(line, "(")
+	end := strings.LastIndex(line, ")")
+	if start == -1 || end == -1 || start > end || strings.Count(line[start:end], ",") != 5 {
+		return "", errors.New("Invalid PASV response format")
+	}
+	return line[start+1 : end], nil
+}
+
 // openDataConn creates a new FTP data connection.
 func (c *ServerConn) openDataConn() (net.Conn, error) {
 	var port int
@@ -286,8 +368,8 @@ func (c *ServerConn) openDataConn() (net.Conn, error) {
 
 	//  If features contains nat6 or EPSV => EPSV
 	//  else -> PASV
-	_, nat6Supported := c.features["nat6"]
-	_, epsvSupported := c.features["EPSV"]
+	nat6Supported, _ := c.HasFeature("nat6")
+	epsvSupported, _ := c.HasFeature("EPSV")
 
 	if !nat6Supported && !epsvSupported {
 		port, _ = c.pasv()
@@ -319,218 +401,256 @@ func (c *ServerConn) Exec(expected int, format string, args ...interface{}) (int
 	return c.cmd(expected, format, args...)
 }
 
+// SendCommand sends a command and returns the complete reply of the server
+// including all lines of a multiline reply. The code of the reply is not
+// checked, so it can be used for commands not supported by the client. The
+// code can be classified with ftps_qftp_client.IsPositiveCompletion and the
+// further functions of the package.
+func (c *ServerConn) SendCommand(format string, args ...interface{}) (*ftps_qftp_client.Response, error) {
+	err := c.send(format, args...)
+	if err != nil {
+		return nil, err
+	}
+	c.setReplyDeadline()
+	code, message, lines, err := ftputil.ReadReply(&c.conn.Reader)
+	c.tcpconn.SetReadDeadline(time.Time{})
+	duration := c.timer.Replied()
+	atomic.StoreInt32(&c.busy, 0)
+	message = ftputil.DecodeString(c.encoding, message)
+	for i := range lines {
+		lines[i] = ftputil.DecodeString(c.encoding, lines[i])
+	}
+	c.log("< " + c.redact(strings.Join(lines, "\n")))
+	if ftputil.IsServiceClosing(code, err) {
+		return nil, c.setClosing(code, c.redact(message), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ftps_qftp_client.Response{Code: code, Message: message, Lines: lines, Duration: duration}, nil
+}
+
 // cmd is a helper function to execute a command and check for the expected FTP
 // return code
 func (c *ServerConn) cmd(expected int, format string, args ...interface{}) (int, string, error) {
-	_, err := c.conn.Cmd(format, args...)
+	err := c.send(format, args...)
 	if err != nil {
 		return 0, "", err
 	}
 
-	return c.conn.ReadResponse(expected)
+	return c.readResponse(expected)
 }
 
-// cmdDataConnFrom executes a command which require a FTP data connection.
-// Issues a REST FTP command to specify the number of bytes to skip for the transfer.
-func (c *ServerConn) cmdDataConnFrom(offset uint64, format string, args ...interface{}) (net.Conn, error) {
-	conn, err := c.openDataConn()
-	if err != nil {
-		return nil, err
+// send writes a command to the control connection. The connection is busy till the
+// final reply to the command is read, meanwhile sending further commands fails
+// with ErrBusy. After the control connection was closed it returns ErrServiceClosing.
+func (c *ServerConn) send(format string, args ...interface{}) error {
+	if !atomic.CompareAndSwapInt32(&c.busy, 0, 1) {
+		return ftps_qftp_client.ErrBusy
 	}
-
-	if offset != 0 {
-		_, _, err := c.cmd(StatusRequestFilePending, "REST %d", offset)
-		if err != nil {
-			return nil, err
-		}
+	if err := c.closing(); err != nil {
+		atomic.StoreInt32(&c.busy, 0)
+		return err
 	}
-
-	_, err = c.conn.Cmd(format, args...)
+	line := fmt.Sprintf(format, args...)
+	c.log("> " + ftputil.RedactCommand(line))
+	encoded, err := ftputil.EncodeString(c.encoding, line)
 	if err != nil {
-		conn.Close()
-		return nil, err
+		atomic.StoreInt32(&c.busy, 0)
+		return errors.New(ftputil.RedactCommand(err.Error()))
 	}
-
-	code, msg, err := c.conn.ReadResponse(-1)
+	c.timer.Sent()
+	_, err = c.conn.Cmd("%s", encoded)
 	if err != nil {
-		conn.Close()
-		return nil, err
+		atomic.StoreInt32(&c.busy, 0)
 	}
-	if code != StatusAlreadyOpen && code != StatusAboutToSend {
-		conn.Close()
-		return nil, &textproto.Error{Code: code, Msg: msg}
+	if ftputil.IsServiceClosing(0, err) {
+		return c.setClosing(0, "", err)
 	}
-
-	return conn, nil
+	return err
 }
 
-var errUnsupportedListLine = errors.New("Unsupported LIST line")
+// readResponse reads the reply to a command and checks for the expected code.
+// If a final reply is expected, preliminary replies (1xx) before it are
+// skipped, as some servers send them with the progress of a command. After a
+// reply with 421 or the end of the control connection the connection is
+// marked as closed and ErrServiceClosing returned.
+func (c *ServerConn) readResponse(expected int) (int, string, error) {
+	return c.readResponses(expected, ftputil.ExpectsFinalReply(expected))
+}
 
-// parseRFC3659ListLine parses the style of directory line defined in RFC 3659.
-func parseRFC3659ListLine(line string) (*ftps_qftp_client.Entry, error) {
-	iSemicolon := strings.Index(line, ";")
-	iWhitespace := strings.Index(line, " ")
+// readFinalResponse reads the final reply to a command with any code and
+// skips the preliminary replies (1xx) before it.
+func (c *ServerConn) readFinalResponse() (int, string, error) {
+	return c.readResponses(-1, true)
+}
 
-	if iSemicolon < 0 || iSemicolon > iWhitespace {
-		return nil, errUnsupportedListLine
+// readTransferStart reads the reply to a command opening a data connection,
+// 125 or 150. Other preliminary replies before it are skipped.
+func (c *ServerConn) readTransferStart() (int, string, error) {
+	code, message, err := c.readResponse(-1)
+	for err == nil && code != StatusAlreadyOpen && code != StatusAboutToSend &&
+		ftps_qftp_client.IsPositivePreliminary(code) {
+		code, message, err = c.readResponse(-1)
 	}
-
-	e := &ftps_qftp_client.Entry{
-		Name: line[iWhitespace+1:],
+	if err == nil && code != StatusAlreadyOpen && code != StatusAboutToSend {
+		err = &textproto.Error{Code: code, Msg: c.redact(message)}
 	}
+	return code, message, err
+}
 
-	for _, field := range strings.Split(line[:iWhitespace-1], ";") {
-		i := strings.Index(field, "=")
-		if i < 1 {
-			return nil, errUnsupportedListLine
-		}
-
-		key := field[:i]
-		value := field[i+1:]
-
-		switch key {
-		case "modify":
-			var err error
-			e.Time, err = time.Parse("20060102150405", value)
-			if err != nil {
-				return nil, err
-			}
-		case "type":
-			switch value {
-			case "dir", "cdir", "pdir":
-				e.Type = ftps_qftp_client.EntryTypeFolder
-			case "file":
-				e.Type = ftps_qftp_client.EntryTypeFile
-			}
-		case "size":
-			e.SetSize(value)
-		}
+func (c *ServerConn) readResponses(expected int, skipPreliminary bool) (int, string, error) {
+	if err := c.closing(); err != nil {
+		atomic.StoreInt32(&c.busy, 0)
+		return 0, "", err
+	}
+	c.setReplyDeadline()
+	code, message, err := c.readReply()
+	for err == nil && skipPreliminary && ftps_qftp_client.IsPositivePreliminary(code) {
+		code, message, err = c.readReply()
+	}
+	c.tcpconn.SetReadDeadline(time.Time{})
+	c.timer.Replied()
+	if err != nil || code >= 200 {
+		// A preliminary reply (1xx) is followed by a further reply to the command
+		atomic.StoreInt32(&c.busy, 0)
+	}
+	if ftputil.IsServiceClosing(code, err) {
+		return code, message, c.setClosing(code, c.redact(message), err)
 	}
-	return e, nil
+	if err == nil && !ftputil.HasExpectedCode(code, expected) {
+		// The message is returned unchanged for parsing, just copies are masked
+		err = &textproto.Error{Code: code, Msg: c.redact(message)}
+	}
+	return code, message, err
 }
 
-// parseLsListLine parses a directory line in a format based on the output of
-// the UNIX ls command.
-func parseLsListLine(line string) (*ftps_qftp_client.Entry, error) {
-	fields := strings.Fields(line)
-	if len(fields) >= 7 && fields[1] == "folder" && fields[2] == "0" {
-		e := &ftps_qftp_client.Entry{
-			Type: ftps_qftp_client.EntryTypeFolder,
-			Name: strings.Join(fields[6:], " "),
-		}
-		if err := e.SetTime(fields[3:6]); err != nil {
-			return nil, err
-		}
-
-		return e, nil
+// Reads a single reply from the control connection and logs it.
+func (c *ServerConn) readReply() (int, string, error) {
+	code, message, _, err := ftputil.ReadReply(&c.conn.Reader)
+	message = ftputil.DecodeString(c.encoding, message)
+	if code != 0 {
+		c.log("< " + strconv.Itoa(code) + " " + c.redact(message))
 	}
+	return code, message, err
+}
 
-	if fields[1] == "0" {
-		e := &ftps_qftp_client.Entry{
-			Type: ftps_qftp_client.EntryTypeFile,
-			Name: strings.Join(fields[7:], " "),
-		}
-
-		if err := e.SetSize(fields[2]); err != nil {
-			return nil, err
-		}
-		if err := e.SetTime(fields[4:7]); err != nil {
-			return nil, err
-		}
-
-		return e, nil
+// Limits the time till the next reply is read to the command timeout. The
+// deadline applies to the secured control connection, too.
+func (c *ServerConn) setReplyDeadline() {
+	if c.commandTimeout > 0 {
+		c.tcpconn.SetReadDeadline(time.Now().Add(c.commandTimeout))
 	}
+}
 
-	if len(fields) < 9 {
-		return nil, errUnsupportedListLine
+// abort issues an ABOR FTP command to abort the running transfer and reads its
+// replies. It is sent while the connection is busy with the transfer.
+func (c *ServerConn) abort() error {
+	c.log("> ABOR")
+	c.timer.Sent()
+	_, err := c.conn.Cmd("ABOR")
+	if err != nil {
+		atomic.StoreInt32(&c.busy, 0)
+		return err
 	}
-
-	e := &ftps_qftp_client.Entry{}
-	switch fields[0][0] {
-	case '-':
-		e.Type = ftps_qftp_client.EntryTypeFile
-		if err := e.SetSize(fields[4]); err != nil {
-			return nil, err
-		}
-	case 'd':
-		e.Type = ftps_qftp_client.EntryTypeFolder
-	case 'l':
-		e.Type = ftps_qftp_client.EntryTypeLink
-	default:
-		return nil, errors.New("Unknown entry type")
+	// 426 for the aborted transfer followed by 226, or just 226
+	code, _, err := c.readFinalResponse()
+	if err == nil && code == StatusTransfertAborted {
+		_, _, err = c.readFinalResponse()
 	}
+	return err
+}
 
-	if err := e.SetTime(fields[5:8]); err != nil {
-		return nil, err
+// Masks the password in a text for logs and errors.
+func (c *ServerConn) redact(text string) string {
+	return ftputil.RedactSecret(text, c.password)
+}
+
+// Passes the line to the command logger, if one is set.
+func (c *ServerConn) log(line string) {
+	if c.commandLogger != nil {
+		c.commandLogger(line)
 	}
+}
 
-	e.Name = strings.Join(fields[8:], " ")
-	return e, nil
+// SetCommandLogger sets the logger receiving the following dialogue on the
+// control connection, nil to stop logging. Credentials are masked.
+func (c *ServerConn) SetCommandLogger(logger ftps_qftp_client.CommandLogger) {
+	c.commandLogger = logger
 }
 
-var dirTimeFormats = []string{
-	"01-02-06  03:04PM",
-	"2006-01-02  15:04",
+// SetSessionHooks sets the hooks called on the following events of the
+// session. The connection itself is already open, so OnConnect is called
+// for the further connections opened for parallel transfers, which take over
+// the hooks.
+func (c *ServerConn) SetSessionHooks(hooks ftps_qftp_client.SessionHooks) {
+	c.hooks = hooks
 }
 
-// parseDirListLine parses a directory line in a format based on the output of
-// the MS-DOS DIR command.
-func parseDirListLine(line string) (*ftps_qftp_client.Entry, error) {
-	e := &ftps_qftp_client.Entry{}
-	var err error
+// CommandStats returns the timings of the replies to the commands sent on
+// the control connection so far.
+func (c *ServerConn) CommandStats() ftps_qftp_client.CommandStats {
+	return c.timer.Stats()
+}
 
-	// Try various time formats that DIR might use, and stop when one works.
-	for _, format := range dirTimeFormats {
-		e.Time, err = time.Parse(format, line[:len(format)])
-		if err == nil {
-			line = line[len(format):]
-			break
+// Returns the error of the closed control connection, nil while it is usable.
+func (c *ServerConn) closing() error {
+	c.closingErrMutex.Lock()
+	defer c.closingErrMutex.Unlock()
+	return c.closingErr
+}
+
+// Marks the control connection as closed by the server and returns the error
+// for this and all following calls.
+func (c *ServerConn) setClosing(code int, message string, err error) error {
+	c.closingErrMutex.Lock()
+	first := c.closingErr == nil
+	if first {
+		if code == StatusNotAvailable {
+			c.closingErr = fmt.Errorf("%w %d %s", ftps_qftp_client.ErrServiceClosing, code, message)
+		} else {
+			c.closingErr = fmt.Errorf("%w %v", ftps_qftp_client.ErrServiceClosing, err)
 		}
 	}
+	err = c.closingErr
+	c.closingErrMutex.Unlock()
+	if first {
+		c.hooks.Failed(err)
+	}
+	return err
+}
+
+// cmdDataConnFrom executes a command which require a FTP data connection.
+// Issues a REST FTP command to specify the number of bytes to skip for the transfer.
+func (c *ServerConn) cmdDataConnFrom(offset uint64, format string, args ...interface{}) (net.Conn, error) {
+	conn, err := c.openDataConn()
 	if err != nil {
-		// None of the time formats worked.
-		return nil, errUnsupportedListLine
+		return nil, err
 	}
 
-	line = strings.TrimLeft(line, " ")
-	if strings.HasPrefix(line, "<DIR>") {
-		e.Type = ftps_qftp_client.EntryTypeFolder
-		line = strings.TrimPrefix(line, "<DIR>")
-	} else {
-		space := strings.Index(line, " ")
-		if space == -1 {
-			return nil, errUnsupportedListLine
-		}
-		e.Size, err = strconv.ParseUint(line[:space], 10, 64)
+	if offset != 0 {
+		_, _, err := c.cmd(StatusRequestFilePending, "REST %d", offset)
 		if err != nil {
-			return nil, errUnsupportedListLine
+			return nil, err
 		}
-		e.Type = ftps_qftp_client.EntryTypeFile
-		line = line[space:]
 	}
 
-	e.Name = strings.TrimLeft(line, " ")
-	return e, nil
-}
-
-var listLineParsers = []func(line string) (*ftps_qftp_client.Entry, error){
-	parseRFC3659ListLine,
-	parseLsListLine,
-	parseDirListLine,
-}
+	err = c.send(format, args...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
 
-// parseListLine parses the various non-standard format returned by the LIST
-// FTP command.
-func parseListLine(line string) (*ftps_qftp_client.Entry, error) {
-	for _, f := range listLineParsers {
-		e, err := f(line)
-		if err == errUnsupportedListLine {
-			// Try another format.
-			continue
-		}
-		return e, err
+	_, _, err = c.readTransferStart()
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
-	return nil, errUnsupportedListLine
+
+	c.dataConnMutex.Lock()
+	c.dataConn = conn
+	c.dataConnMutex.Unlock()
+	return conn, nil
 }
 
 // NameList issues an NLST FTP command.
@@ -540,10 +660,10 @@ func (c *ServerConn) NameList(path string) (entries []string, err error) {
 		return
 	}
 
-	r := &response{conn, c}
+	r := &response{conn: conn, c: c, reader: ftputil.NewDecodingReader(c.encoding, conn), size: -1}
 	defer r.Close()
 
-	scanner := bufio.NewScanner(r)
+	scanner := ftps_qftp_client.NewLineScanner(r, c.maxLineLength)
 	for scanner.Scan() {
 		entries = append(entries, scanner.Text())
 	}
@@ -555,21 +675,58 @@ func (c *ServerConn) NameList(path string) (entries []string, err error) {
 
 // List issues a LIST FTP command.
 func (c *ServerConn) List(path string) (entries []*ftps_qftp_client.Entry, err error) {
-	conn, err := c.cmdDataConnFrom(0, "LIST %s", path)
+	scanner, err := c.ListStream(path)
 	if err != nil {
 		return
 	}
+	defer scanner.Close()
 
-	r := &response{conn, c}
-	defer r.Close()
+	for scanner.Next() {
+		entries = append(entries, scanner.Entry())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
 
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		entry, err := parseListLine(line)
-		if err == nil {
-			entries = append(entries, entry)
-		}
+// ListLenient issues a LIST FTP command like List, but returns also the lines
+// of the listing, which could not be parsed, instead of dropping them. If the
+// transfer fails, the entries and lines read till then are returned with the
+// error.
+func (c *ServerConn) ListLenient(path string) (entries []*ftps_qftp_client.Entry, unparsed []string, err error) {
+	scanner, err := c.ListStream(path)
+	if err != nil {
+		return
+	}
+	defer scanner.Close()
+	scanner.SetKeepUnparsed(true)
+
+	for scanner.Next() {
+		entries = append(entries, scanner.Entry())
+	}
+	return entries, scanner.Unparsed(), scanner.Err()
+}
+
+// ListStream issues a LIST FTP command like List, but returns the entries one
+// by one while they are received. The scanner has to be closed, before
+// further commands are issued.
+func (c *ServerConn) ListStream(path string) (*ftps_qftp_client.EntryScanner, error) {
+	return c.listStream("LIST", path)
+}
+
+// MachineList issues a MLSD FTP command (RFC 3659) and returns the entries in
+// the machine readable format of the directory. The current and the parent
+// directory are returned with the names "." and "..".
+func (c *ServerConn) MachineList(path string) (entries []*ftps_qftp_client.Entry, err error) {
+	scanner, err := c.listStream("MLSD", path)
+	if err != nil {
+		return
+	}
+	defer scanner.Close()
+
+	for scanner.Next() {
+		entries = append(entries, scanner.Entry())
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
@@ -577,11 +734,93 @@ func (c *ServerConn) List(path string) (entries []*ftps_qftp_client.Entry, err e
 	return
 }
 
+// MachineEntry issues a MLST FTP command (RFC 3659) and returns the entry of
+// the file or directory at the path.
+func (c *ServerConn) MachineEntry(path string) (*ftps_qftp_client.Entry, error) {
+	_, message, err := c.cmd(StatusRequestedFileActionOK, "MLST %s", path)
+	if err != nil {
+		return nil, err
+	}
+	return ftps_qftp_client.ParseMachineEntry(message)
+}
+
+// Issues the listing command for the path and returns a scanner for the entries.
+func (c *ServerConn) listStream(command string, path string) (*ftps_qftp_client.EntryScanner, error) {
+	conn, err := c.cmdDataConnFrom(0, "%s %s", command, path)
+	if err != nil {
+		return nil, err
+	}
+	scanner := ftps_qftp_client.NewEntryScanner(&response{conn: conn, c: c, reader: ftputil.NewDecodingReader(c.encoding, conn), size: -1}, c.location())
+	scanner.SetMaxLineLength(c.maxLineLength)
+	return scanner, nil
+}
+
+// ListRecursive issues a "LIST -R" FTP command, which is supported by many
+// servers, and returns the entries of the whole tree below the path with one
+// command instead of one LIST for each directory.
+func (c *ServerConn) ListRecursive(path string) ([]*ftps_qftp_client.PathEntry, error) {
+	conn, err := c.cmdDataConnFrom(0, "LIST -R %s", path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &response{conn: conn, c: c, reader: ftputil.NewDecodingReader(c.encoding, conn), size: -1}
+	defer r.Close()
+	return ftps_qftp_client.ParseRecursiveListing(r, path, c.location(), c.maxLineLength)
+}
+
+// SetMaxLineLength sets the maximal length of the lines of listings returned
+// by NameList, List and ListStream. Longer lines fail with a
+// ftps_qftp_client.LineTooLongError. With maxLength <= 0
+// ftps_qftp_client.DefaultMaxLineLength is used.
+func (c *ServerConn) SetMaxLineLength(maxLength int) {
+	c.maxLineLength = maxLength
+}
+
+// SetBufferSize sets the size of the buffers copying the data of the files
+// stored by Stor and StorFrom and of the files retrieved by a
+// ftps_qftp_client.TransferScheduler. The buffers are reused from a pool.
+// Stor and StorFrom copy without a buffer, if the data connection implements
+// io.ReaderFrom or the reader io.WriterTo.
+// With size <= 0 ftps_qftp_client.DefaultBufferSize is used.
+func (c *ServerConn) SetBufferSize(size int) {
+	c.bufferSize = size
+}
+
+// SetCommandTimeout sets the time, the connection waits for a reply to a
+// command. The final reply to a transfer is awaited after its data was
+// transferred, so the timeout does not limit the duration of transfers.
+// Without a reply within the time the connection is unusable like after
+// ErrServiceClosing, as the reply may still arrive later.
+// With timeout <= 0 the connection waits without a limit, the default.
+func (c *ServerConn) SetCommandTimeout(timeout time.Duration) {
+	c.commandTimeout = timeout
+}
+
+// SetRetrSize sets, whether Retr and RetrFrom request the size of the file
+// with SIZE before retrieving it. The returned reader implements
+// ftps_qftp_client.SizedReader and reports the size, except in ASCII mode,
+// in which the size at the server differs from the one received.
+func (c *ServerConn) SetRetrSize(enabled bool) {
+	c.retrSize = enabled
+}
+
+// BufferSize returns the size of the buffers copying the data of transfers.
+func (c *ServerConn) BufferSize() int {
+	return ftps_qftp_client.BufferPoolOfSize(c.bufferSize).Size()
+}
+
 // ChangeDir issues a CWD FTP command, which changes the current directory to
 // the specified path.
 func (c *ServerConn) ChangeDir(path string) error {
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "CWD %s", path)
-	return err
+	if err != nil {
+		return err
+	}
+	if c.currentDir != "" || ftps_qftp_client.IsAbsPath(path) {
+		c.currentDir = ftps_qftp_client.JoinPath(c.currentDir, path)
+	}
+	return nil
 }
 
 // ChangeDirToParent issues a CDUP FTP command, which changes the current
@@ -589,7 +828,13 @@ func (c *ServerConn) ChangeDir(path string) error {
 // with a path set to "..".
 func (c *ServerConn) ChangeDirToParent() error {
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "CDUP")
-	return err
+	if err != nil {
+		return err
+	}
+	if c.currentDir != "" {
+		c.currentDir = ftps_qftp_client.JoinPath(c.currentDir, "..")
+	}
+	return nil
 }
 
 // CurrentDir issues a PWD FTP command, which Returns the path of the current
@@ -600,14 +845,35 @@ func (c *ServerConn) CurrentDir() (string, error) {
 		return "", err
 	}
 
-	start := strings.Index(msg, "\"")
-	end := strings.LastIndex(msg, "\"")
-
-	if start == -1 || end == -1 {
-		return "", errors.New("Unsuported PWD response format")
+	dir, err := ftputil.ParseCurrentDir(msg)
+	if err != nil {
+		return "", err
 	}
+	c.currentDir = dir
+	return dir, nil
+}
 
-	return msg[start+1 : end], nil
+// AbsPath returns the absolute remote path of the path relative to the
+// current directory. The current directory is tracked by the client, so PWD
+// is only issued if it is unknown, e.g. after the login. Servers with TVFS
+// (RFC 3659) and most others use paths separated by "/" starting at the root
+// "/", for others an error is returned.
+func (c *ServerConn) AbsPath(path string) (string, error) {
+	if ftps_qftp_client.IsAbsPath(path) {
+		return ftps_qftp_client.JoinPath("/", path), nil
+	}
+	dir := c.currentDir
+	if dir == "" {
+		var err error
+		dir, err = c.CurrentDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	if !ftps_qftp_client.IsAbsPath(dir) {
+		return "", errors.New("The current directory " + dir + " is no absolute path starting with /.")
+	}
+	return ftps_qftp_client.JoinPath(dir, path), nil
 }
 
 // Retr issues a RETR FTP command to fetch the specified file from the remote
@@ -623,12 +889,24 @@ func (c *ServerConn) Retr(path string) (io.ReadCloser, error) {
 //
 // The returned ReadCloser must be closed to cleanup the FTP data connection.
 func (c *ServerConn) RetrFrom(path string, offset uint64) (io.ReadCloser, error) {
+	size := int64(-1)
+	if c.retrSize && c.transferType != ftps_qftp_client.ASCII {
+		// Without support of SIZE the file is retrieved with an unknown size
+		if fileSize, err := c.FileSize(path); err == nil && fileSize >= int64(offset) {
+			size = fileSize - int64(offset)
+		}
+	}
 	conn, err := c.cmdDataConnFrom(offset, "RETR %s", path)
 	if err != nil {
 		return nil, err
 	}
+	c.hooks.TransferStarted("RETR", path)
 
-	return &response{conn, c}, nil
+	r := &response{conn: conn, c: c, size: size, path: path}
+	if c.transferType == ftps_qftp_client.ASCII {
+		r.reader = ftputil.NewFromNetworkReader(conn)
+	}
+	return r, nil
 }
 
 // Stor issues a STOR FTP command to store a file to the remote FTP server.
@@ -649,97 +927,252 @@ func (c *ServerConn) StorFrom(path string, r io.Reader, offset uint64) error {
 	if err != nil {
 		return err
 	}
+	c.hooks.TransferStarted("STOR", path)
 
-	_, err = io.Copy(conn, r)
+	if c.transferType == ftps_qftp_client.ASCII {
+		r = ftputil.NewToNetworkReader(r)
+	}
+	n, err := ftps_qftp_client.BufferPoolOfSize(c.bufferSize).CopyFast(conn, r)
 	conn.Close()
 	if err != nil {
-		return err
+		// The server replies to the incomplete transfer, which ends the command
+		c.readFinalResponse()
+	} else {
+		_, _, err = c.readResponse(StatusClosingDataConnection)
 	}
-
-	_, _, err = c.conn.ReadResponse(StatusClosingDataConnection)
+	c.hooks.TransferCompleted("STOR", path, n, err)
 	return err
 }
 
-// MultipleTransfer issues STOR FTP commands in parallel connections to store multiple files
-// to the remote FTP server.
-// Stor creates the specified files as specified in tasks. The number of parallel
-// connections can be limited. nrParallel < 0 means no limit
-//
-// Hint: io.Pipe() can be used if an io.Writer is required.
-func (c *ServerConn) MultipleTransfer(tasks []TransferTask, nrParallel int) error {
-	currentdirctory, err := c.CurrentDir()
+// SetTransferType issues a TYPE FTP command to set the representation type
+// of the following transfers. In ASCII mode the line endings are converted
+// between CRLF on the data connection and LF.
+func (c *ServerConn) SetTransferType(transferType ftps_qftp_client.TransferType) error {
+	_, _, err := c.cmd(StatusCommandOK, "TYPE %s", transferType)
 	if err != nil {
 		return err
 	}
+	c.transferType = transferType
+	return nil
+}
 
-	// Not more connections than files to store or negative
-	if len(tasks) < nrParallel || nrParallel < 0 {
-		nrParallel = len(tasks)
+// Rename renames a file on the remote FTP server.
+func (c *ServerConn) Rename(from, to string) error {
+	_, _, err := c.cmd(StatusRequestFilePending, "RNFR %s", from)
+	if err != nil {
+		return err
 	}
 
-	// Write all tasks to the channel including the finishing message
-	taskChannel := make(chan TransferTask, len(tasks)+nrParallel)
-	returnChannel := make(chan error, len(tasks))
-	for _, task := range tasks {
-		task.finished = false
-		taskChannel <- task
-	}
-	for i := 0; i < nrParallel; i++ {
-		taskChannel <- TransferTask{finished: true}
-	}
+	_, _, err = c.cmd(StatusRequestedFileActionOK, "RNTO %s", to)
+	return err
+}
+
+// Delete issues a DELE FTP command to delete the specified file from the
+// remote FTP server.
+func (c *ServerConn) Delete(path string) error {
+	_, _, err := c.cmd(StatusRequestedFileActionOK, "DELE %s", path)
+	return err
+}
 
-	// Start goroutines for parallel connections and provide the channels for communication
-	for i := 0; i < nrParallel-1; i++ {
-		go c.parallelTransfer(c.hostname+":"+c.hostcontrolport, currentdirctory, c.tlsSecuredControlConnection, c.certfilename, taskChannel, returnChannel)
+// DeleteAll issues a DELE FTP command for each of the paths without waiting
+// for the replies to the previous ones, so deleting many files takes about
+// one round trip instead of one for each file. It returns a result for each
+// path in the order of the paths. If the control connection fails, the error is
+// returned and also set in the results of the paths without a reply.
+func (c *ServerConn) DeleteAll(paths []string) (ftps_qftp_client.DeleteResults, error) {
+	results := make(ftps_qftp_client.DeleteResults, len(paths))
+	lines := make([]string, len(paths))
+	for i, path := range paths {
+		results[i].Path = path
+		lines[i], results[i].Err = ftputil.EncodeString(c.encoding, "DELE "+path)
+	}
+	if !atomic.CompareAndSwapInt32(&c.busy, 0, 1) {
+		return nil, ftps_qftp_client.ErrBusy
+	}
+	defer atomic.StoreInt32(&c.busy, 0)
+	if err := c.closing(); err != nil {
+		return nil, err
 	}
-	// The main connection is also used for parallel transfer
-	for {
-		task := <-taskChannel
-		if task.finished {
+
+	// The commands are written by a goroutine, while the replies are read, so
+	// the client and the server don't block each other with full buffers.
+	stop := make(chan struct{})
+	written := make(chan error, 1)
+	go func() {
+		for i, line := range lines {
+			if results[i].Err != nil {
+				continue
+			}
+			select {
+			case <-stop:
+				written <- nil
+				return
+			default:
+			}
+			c.log("> " + line)
+			if err := c.conn.PrintfLine("%s", line); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+
+	var err error
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		var code int
+		var message string
+		code, message, err = c.readReply()
+		for err == nil && ftps_qftp_client.IsPositivePreliminary(code) {
+			code, message, err = c.readReply()
+		}
+		if ftputil.IsServiceClosing(code, err) {
+			err = c.setClosing(code, c.redact(message), err)
+		}
+		if err != nil {
+			for j := i; j < len(results); j++ {
+				if results[j].Err == nil {
+					results[j].Err = err
+				}
+			}
 			break
-		} else if task.direction == Store {
-			returnChannel <- c.parallelStorTask(task)
-		} else if task.direction == Retrieve {
-			returnChannel <- c.parallelRetrTask(task)
-		} else {
-			returnChannel <- errors.New("Unknown direction for transfer.")
 		}
+		if code != StatusRequestedFileActionOK {
+			results[i].Err = &textproto.Error{Code: code, Msg: c.redact(message)}
+		}
+	}
+	close(stop)
+	if writeErr := <-written; err == nil {
+		err = writeErr
 	}
+	return results, err
+}
 
-	errorMessage := ""
-	// Wait for replais of the STORs in the goroutines
-	for normalReplay, goRoutineResetReply := 0, 0; normalReplay < len(tasks) && goRoutineResetReply < nrParallel; normalReplay++ {
-		replay := <-returnChannel
-		if replay != nil {
-			errorMessage = errorMessage + "\n" + replay.Error()
-			if strings.HasPrefix("Go routine reset.", replay.Error()) {
-				goRoutineResetReply++
-			}
+// ModTime issues a MDTM FTP command (RFC 3659) and returns the time of the
+// last modification of the remote file in UTC.
+func (c *ServerConn) ModTime(path string) (time.Time, error) {
+	_, message, err := c.cmd(StatusFile, "MDTM %s", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ftputil.ParseModTime(message)
+}
+
+// FileSize issues a SIZE FTP command (RFC 3659) and returns the size of the
+// remote file.
+func (c *ServerConn) FileSize(path string) (int64, error) {
+	_, message, err := c.cmd(StatusFile, "SIZE %s", path)
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(message), 10, 64)
+	if err != nil {
+		return 0, errors.New("Unsupported SIZE response format")
+	}
+	return size, nil
+}
+
+// SetModTime issues a MFMT FTP command to set the time of the last
+// modification of the remote file.
+func (c *ServerConn) SetModTime(path string, t time.Time) error {
+	_, _, err := c.cmd(StatusFile, "MFMT %s %s", t.UTC().Format("20060102150405"), path)
+	return err
+}
+
+// Chmod issues a SITE CHMOD FTP command to set the permissions of the remote
+// file or directory. Besides the permission bits the setuid, setgid and
+// sticky bits of the mode are sent, e.g. "SITE CHMOD 755 path".
+func (c *ServerConn) Chmod(path string, mode os.FileMode) error {
+	if !ftputil.SiteCommandAvailable(c.features, "CHMOD") {
+		return errors.New("The server does not support SITE CHMOD.")
+	}
+	code, message, err := c.cmd(-1, "SITE CHMOD %s %s", ftputil.FormatFileMode(mode), path)
+	if err != nil {
+		return err
+	}
+	if code < 200 || code >= 300 {
+		return &textproto.Error{Code: code, Msg: message}
+	}
+	return nil
+}
+
+// AvailableSpace returns the number of bytes, which can be stored in the
+// remote directory. It issues AVBL, if the server announces it, otherwise
+// SITE QUOTA, which is supported in the format of ProFTPD. Batch uploads can
+// use it to fail early, if the space at the server is too small.
+func (c *ServerConn) AvailableSpace(path string) (int64, error) {
+	if available, _ := c.HasFeature("AVBL"); available {
+		_, message, err := c.cmd(StatusFile, "AVBL %s", path)
+		if err != nil {
+			return 0, err
+		}
+		space, err := strconv.ParseInt(strings.TrimSpace(message), 10, 64)
+		if err != nil {
+			return 0, errors.New("Unsupported AVBL response format")
 		}
+		return space, nil
 	}
-	if errorMessage == "" {
-		return nil
-	} else {
-		return errors.New(errorMessage)
+	if !ftputil.SiteCommandAvailable(c.features, "QUOTA") {
+		return 0, errors.New("The server supports neither AVBL nor SITE QUOTA.")
 	}
+	code, message, err := c.cmd(-1, "SITE QUOTA")
+	if err != nil {
+		return 0, err
+	}
+	if code < 200 || code >= 300 {
+		return 0, &textproto.Error{Code: code, Msg: message}
+	}
+	return ftputil.ParseQuota(message)
 }
 
-// Rename renames a file on the remote FTP server.
-func (c *ServerConn) Rename(from, to string) error {
-	_, _, err := c.cmd(StatusRequestFilePending, "RNFR %s", from)
+// SetEncoding sets the character encoding of the server for the paths in
+// commands, replies and listings, e.g. "iso-8859-1", "cp1251" or "shift-jis"
+// for legacy servers, which do not announce UTF8 in their features and
+// garble other names. With "" or "utf-8" the default UTF-8 is used again.
+// The data of transfered files is never converted.
+func (c *ServerConn) SetEncoding(name string) error {
+	enc, err := ftputil.LookupEncoding(name)
 	if err != nil {
 		return err
 	}
+	c.encoding = enc
+	return nil
+}
 
-	_, _, err = c.cmd(StatusRequestedFileActionOK, "RNTO %s", to)
-	return err
+// SetServerLocation sets the time zone, in which the server lists the times
+// of files, see ftps_qftp_client.DetectServerLocation. Without it the times
+// are regarded as UTC.
+func (c *ServerConn) SetServerLocation(location *time.Location) {
+	c.serverLocation = location
 }
 
-// Delete issues a DELE FTP command to delete the specified file from the
-// remote FTP server.
-func (c *ServerConn) Delete(path string) error {
-	_, _, err := c.cmd(StatusRequestedFileActionOK, "DELE %s", path)
-	return err
+// Returns the location of the times listed by the server.
+func (c *ServerConn) location() *time.Location {
+	if c.serverLocation == nil {
+		return time.UTC
+	}
+	return c.serverLocation
+}
+
+// Checksum requests the checksum of the remote file with the HASH command or,
+// if the server does not announce it in its features, with XMD5.
+func (c *ServerConn) Checksum(path string) (ftps_qftp_client.Checksum, error) {
+	command := ftputil.ChecksumCommand(c.features)
+	code, message, err := c.cmd(-1, "%s %s", command, path)
+	if err != nil {
+		return ftps_qftp_client.Checksum{}, err
+	}
+	if code < 200 || code >= 300 {
+		return ftps_qftp_client.Checksum{}, &textproto.Error{Code: code, Msg: message}
+	}
+	algorithm, value, err := ftputil.ParseChecksum(command, message)
+	if err != nil {
+		return ftps_qftp_client.Checksum{}, err
+	}
+	return ftps_qftp_client.Checksum{Algorithm: algorithm, Value: value}, nil
 }
 
 // MakeDir issues a MKD FTP command to create the specified directory on the
@@ -767,6 +1200,7 @@ func (c *ServerConn) NoOp() error {
 // Logout issues a REIN FTP command to logout the current user.
 func (c *ServerConn) Logout() error {
 	_, _, err := c.cmd(StatusReady, "REIN")
+	c.currentDir = ""
 	return err
 }
 
@@ -774,23 +1208,79 @@ func (c *ServerConn) Logout() error {
 // remote FTP server.
 func (c *ServerConn) Quit() error {
 	_, _, err := c.cmd(StatusClosing, "QUIT")
+	if errors.Is(err, ftps_qftp_client.ErrServiceClosing) {
+		// Closed by the server, just release the connection
+		c.conn.Close()
+		return err
+	}
 	if err != nil {
 		return err
 	}
 	return c.conn.Close()
 }
 
+// Close closes the control connection and the data connection of a running
+// transfer without sending QUIT. Blocked calls on the connection return with
+// an error, so it can be used from another goroutine to abort a transfer.
+// The connection is not usable afterwards.
+func (c *ServerConn) Close() error {
+	c.dataConnMutex.Lock()
+	if c.dataConn != nil {
+		c.dataConn.Close()
+	}
+	c.dataConnMutex.Unlock()
+	return c.tcpconn.Close()
+}
+
 // Read implements the io.Reader interface on a FTP data connection.
-func (r *response) Read(buf []byte) (int, error) {
-	return r.conn.Read(buf)
+// The bytes read and the end of the data are recorded for BytesReceived
+// and ReceiveState.
+func (r *response) Read(buf []byte) (n int, err error) {
+	if r.reader != nil {
+		n, err = r.reader.Read(buf)
+	} else {
+		n, err = r.conn.Read(buf)
+	}
+	r.Count(int64(n), err)
+	return n, err
+}
+
+// Size implements the ftps_qftp_client.SizedReader interface, it returns the
+// number of bytes sent by the server, -1 if unknown.
+func (r *response) Size() int64 {
+	return r.size
+}
+
+// WriteTo implements the io.WriterTo interface on a FTP data connection, so
+// io.Copy takes the fast path of w, e.g. splice to a file. The bytes written
+// are recorded for BytesReceived, when the copy has ended.
+func (r *response) WriteTo(w io.Writer) (int64, error) {
+	var src io.Reader = r.conn
+	if r.reader != nil {
+		src = r.reader
+	}
+	n, err := ftps_qftp_client.BufferPoolOfSize(r.c.bufferSize).CopyFast(w, src)
+	if err == nil {
+		// io.Copy returns no error at the end of the data
+		err = io.EOF
+	}
+	r.Count(n, err)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
 }
 
 // Close implements the io.Closer interface on a FTP data connection.
 func (r *response) Close() error {
+	r.Interrupt()
 	err := r.conn.Close()
-	_, _, err2 := r.c.conn.ReadResponse(StatusClosingDataConnection)
+	_, _, err2 := r.c.readResponse(StatusClosingDataConnection)
 	if err2 != nil {
 		err = err2
 	}
+	if r.path != "" {
+		r.c.hooks.TransferCompleted("RETR", r.path, r.BytesReceived(), err)
+	}
 	return err
 }
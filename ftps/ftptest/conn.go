@@ -0,0 +1,193 @@
+// Contains the handling of the commands on the control connections.
+
+package ftptest
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client/internal/testserver"
+)
+
+// Time to wait for the data connection of a transfer
+const dataConnTimeout = 10 * time.Second
+
+// A control connection of a client
+type controlConn struct {
+	server   *Server
+	raw      net.Conn // connection before AUTH TLS
+	conn     *textproto.Conn
+	control  *testserver.Control
+	dataTLS  bool         // data connections are secured with PROT P
+	listener net.Listener // listener of the passive mode for the next transfer
+}
+
+func newControlConn(s *Server, conn net.Conn) *controlConn {
+	return &controlConn{server: s, raw: conn, conn: textproto.NewConn(conn),
+		control: testserver.NewControl(s.fs, s.user, s.password)}
+}
+
+// Serves the commands till QUIT or the end of the connection.
+func (c *controlConn) serve() {
+	defer c.closeListener()
+	if c.conn.PrintfLine("220 ftptest ready.") != nil {
+		return
+	}
+	for {
+		line, err := c.conn.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument := testserver.ParseCommand(line)
+		for _, reply := range c.handle(command, argument) {
+			if c.conn.PrintfLine("%s", reply) != nil {
+				return
+			}
+		}
+		switch command {
+		case "QUIT":
+			return
+		case "AUTH":
+			// The following commands are secured
+			c.conn = textproto.NewConn(tls.Server(c.raw, c.server.tlsConfig))
+		}
+	}
+}
+
+// Performs the command and returns the lines of the reply. The preliminary
+// replies of transfers are sent by the transfer itself.
+func (c *controlConn) handle(command, argument string) []string {
+	switch command {
+	case "FEAT":
+		return []string{"211-Features:", " AUTH TLS", " EPSV", " PASV", " PBSZ", " PROT",
+			" REST STREAM", " SIZE", " UTF8", "211 End"}
+	case "AUTH":
+		if argument != "TLS" && argument != "SSL" {
+			return []string{"504 Unknown AUTH type."}
+		}
+		return []string{"234 Proceeding with negotiation."}
+	case "PBSZ":
+		return []string{"200 PBSZ set to 0."}
+	case "PROT":
+		if argument != "P" && argument != "C" {
+			return []string{"536 PROT " + argument + " unsupported."}
+		}
+		c.dataTLS = argument == "P"
+		return []string{"200 PROT now " + argument + "."}
+	}
+	if replies, handled := c.control.Handle(command, argument); handled {
+		return replies
+	}
+
+	switch command {
+	case "PASV", "EPSV":
+		c.closeListener()
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return []string{"425 Can't open passive connection."}
+		}
+		c.listener = listener
+		port := listener.Addr().(*net.TCPAddr).Port
+		if command == "EPSV" {
+			return []string{"229 Entering Extended Passive Mode (|||" + strconv.Itoa(port) + "|)."}
+		}
+		return []string{"227 Entering Passive Mode (127,0,0,1," + strconv.Itoa(port/256) + "," + strconv.Itoa(port%256) + ")."}
+	case "RETR":
+		offset := c.control.TakeOffset()
+		data, available := c.server.fs.File(c.control.Resolve(argument))
+		if !available || offset > int64(len(data)) {
+			c.closeListener()
+			return []string{"550 Failed to open file."}
+		}
+		return c.send(data[offset:])
+	case "LIST", "NLST":
+		listing, available := c.control.Listing(command, argument)
+		if !available {
+			c.closeListener()
+			return []string{"550 Failed to list directory."}
+		}
+		return c.send([]byte(listing))
+	case "STOR":
+		filePath, refused := c.control.StorePath(argument)
+		if refused != nil {
+			c.closeListener()
+			return refused
+		}
+		return c.receive(filePath, c.control.TakeOffset())
+	}
+	return []string{"502 Command not implemented."}
+}
+
+// Accepts the data connection of the passive mode and sends the preliminary
+// reply. The data connection is secured after PROT P.
+func (c *controlConn) openDataConn() (net.Conn, []string) {
+	if c.listener == nil {
+		return nil, []string{"425 Use PASV or EPSV first."}
+	}
+	defer c.closeListener()
+	if tcpListener, ok := c.listener.(*net.TCPListener); ok {
+		tcpListener.SetDeadline(time.Now().Add(dataConnTimeout))
+	}
+	conn, err := c.listener.Accept()
+	if err != nil {
+		return nil, []string{"425 Can't open data connection."}
+	}
+	if err = c.conn.PrintfLine("150 Opening data connection."); err != nil {
+		conn.Close()
+		return nil, nil
+	}
+	if c.dataTLS {
+		tlsConn := tls.Server(conn, c.server.tlsConfig)
+		if err = tlsConn.Handshake(); err != nil && err != io.EOF {
+			conn.Close()
+			return nil, []string{"425 TLS negotiation on the data connection failed."}
+		}
+		// Without data the client closes the connection without handshake
+		return tlsConn, nil
+	}
+	return conn, nil
+}
+
+// Sends the data in the data connection and returns the final reply.
+func (c *controlConn) send(data []byte) []string {
+	conn, replies := c.openDataConn()
+	if conn == nil {
+		return replies
+	}
+	_, err := conn.Write(data)
+	conn.Close()
+	if err != nil {
+		return []string{"426 Connection closed; transfer aborted."}
+	}
+	return []string{"226 Transfer complete."}
+}
+
+// Receives the data of the data connection and stores it in the file from the
+// offset on. The data received before an aborted transfer is kept, so the
+// transfer can be resumed.
+func (c *controlConn) receive(filePath string, offset int64) []string {
+	conn, replies := c.openDataConn()
+	if conn == nil {
+		return replies
+	}
+	data, err := ioutil.ReadAll(conn)
+	conn.Close()
+	c.server.fs.Store(filePath, offset, data)
+	if err != nil {
+		return []string{"426 Connection closed; transfer aborted."}
+	}
+	return []string{"226 Transfer complete."}
+}
+
+// Closes the listener of the passive mode, if one is open.
+func (c *controlConn) closeListener() {
+	if c.listener != nil {
+		c.listener.Close()
+		c.listener = nil
+	}
+}
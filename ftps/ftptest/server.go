@@ -0,0 +1,122 @@
+// Package ftptest provides an in-process FTPS server for tests of the package
+// ftps and of programs using it. It listens on a port of 127.0.0.1 and keeps
+// its files in memory, so no configured external server is required.
+//
+// The server supports AUTH TLS with PBSZ and PROT for secured control and
+// data connections, the passive modes PASV and EPSV and the commands FEAT,
+// USER, PASS, REIN, QUIT, NOOP, TYPE, PWD, CWD, CDUP, MKD, RMD, DELE, RNFR,
+// RNTO, SIZE, REST, RETR, STOR, LIST and NLST. The certificate of the server
+// is generated when it starts, clients verify it with the file of CertFile.
+package ftptest
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/attenberger/ftps_qftp-client/internal/testserver"
+)
+
+// Server is an in-process FTPS server. Its file system contains just the root
+// directory "/" initially. The methods can be called while clients are
+// connected.
+type Server struct {
+	user      string
+	password  string
+	fs        *testserver.FileSystem
+	listener  net.Listener
+	tlsConfig *tls.Config
+	certFile  string // temporary file with the certificate in PEM format
+	mutex     sync.Mutex
+	conns     map[net.Conn]bool // open control connections
+	handlers  sync.WaitGroup
+}
+
+// NewServer starts a server on a free port of 127.0.0.1, which accepts the
+// user with the password. It must be closed with Close.
+func NewServer(user, password string) (*Server, error) {
+	tlsConfig, certFile, err := generateCertificate()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.Remove(certFile)
+		return nil, err
+	}
+	s := &Server{user: user, password: password, fs: testserver.NewFileSystem(),
+		listener: listener, tlsConfig: tlsConfig, certFile: certFile, conns: make(map[net.Conn]bool)}
+	s.handlers.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address of the control connections, e.g. "127.0.0.1:40123".
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// CertFile returns the path of the file with the certificate of the server,
+// which is passed to ftps.Dial.
+func (s *Server) CertFile() string {
+	return s.certFile
+}
+
+// AddFile creates or replaces the file at the absolute path with the data.
+// Missing parent directories are created.
+func (s *Server) AddFile(filePath string, data []byte) {
+	s.fs.AddFile(filePath, data)
+}
+
+// AddDir creates the directory at the absolute path and its missing parents.
+func (s *Server) AddDir(dirPath string) {
+	s.fs.AddDir(dirPath)
+}
+
+// File returns the content of the file at the absolute path and whether it exists.
+func (s *Server) File(filePath string) ([]byte, bool) {
+	return s.fs.File(filePath)
+}
+
+// IsDir reports whether the directory at the absolute path exists.
+func (s *Server) IsDir(dirPath string) bool {
+	return s.fs.IsDir(dirPath)
+}
+
+// Close stops the server, closes the connections of all clients and removes
+// the file of the certificate.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	s.handlers.Wait()
+	os.Remove(s.certFile)
+	return err
+}
+
+// Accepts the control connections till the listener is closed.
+func (s *Server) serve() {
+	defer s.handlers.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns[conn] = true
+		s.mutex.Unlock()
+		s.handlers.Add(1)
+		go func() {
+			defer s.handlers.Done()
+			newControlConn(s, conn).serve()
+			conn.Close()
+			s.mutex.Lock()
+			delete(s.conns, conn)
+			s.mutex.Unlock()
+		}()
+	}
+}
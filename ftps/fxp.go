@@ -0,0 +1,71 @@
+// Contains the transfer of files directly between two servers (FXP).
+
+package ftps
+
+import (
+	"errors"
+)
+
+// Transfer copies a file from the source to the destination server directly
+// between the servers (FXP): the destination waits for the data connection
+// announced by PASV, the source connects to it after PORT. So the data does
+// not pass the client. Both servers must allow it, many of them refuse PORT
+// with the address of another host.
+// If the data connections are secured, the source has to support SSCN to
+// act as TLS client for the data connection.
+func Transfer(source *ServerConn, destination *ServerConn, sourcePath string, destinationPath string) error {
+	if source.tlsSecuredDataConnection != destination.tlsSecuredDataConnection {
+		return errors.New("The data connections of both servers have to be either secured or not secured.")
+	}
+	if source.tlsSecuredDataConnection {
+		_, _, err := source.cmd(StatusCommandOK, "SSCN ON")
+		if err != nil {
+			return errors.New("Error while SSCN ON command. " + err.Error())
+		}
+		defer source.cmd(StatusCommandOK, "SSCN OFF")
+	}
+
+	_, line, err := destination.cmd(StatusPassiveMode, "PASV")
+	if err != nil {
+		return err
+	}
+	address, err := parsePasvAddress(line)
+	if err != nil {
+		return err
+	}
+	_, _, err = source.cmd(StatusCommandOK, "PORT %s", address)
+	if err != nil {
+		return err
+	}
+
+	// The destination has to wait for the data connection before the source connects
+	err = startTransfer(destination, "STOR %s", destinationPath)
+	if err != nil {
+		return err
+	}
+	err = startTransfer(source, "RETR %s", sourcePath)
+	if err != nil {
+		destination.abort()
+		return err
+	}
+
+	_, _, err = source.readResponse(StatusClosingDataConnection)
+	_, _, destinationErr := destination.readResponse(StatusClosingDataConnection)
+	if err != nil {
+		return errors.New("Error while retrieving " + sourcePath + " on the source server. " + err.Error())
+	}
+	if destinationErr != nil {
+		return errors.New("Error while storing " + destinationPath + " on the destination server. " + destinationErr.Error())
+	}
+	return nil
+}
+
+// Issues a command starting a transfer on a data connection opened by the server.
+func startTransfer(c *ServerConn, format string, args ...interface{}) error {
+	err := c.send(format, args...)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.readTransferStart()
+	return err
+}
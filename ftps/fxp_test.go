@@ -0,0 +1,92 @@
+package ftps
+
+import (
+	"net"
+	"net/textproto"
+	"reflect"
+	"testing"
+)
+
+// Starts a server on a pipe, which answers each command with the replies in
+// the map and sends the received commands to the channel after the last one.
+func newScriptedConn(t *testing.T, replies map[string][]string, last string, commands chan []string) *ServerConn {
+	client, server := net.Pipe()
+	go func() {
+		proto := textproto.NewConn(server)
+		var received []string
+		defer func() { commands <- received }()
+		for {
+			command, err := proto.ReadLine()
+			if err != nil {
+				return
+			}
+			received = append(received, command)
+			lines, available := replies[command]
+			if !available {
+				lines = []string{"500 Unknown command."}
+			}
+			for _, line := range lines {
+				proto.Writer.PrintfLine("%s", line)
+			}
+			if command == last {
+				return
+			}
+		}
+	}()
+	return &ServerConn{conn: textproto.NewConn(client), tcpconn: client, features: make(map[string]string)}
+}
+
+func TestTransferFXP(t *testing.T) {
+	sourceCommands := make(chan []string, 1)
+	source := newScriptedConn(t, map[string][]string{
+		"PORT 192,168,1,2,19,137": {"200 PORT command successful."},
+		"RETR a.txt":              {"150 Opening data connection.", "226 Transfer complete."},
+	}, "RETR a.txt", sourceCommands)
+	defer source.Close()
+
+	destinationCommands := make(chan []string, 1)
+	destination := newScriptedConn(t, map[string][]string{
+		"PASV":       {"227 Entering Passive Mode (192,168,1,2,19,137)."},
+		"STOR b.txt": {"150 Ok to send data.", "226 Transfer complete."},
+	}, "STOR b.txt", destinationCommands)
+	defer destination.Close()
+
+	if err := Transfer(source, destination, "a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if commands := <-sourceCommands; !reflect.DeepEqual(commands, []string{"PORT 192,168,1,2,19,137", "RETR a.txt"}) {
+		t.Errorf("source received %q", commands)
+	}
+	if commands := <-destinationCommands; !reflect.DeepEqual(commands, []string{"PASV", "STOR b.txt"}) {
+		t.Errorf("destination received %q", commands)
+	}
+}
+
+func TestTransferFXPAbortsDestination(t *testing.T) {
+	sourceCommands := make(chan []string, 1)
+	source := newScriptedConn(t, map[string][]string{
+		"PORT 10,0,0,1,4,1": {"200 PORT command successful."},
+		"RETR missing":      {"550 No such file."},
+	}, "RETR missing", sourceCommands)
+	defer source.Close()
+
+	destinationCommands := make(chan []string, 1)
+	destination := newScriptedConn(t, map[string][]string{
+		"PASV":       {"227 Entering Passive Mode (10,0,0,1,4,1)."},
+		"STOR b.txt": {"150 Ok to send data."},
+		"ABOR":       {"426 Transfer aborted.", "226 Abort successful."},
+	}, "ABOR", destinationCommands)
+	defer destination.Close()
+
+	if err := Transfer(source, destination, "missing", "b.txt"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if commands := <-destinationCommands; !reflect.DeepEqual(commands, []string{"PASV", "STOR b.txt", "ABOR"}) {
+		t.Errorf("destination received %q", commands)
+	}
+	// Usable after the abort
+	if destination.busy != 0 {
+		t.Error("destination busy after the abort")
+	}
+}
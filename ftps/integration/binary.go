@@ -0,0 +1,82 @@
+// Contains the start of vsftpd as a binary installed on the machine.
+
+package integration
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// StartBinary starts the vsftpd binary at the path with a generated
+// configuration. vsftpd must run as root, because it changes into the root
+// directory of the anonymous user and drops its privileges to the user "ftp".
+// The files of the server are kept in a temporary directory.
+func StartBinary(path string) (*Server, error) {
+	dir, certFile, keyFile, err := newServerDir()
+	if err != nil {
+		return nil, err
+	}
+	server, err := startBinary(path, dir, certFile, keyFile)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return server, nil
+}
+
+func startBinary(path string, dir string, certFile string, keyFile string) (*Server, error) {
+	anonRoot := filepath.Join(dir, "root")
+	secureChroot := filepath.Join(dir, "empty")
+	for _, subDir := range []string{anonRoot, secureChroot} {
+		err := os.Mkdir(subDir, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Mkdir applies the umask, so the mode is set explicitly.
+	incoming := filepath.Join(anonRoot, "incoming")
+	err := os.Mkdir(incoming, 0777)
+	if err == nil {
+		err = os.Chmod(incoming, 0777)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	controlPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	configFile := filepath.Join(dir, "vsftpd.conf")
+	err = writeConfig(configFile, vsftpdConfig{controlPort: controlPort, anonRoot: anonRoot,
+		secureChroot: secureChroot, certFile: certFile, keyFile: keyFile})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path, configFile)
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	stop := func() error {
+		err := cmd.Process.Kill()
+		<-exited
+		return err
+	}
+
+	addr := "127.0.0.1:" + strconv.Itoa(controlPort)
+	err = waitReady(addr, exited)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	return &Server{addr: addr, certFile: certFile, dir: dir, stop: stop}, nil
+}
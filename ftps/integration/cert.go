@@ -0,0 +1,75 @@
+// Contains the generation of the certificate of the integration server.
+
+package integration
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Names of the files written by GenerateCertificate.
+const (
+	certFileName = "cert.pem"
+	keyFileName  = "key.pem"
+)
+
+// GenerateCertificate generates a self-signed RSA certificate for 127.0.0.1
+// and localhost and writes it and its private key in PEM format to the
+// directory. It returns the paths of both files. The certificate file is
+// passed to ftps.Dial, the key file is just read by the server.
+func GenerateCertificate(dir string) (certFile string, keyFile string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{Organization: []string{"integration"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+
+	certFile = filepath.Join(dir, certFileName)
+	err = writePEM(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err != nil {
+		return "", "", err
+	}
+	keyFile = filepath.Join(dir, keyFileName)
+	err = writePEM(keyFile, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// Writes the block to a new file, which is readable for all users, so the
+// server can read it after dropping its privileges.
+func writePEM(path string, block *pem.Block) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	err = pem.Encode(file, block)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package integration
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestGenerateCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "integration-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile, err := GenerateCertificate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cert.VerifyHostname("127.0.0.1")
+	if err != nil {
+		t.Error(err)
+	}
+}
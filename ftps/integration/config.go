@@ -0,0 +1,95 @@
+// Contains the configuration of the vsftpd server.
+
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+)
+
+// Number of ports vsftpd uses for passive data connections. The tests open
+// up to 18 parallel connections.
+const passivePortCount = 32
+
+// Settings, which differ between a server in a container and a bundled binary.
+type vsftpdConfig struct {
+	controlPort    int
+	passiveMinPort int
+	passiveMaxPort int
+	anonRoot       string // root directory of the anonymous user
+	secureChroot   string // empty directory, which is not writable
+	certFile       string
+	keyFile        string
+}
+
+// Writes the configuration file of vsftpd. Anonymous users may log in with
+// any password, secured and insecure connections are both allowed and the
+// anonymous user may write below the directory "incoming" of its root.
+func writeConfig(path string, config vsftpdConfig) error {
+	content := "# Generated by the package integration\n" +
+		"listen=YES\n" +
+		"listen_address=127.0.0.1\n" +
+		"listen_ipv6=NO\n" +
+		"listen_port=" + strconv.Itoa(config.controlPort) + "\n" +
+		"background=NO\n" +
+		"seccomp_sandbox=NO\n" +
+		"secure_chroot_dir=" + config.secureChroot + "\n" +
+		"local_enable=NO\n" +
+		"anonymous_enable=YES\n" +
+		"no_anon_password=YES\n" +
+		"anon_root=" + config.anonRoot + "\n" +
+		"write_enable=YES\n" +
+		"anon_upload_enable=YES\n" +
+		"anon_mkdir_write_enable=YES\n" +
+		"anon_other_write_enable=YES\n" +
+		"anon_umask=022\n" +
+		"pasv_enable=YES\n" +
+		"pasv_address=127.0.0.1\n" +
+		"pasv_min_port=" + strconv.Itoa(config.passiveMinPort) + "\n" +
+		"pasv_max_port=" + strconv.Itoa(config.passiveMaxPort) + "\n" +
+		"ssl_enable=YES\n" +
+		"allow_anon_ssl=YES\n" +
+		"force_anon_logins_ssl=NO\n" +
+		"force_anon_data_ssl=NO\n" +
+		"require_ssl_reuse=NO\n" +
+		"ssl_ciphers=HIGH\n" +
+		"rsa_cert_file=" + config.certFile + "\n" +
+		"rsa_private_key_file=" + config.keyFile + "\n"
+	return ioutil.WriteFile(path, []byte(content), 0644)
+}
+
+// Returns a port of 127.0.0.1, which is free at the moment.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Searches count consecutive ports of 127.0.0.1, which are free at the moment,
+// and returns the first one.
+func freePortRange(count int) (int, error) {
+	for first := 30000; first+count <= 60000; first += count {
+		if portsFree(first, count) {
+			return first, nil
+		}
+	}
+	return 0, errors.New("No range of " + strconv.Itoa(count) + " free ports found.")
+}
+
+// Checks whether the count ports starting with first can be listened on.
+func portsFree(first int, count int) bool {
+	for port := first; port < first+count; port++ {
+		listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return false
+		}
+		listener.Close()
+	}
+	return true
+}
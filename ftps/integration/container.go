@@ -0,0 +1,106 @@
+// Contains the start of vsftpd in a docker container.
+
+package integration
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultImage is the image of the containers, if no other one is chosen.
+// vsftpd is installed with apk when the container starts, if the image does
+// not contain it.
+const DefaultImage = "alpine:3.18"
+
+// Directory of the container, where the temporary directory of the server is
+// mounted.
+const containerConfigDir = "/etc/integration"
+
+// StartContainer starts vsftpd in a new docker container of the image. The
+// docker command must be available. The ports of the control and the data
+// connections are published on 127.0.0.1 with the same numbers, so the
+// addresses in the replies to PASV are valid outside of the container. The
+// container is removed, when the server is closed.
+func StartContainer(image string) (*Server, error) {
+	dir, certFile, _, err := newServerDir()
+	if err != nil {
+		return nil, err
+	}
+	server, err := startContainer(image, dir, certFile)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return server, nil
+}
+
+func startContainer(image string, dir string, certFile string) (*Server, error) {
+	controlPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	passiveMinPort, err := freePortRange(passivePortCount)
+	if err != nil {
+		return nil, err
+	}
+	passiveMaxPort := passiveMinPort + passivePortCount - 1
+	err = writeConfig(filepath.Join(dir, "vsftpd.conf"), vsftpdConfig{controlPort: controlPort,
+		passiveMinPort: passiveMinPort, passiveMaxPort: passiveMaxPort,
+		anonRoot: "/var/ftp", secureChroot: "/var/empty",
+		certFile: containerConfigDir + "/" + certFileName, keyFile: containerConfigDir + "/" + keyFileName})
+	if err != nil {
+		return nil, err
+	}
+
+	// The directories are created in the container, so their owner is root.
+	script := "(command -v vsftpd >/dev/null || apk add --no-cache vsftpd) && " +
+		"mkdir -p /var/empty /var/ftp/incoming && chmod 0755 /var/ftp && chmod 0777 /var/ftp/incoming && " +
+		"exec vsftpd " + containerConfigDir + "/vsftpd.conf"
+	passivePorts := strconv.Itoa(passiveMinPort) + "-" + strconv.Itoa(passiveMaxPort)
+	output, err := docker("run", "--detach", "--rm",
+		"--publish", "127.0.0.1:"+strconv.Itoa(controlPort)+":"+strconv.Itoa(controlPort),
+		"--publish", "127.0.0.1:"+passivePorts+":"+passivePorts,
+		"--volume", dir+":"+containerConfigDir+":ro",
+		"--entrypoint", "/bin/sh", image, "-c", script)
+	if err != nil {
+		return nil, err
+	}
+	id := strings.TrimSpace(output)
+
+	stop := func() error {
+		_, err := docker("rm", "--force", id)
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		docker("wait", id)
+		close(exited)
+	}()
+
+	addr := "127.0.0.1:" + strconv.Itoa(controlPort)
+	err = waitReady(addr, exited)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	return &Server{addr: addr, certFile: certFile, dir: dir, stop: stop}, nil
+}
+
+// Runs the docker command with the arguments and returns its standard output.
+// The error contains the standard error output.
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", errors.New("docker " + args[0] + ": " + err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
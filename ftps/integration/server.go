@@ -0,0 +1,132 @@
+// Package integration starts a real FTPS server for integration tests of the
+// package ftps and of programs using it. The server is vsftpd, either run in
+// a docker container or as a binary installed on the machine. Its certificate
+// is generated when it starts, so the tests need no prepared configuration.
+//
+// The server listens on 127.0.0.1 and allows anonymous logins. The root
+// directory of the anonymous user contains just the writable directory
+// "incoming". Secured and insecure connections are both allowed.
+//
+// The tests of the package ftps, which use this package, are only built with
+// the build tag "integration":
+//
+//	go test -tags integration ./ftps
+//
+// Start reads the environment variables FTPS_INTEGRATION_VSFTPD and
+// FTPS_INTEGRATION_IMAGE to choose how the server is run.
+package integration
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Name of the user and its password, which the server accepts.
+const (
+	User     = "anonymous"
+	Password = "anonymous"
+)
+
+// Time, till the server must accept connections after it was started.
+const startTimeout = 2 * time.Minute
+
+// Server is a running vsftpd server.
+type Server struct {
+	addr     string
+	certFile string
+	dir      string       // temporary directory with configuration and certificate
+	stop     func() error // stops the container or the process
+}
+
+// Start starts a server. If the environment variable FTPS_INTEGRATION_VSFTPD
+// contains the path of a vsftpd binary, it is run with StartBinary.
+// Otherwise the server runs in a container started with StartContainer and
+// the image of FTPS_INTEGRATION_IMAGE or DefaultImage.
+func Start() (*Server, error) {
+	if binary := os.Getenv("FTPS_INTEGRATION_VSFTPD"); binary != "" {
+		return StartBinary(binary)
+	}
+	image := os.Getenv("FTPS_INTEGRATION_IMAGE")
+	if image == "" {
+		image = DefaultImage
+	}
+	return StartContainer(image)
+}
+
+// Addr returns the address of the control connections, e.g. "127.0.0.1:40123".
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// CertFile returns the path of the file with the certificate of the server,
+// which is passed to ftps.Dial.
+func (s *Server) CertFile() string {
+	return s.certFile
+}
+
+// Close stops the server and removes its temporary files.
+func (s *Server) Close() error {
+	err := s.stop()
+	if removeErr := os.RemoveAll(s.dir); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// Creates the temporary directory of a server and writes the certificate.
+func newServerDir() (dir string, certFile string, keyFile string, err error) {
+	dir, err = ioutil.TempDir("", "ftps-integration-")
+	if err != nil {
+		return "", "", "", err
+	}
+	// The server must be able to read the files after dropping its privileges.
+	err = os.Chmod(dir, 0755)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", "", err
+	}
+	certFile, keyFile, err = GenerateCertificate(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", "", err
+	}
+	return dir, certFile, keyFile, nil
+}
+
+// Waits till the server at the address sends its welcome message or exited
+// is closed. A container needs some time to start, so refused connections
+// are retried.
+func waitReady(addr string, exited <-chan struct{}) error {
+	deadline := time.Now().Add(startTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			return errors.New("The server at " + addr + " exited while starting.")
+		default:
+		}
+		if welcomed(addr) {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return errors.New("The server at " + addr + " did not start within " + startTimeout.String() + ".")
+}
+
+// Checks whether the server at the address sends the code 220 on a new
+// control connection. A port published by docker accepts connections before
+// the server is listening, but closes them immediately.
+func welcomed(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	return err == nil && strings.HasPrefix(line, "220")
+}
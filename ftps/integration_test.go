@@ -0,0 +1,20 @@
+//go:build integration
+// +build integration
+
+// Replaces the in-process server of the tests with vsftpd, which the package
+// integration starts in a docker container or as a local binary. Run the
+// tests with:
+//
+//	go test -tags integration ./ftps
+
+package ftps
+
+import (
+	"github.com/attenberger/ftps_qftp-client/ftps/integration"
+)
+
+func init() {
+	startTestServer = func() (testServer, error) {
+		return integration.Start()
+	}
+}
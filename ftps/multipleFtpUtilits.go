@@ -4,127 +4,111 @@
 package ftps
 
 import (
-	"errors"
-	"io"
-	"os"
+	"context"
+	"github.com/attenberger/ftps_qftp-client"
+	"net"
 	"time"
 )
 
-type TransferDirction int8
-
-const (
-	Retrieve = TransferDirction(1)
-	Store    = TransferDirction(2)
-)
+// MultipleTransfer issues STOR and RETR FTP commands in parallel connections to transfer
+// multiple files between the client and the remote FTP server.
+// The files are transfered as specified in tasks. The number of parallel
+// connections can be limited. nrParallel < 0 means no limit
+// The result of each task is returned in the order of the tasks. Cancelling
+// the context aborts the transfers. For further options, e.g. a dry run, use
+// NewTransferScheduler.
+//
+// Hint: io.Pipe() can be used if an io.Writer is required.
+func (c *ServerConn) MultipleTransfer(ctx context.Context, tasks []ftps_qftp_client.TransferTask, nrParallel int) (ftps_qftp_client.TransferResults, error) {
+	scheduler, err := c.NewTransferScheduler(nrParallel)
+	if err != nil {
+		return nil, err
+	}
+	return scheduler.Run(ctx, tasks), nil
+}
 
-// Task to inform a go routine which transfer should be performed
-type TransferTask struct {
-	localpath  string
-	remotepath string
-	direction  TransferDirction
-	finished   bool
+// NewTransferScheduler creates a scheduler for parallel transfers, whose connections
+// are secured and logged in like this connection and start in its current directory.
+func (c *ServerConn) NewTransferScheduler(nrParallel int) (*ftps_qftp_client.TransferScheduler, error) {
+	currentdirctory, err := c.CurrentDir()
+	if err != nil {
+		return nil, err
+	}
+	openConn := func() (ftps_qftp_client.ConnectionI, error) {
+		return c.openParallelConn(currentdirctory)
+	}
+	return ftps_qftp_client.NewTransferScheduler(nrParallel, openConn), nil
 }
 
-// Creates a new TransferTask
-func NewTransferTask(direction TransferDirction, localpath string, remotepath string) TransferTask {
-	return TransferTask{localpath: localpath, remotepath: remotepath, direction: direction, finished: false}
+// ParallelWalk walks the remote file tree below root like
+// ftps_qftp_client.Walk, but lists sibling directories concurrently in up to
+// nrParallel further connections, which are set up like for MultipleTransfer.
+// fn is called in the same order as by Walk and never concurrently.
+func (c *ServerConn) ParallelWalk(root string, nrParallel int, fn ftps_qftp_client.WalkFunc) error {
+	currentdirctory, err := c.CurrentDir()
+	if err != nil {
+		return err
+	}
+	openConn := func() (ftps_qftp_client.ConnectionI, error) {
+		return c.openParallelConn(currentdirctory)
+	}
+	return ftps_qftp_client.ParallelWalk(openConn, nrParallel, root, fn)
 }
 
-// Runs a parallel transfer.
-// In the taskChannel it gets the TransferTask to perform.
-// In the returnChannel it returns occured error or nil for success
-func (c *ServerConn) parallelTransfer(serveraddr string, dirctory string, secure bool, serverCertFilename string, taskChannel chan TransferTask, returnChannel chan error) {
+// Opens a further control connection for a parallel transfer, which is
+// secured if the main connection is secured, logged in and in the specified directory.
+func (c *ServerConn) openParallelConn(dirctory string) (*ServerConn, error) {
 	// Open Controlconnection
-	conn, err := DialTimeout(serveraddr, time.Second*30, serverCertFilename)
+	conn, err := DialTLSConfig(net.JoinHostPort(c.hostname, c.hostcontrolport), time.Second*30, c.tlsConfig)
 	if err != nil {
-		returnChannel <- errors.New("Go routine reset. " + err.Error())
-		return
+		return nil, err
 	}
-	defer conn.Quit()
+	// Take over the settings of the main connection
+	conn.loginHook = c.loginHook
+	conn.commandLogger = c.commandLogger
+	conn.transferType = c.transferType
+	conn.maxLineLength = c.maxLineLength
+	conn.bufferSize = c.bufferSize
+	conn.retrSize = c.retrSize
+	conn.serverLocation = c.serverLocation
+	conn.encoding = c.encoding
+	conn.hooks = c.hooks
+	conn.hooks.Connected(conn.RemoteAddr().String())
 	// Secure if main connection is secured
-	if secure {
+	if c.tlsSecuredControlConnection {
 		err = conn.AuthTLS()
 		if err != nil {
-			returnChannel <- errors.New("Go routine reset. " + err.Error())
-			return
+			conn.Quit()
+			return nil, err
 		}
 	}
 	// Login in
 	err = conn.Login(c.username, c.password)
 	if err != nil {
-		returnChannel <- errors.New("Go routine reset. " + err.Error())
-		return
+		conn.Quit()
+		return nil, err
 	}
 	// Change to directory of the main connection
 	err = conn.ChangeDir(dirctory)
 	if err != nil {
-		returnChannel <- errors.New("Go routine reset. " + err.Error())
-		return
-	}
-
-	// run tasks
-	for {
-		task := <-taskChannel
-		if task.finished {
-			return
-		} else if task.direction == Store {
-			returnChannel <- conn.parallelStorTask(task)
-		} else if task.direction == Retrieve {
-			returnChannel <- conn.parallelRetrTask(task)
-		} else {
-			returnChannel <- errors.New("Unknown direction for transfer.")
-		}
+		conn.Quit()
+		return nil, err
 	}
+	return conn, nil
 }
 
-// Stores a file at the server within a parallel transfer.
-func (c *ServerConn) parallelStorTask(task TransferTask) error {
-	file, err := os.Open(task.localpath)
-	defer file.Close()
-	if err != nil {
-		return errors.New("Error while opening the local file " + task.localpath + ". " + err.Error())
-	}
-
-	err = c.Stor(task.remotepath, file)
-	if err != nil {
-		return errors.New("Error while writing file " + task.localpath + " to server. " + err.Error())
-	}
-	return nil
-}
-
-// Receives a file at the server within a parallel transfer.
-func (c *ServerConn) parallelRetrTask(task TransferTask) error {
-	// Check if file already exists at client
-	if _, err := os.Stat(task.localpath); os.IsExist(err) {
-		return errors.New("File with this name already exists in local folder.")
-	}
-
-	// Create and open the file
-	file, err := os.Create(task.localpath)
-	if err != nil {
-		return errors.New("Error while creating the local file. " + err.Error())
-	}
-	defer file.Close()
-
-	// Retrieve the file and write it to the filesystem
-	reader, err := c.Retr(task.remotepath)
+// Copy copies a remote file to another path on the server. The file is
+// retrieved on this connection and stored on a further connection, so the
+// data just passes the buffer of the client.
+func (c *ServerConn) Copy(sourcePath string, destinationPath string) error {
+	currentdirctory, err := c.CurrentDir()
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(file, reader)
-	if err != nil {
-		errortext := "Error while writing file to local file. " + err.Error()
-		err = reader.Close()
-		if err != nil {
-			errortext = errortext + " Error while closing reader from server. " + err.Error()
-		}
-		return errors.New(errortext)
-	}
-
-	// Finalize retrieve of the file
-	err = reader.Close()
+	destination, err := c.openParallelConn(currentdirctory)
 	if err != nil {
-		return errors.New(" Error while closing reader from server. " + err.Error())
+		return err
 	}
-	return nil
+	defer destination.Quit()
+	return ftps_qftp_client.Copy(c, sourcePath, destination, destinationPath)
 }
@@ -0,0 +1,114 @@
+// Contains the expansion of transfer tasks with wildcards into tasks for the
+// matching files.
+
+package ftps_qftp_client
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Checks whether the path contains wildcards of path.Match.
+func hasWildcards(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// ExpandGlobTasks replaces each task, whose source contains the wildcards
+// "*", "?" or "[" of path.Match, by tasks for the matching files and
+// directories. The destination of such a task is a directory, which is
+// created if it is missing, the matches keep their names in it. Store tasks
+// match the local paths with filepath.Glob, retrieve tasks the entries
+// listed in the remote directory, where just the last element of the path
+// may contain wildcards. A pattern without match is an error. Matched
+// directories can be expanded with ExpandDirectoryTasks afterwards.
+func ExpandGlobTasks(conn ConnectionI, tasks []TransferTask) ([]TransferTask, error) {
+	expanded := make([]TransferTask, 0, len(tasks))
+	for _, task := range tasks {
+		var err error
+		switch {
+		case task.Direction == Store && hasWildcards(task.LocalPath):
+			expanded, err = expandStoreGlob(conn, task, expanded)
+		case task.Direction == Retrieve && hasWildcards(task.RemotePath):
+			expanded, err = expandRetrieveGlob(conn, task, expanded)
+		default:
+			expanded = append(expanded, task)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// Appends the tasks to store the local files matching the local path.
+func expandStoreGlob(conn ConnectionI, task TransferTask, expanded []TransferTask) ([]TransferTask, error) {
+	matches, err := filepath.Glob(task.LocalPath)
+	if err != nil {
+		return nil, errors.New("Invalid pattern " + task.LocalPath + ". " + err.Error())
+	}
+	if len(matches) == 0 {
+		return nil, errors.New("No local file matches " + task.LocalPath + ".")
+	}
+	// The directory may already exist, then storing the files shows whether
+	// it is usable.
+	MkdirAll(conn, task.RemotePath)
+	for _, match := range matches {
+		matchTask := task
+		matchTask.LocalPath = match
+		matchTask.RemotePath = path.Join(task.RemotePath, filepath.Base(match))
+		matchTask.Size = 0
+		matchTask.Offset = 0
+		expanded = append(expanded, matchTask)
+	}
+	return expanded, nil
+}
+
+// Appends the tasks to retrieve the remote files matching the remote path.
+func expandRetrieveGlob(conn ConnectionI, task TransferTask, expanded []TransferTask) ([]TransferTask, error) {
+	dir, pattern := path.Split(task.RemotePath)
+	dir = path.Clean(dir)
+	if hasWildcards(dir) {
+		return nil, errors.New("Just the last element of the remote path " + task.RemotePath + " may contain wildcards.")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, errors.New("Invalid pattern " + task.RemotePath + ". " + err.Error())
+	}
+	entries, err := conn.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*Entry
+	for _, entry := range entries {
+		name := path.Base(entry.Name)
+		if name == "." || name == ".." {
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			matches = append(matches, entry)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, errors.New("No remote file matches " + task.RemotePath + ".")
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+
+	if err = makeLocalDir(task.LocalPath, false, nil); err != nil {
+		return nil, err
+	}
+	for _, entry := range matches {
+		name := path.Base(entry.Name)
+		matchTask := task
+		matchTask.LocalPath = filepath.Join(task.LocalPath, name)
+		matchTask.RemotePath = path.Join(dir, name)
+		matchTask.Size = 0
+		if entry.Type == EntryTypeFile {
+			matchTask.Size = int64(entry.Size)
+		}
+		matchTask.Offset = 0
+		expanded = append(expanded, matchTask)
+	}
+	return expanded, nil
+}
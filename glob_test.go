@@ -0,0 +1,59 @@
+package ftps_qftp_client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandGlobTasks(t *testing.T) {
+	localDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.log"} {
+		if err := ioutil.WriteFile(filepath.Join(localDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := newMemoryServer()
+	server.dirs["/remote"] = true
+	server.dirs["/remote/logs"] = true
+	server.files["/remote/x.log"] = []byte("x")
+	server.files["/remote/y.txt"] = []byte("y")
+	conn, _ := server.opener()()
+
+	tasks, err := ExpandGlobTasks(conn, []TransferTask{
+		NewTransferTask(Store, filepath.Join(localDir, "*.txt"), "/uploaded"),
+		NewTransferTask(Retrieve, filepath.Join(localDir, "download"), "/remote/*log*"),
+		NewTransferTask(Retrieve, filepath.Join(localDir, "plain"), "/remote/y.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct{ local, remote string }{
+		{filepath.Join(localDir, "a.txt"), "/uploaded/a.txt"},
+		{filepath.Join(localDir, "b.txt"), "/uploaded/b.txt"},
+		{filepath.Join(localDir, "download", "logs"), "/remote/logs"},
+		{filepath.Join(localDir, "download", "x.log"), "/remote/x.log"},
+		{filepath.Join(localDir, "plain"), "/remote/y.txt"},
+	}
+	if len(tasks) != len(expected) {
+		t.Fatalf("got %d tasks, expected %d: %+v", len(tasks), len(expected), tasks)
+	}
+	for i, task := range tasks {
+		if task.LocalPath != expected[i].local || task.RemotePath != expected[i].remote {
+			t.Errorf("got task %s %s, expected %s %s", task.LocalPath, task.RemotePath, expected[i].local, expected[i].remote)
+		}
+	}
+	if !server.dirs["/uploaded"] {
+		t.Error("The remote directory of the matches was not created")
+	}
+
+	for _, task := range []TransferTask{
+		NewTransferTask(Store, filepath.Join(localDir, "*.missing"), "/uploaded"),
+		NewTransferTask(Retrieve, localDir, "/remote/*.missing"),
+		NewTransferTask(Retrieve, localDir, "/rem*/x.log"),
+	} {
+		if _, err = ExpandGlobTasks(conn, []TransferTask{task}); err == nil {
+			t.Errorf("no error for %s %s", task.LocalPath, task.RemotePath)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package ftps_qftp_client
 
-import "io"
+import (
+	"io"
+	"os"
+	"time"
+)
 
 type ConnectionI interface {
 
@@ -27,6 +31,17 @@ type ConnectionI interface {
 	// List issues a LIST FTP command.
 	List(path string) (entries []*Entry, err error)
 
+	// MachineList issues a MLSD FTP command (RFC 3659) and returns the
+	// entries in the machine readable format of the directory.
+	MachineList(path string) (entries []*Entry, err error)
+
+	// MachineEntry issues a MLST FTP command (RFC 3659) and returns the
+	// entry of the file or directory at the path.
+	MachineEntry(path string) (*Entry, error)
+
+	// Capabilities returns the optional commands announced by the server.
+	Capabilities() Capabilities
+
 	// ChangeDir issues a CWD FTP command, which changes the current directory to
 	// the specified path.
 	ChangeDir(path string) error
@@ -50,6 +65,7 @@ type ConnectionI interface {
 	// FTP server, the server will not send the offset first bytes of the file.
 	//
 	// The retrive must be finialized with FinializeRetr() to cleanup the FTP data connection.
+	// The readers of Retr and RetrFrom implement ReceiveProgress.
 	RetrFrom(path string, offset uint64) (io.ReadCloser, error)
 
 	// Stor issues a STOR FTP command to store a file to the remote FTP server.
@@ -65,6 +81,10 @@ type ConnectionI interface {
 	// Hint: io.Pipe() can be used if an io.Writer is required.
 	StorFrom(path string, r io.Reader, offset uint64) error
 
+	// SetTransferType issues a TYPE FTP command to set the representation type
+	// of the following transfers.
+	SetTransferType(transferType TransferType) error
+
 	// Rename renames a file on the remote FTP server.
 	Rename(from, to string) error
 
@@ -72,6 +92,30 @@ type ConnectionI interface {
 	// remote FTP server.
 	Delete(path string) error
 
+	// FileSize issues a SIZE FTP command (RFC 3659) and returns the size of
+	// the remote file.
+	FileSize(path string) (int64, error)
+
+	// ModTime issues a MDTM FTP command (RFC 3659) and returns the time of
+	// the last modification of the remote file.
+	ModTime(path string) (time.Time, error)
+
+	// SetModTime issues a MFMT FTP command to set the time of the last
+	// modification of the remote file.
+	SetModTime(path string, t time.Time) error
+
+	// Checksum requests the checksum of the remote file computed by the server
+	// with the HASH or XMD5 command.
+	Checksum(path string) (Checksum, error)
+
+	// Chmod issues a SITE CHMOD FTP command to set the permissions of the
+	// remote file or directory.
+	Chmod(path string, mode os.FileMode) error
+
+	// AvailableSpace returns the number of bytes, which can be stored in the
+	// remote directory, with AVBL or SITE QUOTA.
+	AvailableSpace(path string) (int64, error)
+
 	// MakeDir issues a MKD FTP command to create the specified directory on the
 	// remote FTP server.
 	MakeDir(path string) error
@@ -91,4 +135,8 @@ type ConnectionI interface {
 
 	// Logout issues a REIN FTP command to logout the current user.
 	Quit() error
+
+	// Close closes the connection without sending QUIT. Blocked calls return
+	// with an error, so it can be used from another goroutine to abort a transfer.
+	Close() error
 }
@@ -0,0 +1,86 @@
+package ftputil
+
+import (
+	"bufio"
+	"io"
+)
+
+// Converts the CRLF line endings of the network representation of ASCII
+// data into LF.
+type fromNetworkReader struct {
+	reader *bufio.Reader
+}
+
+// NewFromNetworkReader returns a reader converting the CRLF line endings of
+// the data read from the data connection of a TYPE A transfer into LF.
+func NewFromNetworkReader(reader io.Reader) io.Reader {
+	return &fromNetworkReader{reader: bufio.NewReader(reader)}
+}
+
+// Read implements the io.Reader interface. It returns the converted data
+// available without blocking, but at least one byte.
+func (r *fromNetworkReader) Read(buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		if n > 0 && r.reader.Buffered() == 0 {
+			break
+		}
+		b, err := r.reader.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if b == '\r' {
+			if next, err := r.reader.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+		}
+		buf[n] = b
+		n++
+	}
+	return n, nil
+}
+
+// Converts LF line endings into the CRLF of the network representation of
+// ASCII data.
+type toNetworkReader struct {
+	reader    *bufio.Reader
+	last      byte
+	pendingLF bool // a CR was inserted, the LF is not yet returned
+}
+
+// NewToNetworkReader returns a reader converting the LF line endings of the
+// data into CRLF for sending it on the data connection of a TYPE A transfer.
+// Line endings already in CRLF are kept.
+func NewToNetworkReader(reader io.Reader) io.Reader {
+	return &toNetworkReader{reader: bufio.NewReader(reader)}
+}
+
+// Read implements the io.Reader interface. It returns the converted data
+// available without blocking, but at least one byte.
+func (r *toNetworkReader) Read(buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		if r.pendingLF {
+			buf[n] = '\n'
+			n++
+			r.pendingLF = false
+			continue
+		}
+		if n > 0 && r.reader.Buffered() == 0 {
+			break
+		}
+		b, err := r.reader.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if b == '\n' && r.last != '\r' {
+			buf[n] = '\r'
+			r.pendingLF = true
+		} else {
+			buf[n] = b
+		}
+		r.last = b
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,45 @@
+package ftputil
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFromNetworkReader(t *testing.T) {
+	tests := map[string]string{
+		"line 1\r\nline 2\r\n": "line 1\nline 2\n",
+		"single \r stays":      "single \r stays",
+		"end\r":                "end\r",
+		"\r\n\r\n":             "\n\n",
+	}
+	for input, expected := range tests {
+		// Byte by byte to test line endings split between reads
+		data, err := ioutil.ReadAll(NewFromNetworkReader(iotest.OneByteReader(strings.NewReader(input))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("converted %q to %q, want %q", input, data, expected)
+		}
+	}
+}
+
+func TestToNetworkReader(t *testing.T) {
+	tests := map[string]string{
+		"line 1\nline 2\n": "line 1\r\nline 2\r\n",
+		"kept\r\n":         "kept\r\n",
+		"\n\n":             "\r\n\r\n",
+		"no line ending":   "no line ending",
+	}
+	for input, expected := range tests {
+		data, err := ioutil.ReadAll(iotest.OneByteReader(NewToNetworkReader(strings.NewReader(input))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("converted %q to %q, want %q", input, data, expected)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Contains the conversion of paths and listings for servers, which do not
+// use UTF-8.
+
+package ftputil
+
+import (
+	"errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+	"io"
+	"strings"
+)
+
+// LookupEncoding returns the character encoding with the name, e.g.
+// "iso-8859-1", "cp1251" or "shift-jis". The IANA names and the labels of the
+// WHATWG encoding standard are supported. For "" and "utf-8" it returns nil,
+// as UTF-8 is the default of the connections.
+func LookupEncoding(name string) (encoding.Encoding, error) {
+	if name == "" || strings.EqualFold(name, "utf-8") || strings.EqualFold(name, "utf8") {
+		return nil, nil
+	}
+	if enc, err := ianaindex.IANA.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+	if enc, err := htmlindex.Get(name); err == nil {
+		return enc, nil
+	}
+	return nil, errors.New("Unknown encoding " + name + ".")
+}
+
+// EncodeString converts the text to the encoding, nil for UTF-8. It fails for
+// characters not available in the encoding.
+func EncodeString(enc encoding.Encoding, text string) (string, error) {
+	if enc == nil {
+		return text, nil
+	}
+	encoded, err := enc.NewEncoder().String(text)
+	if err != nil {
+		return "", errors.New("The text " + text + " contains characters not available in the encoding of the server.")
+	}
+	return encoded, nil
+}
+
+// DecodeString converts the text from the encoding, nil for UTF-8.
+func DecodeString(enc encoding.Encoding, text string) string {
+	if enc == nil {
+		return text
+	}
+	decoded, err := enc.NewDecoder().String(text)
+	if err != nil {
+		return text
+	}
+	return decoded
+}
+
+// NewDecodingReader returns a reader converting the data of the reader from
+// the encoding. For UTF-8 (nil) it returns nil, so the reader is used
+// unchanged.
+func NewDecodingReader(enc encoding.Encoding, reader io.Reader) io.Reader {
+	if enc == nil {
+		return nil
+	}
+	return transform.NewReader(reader, enc.NewDecoder())
+}
@@ -0,0 +1,44 @@
+package ftputil
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLookupEncoding(t *testing.T) {
+	for _, name := range []string{"iso-8859-1", "cp1251", "shift-jis", "windows-1251"} {
+		if enc, err := LookupEncoding(name); err != nil || enc == nil {
+			t.Errorf("LookupEncoding(%s) = %v, %v", name, enc, err)
+		}
+	}
+	if enc, err := LookupEncoding("UTF-8"); err != nil || enc != nil {
+		t.Errorf("LookupEncoding(UTF-8) = %v, %v, want nil", enc, err)
+	}
+	if _, err := LookupEncoding("klingon"); err == nil {
+		t.Error("LookupEncoding of an unknown name succeeded")
+	}
+}
+
+func TestEncodeString(t *testing.T) {
+	latin1, _ := LookupEncoding("iso-8859-1")
+	encoded, err := EncodeString(latin1, "CWD Bücher")
+	if err != nil || encoded != "CWD B\xfccher" {
+		t.Errorf("EncodeString = %q, %v", encoded, err)
+	}
+	if decoded := DecodeString(latin1, encoded); decoded != "CWD Bücher" {
+		t.Errorf("DecodeString = %q", decoded)
+	}
+	if _, err = EncodeString(latin1, "CWD 本"); err == nil {
+		t.Error("EncodeString of a character missing in the encoding succeeded")
+	}
+
+	reader := NewDecodingReader(latin1, strings.NewReader("M\xfcller.txt\r\n"))
+	data, err := ioutil.ReadAll(reader)
+	if err != nil || string(data) != "Müller.txt\r\n" {
+		t.Errorf("decoded %q, %v", data, err)
+	}
+	if NewDecodingReader(nil, strings.NewReader("")) != nil {
+		t.Error("NewDecodingReader for UTF-8 is not nil")
+	}
+}
@@ -0,0 +1,278 @@
+// Package ftputil contains implementation details shared by the FTPS- and the
+// QUIC-FTP-client. It is internal and may change without notice, the public
+// API is in the packages ftps_qftp_client, ftps and ftpq.
+package ftputil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Code of the reply of a server closing the control connection (RFC 959)
+const statusServiceClosing = 421
+
+// ParseFeatures parses the message of a reply to the FEAT command and adds the
+// features with their description to the map.
+// FEAT is described in RFC 2389
+func ParseFeatures(message string, features map[string]string) {
+	lines := strings.Split(message, "\n")
+	for _, line := range lines {
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+		featureElements := strings.SplitN(line, " ", 2)
+
+		command := featureElements[0]
+
+		var commandDesc string
+		if len(featureElements) == 2 {
+			commandDesc = featureElements[1]
+		}
+
+		// Servers announce the commands of SITE in a line each, e.g. " SITE CHMOD"
+		if previous := features[command]; previous != "" && commandDesc != "" {
+			commandDesc = previous + ";" + commandDesc
+		}
+		features[command] = commandDesc
+	}
+}
+
+// ParseCurrentDir extracts the path from the message of a reply to the PWD command.
+func ParseCurrentDir(message string) (string, error) {
+	start := strings.Index(message, "\"")
+	end := strings.LastIndex(message, "\"")
+
+	if start == -1 || end == -1 {
+		return "", errors.New("Unsuported PWD response format")
+	}
+
+	return message[start+1 : end], nil
+}
+
+// TLSConfig generates from the specified certifiate file a tls configuration
+func TLSConfig(certfile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	tlsConfig.InsecureSkipVerify = true
+	certficate, err := ioutil.ReadFile(certfile)
+	if err != nil {
+		return tlsConfig, err
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM([]byte(certficate)) {
+		return tlsConfig, errors.New("ERROR: Fehler beim parsen des Serverzertifikats.\n")
+	}
+	tlsConfig.RootCAs = rootCAs
+	return tlsConfig, nil
+}
+
+// ChecksumCommand returns the command to request the checksum of a file
+// supported by the server according to its features: HASH
+// (draft-bryan-ftpext-hash) or otherwise the non-standard XMD5.
+func ChecksumCommand(features map[string]string) string {
+	if _, available := LookupFeature(features, "HASH"); available {
+		return "HASH"
+	}
+	return "XMD5"
+}
+
+// ParseChecksum parses the message of a reply to the checksum command and
+// returns the algorithm and the hexadecimal checksum.
+func ParseChecksum(command string, message string) (string, string, error) {
+	fields := strings.Fields(message)
+	if command == "HASH" {
+		// <algorithm> <start>-<end> <checksum> <path>
+		if len(fields) < 3 {
+			return "", "", errors.New("Unsupported HASH response format")
+		}
+		return fields[0], strings.ToLower(fields[2]), nil
+	}
+
+	// The servers reply with the checksum and optionally the path in any order
+	for _, field := range fields {
+		if len(field) == 32 && isHex(field) {
+			return "MD5", strings.ToLower(field), nil
+		}
+	}
+	return "", "", errors.New("Unsupported XMD5 response format")
+}
+
+// Checks whether the string consists of hexadecimal digits only.
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseModTime parses the message of a reply to the MDTM command, a time in
+// UTC with optional fractions of a second, e.g. "20150813175250.123".
+// MDTM is described in RFC 3659
+func ParseModTime(message string) (time.Time, error) {
+	message = strings.TrimSpace(message)
+	if i := strings.Index(message, "."); i >= 0 {
+		message = message[:i]
+	}
+	t, err := time.Parse("20060102150405", message)
+	if err != nil {
+		return time.Time{}, errors.New("Unsupported MDTM response format")
+	}
+	return t, nil
+}
+
+// LookupFeature returns the description of the feature and whether the server
+// supports it. Feature names are not case sensitive (RFC 2389).
+func LookupFeature(features map[string]string, name string) (string, bool) {
+	if description, available := features[name]; available {
+		return description, true
+	}
+	for feature, description := range features {
+		if strings.EqualFold(feature, name) {
+			return description, true
+		}
+	}
+	return "", false
+}
+
+// ReadReply reads a complete reply from the control connection. Besides the
+// code and the message, as returned by textproto.Reader.ReadResponse, it
+// returns the lines of the reply as sent by the server. A multiline reply
+// starts with "<code>-" and ends with a line starting with "<code> " (RFC 959).
+func ReadReply(reader *textproto.Reader) (int, string, []string, error) {
+	line, err := reader.ReadLine()
+	if err != nil {
+		return 0, "", nil, err
+	}
+	code, continued, message, err := parseReplyLine(line)
+	if err != nil {
+		return 0, "", []string{line}, err
+	}
+	lines := []string{line}
+	for continued {
+		line, err = reader.ReadLine()
+		if err != nil {
+			return code, message, lines, err
+		}
+		lines = append(lines, line)
+		lineCode, lineContinued, lineMessage, err := parseReplyLine(line)
+		if err != nil || lineCode != code {
+			// Lines inside of a multiline reply may contain any text
+			message += "\n" + line
+			continue
+		}
+		continued = lineContinued
+		message += "\n" + lineMessage
+	}
+	return code, message, lines, nil
+}
+
+// Parses a line of a reply into the code, whether further lines follow and the text.
+func parseReplyLine(line string) (int, bool, string, error) {
+	if len(line) < 4 || (line[3] != ' ' && line[3] != '-') {
+		if len(line) == 3 {
+			line += " "
+		} else {
+			return 0, false, "", textproto.ProtocolError("short response: " + line)
+		}
+	}
+	code, err := strconv.Atoi(line[0:3])
+	if err != nil || code < 100 {
+		return 0, false, "", textproto.ProtocolError("invalid response code: " + line)
+	}
+	return code, line[3] == '-', line[4:], nil
+}
+
+// HasExpectedCode reports whether the code of a reply is the expected one
+// like textproto.Reader.ReadResponse: an expected code of one digit is
+// compared with the first digit, of two digits with the first two digits. Any
+// code is expected, if expected <= 0.
+func HasExpectedCode(code int, expected int) bool {
+	switch {
+	case expected <= 0:
+		return true
+	case expected < 10:
+		return code/100 == expected
+	case expected < 100:
+		return code/10 == expected
+	}
+	return code == expected
+}
+
+// ExpectsFinalReply reports whether the expected code, as passed to
+// HasExpectedCode, is not the one of a preliminary reply (1xx). Preliminary
+// replies before the final one, e.g. progress messages of some servers, can
+// then be skipped.
+func ExpectsFinalReply(expected int) bool {
+	switch {
+	case expected <= 0:
+		return false
+	case expected < 10:
+		return expected != 1
+	case expected < 100:
+		return expected/10 != 1
+	}
+	return expected/100 != 1
+}
+
+// IsServiceClosing reports whether the reply code or the error of a command
+// shows, that the server closed or is closing the control connection: a reply
+// with 421, the end of the connection or a reset stream. A timeout while
+// reading a reply makes the connection unusable, too, as the rest of the
+// reply may still arrive.
+func IsServiceClosing(code int, err error) bool {
+	if code == statusServiceClosing {
+		return true
+	}
+	if err == nil {
+		return false
+	}
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return false
+	}
+	// Streams reset by the peer (e.g. QUIC stream errors)
+	var canceledErr interface{ Canceled() bool }
+	if errors.As(err, &canceledErr) && canceledErr.Canceled() {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// Replacement of credentials in logs and errors
+const redacted = "****"
+
+// RedactCommand masks the argument of a command containing credentials
+// (PASS and ACCT), e.g. for logging.
+func RedactCommand(line string) string {
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) == 2 && (strings.EqualFold(fields[0], "PASS") || strings.EqualFold(fields[0], "ACCT")) {
+		return fields[0] + " " + redacted
+	}
+	return line
+}
+
+// RedactSecret masks all occurrences of the secret in the text, e.g. a
+// password echoed by the server in an error reply.
+func RedactSecret(text string, secret string) string {
+	if secret == "" {
+		return text
+	}
+	return strings.Replace(text, secret, redacted, -1)
+}
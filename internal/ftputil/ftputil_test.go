@@ -0,0 +1,127 @@
+package ftputil
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseFeatures(t *testing.T) {
+	message := "Extensions supported:\n EPSV\n HASH SHA-1;SHA-256*;MD5\n mlst size*;modify*;type*;\nEnd"
+	features := make(map[string]string)
+	ParseFeatures(message, features)
+
+	tests := []struct {
+		name        string
+		available   bool
+		description string
+	}{
+		{"EPSV", true, ""},
+		{"hash", true, "SHA-1;SHA-256*;MD5"},
+		{"MLST", true, "size*;modify*;type*;"},
+		{"MLSD", false, ""},
+	}
+	for _, test := range tests {
+		description, available := LookupFeature(features, test.name)
+		if available != test.available || description != test.description {
+			t.Errorf("LookupFeature(%s) = %q, %v, want %q, %v", test.name, description, available, test.description, test.available)
+		}
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	reply := "211-Status of server\r\n Connected to 127.0.0.1\r\n211-Logged in as anonymous\r\n211 End of status\r\n200 next\r\n"
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(reply)))
+
+	code, message, lines, err := ReadReply(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 211 {
+		t.Errorf("code = %d, want 211", code)
+	}
+	if expected := "Status of server\n Connected to 127.0.0.1\nLogged in as anonymous\nEnd of status"; message != expected {
+		t.Errorf("message = %q, want %q", message, expected)
+	}
+	if len(lines) != 4 || lines[1] != " Connected to 127.0.0.1" || lines[3] != "211 End of status" {
+		t.Errorf("lines = %q", lines)
+	}
+
+	// The following reply is not consumed
+	code, _, _, err = ReadReply(reader)
+	if err != nil || code != 200 {
+		t.Errorf("next reply = %d, %v, want 200", code, err)
+	}
+}
+
+func TestHasExpectedCode(t *testing.T) {
+	tests := []struct {
+		code, expected int
+		result, final  bool
+	}{
+		{226, 226, true, true},
+		{250, 226, false, true},
+		{226, 22, true, true},
+		{226, 2, true, true},
+		{331, 2, false, true},
+		{150, 1, true, false},
+		{150, 150, true, false},
+		{150, 15, true, false},
+		{550, -1, true, false},
+	}
+	for _, test := range tests {
+		if result := HasExpectedCode(test.code, test.expected); result != test.result {
+			t.Errorf("HasExpectedCode(%d, %d) = %v", test.code, test.expected, result)
+		}
+		if final := ExpectsFinalReply(test.expected); final != test.final {
+			t.Errorf("ExpectsFinalReply(%d) = %v", test.expected, final)
+		}
+	}
+}
+
+func TestIsServiceClosing(t *testing.T) {
+	tests := []struct {
+		code    int
+		err     error
+		closing bool
+	}{
+		{421, &textproto.Error{Code: 421, Msg: "Timeout."}, true},
+		{550, &textproto.Error{Code: 550, Msg: "No such file."}, false},
+		{0, io.EOF, true},
+		{0, os.ErrDeadlineExceeded, true},
+		{0, textproto.ProtocolError("short response: x"), false},
+		{0, errors.New("other"), false},
+		{200, nil, false},
+	}
+	for _, test := range tests {
+		if closing := IsServiceClosing(test.code, test.err); closing != test.closing {
+			t.Errorf("IsServiceClosing(%d, %v) = %v, want %v", test.code, test.err, closing, test.closing)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	commands := map[string]string{
+		"PASS secret":   "PASS ****",
+		"pass secret":   "pass ****",
+		"ACCT billing":  "ACCT ****",
+		"USER john":     "USER john",
+		"PASSIVE x":     "PASSIVE x",
+		"RETR pass.txt": "RETR pass.txt",
+	}
+	for command, expected := range commands {
+		if redacted := RedactCommand(command); redacted != expected {
+			t.Errorf("RedactCommand(%q) = %q, want %q", command, redacted, expected)
+		}
+	}
+	if redacted := RedactSecret("500 'PASS secret' not understood", "secret"); redacted != "500 'PASS ****' not understood" {
+		t.Errorf("RedactSecret returned %q", redacted)
+	}
+	if redacted := RedactSecret("230 Logged in", ""); redacted != "230 Logged in" {
+		t.Errorf("RedactSecret with empty secret returned %q", redacted)
+	}
+}
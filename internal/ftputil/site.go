@@ -0,0 +1,85 @@
+// Contains the helpers for the SITE commands, which are not standardized
+// but supported by many servers.
+
+package ftputil
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SiteCommandAvailable reports whether the server may support the command of
+// SITE. Most servers do not announce SITE in their features, then the command
+// is just tried. Only if SITE is announced with its commands and the command
+// is missing, it is known to be unsupported.
+func SiteCommandAvailable(features map[string]string, command string) bool {
+	description, available := LookupFeature(features, "SITE")
+	if !available || description == "" {
+		return true
+	}
+	announced := strings.FieldsFunc(description, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	})
+	for _, name := range announced {
+		if strings.EqualFold(name, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatFileMode returns the permissions of the mode as octal number for
+// SITE CHMOD, e.g. "755". The setuid, setgid and sticky bits are included
+// as in chmod, e.g. "4755".
+func FormatFileMode(mode os.FileMode) string {
+	bits := uint64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	formatted := strconv.FormatUint(bits, 8)
+	for len(formatted) < 3 {
+		formatted = "0" + formatted
+	}
+	return formatted
+}
+
+// ParseQuota returns the bytes left to upload from the message of a reply to
+// SITE QUOTA in the format of ProFTPD, which contains a line like
+// "Uploaded bytes:  1024.00/1048576.00" with the used bytes and the limit.
+func ParseQuota(message string) (int64, error) {
+	for _, line := range strings.Split(message, "\n") {
+		i := strings.Index(line, "Uploaded bytes:")
+		if i < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[i+len("Uploaded bytes:"):])
+		if strings.EqualFold(value, "unlimited") {
+			return 0, errors.New("No quota for uploads.")
+		}
+		parts := strings.SplitN(value, "/", 2)
+		if len(parts) != 2 {
+			break
+		}
+		used, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err != nil {
+			break
+		}
+		limit, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			break
+		}
+		if used >= limit {
+			return 0, nil
+		}
+		return int64(limit - used), nil
+	}
+	return 0, errors.New("Unsupported SITE QUOTA response format")
+}
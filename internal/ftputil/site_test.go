@@ -0,0 +1,52 @@
+package ftputil
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSiteCommandAvailable(t *testing.T) {
+	features := make(map[string]string)
+	ParseFeatures("Extensions supported:\n SITE CHMOD\n SITE UTIME\nEnd", features)
+	if !SiteCommandAvailable(features, "chmod") || !SiteCommandAvailable(features, "UTIME") {
+		t.Errorf("announced SITE commands %q not available", features["SITE"])
+	}
+	if SiteCommandAvailable(features, "QUOTA") {
+		t.Error("SITE QUOTA available although not announced")
+	}
+	if !SiteCommandAvailable(map[string]string{}, "CHMOD") {
+		t.Error("SITE CHMOD not available without announced SITE commands")
+	}
+}
+
+func TestFormatFileMode(t *testing.T) {
+	tests := map[os.FileMode]string{
+		0755:                 "755",
+		0640:                 "640",
+		0007:                 "007",
+		os.ModeSetuid | 0755: "4755",
+		os.ModeSticky | 0777: "1777",
+		os.ModeDir | 0700:    "700",
+	}
+	for mode, expected := range tests {
+		if formatted := FormatFileMode(mode); formatted != expected {
+			t.Errorf("FormatFileMode(%v) = %s, want %s", mode, formatted, expected)
+		}
+	}
+}
+
+func TestParseQuota(t *testing.T) {
+	message := "The current quota for this session are [current/limit]:\nName: ftp\nQuota Type: User\n" +
+		"  Uploaded bytes:         1024.00/1048576.00\n  Downloaded bytes:       unlimited\n" +
+		"Please contact root if these entries are inaccurate"
+	available, err := ParseQuota(message)
+	if err != nil || available != 1048576-1024 {
+		t.Errorf("ParseQuota = %d, %v, want %d", available, err, 1048576-1024)
+	}
+	if _, err = ParseQuota("Uploaded bytes: unlimited"); err == nil {
+		t.Error("ParseQuota without limit succeeded")
+	}
+	if _, err = ParseQuota("Quota exceeded"); err == nil {
+		t.Error("ParseQuota of an unknown format succeeded")
+	}
+}
@@ -0,0 +1,186 @@
+// Contains the commands of the control connections, which transfer no data.
+
+package testserver
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Control is the state of a control connection or stream of a test server.
+type Control struct {
+	fs         *FileSystem
+	user       string // accepted user
+	password   string // password of the accepted user
+	sentUser   string // user sent with USER
+	loggedIn   bool
+	dir        string // current directory
+	offset     int64  // offset of the next transfer set by REST
+	renameFrom string // path sent with RNFR
+}
+
+// NewControl creates the state of a new control connection, which accepts
+// the user with the password.
+func NewControl(fs *FileSystem, user, password string) *Control {
+	return &Control{fs: fs, user: user, password: password, dir: "/"}
+}
+
+// ParseCommand splits a line of the control connection into the command in
+// upper case and its argument.
+func ParseCommand(line string) (string, string) {
+	command, argument := line, ""
+	if i := strings.Index(line, " "); i >= 0 {
+		command, argument = line[:i], line[i+1:]
+	}
+	return strings.ToUpper(command), argument
+}
+
+// Handle performs the command, if it transfers no data, and returns the lines
+// of its reply. Commands requiring a login are refused before. For the other
+// commands, e.g. the transfers, it returns false, they are performed by the
+// transport with Resolve and TakeOffset.
+func (c *Control) Handle(command, argument string) ([]string, bool) {
+	switch command {
+	case "USER":
+		c.sentUser = argument
+		c.loggedIn = false
+		return []string{"331 Please specify the password."}, true
+	case "PASS":
+		if c.sentUser != c.user || argument != c.password {
+			return []string{"530 Login incorrect."}, true
+		}
+		c.loggedIn = true
+		c.dir = "/"
+		return []string{"230 Login successful."}, true
+	case "QUIT":
+		return []string{"221 Goodbye."}, true
+	case "REIN":
+		c.Reset()
+		return []string{"220 Service ready for new user."}, true
+	case "NOOP":
+		return []string{"200 NOOP ok."}, true
+	}
+	if !c.loggedIn {
+		return []string{"530 Please login with USER and PASS."}, true
+	}
+
+	replies, handled := c.handleFileCommand(command, argument)
+	if handled && command != "REST" {
+		// The offset applies to the next command only
+		c.offset = 0
+	}
+	return replies, handled
+}
+
+// Performs the commands of a logged in user, which transfer no data.
+func (c *Control) handleFileCommand(command, argument string) ([]string, bool) {
+	target := c.Resolve(argument)
+	switch command {
+	case "TYPE":
+		return []string{"200 Switching to " + argument + " mode."}, true
+	case "PWD":
+		return []string{"257 \"" + c.dir + "\" is the current directory."}, true
+	case "CWD":
+		if !c.fs.IsDir(target) {
+			return []string{"550 Failed to change directory."}, true
+		}
+		c.dir = target
+		return []string{"250 Directory successfully changed."}, true
+	case "CDUP":
+		c.dir = path.Dir(c.dir)
+		return []string{"250 Directory successfully changed."}, true
+	case "REST":
+		offset, err := strconv.ParseInt(argument, 10, 64)
+		if err != nil || offset < 0 {
+			return []string{"501 Invalid offset."}, true
+		}
+		c.offset = offset
+		return []string{"350 Restart position accepted (" + argument + ")."}, true
+	case "RNFR":
+		if !c.fs.Exists(target) {
+			return []string{"550 RNFR command failed."}, true
+		}
+		c.renameFrom = target
+		return []string{"350 Ready for RNTO."}, true
+	case "RNTO":
+		from := c.renameFrom
+		c.renameFrom = ""
+		if from == "" {
+			return []string{"503 RNFR required first."}, true
+		}
+		if !c.fs.Rename(from, target) {
+			return []string{"550 Rename failed."}, true
+		}
+		return []string{"250 Rename successful."}, true
+	case "SIZE":
+		data, available := c.fs.File(target)
+		if !available {
+			return []string{"550 Could not get file size."}, true
+		}
+		return []string{"213 " + strconv.Itoa(len(data))}, true
+	case "MKD":
+		if !c.fs.MakeDir(target) {
+			return []string{"550 Create directory operation failed."}, true
+		}
+		return []string{"257 \"" + target + "\" created"}, true
+	case "RMD":
+		if !c.fs.RemoveDir(target) {
+			return []string{"550 Remove directory operation failed."}, true
+		}
+		return []string{"250 Remove directory operation successful."}, true
+	case "DELE":
+		if !c.fs.Delete(target) {
+			return []string{"550 Delete operation failed."}, true
+		}
+		return []string{"250 Delete operation successful."}, true
+	}
+	return nil, false
+}
+
+// Reset logs out and returns to the state of a new control connection.
+func (c *Control) Reset() {
+	*c = Control{fs: c.fs, user: c.user, password: c.password, dir: "/"}
+}
+
+// Resolve resolves the path against the current directory.
+func (c *Control) Resolve(p string) string {
+	if p == "" {
+		return c.dir
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = c.dir + "/" + p
+	}
+	return path.Clean(p)
+}
+
+// TakeOffset returns the offset set by REST for the transfer and resets it.
+func (c *Control) TakeOffset() int64 {
+	offset := c.offset
+	c.offset = 0
+	return offset
+}
+
+// ListPath returns the path of the argument of LIST and NLST. Options like
+// -a and -R are ignored.
+func (c *Control) ListPath(argument string) string {
+	for strings.HasPrefix(argument, "-") {
+		argument = strings.TrimLeft(strings.TrimLeft(argument, "-abcdfhilnrRtu"), " ")
+	}
+	return c.Resolve(argument)
+}
+
+// Listing returns the data of LIST and NLST and whether the path exists.
+func (c *Control) Listing(command, argument string) (string, bool) {
+	return c.fs.Listing(c.ListPath(argument), command == "NLST")
+}
+
+// StorePath checks the path of the file to store and returns the reply,
+// if it can't be stored.
+func (c *Control) StorePath(p string) (string, []string) {
+	filePath := c.Resolve(p)
+	if !c.fs.IsDir(path.Dir(filePath)) || c.fs.IsDir(filePath) {
+		return filePath, []string{"553 Could not create file."}
+	}
+	return filePath, nil
+}
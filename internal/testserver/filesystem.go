@@ -0,0 +1,227 @@
+// Package testserver contains the parts of the in-memory test servers of the
+// packages ftpqtest and ftptest, which are independent of the transport: the
+// file system and the commands without data transfer.
+package testserver
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A file of the file system
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// FileSystem is the in-memory file system of a test server. It contains just
+// the root directory "/" initially. All paths are absolute. Its methods can
+// be called from several goroutines.
+type FileSystem struct {
+	mutex sync.Mutex
+	files map[string]*memoryFile
+	dirs  map[string]bool
+}
+
+// NewFileSystem creates a file system with the root directory.
+func NewFileSystem() *FileSystem {
+	return &FileSystem{files: make(map[string]*memoryFile), dirs: map[string]bool{"/": true}}
+}
+
+// AddFile creates or replaces the file with the data. Missing parent
+// directories are created.
+func (fs *FileSystem) AddFile(filePath string, data []byte) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	filePath = path.Clean(filePath)
+	fs.addParents(filePath)
+	fs.files[filePath] = &memoryFile{data: append([]byte(nil), data...), modTime: time.Now()}
+}
+
+// AddDir creates the directory and its missing parents.
+func (fs *FileSystem) AddDir(dirPath string) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	dirPath = path.Clean(dirPath)
+	fs.addParents(dirPath)
+	fs.dirs[dirPath] = true
+}
+
+// File returns the content of the file and whether it exists.
+func (fs *FileSystem) File(filePath string) ([]byte, bool) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	file, available := fs.files[path.Clean(filePath)]
+	if !available {
+		return nil, false
+	}
+	return append([]byte(nil), file.data...), true
+}
+
+// IsDir reports whether the directory exists.
+func (fs *FileSystem) IsDir(dirPath string) bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.dirs[path.Clean(dirPath)]
+}
+
+// Exists reports whether a file or a directory exists at the path.
+func (fs *FileSystem) Exists(p string) bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	_, available := fs.files[p]
+	return available || fs.dirs[p]
+}
+
+// Store writes the data to the file from the offset on, the rest of an
+// existing file is cut off. It fails, if the parent directory doesn't exist
+// or a directory is at the path.
+func (fs *FileSystem) Store(filePath string, offset int64, data []byte) bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if !fs.dirs[path.Dir(filePath)] || fs.dirs[filePath] {
+		return false
+	}
+	var content []byte
+	if file, available := fs.files[filePath]; available && offset > 0 {
+		if offset > int64(len(file.data)) {
+			offset = int64(len(file.data))
+		}
+		content = append(content, file.data[:offset]...)
+	}
+	fs.files[filePath] = &memoryFile{data: append(content, data...), modTime: time.Now()}
+	return true
+}
+
+// Listing returns the listing of the directory or of the file in the format
+// of "ls -l", with names just the names of the entries. The lines end with
+// "\r\n". It fails, if nothing exists at the path.
+func (fs *FileSystem) Listing(p string, names bool) (string, bool) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	var lines []string
+	if _, available := fs.files[p]; available {
+		if names {
+			lines = append(lines, path.Base(p))
+		} else {
+			lines = append(lines, fs.listLine(p))
+		}
+	} else if fs.dirs[p] {
+		for _, name := range fs.children(p) {
+			if names {
+				lines = append(lines, name)
+			} else {
+				lines = append(lines, fs.listLine(path.Join(p, name)))
+			}
+		}
+	} else {
+		return "", false
+	}
+	if len(lines) == 0 {
+		return "", true
+	}
+	return strings.Join(lines, "\r\n") + "\r\n", true
+}
+
+// Rename renames the file or the directory with its content.
+func (fs *FileSystem) Rename(from, to string) bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if !fs.dirs[path.Dir(to)] || fs.dirs[to] || fs.files[to] != nil || from == "/" {
+		return false
+	}
+	if file, available := fs.files[from]; available {
+		delete(fs.files, from)
+		fs.files[to] = file
+		return true
+	}
+	if !fs.dirs[from] || strings.HasPrefix(to+"/", from+"/") {
+		// Missing or into itself
+		return false
+	}
+	prefix := from + "/"
+	for p, file := range fs.files {
+		if strings.HasPrefix(p, prefix) {
+			delete(fs.files, p)
+			fs.files[to+"/"+strings.TrimPrefix(p, prefix)] = file
+		}
+	}
+	for p := range fs.dirs {
+		if p == from || strings.HasPrefix(p, prefix) {
+			delete(fs.dirs, p)
+			fs.dirs[to+strings.TrimPrefix(p, from)] = true
+		}
+	}
+	return true
+}
+
+// MakeDir creates the directory, its parent must exist.
+func (fs *FileSystem) MakeDir(p string) bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if !fs.dirs[path.Dir(p)] || fs.dirs[p] || fs.files[p] != nil {
+		return false
+	}
+	fs.dirs[p] = true
+	return true
+}
+
+// RemoveDir removes the directory, if it is empty.
+func (fs *FileSystem) RemoveDir(p string) bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if p == "/" || !fs.dirs[p] || len(fs.children(p)) > 0 {
+		return false
+	}
+	delete(fs.dirs, p)
+	return true
+}
+
+// Delete deletes the file.
+func (fs *FileSystem) Delete(p string) bool {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if _, available := fs.files[p]; !available {
+		return false
+	}
+	delete(fs.files, p)
+	return true
+}
+
+// Creates the missing parents of the path. The mutex must be held.
+func (fs *FileSystem) addParents(p string) {
+	for dir := path.Dir(p); !fs.dirs[dir]; dir = path.Dir(dir) {
+		fs.dirs[dir] = true
+	}
+}
+
+// Returns the names of the entries of the directory sorted. The mutex must be held.
+func (fs *FileSystem) children(dir string) []string {
+	var names []string
+	for p := range fs.files {
+		if path.Dir(p) == dir {
+			names = append(names, path.Base(p))
+		}
+	}
+	for p := range fs.dirs {
+		if p != "/" && path.Dir(p) == dir {
+			names = append(names, path.Base(p))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the line of the entry in the format of "ls -l". The mutex must be held.
+func (fs *FileSystem) listLine(p string) string {
+	name := path.Base(p)
+	if file, available := fs.files[p]; available {
+		return "-rw-r--r-- 1 ftp ftp " + strconv.Itoa(len(file.data)) + " " +
+			file.modTime.UTC().Format("Jan _2 15:04") + " " + name
+	}
+	return "drwxr-xr-x 2 ftp ftp 0 " + time.Now().UTC().Format("Jan _2 15:04") + " " + name
+}
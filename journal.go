@@ -0,0 +1,217 @@
+// Contains the journal, which allows to resume interrupted parallel transfers.
+
+package ftps_qftp_client
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// JournalInterval is the minimal interval between two writes of a journal,
+// which are caused only by transfered data. Finished tasks are always written.
+const JournalInterval = time.Second
+
+// Entry of a TransferJournal for one task
+type JournalEntry struct {
+	Direction  TransferDirction
+	LocalPath  string
+	RemotePath string
+	Offset     int64 // number of bytes transfered so far
+	Completed  bool
+	// Path at the destination chosen by the OverwritePolicy, e.g. the new
+	// name of OverwriteRename, empty if not yet chosen. A resumed task
+	// continues this file.
+	Destination string `json:",omitempty"`
+}
+
+// TransferJournal records the progress of the tasks of parallel transfers in
+// a file. A scheduler with a journal skips the tasks completed by an earlier
+// run and resumes partially transfered files with REST, so an interrupted job
+// can be started again with the same tasks. A nil journal records nothing.
+type TransferJournal struct {
+	path      string
+	mutex     sync.Mutex
+	entries   map[string]*JournalEntry
+	lastWrite time.Time
+}
+
+// OpenTransferJournal reads the journal in the file or creates an empty one,
+// if the file does not exist.
+func OpenTransferJournal(filename string) (*TransferJournal, error) {
+	journal := &TransferJournal{path: filename, entries: make(map[string]*JournalEntry)}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, errors.New("Error while reading the journal " + filename + ". " + err.Error())
+	}
+	var entries []*JournalEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.New("Error while parsing the journal " + filename + ". " + err.Error())
+	}
+	for _, entry := range entries {
+		journal.entries[journalKey(entry.Direction, entry.LocalPath, entry.RemotePath)] = entry
+	}
+	return journal, nil
+}
+
+// Returns the key of the entry of a task.
+func journalKey(direction TransferDirction, localPath string, remotePath string) string {
+	return strconv.Itoa(int(direction)) + "\x00" + localPath + "\x00" + remotePath
+}
+
+// Entry returns the entry of the task and whether the journal contains one.
+func (j *TransferJournal) Entry(task TransferTask) (JournalEntry, bool) {
+	if j == nil {
+		return JournalEntry{}, false
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	entry, available := j.entries[journalKey(task.Direction, task.LocalPath, task.RemotePath)]
+	if !available {
+		return JournalEntry{}, false
+	}
+	return *entry, true
+}
+
+// Completed reports whether the task was completed according to the journal.
+func (j *TransferJournal) Completed(task TransferTask) bool {
+	entry, available := j.Entry(task)
+	return available && entry.Completed
+}
+
+// Returns the entry of the task, a new one is added if necessary.
+// The mutex has to be held.
+func (j *TransferJournal) entry(task TransferTask) *JournalEntry {
+	key := journalKey(task.Direction, task.LocalPath, task.RemotePath)
+	entry, available := j.entries[key]
+	if !available {
+		entry = &JournalEntry{Direction: task.Direction, LocalPath: task.LocalPath, RemotePath: task.RemotePath}
+		j.entries[key] = entry
+	}
+	return entry
+}
+
+// Records the number of bytes of the task transfered so far. The journal is
+// written at most once per JournalInterval.
+func (j *TransferJournal) record(task TransferTask, offset int64) error {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.entry(task).Offset = offset
+	if time.Since(j.lastWrite) < JournalInterval {
+		return nil
+	}
+	return j.write()
+}
+
+// Records the destination chosen for the task, it is written with the next
+// offset.
+func (j *TransferJournal) setDestination(task TransferTask, destination string) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.entry(task).Destination = destination
+}
+
+// Records the task as completed and writes the journal.
+func (j *TransferJournal) complete(task TransferTask, offset int64) error {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	entry := j.entry(task)
+	entry.Offset = offset
+	entry.Completed = true
+	return j.write()
+}
+
+// Save writes the journal to its file.
+func (j *TransferJournal) Save() error {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.write()
+}
+
+// Remove deletes the file of the journal, e.g. after all tasks were completed.
+func (j *TransferJournal) Remove() error {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.entries = make(map[string]*JournalEntry)
+	err := os.Remove(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Writes the journal to a temporary file, which replaces the file of the
+// journal, so an interruption leaves a complete journal. The mutex has to be held.
+func (j *TransferJournal) write() error {
+	entries := make([]*JournalEntry, 0, len(j.entries))
+	for _, entry := range j.entries {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := j.path + ".tmp"
+	if err = ioutil.WriteFile(tempPath, data, 0644); err != nil {
+		return errors.New("Error while writing the journal " + j.path + ". " + err.Error())
+	}
+	if err = os.Rename(tempPath, j.path); err != nil {
+		return errors.New("Error while writing the journal " + j.path + ". " + err.Error())
+	}
+	j.lastWrite = time.Now()
+	return nil
+}
+
+// Returns the offset, from which the task can be resumed. The offset of the
+// journal is limited to the size of the partial file at the destination, as
+// data transfered after the last write of the journal or not yet written at
+// the destination is unknown. destination is the task with the paths the
+// task is actually transfered to, see retryTask.
+func (j *TransferJournal) resumeOffset(conn ConnectionI, task TransferTask, destination TransferTask) int64 {
+	entry, available := j.Entry(task)
+	if !available || entry.Offset <= 0 || task.Gzip {
+		// The offsets of compressed data can not be resumed
+		return 0
+	}
+	var size int64
+	switch task.Direction {
+	case Retrieve:
+		info, err := os.Stat(destination.LocalPath)
+		if err != nil {
+			return 0
+		}
+		size = info.Size()
+	case Store:
+		var exists bool
+		size, exists = remoteFileSize(conn, destination.RemotePath)
+		if !exists {
+			return 0
+		}
+	}
+	if size < entry.Offset {
+		return size
+	}
+	return entry.Offset
+}
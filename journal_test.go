@@ -0,0 +1,125 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransferJournalResume(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.files["partial.txt"] = []byte("0123456789")
+	server.files["done.txt"] = []byte("already retrieved")
+	// The local file contains data behind the offset of the journal, which was not recorded
+	if err = ioutil.WriteFile(filepath.Join(localDir, "partial.txt"), []byte("01234xx"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	journalPath := filepath.Join(localDir, "journal.json")
+	journal, err := OpenTransferJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := NewTransferTask(Retrieve, filepath.Join(localDir, "partial.txt"), "partial.txt")
+	done := NewTransferTask(Retrieve, filepath.Join(localDir, "done.txt"), "done.txt")
+	if err = journal.record(partial, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err = journal.complete(done, int64(len("already retrieved"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resume with the journal read from its file
+	journal, err = OpenTransferJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := NewTransferScheduler(2, server.opener())
+	scheduler.Journal = journal
+	results := scheduler.Run(context.Background(), []TransferTask{partial, done})
+
+	if err = results.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Bytes != 5 {
+		t.Errorf("resumed transfer has %d bytes, want 5", results[0].Bytes)
+	}
+	data, err := ioutil.ReadFile(partial.LocalPath)
+	if err != nil || string(data) != "0123456789" {
+		t.Errorf("resumed file contains %q, %v", data, err)
+	}
+	if !results[1].Skipped {
+		t.Error("completed task was not skipped")
+	}
+	if _, err = os.Stat(done.LocalPath); !os.IsNotExist(err) {
+		t.Errorf("completed task was transfered again: %v", err)
+	}
+	if !journal.Completed(partial) {
+		t.Error("resumed task not completed in the journal")
+	}
+}
+
+func TestNilTransferJournal(t *testing.T) {
+	var journal *TransferJournal
+	task := NewTransferTask(Retrieve, "local.txt", "remote.txt")
+	if journal.record(task, 5) != nil || journal.complete(task, 10) != nil || journal.Save() != nil || journal.Remove() != nil {
+		t.Error("nil journal returned an error")
+	}
+	if journal.Completed(task) {
+		t.Error("nil journal has a completed task")
+	}
+}
+
+func TestTransferJournalResumeRename(t *testing.T) {
+	localDir := t.TempDir()
+	localPath := filepath.Join(localDir, "big.txt")
+	if err := ioutil.WriteFile(localPath, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := &partialServer{memoryServer: newMemoryServer(), broken: true}
+	server.files["big.txt"] = []byte("0123456789")
+	openConn := func() (ConnectionI, error) {
+		return &partialConn{memoryConn: memoryConn{server: server.memoryServer}, server: server}, nil
+	}
+	task := NewTransferTask(Retrieve, localPath, "big.txt")
+	task.Overwrite = OverwriteRename
+
+	// The first run is interrupted after the policy chose big_1.txt
+	journalPath := filepath.Join(t.TempDir(), "journal.json")
+	journal, err := OpenTransferJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := NewTransferScheduler(1, openConn)
+	scheduler.Journal = journal
+	if results := scheduler.Run(context.Background(), []TransferTask{task}); results[0].Err == nil {
+		t.Fatal("the broken transfer succeeded")
+	}
+
+	// The restarted run continues big_1.txt and keeps big.txt
+	if journal, err = OpenTransferJournal(journalPath); err != nil {
+		t.Fatal(err)
+	}
+	scheduler = NewTransferScheduler(1, openConn)
+	scheduler.Journal = journal
+	results := scheduler.Run(context.Background(), []TransferTask{task})
+	renamed := filepath.Join(localDir, "big_1.txt")
+	if results[0].Err != nil || results[0].Destination != renamed || results[0].Bytes != 5 {
+		t.Errorf("got %v with %d bytes to %q, want 5 bytes to %q", results[0].Err, results[0].Bytes,
+			results[0].Destination, renamed)
+	}
+	if data, _ := ioutil.ReadFile(localPath); string(data) != "keep me" {
+		t.Errorf("the kept file contains %q", data)
+	}
+	if data, _ := ioutil.ReadFile(renamed); string(data) != "0123456789" {
+		t.Errorf("the renamed file contains %q", data)
+	}
+}
@@ -0,0 +1,160 @@
+// Contains the incremental parsing of directory listings.
+
+package ftps_qftp_client
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxLineLength is the maximal length of a line of a listing, if no
+// other is set with SetMaxLineLength.
+const DefaultMaxLineLength = bufio.MaxScanTokenSize
+
+// LineTooLongError is returned while reading a listing, if a line exceeds the
+// maximal length. It wraps bufio.ErrTooLong.
+type LineTooLongError struct {
+	MaxLength int
+}
+
+func (e *LineTooLongError) Error() string {
+	return "Line of listing longer than " + strconv.Itoa(e.MaxLength) + " bytes"
+}
+
+// Unwrap returns bufio.ErrTooLong.
+func (e *LineTooLongError) Unwrap() error {
+	return bufio.ErrTooLong
+}
+
+// LineScanner reads the lines of a listing like bufio.Scanner with a
+// configurable maximal length of the lines. Err returns a LineTooLongError
+// for too long lines.
+type LineScanner struct {
+	*bufio.Scanner
+	maxLength int
+}
+
+// NewLineScanner creates a LineScanner for lines up to maxLength bytes. With
+// maxLength <= 0 DefaultMaxLineLength is used.
+func NewLineScanner(reader io.Reader, maxLength int) *LineScanner {
+	if maxLength <= 0 {
+		maxLength = DefaultMaxLineLength
+	}
+	scanner := bufio.NewScanner(reader)
+	initialSize := 4096
+	if maxLength < initialSize {
+		initialSize = maxLength
+	}
+	scanner.Buffer(make([]byte, 0, initialSize), maxLength)
+	return &LineScanner{Scanner: scanner, maxLength: maxLength}
+}
+
+// Err returns the first error, which occured while reading the lines.
+func (s *LineScanner) Err() error {
+	err := s.Scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return &LineTooLongError{MaxLength: s.maxLength}
+	}
+	return err
+}
+
+// EntryScanner reads the entries of a directory listing one by one from the
+// data connection, so large directories are not held in memory. Lines in an
+// unsupported format are skipped, with SetKeepUnparsed they are collected
+// for Unparsed. The scanner has to be closed to finish the
+// transfer of the listing.
+//
+//	scanner, err := conn.ListStream(path)
+//	...
+//	defer scanner.Close()
+//	for scanner.Next() {
+//		entry := scanner.Entry()
+//		...
+//	}
+//	err = scanner.Err()
+type EntryScanner struct {
+	scanner  *LineScanner
+	reader   io.ReadCloser
+	location *time.Location
+	entry    *Entry
+	// Lines, which could not be parsed. Nil, if they are not kept.
+	unparsed     []string
+	keepUnparsed bool
+}
+
+// NewEntryScanner creates an EntryScanner for the LIST lines read from the
+// reader, whose Close finishes the transfer. Local times of the server are
+// interpreted in the location, see ParseListLineIn.
+func NewEntryScanner(reader io.ReadCloser, location *time.Location) *EntryScanner {
+	return &EntryScanner{scanner: NewLineScanner(reader, 0), reader: reader, location: location}
+}
+
+// SetMaxLineLength sets the maximal length of the lines of the listing, see
+// NewLineScanner. It has to be called before Next.
+func (s *EntryScanner) SetMaxLineLength(maxLength int) {
+	s.scanner = NewLineScanner(s.reader, maxLength)
+}
+
+// SetKeepUnparsed sets whether the lines, which can not be parsed, are kept
+// for Unparsed instead of being dropped. Empty lines and the line with the
+// total blocks of ls are dropped anyway. It has to be called before Next.
+func (s *EntryScanner) SetKeepUnparsed(keep bool) {
+	s.keepUnparsed = keep
+}
+
+// Next advances to the next entry, which is then available from Entry. It
+// returns false at the end of the listing or if an error occured.
+func (s *EntryScanner) Next() bool {
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		entry, err := ParseListLineIn(line, s.location)
+		if err == nil {
+			s.entry = entry
+			return true
+		}
+		if s.keepUnparsed && !isListNoise(line) {
+			s.unparsed = append(s.unparsed, line)
+		}
+	}
+	s.entry = nil
+	return false
+}
+
+// Entry returns the current entry.
+func (s *EntryScanner) Entry() *Entry {
+	return s.entry
+}
+
+// Unparsed returns the lines read so far, which could not be parsed, if they
+// are kept, see SetKeepUnparsed.
+func (s *EntryScanner) Unparsed() []string {
+	return s.unparsed
+}
+
+// Err returns the first error, which occured while reading the listing.
+func (s *EntryScanner) Err() error {
+	return s.scanner.Err()
+}
+
+// Close finishes the transfer of the listing, also if not all entries were read.
+func (s *EntryScanner) Close() error {
+	return s.reader.Close()
+}
+
+// Checks whether the line of a listing contains no entry, because it is empty
+// or the total blocks of ls, e.g. "total 24".
+func isListNoise(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	if len(fields) != 2 || fields[0] != "total" {
+		return false
+	}
+	_, err := strconv.ParseUint(fields[1], 10, 64)
+	return err == nil
+}
@@ -0,0 +1,86 @@
+package ftps_qftp_client
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closeRecorder records whether the listing was closed.
+type closeRecorder struct {
+	*strings.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestEntryScanner(t *testing.T) {
+	listing := "total 2\r\n" +
+		"drwxr-xr-x    3 110      1002            3 Dec 02  2009 pub\r\n" +
+		"-rwxr-xr-x    3 110      1002      1234567 Dec 02  2009 fileName\r\n"
+	reader := &closeRecorder{Reader: strings.NewReader(listing)}
+	scanner := NewEntryScanner(reader, time.UTC)
+
+	var names []string
+	for scanner.Next() {
+		names = append(names, scanner.Entry().Name)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "pub" || names[1] != "fileName" {
+		t.Errorf("scanned %v, want the entries without the unsupported line", names)
+	}
+	if scanner.Entry() != nil {
+		t.Error("Entry() after the end of the listing is not nil")
+	}
+	scanner.Close()
+	if !reader.closed {
+		t.Error("Close() did not close the listing")
+	}
+}
+
+func TestEntryScannerKeepUnparsed(t *testing.T) {
+	listing := "total 2\r\n" +
+		"drwxr-xr-x    3 110      1002            3 Dec 02  2009 pub\r\n" +
+		"some garbage\r\n" +
+		"\r\n" +
+		"-rwxr-xr-x    3 110      1002      1234567 Dec 02  2009 fileName\r\n"
+	scanner := NewEntryScanner(&closeRecorder{Reader: strings.NewReader(listing)}, time.UTC)
+	scanner.SetKeepUnparsed(true)
+
+	entries := 0
+	for scanner.Next() {
+		entries++
+	}
+	unparsed := scanner.Unparsed()
+	if entries != 2 || len(unparsed) != 1 || unparsed[0] != "some garbage" {
+		t.Errorf("scanned %d entries and the unparsed lines %q", entries, unparsed)
+	}
+}
+
+func TestLineScannerTooLong(t *testing.T) {
+	listing := "short\n" + strings.Repeat("x", 100) + "\n"
+	scanner := NewLineScanner(strings.NewReader(listing), 50)
+	for scanner.Scan() {
+	}
+	err := scanner.Err()
+	var tooLong *LineTooLongError
+	if !errors.As(err, &tooLong) || tooLong.MaxLength != 50 || !errors.Is(err, bufio.ErrTooLong) {
+		t.Errorf("Err() = %v, want a LineTooLongError", err)
+	}
+
+	scanner = NewLineScanner(strings.NewReader(listing), 200)
+	lines := 0
+	for scanner.Scan() {
+		lines++
+	}
+	if scanner.Err() != nil || lines != 2 {
+		t.Errorf("scanned %d lines, %v with a sufficient maximal length", lines, scanner.Err())
+	}
+}
@@ -0,0 +1,251 @@
+// Package metrics exports the events and the command timings of FTPS and
+// QUIC-FTP connections as Prometheus metrics. A Collector is fed by the
+// session hooks and the CommandStats of the connections:
+//
+//	collector := metrics.NewCollector("ftp")
+//	prometheus.MustRegister(collector)
+//	c.SetSessionHooks(collector.Hooks(ftps_qftp_client.SessionHooks{}))
+//	unwatch := collector.WatchCommands(c.CommandStats)
+//	defer unwatch()
+//
+// The package is optional, the other packages of the client do not depend
+// on the Prometheus client library.
+package metrics
+
+import (
+	"errors"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the label "result" of the transfers
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// Buckets of the durations of transfers in seconds, from 10 milliseconds up
+// to about 45 minutes.
+var transferBuckets = prometheus.ExponentialBuckets(0.01, 4, 10)
+
+// Collector is a prometheus.Collector with the metrics of the connections,
+// which are fed by the hooks returned by Hooks and the stats passed to
+// WatchCommands. Its methods can be called from several goroutines.
+//
+// The following metrics are exported with the namespace as prefix:
+//
+//	connections_total                   further connections opened, e.g. for parallel transfers
+//	logins_total                        successful logins
+//	transfers_total{command,result}     finished file transfers, result "success" or "failure"
+//	transfer_bytes_total{command}       bytes of the file transfers
+//	transfer_duration_seconds{command}  histogram of the durations of the file transfers
+//	errors_total{code}                  failed transfers and connections by the reply code
+//	command_duration_seconds            summary of the times till the replies to the commands
+//	command_duration_max_seconds        time of the slowest command
+//
+// The label "command" is "RETR" or "STOR". The label "code" is the code of
+// the reply the server refused a transfer with, "closing" after the server
+// closed the service and "other" for errors without a reply, e.g. of the
+// network.
+type Collector struct {
+	connections      prometheus.Counter
+	logins           prometheus.Counter
+	transfers        *prometheus.CounterVec
+	transferBytes    *prometheus.CounterVec
+	transferDuration *prometheus.HistogramVec
+	errors           *prometheus.CounterVec
+	commandDuration  *prometheus.Desc
+	commandMax       *prometheus.Desc
+
+	mutex       sync.Mutex
+	started     map[string][]time.Time // start times of the running transfers by command and path
+	watched     map[int]func() ftps_qftp_client.CommandStats
+	nextWatched int
+	finished    ftps_qftp_client.CommandStats // stats of the connections no longer watched
+}
+
+// NewCollector creates a collector, whose metrics are prefixed with the
+// namespace, e.g. "ftp". An empty namespace adds no prefix.
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		connections: prometheus.NewCounter(prometheus.CounterOpts{Namespace: namespace,
+			Name: "connections_total", Help: "Number of further connections opened to the server."}),
+		logins: prometheus.NewCounter(prometheus.CounterOpts{Namespace: namespace,
+			Name: "logins_total", Help: "Number of successful logins."}),
+		transfers: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace,
+			Name: "transfers_total", Help: "Number of finished file transfers."}, []string{"command", "result"}),
+		transferBytes: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace,
+			Name: "transfer_bytes_total", Help: "Number of bytes of the file transfers."}, []string{"command"}),
+		transferDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: namespace,
+			Name: "transfer_duration_seconds", Help: "Durations of the file transfers.", Buckets: transferBuckets},
+			[]string{"command"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace,
+			Name: "errors_total", Help: "Number of failed transfers and connections by the reply code."}, []string{"code"}),
+		commandDuration: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "command_duration_seconds"),
+			"Times between sending the commands and receiving their replies.", nil, nil),
+		commandMax: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "command_duration_max_seconds"),
+			"Time of the slowest command.", nil, nil),
+		started: make(map[string][]time.Time),
+		watched: make(map[int]func() ftps_qftp_client.CommandStats),
+	}
+}
+
+// Hooks returns the session hooks feeding the collector. They call the hooks
+// of next afterwards, so the application can react to the events as well.
+// The hooks can be set on any number of connections.
+func (c *Collector) Hooks(next ftps_qftp_client.SessionHooks) ftps_qftp_client.SessionHooks {
+	return ftps_qftp_client.SessionHooks{
+		OnConnect: func(addr string) {
+			c.connections.Inc()
+			next.Connected(addr)
+		},
+		OnLogin: func(user string) {
+			c.logins.Inc()
+			next.LoggedIn(user)
+		},
+		OnTransferStart: func(command string, path string) {
+			c.transferStarted(command, path)
+			next.TransferStarted(command, path)
+		},
+		OnTransferComplete: func(command string, path string, bytes int64, err error) {
+			c.transferCompleted(command, path, bytes, err)
+			next.TransferCompleted(command, path, bytes, err)
+		},
+		OnError: func(err error) {
+			c.errors.WithLabelValues(errorCode(err)).Inc()
+			next.Failed(err)
+		},
+	}
+}
+
+// Records the start of a transfer for its duration.
+func (c *Collector) transferStarted(command string, path string) {
+	key := command + " " + path
+	c.mutex.Lock()
+	c.started[key] = append(c.started[key], time.Now())
+	c.mutex.Unlock()
+}
+
+// Updates the metrics of a finished transfer. Transfers of the same file
+// running at the same time are assumed to finish in the order of their start.
+func (c *Collector) transferCompleted(command string, path string, bytes int64, err error) {
+	key := command + " " + path
+	c.mutex.Lock()
+	starts := c.started[key]
+	var start time.Time
+	if len(starts) > 0 {
+		start = starts[0]
+		if len(starts) == 1 {
+			delete(c.started, key)
+		} else {
+			c.started[key] = starts[1:]
+		}
+	}
+	c.mutex.Unlock()
+
+	if !start.IsZero() {
+		c.transferDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	}
+	if bytes > 0 {
+		c.transferBytes.WithLabelValues(command).Add(float64(bytes))
+	}
+	if err != nil {
+		c.transfers.WithLabelValues(command, resultFailure).Inc()
+		c.errors.WithLabelValues(errorCode(err)).Inc()
+	} else {
+		c.transfers.WithLabelValues(command, resultSuccess).Inc()
+	}
+}
+
+// Returns the value of the label "code" for the error.
+func errorCode(err error) string {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return strconv.Itoa(protoErr.Code)
+	}
+	if errors.Is(err, ftps_qftp_client.ErrServiceClosing) {
+		return "closing"
+	}
+	return "other"
+}
+
+// WatchCommands adds the timings of a connection to the command metrics,
+// e.g. the method CommandStats of a ServerConn. stats is called on each
+// collection, till the returned function is called. It must be called when
+// the connection is closed, the timings collected till then are kept.
+func (c *Collector) WatchCommands(stats func() ftps_qftp_client.CommandStats) (unwatch func()) {
+	c.mutex.Lock()
+	id := c.nextWatched
+	c.nextWatched++
+	c.watched[id] = stats
+	c.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			final := stats()
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			delete(c.watched, id)
+			c.finished = addStats(c.finished, final)
+		})
+	}
+}
+
+// Returns the sum of the timings of two connections.
+func addStats(a ftps_qftp_client.CommandStats, b ftps_qftp_client.CommandStats) ftps_qftp_client.CommandStats {
+	a.Commands += b.Commands
+	a.TotalTime += b.TotalTime
+	if b.MaxTime > a.MaxTime {
+		a.MaxTime = b.MaxTime
+	}
+	a.LastTime = b.LastTime
+	return a
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.connections.Describe(ch)
+	c.logins.Describe(ch)
+	c.transfers.Describe(ch)
+	c.transferBytes.Describe(ch)
+	c.transferDuration.Describe(ch)
+	c.errors.Describe(ch)
+	ch <- c.commandDuration
+	ch <- c.commandMax
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.connections.Collect(ch)
+	c.logins.Collect(ch)
+	c.transfers.Collect(ch)
+	c.transferBytes.Collect(ch)
+	c.transferDuration.Collect(ch)
+	c.errors.Collect(ch)
+
+	stats := c.commandStats()
+	ch <- prometheus.MustNewConstSummary(c.commandDuration, uint64(stats.Commands), stats.TotalTime.Seconds(), nil)
+	ch <- prometheus.MustNewConstMetric(c.commandMax, prometheus.GaugeValue, stats.MaxTime.Seconds())
+}
+
+// Returns the sum of the timings of all connections watched so far.
+func (c *Collector) commandStats() ftps_qftp_client.CommandStats {
+	c.mutex.Lock()
+	total := c.finished
+	watched := make([]func() ftps_qftp_client.CommandStats, 0, len(c.watched))
+	for _, stats := range c.watched {
+		watched = append(watched, stats)
+	}
+	c.mutex.Unlock()
+	// The stats are read without holding the mutex, they lock the connections
+	for _, stats := range watched {
+		total = addStats(total, stats())
+	}
+	return total
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"errors"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorHooks(t *testing.T) {
+	collector := NewCollector("ftp")
+	var forwarded []string
+	hooks := collector.Hooks(ftps_qftp_client.SessionHooks{
+		OnLogin: func(user string) {
+			forwarded = append(forwarded, user)
+		},
+	})
+
+	hooks.Connected("127.0.0.1:21")
+	hooks.LoggedIn("anonymous")
+	hooks.TransferStarted("STOR", "a.txt")
+	hooks.TransferCompleted("STOR", "a.txt", 100, nil)
+	hooks.TransferStarted("RETR", "b.txt")
+	hooks.TransferCompleted("RETR", "b.txt", 20, &textproto.Error{Code: 451, Msg: "Local error."})
+	hooks.Failed(ftps_qftp_client.ErrServiceClosing)
+	hooks.Failed(errors.New("connection reset"))
+
+	if len(forwarded) != 1 || forwarded[0] != "anonymous" {
+		t.Errorf("The hooks of next received %q", forwarded)
+	}
+	for _, test := range []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"connections", testutil.ToFloat64(collector.connections), 1},
+		{"logins", testutil.ToFloat64(collector.logins), 1},
+		{"successful STOR", testutil.ToFloat64(collector.transfers.WithLabelValues("STOR", resultSuccess)), 1},
+		{"failed RETR", testutil.ToFloat64(collector.transfers.WithLabelValues("RETR", resultFailure)), 1},
+		{"STOR bytes", testutil.ToFloat64(collector.transferBytes.WithLabelValues("STOR")), 100},
+		{"RETR bytes", testutil.ToFloat64(collector.transferBytes.WithLabelValues("RETR")), 20},
+		{"errors 451", testutil.ToFloat64(collector.errors.WithLabelValues("451")), 1},
+		{"errors closing", testutil.ToFloat64(collector.errors.WithLabelValues("closing")), 1},
+		{"errors other", testutil.ToFloat64(collector.errors.WithLabelValues("other")), 1},
+	} {
+		if test.value != test.expected {
+			t.Errorf("The metric of %s is %v, expected %v", test.name, test.value, test.expected)
+		}
+	}
+	if count := testutil.CollectAndCount(collector.transferDuration); count != 2 {
+		t.Errorf("The durations of %d commands were collected, expected 2", count)
+	}
+	if len(collector.started) != 0 {
+		t.Errorf("The start times of finished transfers are kept: %v", collector.started)
+	}
+}
+
+func TestCollectorCommands(t *testing.T) {
+	collector := NewCollector("ftp")
+	first := ftps_qftp_client.CommandStats{Commands: 2, TotalTime: 3 * time.Second, MaxTime: 2 * time.Second}
+	second := ftps_qftp_client.CommandStats{Commands: 1, TotalTime: time.Second, MaxTime: time.Second}
+	unwatchFirst := collector.WatchCommands(func() ftps_qftp_client.CommandStats { return first })
+	collector.WatchCommands(func() ftps_qftp_client.CommandStats { return second })
+
+	stats := collector.commandStats()
+	if stats.Commands != 3 || stats.TotalTime != 4*time.Second || stats.MaxTime != 2*time.Second {
+		t.Errorf("The stats of the watched connections are %+v", stats)
+	}
+
+	// The timings of connections no longer watched are kept
+	first.Commands = 5
+	unwatchFirst()
+	unwatchFirst()
+	first.Commands = 100
+	if stats = collector.commandStats(); stats.Commands != 6 {
+		t.Errorf("%d commands after unwatching, expected 6", stats.Commands)
+	}
+
+	// connections, logins and the two command metrics
+	if count := testutil.CollectAndCount(collector); count != 4 {
+		t.Errorf("%d metrics were collected, expected 4", count)
+	}
+}
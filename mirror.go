@@ -0,0 +1,341 @@
+// Contains the mirroring of directory trees, which transfers just the files
+// missing or changed at the destination.
+
+package ftps_qftp_client
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MirrorPlan contains the operations, which make the destination directory a
+// copy of the source directory. It is created by PlanMirror and can be shown
+// with Operations before it is performed.
+type MirrorPlan struct {
+	// Retrieve mirrors the remote directory into the local one, Store the
+	// local directory into the remote one
+	Direction TransferDirction
+	// Files and directories at the destination, which are missing at the
+	// source, the content of directories before them. Only filled with delete.
+	Delete []MirrorDeletion
+	// Directories missing at the destination, parents before their content
+	Dirs []string
+	// Files missing at the destination or differing in size or modified at
+	// the source after the destination
+	Tasks []TransferTask
+	// Remote paths of the tasks, whose files have the same size at the
+	// source and the destination, compared by SkipUnchanged
+	sameSize map[string]bool
+	// Mirrored directories and their trees, nil for a missing directory
+	localDir, remoteDir   string
+	localTree, remoteTree map[string]mirrorEntry
+	// Relative paths of the conflicts of ResolveConflicts, which were just
+	// reported
+	unresolved map[string]bool
+}
+
+// MirrorDeletion is a file or directory of the destination to delete.
+type MirrorDeletion struct {
+	Path  string
+	IsDir bool
+}
+
+// File or directory of a tree compared by PlanMirror
+type mirrorEntry struct {
+	isDir bool
+	size  int64
+	time  time.Time // zero if unknown
+}
+
+// PlanMirror compares the local and the remote directory tree and returns the
+// operations to mirror the source into the destination of the direction. A
+// file is transferred, if it is missing at the destination, has another size
+// or was modified at the source after the destination. Unknown modification
+// times, e.g. of servers without them in listings, are not compared. With
+// delete the files and directories at the destination, which are missing at
+// the source, are deleted. Links are neither transferred nor deleted.
+func PlanMirror(conn ConnectionI, direction TransferDirction, localDir string, remoteDir string, delete bool) (*MirrorPlan, error) {
+	localTree, err := localMirrorTree(localDir)
+	if err != nil {
+		return nil, err
+	}
+	remoteTree, err := remoteMirrorTree(conn, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	source, destination := remoteTree, localTree
+	sourceDir, destinationDir := remoteDir, localDir
+	if direction == Store {
+		source, destination = localTree, remoteTree
+		sourceDir, destinationDir = localDir, remoteDir
+	}
+	if source == nil {
+		return nil, &os.PathError{Op: "mirror", Path: sourceDir, Err: os.ErrNotExist}
+	}
+
+	plan := &MirrorPlan{Direction: direction, sameSize: make(map[string]bool), localDir: localDir, remoteDir: remoteDir,
+		localTree: localTree, remoteTree: remoteTree}
+	if destination == nil {
+		plan.Dirs = append(plan.Dirs, destinationDir)
+	}
+	// Sorted, so parents come before their content
+	for _, relativePath := range sortedMirrorPaths(destination) {
+		if relativePath == "." {
+			continue
+		}
+		entry := destination[relativePath]
+		sourceEntry, exists := source[relativePath]
+		if delete && (!exists || sourceEntry.isDir != entry.isDir) {
+			plan.Delete = append(plan.Delete, MirrorDeletion{Path: mirrorPath(direction == Retrieve, destinationDir,
+				relativePath), IsDir: entry.isDir})
+		}
+	}
+	// The content of a directory is deleted before it
+	for i, j := 0, len(plan.Delete)-1; i < j; i, j = i+1, j-1 {
+		plan.Delete[i], plan.Delete[j] = plan.Delete[j], plan.Delete[i]
+	}
+
+	for _, relativePath := range sortedMirrorPaths(source) {
+		entry := source[relativePath]
+		destinationEntry, exists := destination[relativePath]
+		if exists && delete && destinationEntry.isDir != entry.isDir {
+			exists = false
+		}
+		localPath := mirrorPath(true, localDir, relativePath)
+		remotePath := mirrorPath(false, remoteDir, relativePath)
+		if entry.isDir {
+			if !exists && relativePath != "." {
+				plan.Dirs = append(plan.Dirs, mirrorPath(direction == Retrieve, destinationDir, relativePath))
+			}
+			continue
+		}
+		if exists && destinationEntry.size == entry.size &&
+			(entry.time.IsZero() || destinationEntry.time.IsZero() || !entry.time.After(destinationEntry.time)) {
+			continue
+		}
+		task := NewTransferTask(direction, localPath, remotePath)
+		task.Size = entry.size
+		plan.Tasks = append(plan.Tasks, task)
+		if exists && destinationEntry.size == entry.size {
+			plan.sameSize[remotePath] = true
+		}
+	}
+	return plan, nil
+}
+
+// SkipUnchanged removes the tasks of files from the plan, which were modified
+// at the source after the destination but have the same content, e.g. after
+// a redeployment. The files of the same size are compared by their checksums.
+// The checksums of the remote files are requested with HASH or XMD5
+// concurrently in up to nrParallel connections opened with openConn, the ones
+// of the local files are computed meanwhile. A file, whose checksum can not
+// be determined, is still transferred. If the server implements neither
+// command, the remaining files are not compared. SkipUnchanged returns the
+// number of removed tasks and fails, if no connection could be opened.
+func (p *MirrorPlan) SkipUnchanged(openConn ConnectionOpener, nrParallel int) (int, error) {
+	var compared []int
+	for i, task := range p.Tasks {
+		if p.sameSize[task.RemotePath] {
+			compared = append(compared, i)
+		}
+	}
+	if len(compared) == 0 {
+		return 0, nil
+	}
+	if nrParallel > len(compared) {
+		nrParallel = len(compared)
+	}
+	conns, err := openConnections(openConn, nrParallel)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := make(chan int)
+	unchanged := make([]bool, len(p.Tasks))
+	var notImplemented int32 // set atomically by the first worker refused
+	var workers sync.WaitGroup
+	for _, conn := range conns {
+		workers.Add(1)
+		go func(conn ConnectionI) {
+			defer workers.Done()
+			defer conn.Quit()
+			for i := range jobs {
+				if atomic.LoadInt32(&notImplemented) != 0 {
+					continue
+				}
+				same, err := sameContent(conn, p.Tasks[i])
+				if isNotImplemented(err) {
+					atomic.StoreInt32(&notImplemented, 1)
+				}
+				unchanged[i] = same
+			}
+		}(conn)
+	}
+	for _, i := range compared {
+		jobs <- i
+	}
+	close(jobs)
+	workers.Wait()
+
+	tasks := make([]TransferTask, 0, len(p.Tasks))
+	for i, task := range p.Tasks {
+		if !unchanged[i] {
+			tasks = append(tasks, task)
+		}
+	}
+	skipped := len(p.Tasks) - len(tasks)
+	p.Tasks = tasks
+	return skipped, nil
+}
+
+// Reports whether the local and the remote file of the task have the same
+// checksum.
+func sameContent(conn ConnectionI, task TransferTask) (bool, error) {
+	remote, err := conn.Checksum(task.RemotePath)
+	if err != nil {
+		return false, err
+	}
+	local, err := FileChecksum(task.LocalPath, remote.Algorithm)
+	if err != nil {
+		return false, err
+	}
+	return local.Matches(remote), nil
+}
+
+// Operations returns the operations of the plan in the order of Perform, like
+// a DryRunLogger receives them, e.g. "RETR /pub/a.txt -> /home/user/a.txt".
+func (p *MirrorPlan) Operations() []string {
+	var operations []string
+	for _, deletion := range p.Delete {
+		switch {
+		case p.Direction == Retrieve && deletion.IsDir:
+			operations = append(operations, "Remove local directory "+deletion.Path)
+		case p.Direction == Retrieve:
+			operations = append(operations, "Delete local "+deletion.Path)
+		case deletion.IsDir:
+			operations = append(operations, "RMD "+deletion.Path)
+		default:
+			operations = append(operations, "DELE "+deletion.Path)
+		}
+	}
+	for _, dir := range p.Dirs {
+		if p.Direction == Retrieve {
+			operations = append(operations, "Create local directory "+dir)
+		} else {
+			operations = append(operations, "MKD "+dir)
+		}
+	}
+	for _, task := range p.Tasks {
+		operations = append(operations, taskOperations(task)...)
+	}
+	return operations
+}
+
+// Perform deletes the obsolete files and directories, creates the missing
+// directories and transfers the files on the connection. It returns the
+// results of the transfers and of the deletions. A directory, which could
+// not be created, is reported by the transfers of its files.
+func (p *MirrorPlan) Perform(conn ConnectionI) (TransferResults, DeleteResults) {
+	deleted := make(DeleteResults, len(p.Delete))
+	for i, deletion := range p.Delete {
+		var err error
+		switch {
+		case p.Direction == Retrieve:
+			err = os.Remove(deletion.Path)
+		case deletion.IsDir:
+			err = conn.RemoveDir(deletion.Path)
+		default:
+			err = conn.Delete(deletion.Path)
+		}
+		deleted[i] = DeleteResult{Path: deletion.Path, Err: err}
+	}
+	for _, dir := range p.Dirs {
+		if p.Direction == Retrieve {
+			os.MkdirAll(dir, 0755)
+		} else {
+			MkdirAll(conn, dir)
+		}
+	}
+	results := make(TransferResults, len(p.Tasks))
+	for i, task := range p.Tasks {
+		results[i] = PerformTransferTask(conn, task)
+	}
+	return results, deleted
+}
+
+// Returns the entries of the local tree by their paths relative to the
+// directory, nil if the directory does not exist.
+func localMirrorTree(localDir string) (map[string]mirrorEntry, error) {
+	if _, err := os.Stat(localDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	tree := make(map[string]mirrorEntry)
+	err := filepath.Walk(localDir, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(localDir, localPath)
+		if err != nil {
+			return err
+		}
+		tree[filepath.ToSlash(relativePath)] = mirrorEntry{isDir: info.IsDir(), size: info.Size(), time: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// Returns the entries of the remote tree by their paths relative to the
+// directory, nil if the directory does not exist.
+func remoteMirrorTree(conn ConnectionI, remoteDir string) (map[string]mirrorEntry, error) {
+	isDir, err := isRemoteDir(conn, remoteDir)
+	if err != nil || !isDir {
+		return nil, err
+	}
+	tree := map[string]mirrorEntry{".": {isDir: true}}
+	err = Walk(conn, remoteDir, func(remotePath string, entry *Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type == EntryTypeLink {
+			return nil
+		}
+		tree[relativeRemotePath(remoteDir, remotePath)] = mirrorEntry{isDir: entry.IsDir(), size: int64(entry.Size),
+			time: entry.Time}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// Returns the paths of the tree sorted, so directories come before their
+// content.
+func sortedMirrorPaths(tree map[string]mirrorEntry) []string {
+	paths := make([]string, 0, len(tree))
+	for relativePath := range tree {
+		paths = append(paths, relativePath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Joins the directory with the relative path of a tree, as local path or as
+// remote path.
+func mirrorPath(local bool, dir string, relativePath string) string {
+	if local {
+		return filepath.Join(dir, filepath.FromSlash(relativePath))
+	}
+	return path.Join(dir, relativePath)
+}
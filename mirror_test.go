@@ -0,0 +1,163 @@
+package ftps_qftp_client
+
+import (
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMirrorRetrieve(t *testing.T) {
+	localDir := t.TempDir()
+	server := newMemoryServer()
+	server.dirs["/pub"] = true
+	server.dirs["/pub/sub"] = true
+	server.files["/pub/same.txt"] = []byte("same")
+	server.files["/pub/changed.txt"] = []byte("changed")
+	server.files["/pub/sub/new.txt"] = []byte("new")
+	for name, content := range map[string]string{"same.txt": "same", "changed.txt": "old", "obsolete.txt": "x"} {
+		if err := ioutil.WriteFile(filepath.Join(localDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn := &memoryConn{server: server}
+
+	plan, err := PlanMirror(conn, Retrieve, localDir, "/pub", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"Delete local " + filepath.Join(localDir, "obsolete.txt"),
+		"Create local directory " + filepath.Join(localDir, "sub"),
+		"RETR /pub/changed.txt -> " + filepath.Join(localDir, "changed.txt"),
+		"RETR /pub/sub/new.txt -> " + filepath.Join(localDir, "sub", "new.txt"),
+	}
+	if operations := plan.Operations(); !reflect.DeepEqual(operations, expected) {
+		t.Errorf("got the operations\n%q\nexpected\n%q", operations, expected)
+	}
+
+	results, deleted := plan.Perform(conn)
+	if results.Err() != nil || deleted.Err() != nil {
+		t.Fatalf("got the errors %v and %v", results.Err(), deleted.Err())
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(localDir, "sub", "new.txt")); string(data) != "new" {
+		t.Errorf("got %q in the new file", data)
+	}
+	if _, err = os.Stat(filepath.Join(localDir, "obsolete.txt")); !os.IsNotExist(err) {
+		t.Error("the obsolete file was not deleted")
+	}
+
+	plan, err = PlanMirror(conn, Retrieve, localDir, "/pub", true)
+	if err != nil || len(plan.Operations()) != 0 {
+		t.Errorf("got %q, %v for the mirrored directory", plan.Operations(), err)
+	}
+}
+
+func TestMirrorStore(t *testing.T) {
+	localDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(localDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(localDir, "sub", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := newMemoryServer()
+	server.files["/obsolete.txt"] = []byte("x")
+	conn := &memoryConn{server: server}
+
+	// Without delete the obsolete file is kept
+	plan, err := PlanMirror(conn, Store, localDir, "/incoming", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"MKD /incoming", "MKD /incoming/sub", "STOR " + filepath.Join(localDir, "sub", "a.txt") +
+		" -> /incoming/sub/a.txt"}
+	if operations := plan.Operations(); !reflect.DeepEqual(operations, expected) {
+		t.Errorf("got the operations\n%q\nexpected\n%q", operations, expected)
+	}
+	results, _ := plan.Perform(conn)
+	if results.Err() != nil || string(server.files["/incoming/sub/a.txt"]) != "a" {
+		t.Errorf("got %v and the files %q", results.Err(), server.files)
+	}
+
+	if _, err = PlanMirror(conn, Store, filepath.Join(localDir, "missing"), "/incoming", false); err == nil {
+		t.Error("no error for a missing source")
+	}
+}
+
+// Lists the files of a memoryServer with a modification time.
+type timedConn struct {
+	*memoryConn
+	time time.Time
+}
+
+func (c timedConn) List(dir string) ([]*Entry, error) {
+	entries, err := c.memoryConn.List(dir)
+	for _, entry := range entries {
+		entry.Time = c.time
+	}
+	return entries, err
+}
+
+// Refuses the checksum requests like a server without HASH and XMD5.
+type noChecksumConn struct {
+	*memoryConn
+}
+
+func (c noChecksumConn) Checksum(path string) (Checksum, error) {
+	return Checksum{}, &textproto.Error{Code: StatusNotImplemented, Msg: "Command not implemented."}
+}
+
+func TestMirrorSkipUnchanged(t *testing.T) {
+	localDir := t.TempDir()
+	server := newMemoryServer()
+	server.dirs["/pub"] = true
+	server.files["/pub/same.txt"] = []byte("same")
+	server.files["/pub/edited.txt"] = []byte("new!")
+	server.files["/pub/longer.txt"] = []byte("longer")
+	deployed := time.Now().Add(-time.Hour)
+	for name, content := range map[string]string{"same.txt": "same", "edited.txt": "old!", "longer.txt": "long"} {
+		localPath := filepath.Join(localDir, name)
+		if err := ioutil.WriteFile(localPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(localPath, deployed, deployed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn := timedConn{memoryConn: &memoryConn{server: server}, time: time.Now()}
+
+	plan, err := PlanMirror(conn, Retrieve, localDir, "/pub", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Tasks) != 3 {
+		t.Fatalf("got the operations %q before the comparison", plan.Operations())
+	}
+	skipped, err := plan.SkipUnchanged(server.opener(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"RETR /pub/edited.txt -> " + filepath.Join(localDir, "edited.txt"),
+		"RETR /pub/longer.txt -> " + filepath.Join(localDir, "longer.txt"),
+	}
+	if operations := plan.Operations(); skipped != 1 || !reflect.DeepEqual(operations, expected) {
+		t.Errorf("skipped %d, got the operations\n%q\nexpected\n%q", skipped, operations, expected)
+	}
+
+	// Without checksums at the server all files are transferred
+	plan, err = PlanMirror(conn, Retrieve, localDir, "/pub", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	openConn := func() (ConnectionI, error) {
+		return noChecksumConn{&memoryConn{server: server}}, nil
+	}
+	if skipped, err = plan.SkipUnchanged(openConn, 2); err != nil || skipped != 0 || len(plan.Tasks) != 3 {
+		t.Errorf("skipped %d of the tasks %q, %v", skipped, plan.Operations(), err)
+	}
+}
@@ -0,0 +1,279 @@
+// Contains the state of mirrored directories, with which a mirror detects the
+// files modified at both sides since the last run.
+
+package ftps_qftp_client
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// ConflictPolicy determines which version of a file a mirror keeps, which was
+// modified at the source and at the destination since the last run.
+type ConflictPolicy int8
+
+const (
+	// Transfer neither version and just report the conflict
+	ConflictReport ConflictPolicy = iota
+	// Keep the version modified last, the one of the source if a
+	// modification time is unknown
+	ConflictNewestWins
+	// Keep the version of the local file
+	ConflictLocalWins
+	// Keep the version of the remote file
+	ConflictRemoteWins
+)
+
+// Algorithm of the checksums recorded in a MirrorState, if the server computes
+// none or an unsupported one
+const mirrorStateAlgorithm = "MD5"
+
+// MirrorConflict is a file modified at both sides since the last run.
+type MirrorConflict struct {
+	LocalPath  string
+	RemotePath string
+	LocalTime  time.Time // zero if unknown
+	RemoteTime time.Time // zero if unknown
+	// Direction of the transfer, which resolves the conflict, 0 if it was
+	// just reported
+	Resolution TransferDirction
+}
+
+// MirrorFileState is the state of a file, which was the same at both sides
+// after a mirror run.
+type MirrorFileState struct {
+	Path       string // relative to the mirrored directories
+	Size       int64
+	LocalTime  time.Time
+	RemoteTime time.Time // zero if unknown
+	Checksum   Checksum  // of the content, to recognize files just touched
+}
+
+// MirrorState records the files of a local and a remote directory after the
+// last mirror run in a file. It is read by ResolveConflicts and written by
+// SaveState of a MirrorPlan.
+type MirrorState struct {
+	path  string
+	files map[string]MirrorFileState
+}
+
+// OpenMirrorState reads the state in the file or creates an empty one, if
+// the file does not exist.
+func OpenMirrorState(filename string) (*MirrorState, error) {
+	state := &MirrorState{path: filename, files: make(map[string]MirrorFileState)}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, errors.New("Error while reading the mirror state " + filename + ". " + err.Error())
+	}
+	var files []MirrorFileState
+	if err = json.Unmarshal(data, &files); err != nil {
+		return nil, errors.New("Error while parsing the mirror state " + filename + ". " + err.Error())
+	}
+	for _, file := range files {
+		state.files[file.Path] = file
+	}
+	return state, nil
+}
+
+// File returns the state of the file with the relative path and whether the
+// state contains it.
+func (s *MirrorState) File(relativePath string) (MirrorFileState, bool) {
+	file, available := s.files[relativePath]
+	return file, available
+}
+
+// Writes the state to a temporary file, which replaces the file of the state.
+func (s *MirrorState) write() error {
+	files := make([]MirrorFileState, 0, len(s.files))
+	for _, relativePath := range sortedStatePaths(s.files) {
+		files = append(files, s.files[relativePath])
+	}
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := s.path + ".tmp"
+	if err = ioutil.WriteFile(tempPath, data, 0644); err != nil {
+		return errors.New("Error while writing the mirror state " + s.path + ". " + err.Error())
+	}
+	if err = os.Rename(tempPath, s.path); err != nil {
+		return errors.New("Error while writing the mirror state " + s.path + ". " + err.Error())
+	}
+	return nil
+}
+
+// ResolveConflicts looks for the files of the tasks, which were modified at
+// the source and at the destination since the run recorded in the state, and
+// changes the plan by the policy: the task is kept, reversed to keep the
+// version of the destination or with ConflictReport removed. A file counts
+// as modified, if its size or modification time differs from the state and
+// its checksum, if recorded, too. The remote checksums are requested with
+// HASH or XMD5. Files missing in the state, e.g. at the first run, and
+// deletions are no conflicts. The conflicts are returned in the order of the
+// tasks.
+func (p *MirrorPlan) ResolveConflicts(conn ConnectionI, state *MirrorState, policy ConflictPolicy) []MirrorConflict {
+	var conflicts []MirrorConflict
+	p.unresolved = make(map[string]bool)
+	tasks := make([]TransferTask, 0, len(p.Tasks))
+	for _, task := range p.Tasks {
+		relativePath := relativeRemotePath(p.remoteDir, task.RemotePath)
+		file, recorded := state.File(relativePath)
+		local, localExists := p.localTree[relativePath]
+		remote, remoteExists := p.remoteTree[relativePath]
+		if !recorded || !localExists || !remoteExists || local.isDir || remote.isDir ||
+			!localModified(task.LocalPath, local, file) || !remoteModified(conn, task.RemotePath, remote, file) {
+			tasks = append(tasks, task)
+			continue
+		}
+
+		conflict := MirrorConflict{LocalPath: task.LocalPath, RemotePath: task.RemotePath, LocalTime: local.time,
+			RemoteTime: remote.time}
+		switch policy {
+		case ConflictNewestWins:
+			conflict.Resolution = task.Direction
+			if !local.time.IsZero() && !remote.time.IsZero() {
+				if local.time.After(remote.time) {
+					conflict.Resolution = Store
+				} else if remote.time.After(local.time) {
+					conflict.Resolution = Retrieve
+				}
+			}
+		case ConflictLocalWins:
+			conflict.Resolution = Store
+		case ConflictRemoteWins:
+			conflict.Resolution = Retrieve
+		}
+		conflicts = append(conflicts, conflict)
+		switch conflict.Resolution {
+		case 0:
+			p.unresolved[relativePath] = true
+		case task.Direction:
+			tasks = append(tasks, task)
+		default:
+			// The version of the destination replaces the one of the source
+			reversed := task
+			reversed.Direction = conflict.Resolution
+			reversed.Size = local.size
+			if conflict.Resolution == Retrieve {
+				reversed.Size = remote.size
+			}
+			tasks = append(tasks, reversed)
+		}
+	}
+	p.Tasks = tasks
+	return conflicts
+}
+
+// Reports whether the local file was modified since the state was recorded.
+func localModified(localPath string, entry mirrorEntry, file MirrorFileState) bool {
+	if entry.size != file.Size {
+		return true
+	}
+	if entry.time.Equal(file.LocalTime) {
+		return false
+	}
+	if file.Checksum.Value == "" {
+		return true
+	}
+	checksum, err := FileChecksum(localPath, file.Checksum.Algorithm)
+	return err != nil || !checksum.Matches(file.Checksum)
+}
+
+// Reports whether the remote file was modified since the state was recorded.
+func remoteModified(conn ConnectionI, remotePath string, entry mirrorEntry, file MirrorFileState) bool {
+	if entry.size != file.Size {
+		return true
+	}
+	if entry.time.Equal(file.RemoteTime) {
+		return false
+	}
+	if file.Checksum.Value == "" {
+		return true
+	}
+	checksum, err := conn.Checksum(remotePath)
+	return err != nil || !checksum.Matches(file.Checksum)
+}
+
+// SaveState records the files, which are the same at both sides after the
+// plan was performed, in the state and writes it to its file. The trees are
+// listed again for it. The checksums of new and modified files are computed
+// from the local files with the algorithm the server uses for HASH or XMD5,
+// so ResolveConflicts can compare them with the ones of the server. The
+// recorded state of the conflicts just reported by
+// ResolveConflicts is kept, so they are reported again by the next run.
+func (p *MirrorPlan) SaveState(conn ConnectionI, state *MirrorState) error {
+	localTree, err := localMirrorTree(p.localDir)
+	if err != nil {
+		return err
+	}
+	remoteTree, err := remoteMirrorTree(conn, p.remoteDir)
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]MirrorFileState)
+	algorithm := "" // of the server, requested with the first checksum computed
+	for relativePath := range p.unresolved {
+		if old, recorded := state.files[relativePath]; recorded {
+			files[relativePath] = old
+		}
+	}
+	for relativePath, local := range localTree {
+		remote, exists := remoteTree[relativePath]
+		if p.unresolved[relativePath] || !exists || local.isDir || remote.isDir || local.size != remote.size {
+			continue
+		}
+		file := MirrorFileState{Path: relativePath, Size: local.size, LocalTime: local.time, RemoteTime: remote.time}
+		old, recorded := state.files[relativePath]
+		if recorded && old.Size == file.Size && old.LocalTime.Equal(file.LocalTime) {
+			file.Checksum = old.Checksum
+		} else {
+			fileAlgorithm := algorithm
+			if fileAlgorithm == "" {
+				var known bool
+				fileAlgorithm, known = serverAlgorithm(conn, mirrorPath(false, p.remoteDir, relativePath))
+				if known {
+					algorithm = fileAlgorithm
+				}
+			}
+			if file.Checksum, err = FileChecksum(mirrorPath(true, p.localDir, relativePath), fileAlgorithm); err != nil {
+				return err
+			}
+		}
+		files[relativePath] = file
+	}
+	state.files = files
+	return state.write()
+}
+
+// Returns the algorithm of the checksums computed by the server, requested for
+// the remote file, and whether it is known for the following files. If the
+// server computes none or an unsupported one, mirrorStateAlgorithm is used.
+func serverAlgorithm(conn ConnectionI, remotePath string) (string, bool) {
+	checksum, err := conn.Checksum(remotePath)
+	if err != nil {
+		// Other errors may be caused just by this file
+		return mirrorStateAlgorithm, isNotImplemented(err)
+	}
+	if _, err = NewHash(checksum.Algorithm); err != nil {
+		return mirrorStateAlgorithm, true
+	}
+	return checksum.Algorithm, true
+}
+
+// Returns the paths of the recorded files sorted.
+func sortedStatePaths(files map[string]MirrorFileState) []string {
+	paths := make([]string, 0, len(files))
+	for relativePath := range files {
+		paths = append(paths, relativePath)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,151 @@
+package ftps_qftp_client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMirrorConflicts(t *testing.T) {
+	localDir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "mirror.state")
+	server := newMemoryServer()
+	server.dirs["/pub"] = true
+	server.files["/pub/a.txt"] = []byte("aaaa")
+	server.files["/pub/b.txt"] = []byte("bbbb")
+	server.files["/pub/c.txt"] = []byte("cccc")
+	conn := timedConn{memoryConn: &memoryConn{server: server}, time: time.Now().Add(-2 * time.Hour)}
+
+	state, err := OpenMirrorState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanMirror(conn, Retrieve, localDir, "/pub", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conflicts := plan.ResolveConflicts(conn, state, ConflictReport); len(conflicts) != 0 {
+		t.Errorf("got the conflicts %+v at the first run", conflicts)
+	}
+	if results, _ := plan.Perform(conn); results.Err() != nil {
+		t.Fatal(results.Err())
+	}
+	if err = plan.SaveState(conn, state); err != nil {
+		t.Fatal(err)
+	}
+	if file, recorded := state.File("b.txt"); !recorded || file.Size != 4 || file.Checksum.Algorithm != "MD5" {
+		t.Errorf("recorded %+v", file)
+	}
+
+	// a.txt is modified at both sides, b.txt just at the server
+	server.files["/pub/a.txt"] = []byte("remote")
+	server.files["/pub/b.txt"] = []byte("server")
+	if err = ioutil.WriteFile(filepath.Join(localDir, "a.txt"), []byte("local!!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conn.time = time.Now().Add(time.Hour)
+	aRetrieve := "RETR /pub/a.txt -> " + filepath.Join(localDir, "a.txt")
+	bRetrieve := "RETR /pub/b.txt -> " + filepath.Join(localDir, "b.txt")
+	cRetrieve := "RETR /pub/c.txt -> " + filepath.Join(localDir, "c.txt")
+	for policy, expected := range map[ConflictPolicy][]string{
+		ConflictReport:     {bRetrieve, cRetrieve},
+		ConflictNewestWins: {aRetrieve, bRetrieve, cRetrieve},
+		ConflictRemoteWins: {aRetrieve, bRetrieve, cRetrieve},
+		ConflictLocalWins:  {"STOR " + filepath.Join(localDir, "a.txt") + " -> /pub/a.txt", bRetrieve, cRetrieve},
+	} {
+		if state, err = OpenMirrorState(statePath); err != nil {
+			t.Fatal(err)
+		}
+		if plan, err = PlanMirror(conn, Retrieve, localDir, "/pub", false); err != nil {
+			t.Fatal(err)
+		}
+		conflicts := plan.ResolveConflicts(conn, state, policy)
+		if len(conflicts) != 1 || conflicts[0].RemotePath != "/pub/a.txt" {
+			t.Errorf("policy %d: got the conflicts %+v", policy, conflicts)
+		}
+		if operations := plan.Operations(); !reflect.DeepEqual(operations, expected) {
+			t.Errorf("policy %d: got the operations\n%q\nexpected\n%q", policy, operations, expected)
+		}
+	}
+
+	// A reported conflict is reported again by the next run
+	if state, err = OpenMirrorState(statePath); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = PlanMirror(conn, Retrieve, localDir, "/pub", false); err != nil {
+		t.Fatal(err)
+	}
+	plan.ResolveConflicts(conn, state, ConflictReport)
+	if results, _ := plan.Perform(conn); results.Err() != nil {
+		t.Fatal(results.Err())
+	}
+	if err = plan.SaveState(conn, state); err != nil {
+		t.Fatal(err)
+	}
+	if state, err = OpenMirrorState(statePath); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = PlanMirror(conn, Retrieve, localDir, "/pub", false); err != nil {
+		t.Fatal(err)
+	}
+	if conflicts := plan.ResolveConflicts(conn, state, ConflictReport); len(conflicts) != 1 {
+		t.Errorf("got the conflicts %+v after the report", conflicts)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(localDir, "a.txt")); string(data) != "local!!" {
+		t.Errorf("the reported local file contains %q", data)
+	}
+}
+
+// Computes the checksums with SHA-256 like servers with HASH.
+type sha256Conn struct {
+	timedConn
+}
+
+func (c *sha256Conn) Checksum(path string) (Checksum, error) {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	sum := sha256.Sum256(c.server.files[path])
+	return Checksum{Algorithm: "SHA-256", Value: hex.EncodeToString(sum[:])}, nil
+}
+
+func TestMirrorStateServerAlgorithm(t *testing.T) {
+	localDir := t.TempDir()
+	server := newMemoryServer()
+	server.dirs["/pub"] = true
+	server.files["/pub/a.txt"] = []byte("aaaa")
+	conn := &sha256Conn{timedConn{memoryConn: &memoryConn{server: server}, time: time.Now().Add(-2 * time.Hour)}}
+
+	state, err := OpenMirrorState(filepath.Join(t.TempDir(), "mirror.state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanMirror(conn, Retrieve, localDir, "/pub", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := plan.Perform(conn); results.Err() != nil {
+		t.Fatal(results.Err())
+	}
+	if err = plan.SaveState(conn, state); err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := state.File("a.txt"); file.Checksum.Algorithm != "SHA-256" {
+		t.Errorf("recorded the checksum %+v", file.Checksum)
+	}
+
+	// The remote file was just touched, so the local modification is no conflict
+	if err = ioutil.WriteFile(filepath.Join(localDir, "a.txt"), []byte("AAAA"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conn.time = time.Now().Add(time.Hour)
+	if plan, err = PlanMirror(conn, Retrieve, localDir, "/pub", false); err != nil {
+		t.Fatal(err)
+	}
+	if conflicts := plan.ResolveConflicts(conn, state, ConflictReport); len(conflicts) != 0 || len(plan.Tasks) != 1 {
+		t.Errorf("got the conflicts %+v and the operations %q", conflicts, plan.Operations())
+	}
+}
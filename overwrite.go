@@ -0,0 +1,130 @@
+// Contains the handling of existing files at the destination of a transfer
+// and the removal of the source after a transfer.
+
+package ftps_qftp_client
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OverwritePolicy determines how a transfer handles an existing file at its destination.
+type OverwritePolicy int8
+
+const (
+	// Replace the existing file
+	Overwrite OverwritePolicy = iota
+	// Keep the existing file and don't transfer
+	OverwriteSkip
+	// Keep the existing file and transfer to a new name, e.g. "file_1.txt"
+	OverwriteRename
+	// Treat the existing file as partial transfer and continue it with REST
+	OverwriteResume
+)
+
+// Maximal number of names tried by OverwriteRename
+const maxRenameAttempts = 1000
+
+// Returns the size of the file at the destination of the task and whether it exists.
+func destinationSize(conn ConnectionI, task TransferTask) (int64, bool) {
+	switch task.Direction {
+	case Retrieve:
+		info, err := os.Stat(task.LocalPath)
+		if err != nil || info.IsDir() {
+			return 0, false
+		}
+		return info.Size(), true
+	case Store:
+		return remoteFileSize(conn, task.RemotePath)
+	}
+	return 0, false
+}
+
+// Returns the size of the remote file and whether it exists. Without SIZE
+// the file is listed, the listing of a file contains only the file itself.
+func remoteFileSize(conn ConnectionI, remotePath string) (int64, bool) {
+	if conn.Capabilities().Size {
+		size, err := conn.FileSize(remotePath)
+		return size, err == nil
+	}
+	entries, err := conn.List(remotePath)
+	if err != nil || len(entries) != 1 || entries[0].Name != path.Base(remotePath) || entries[0].Type != EntryTypeFile {
+		return 0, false
+	}
+	return int64(entries[0].Size), true
+}
+
+// Applies the OverwritePolicy of the task. It returns the task with the
+// destination to transfer to, the offset to start at and whether the
+// transfer is to be skipped.
+func applyOverwritePolicy(conn ConnectionI, task TransferTask) (TransferTask, int64, bool, error) {
+	if task.Overwrite == Overwrite {
+		return task, 0, false, nil
+	}
+	size, exists := destinationSize(conn, task)
+	if !exists {
+		return task, 0, false, nil
+	}
+
+	switch task.Overwrite {
+	case OverwriteSkip:
+		return task, 0, true, nil
+	case OverwriteResume:
+		switch task.Direction {
+		case Store:
+			info, err := os.Stat(task.LocalPath)
+			if err != nil {
+				return task, 0, false, errors.New("Error while opening the local file " + task.LocalPath + ". " + err.Error())
+			}
+			if size >= info.Size() {
+				// Already completely stored
+				return task, 0, true, nil
+			}
+		case Retrieve:
+			remoteSize, exists := remoteFileSize(conn, task.RemotePath)
+			if exists && size >= remoteSize {
+				// Already completely retrieved
+				return task, 0, true, nil
+			}
+		}
+		return task, size, false, nil
+	case OverwriteRename:
+		for i := 1; i <= maxRenameAttempts; i++ {
+			renamed := task
+			if task.Direction == Retrieve {
+				renamed.LocalPath = numberedName(task.LocalPath, filepath.Ext(task.LocalPath), i)
+			} else {
+				renamed.RemotePath = numberedName(task.RemotePath, path.Ext(task.RemotePath), i)
+			}
+			if _, exists := destinationSize(conn, renamed); !exists {
+				return renamed, 0, false, nil
+			}
+		}
+		return task, 0, false, errors.New("No free name found for " + task.LocalPath + ".")
+	}
+	return task, 0, false, errors.New("Unknown overwrite policy " + strconv.Itoa(int(task.Overwrite)) + ".")
+}
+
+// Inserts the number before the extension of the name, e.g. "file_1.txt".
+func numberedName(name string, extension string, number int) string {
+	return strings.TrimSuffix(name, extension) + "_" + strconv.Itoa(number) + extension
+}
+
+// Deletes the source of a successful transfer.
+func deleteSource(conn ConnectionI, task TransferTask) error {
+	var err error
+	switch task.Direction {
+	case Retrieve:
+		err = conn.Delete(task.RemotePath)
+	case Store:
+		err = os.Remove(task.LocalPath)
+	}
+	if err != nil {
+		return errors.New("Transfer of " + task.LocalPath + " successful, but deleting the source failed. " + err.Error())
+	}
+	return nil
+}
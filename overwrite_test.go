@@ -0,0 +1,89 @@
+package ftps_qftp_client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverwritePolicy(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	conn := &memoryConn{server: server}
+	server.files["file.txt"] = []byte("0123456789")
+	localPath := filepath.Join(localDir, "file.txt")
+
+	task := NewTransferTask(Retrieve, localPath, "file.txt")
+	tests := []struct {
+		policy   OverwritePolicy
+		existing string
+		skipped  bool
+		file     string // name of the written file
+		content  string
+	}{
+		{Overwrite, "old", false, "file.txt", "0123456789"},
+		{OverwriteSkip, "old", true, "file.txt", "old"},
+		{OverwriteSkip, "", false, "file.txt", "0123456789"},
+		{OverwriteRename, "old", false, "file_1.txt", "0123456789"},
+		{OverwriteResume, "01234", false, "file.txt", "0123456789"},
+		{OverwriteResume, "0123456789", true, "file.txt", "0123456789"},
+	}
+	for _, test := range tests {
+		os.Remove(localPath)
+		os.Remove(filepath.Join(localDir, "file_1.txt"))
+		if test.existing != "" {
+			if err = ioutil.WriteFile(localPath, []byte(test.existing), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		task.Overwrite = test.policy
+		result := PerformTransferTask(conn, task)
+		if result.Err != nil || result.Skipped != test.skipped {
+			t.Errorf("policy %d: err = %v, skipped = %v", test.policy, result.Err, result.Skipped)
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(localDir, test.file))
+		if err != nil || string(data) != test.content {
+			t.Errorf("policy %d: %s contains %q, %v, want %q", test.policy, test.file, data, err, test.content)
+		}
+	}
+}
+
+func TestDeleteSourceAfterSuccess(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	conn := &memoryConn{server: server}
+	localPath := filepath.Join(localDir, "moved.txt")
+	if err = ioutil.WriteFile(localPath, []byte("moved"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	task := NewTransferTask(Store, localPath, "moved.txt")
+	task.DeleteSourceAfterSuccess = true
+	if result := PerformTransferTask(conn, task); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if _, err = os.Stat(localPath); !os.IsNotExist(err) {
+		t.Errorf("local source not deleted: %v", err)
+	}
+
+	task = NewTransferTask(Retrieve, localPath, "moved.txt")
+	task.DeleteSourceAfterSuccess = true
+	if result := PerformTransferTask(conn, task); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if _, available := server.files["moved.txt"]; available {
+		t.Error("remote source not deleted")
+	}
+}
@@ -0,0 +1,508 @@
+// Contains the parsers for the lines returned by the LIST FTP command,
+// which are used by the FTPS- and the QUIC-FTP-client.
+
+package ftps_qftp_client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnsupportedListLine is returned by ParseListLine for lines in an unknown format.
+var ErrUnsupportedListLine = errors.New("Unsupported LIST line")
+
+// parseRFC3659ListLine parses the style of directory line defined in RFC 3659.
+func parseRFC3659ListLine(line string) (*Entry, error) {
+	iSemicolon := strings.Index(line, ";")
+	iWhitespace := strings.Index(line, " ")
+
+	if iSemicolon < 0 || iSemicolon > iWhitespace {
+		return nil, ErrUnsupportedListLine
+	}
+
+	e := &Entry{
+		Name: line[iWhitespace+1:],
+	}
+
+	for _, field := range strings.Split(line[:iWhitespace-1], ";") {
+		i := strings.Index(field, "=")
+		if i < 1 {
+			return nil, ErrUnsupportedListLine
+		}
+
+		// Fact names are not case sensitive
+		key := strings.ToLower(field[:i])
+		value := field[i+1:]
+
+		switch key {
+		case "modify":
+			var err error
+			e.Time, err = time.Parse("20060102150405", value)
+			if err != nil {
+				return nil, err
+			}
+		case "type":
+			lowerValue := strings.ToLower(value)
+			switch {
+			case lowerValue == "dir":
+				e.Type = EntryTypeFolder
+			case lowerValue == "cdir":
+				// Servers list the current directory with its path
+				e.Type = EntryTypeFolder
+				e.Name = "."
+			case lowerValue == "pdir":
+				e.Type = EntryTypeFolder
+				e.Name = ".."
+			case lowerValue == "file":
+				e.Type = EntryTypeFile
+			case strings.HasPrefix(lowerValue, "os.unix=slink"), strings.HasPrefix(lowerValue, "os.unix=symlink"):
+				// e.g. OS.unix=slink:/usr/bin
+				e.Type = EntryTypeLink
+				if i := strings.Index(value, ":"); i >= 0 {
+					e.Target = value[i+1:]
+				}
+			}
+		case "size":
+			e.SetSize(value)
+		case "perm":
+			e.Perm = value
+		case "unix.mode":
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil {
+				return nil, ErrUnsupportedListLine
+			}
+			e.Mode = unixMode(mode)
+		case "unix.owner":
+			if e.Owner == "" {
+				e.Owner = value
+			}
+		case "unix.ownername":
+			e.Owner = value
+		case "unix.group":
+			if e.Group == "" {
+				e.Group = value
+			}
+		case "unix.groupname":
+			e.Group = value
+		}
+	}
+	return e, nil
+}
+
+// Converts the mode of a UNIX file to the permission bits of an os.FileMode.
+func unixMode(mode uint64) os.FileMode {
+	fileMode := os.FileMode(mode & 0777)
+	if mode&04000 != 0 {
+		fileMode |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		fileMode |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		fileMode |= os.ModeSticky
+	}
+	return fileMode
+}
+
+// Splits the name of a link listed by ls into the name and the target.
+func (e *Entry) setLinkName(name string) {
+	if i := strings.Index(name, " -> "); i >= 0 {
+		e.Name = name[:i]
+		e.Target = name[i+len(" -> "):]
+		return
+	}
+	e.Name = name
+}
+
+// parseLsListLine parses a directory line in a format based on the output of
+// the UNIX ls command.
+func parseLsListLine(line string) (*Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 7 {
+		return nil, ErrUnsupportedListLine
+	}
+	if fields[1] == "folder" && fields[2] == "0" {
+		e := &Entry{
+			Type: EntryTypeFolder,
+			Name: strings.Join(fields[6:], " "),
+		}
+		setLsMode(e, fields[0])
+		if err := e.SetTime(fields[3:6]); err != nil {
+			return nil, err
+		}
+
+		return e, nil
+	}
+
+	if fields[1] == "0" && len(fields) >= 8 {
+		e := &Entry{
+			Type: EntryTypeFile,
+			Name: strings.Join(fields[7:], " "),
+		}
+
+		if err := e.SetSize(fields[2]); err != nil {
+			return nil, err
+		}
+		setLsMode(e, fields[0])
+		if err := e.SetTime(fields[4:7]); err != nil {
+			return nil, err
+		}
+
+		return e, nil
+	}
+
+	if len(fields) < 9 {
+		return nil, ErrUnsupportedListLine
+	}
+
+	e := &Entry{
+		Owner: fields[2],
+		Group: fields[3],
+	}
+	switch fields[0][0] {
+	case '-':
+		e.Type = EntryTypeFile
+		if err := e.SetSize(fields[4]); err != nil {
+			return nil, err
+		}
+	case 'd':
+		e.Type = EntryTypeFolder
+	case 'l':
+		e.Type = EntryTypeLink
+	default:
+		return nil, errors.New("Unknown entry type")
+	}
+
+	setLsMode(e, fields[0])
+	if err := e.SetTime(fields[5:8]); err != nil {
+		return nil, err
+	}
+
+	name := strings.Join(fields[8:], " ")
+	if e.Type == EntryTypeLink {
+		e.setLinkName(name)
+	} else {
+		e.Name = name
+	}
+	return e, nil
+}
+
+// Sets the Mode from the first field of ls, e.g. "drwxr-xr-x". Unknown
+// formats like the one of NetWare are ignored, as the mode is optional.
+func setLsMode(e *Entry, field string) {
+	if len(field) >= 10 {
+		e.SetMode(field[1:10])
+	}
+}
+
+// parseNetWareListLine parses a directory line of Novell NetWare servers, e.g.
+// "d [R----F--] supervisor            512       Jan 16 18:53 login".
+func parseNetWareListLine(line string) (*Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 8 || len(fields[0]) != 1 ||
+		!strings.HasPrefix(fields[1], "[") || !strings.HasSuffix(fields[1], "]") {
+		return nil, ErrUnsupportedListLine
+	}
+
+	e := &Entry{Owner: fields[2]}
+	switch fields[0] {
+	case "-":
+		e.Type = EntryTypeFile
+		if err := e.SetSize(fields[3]); err != nil {
+			return nil, err
+		}
+	case "d":
+		e.Type = EntryTypeFolder
+	default:
+		return nil, ErrUnsupportedListLine
+	}
+	if err := e.SetTime(fields[4:7]); err != nil {
+		return nil, err
+	}
+	e.Name = strings.Join(fields[7:], " ")
+	return e, nil
+}
+
+var vmsTimeFormats = []string{
+	"2-Jan-2006 15:04:05",
+	"2-Jan-2006 15:04",
+}
+
+// Size of the blocks used by VMS for the size of files
+const vmsBlockSize = 512
+
+// parseVMSListLine parses a directory line of OpenVMS servers, e.g.
+// "CII-MANUAL.TEX;1  213/216  29-JAN-1996 03:33:12  [ANONYMOU,ANONYMOUS]   (RWED,RWED,,)".
+// The size is given in blocks, so it is only approximately the one of the file.
+func parseVMSListLine(line string) (*Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return nil, ErrUnsupportedListLine
+	}
+	// The name contains the version of the file, e.g. ";1"
+	iVersion := strings.LastIndex(fields[0], ";")
+	if iVersion < 1 {
+		return nil, ErrUnsupportedListLine
+	}
+	if _, err := strconv.ParseUint(fields[0][iVersion+1:], 10, 32); err != nil {
+		return nil, ErrUnsupportedListLine
+	}
+
+	e := &Entry{Name: fields[0][:iVersion], Type: EntryTypeFile}
+	if strings.HasSuffix(strings.ToUpper(e.Name), ".DIR") {
+		e.Type = EntryTypeFolder
+		e.Name = e.Name[:len(e.Name)-len(".DIR")]
+	}
+
+	// Used and allocated blocks, e.g. "213/216"
+	blocks, err := strconv.ParseUint(strings.SplitN(fields[1], "/", 2)[0], 10, 64)
+	if err != nil {
+		return nil, ErrUnsupportedListLine
+	}
+	if e.Type == EntryTypeFile {
+		e.Size = blocks * vmsBlockSize
+	}
+
+	timeStr := fields[2] + " " + fields[3]
+	for _, format := range vmsTimeFormats {
+		e.Time, err = time.Parse(format, timeStr)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, ErrUnsupportedListLine
+	}
+
+	for _, field := range fields[4:] {
+		switch {
+		case strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]"):
+			// [GROUP,OWNER] or [OWNER]
+			identifier := strings.Split(field[1:len(field)-1], ",")
+			e.Owner = identifier[len(identifier)-1]
+			if len(identifier) == 2 {
+				e.Group = identifier[0]
+			}
+		case strings.HasPrefix(field, "(") && strings.HasSuffix(field, ")"):
+			e.Mode = vmsMode(field[1 : len(field)-1])
+		}
+	}
+	return e, nil
+}
+
+// Converts the protection of VMS for system, owner, group and world, e.g.
+// "RWED,RWED,RE,", to the permission bits of owner, group and others.
+func vmsMode(protection string) os.FileMode {
+	classes := strings.Split(protection, ",")
+	var mode os.FileMode
+	for i, shift := range []uint{6, 3, 0} {
+		if i+1 >= len(classes) {
+			break
+		}
+		for _, right := range classes[i+1] {
+			switch right {
+			case 'R':
+				mode |= 04 << shift
+			case 'W':
+				mode |= 02 << shift
+			case 'E':
+				mode |= 01 << shift
+			}
+		}
+	}
+	return mode
+}
+
+var dirTimeFormats = []string{
+	"01-02-06  03:04PM",
+	"2006-01-02  15:04",
+}
+
+// parseDirListLine parses a directory line in a format based on the output of
+// the MS-DOS DIR command.
+func parseDirListLine(line string) (*Entry, error) {
+	e := &Entry{}
+	var err error
+
+	// Try various time formats that DIR might use, and stop when one works.
+	err = ErrUnsupportedListLine
+	for _, format := range dirTimeFormats {
+		if len(line) < len(format) {
+			continue
+		}
+		e.Time, err = time.Parse(format, line[:len(format)])
+		if err == nil {
+			line = line[len(format):]
+			break
+		}
+	}
+	if err != nil {
+		// None of the time formats worked.
+		return nil, ErrUnsupportedListLine
+	}
+
+	line = strings.TrimLeft(line, " ")
+	if strings.HasPrefix(line, "<DIR>") {
+		e.Type = EntryTypeFolder
+		line = strings.TrimPrefix(line, "<DIR>")
+	} else {
+		space := strings.Index(line, " ")
+		if space == -1 {
+			return nil, ErrUnsupportedListLine
+		}
+		e.Size, err = strconv.ParseUint(line[:space], 10, 64)
+		if err != nil {
+			return nil, ErrUnsupportedListLine
+		}
+		e.Type = EntryTypeFile
+		line = line[space:]
+	}
+
+	e.Name = strings.TrimLeft(line, " ")
+	return e, nil
+}
+
+// ListParser parses a line returned by the LIST FTP command. For lines in a
+// format it does not know, it returns ErrUnsupportedListLine, so the next
+// parser is tried. Times without a zone are returned as UTC.
+type ListParser func(line string) (*Entry, error)
+
+// A ListParser together with the information, whether the format contains
+// times in UTC or in the local time of the server.
+type listParser struct {
+	parse ListParser
+	utc   bool
+}
+
+var (
+	listLineParsersMutex sync.RWMutex
+	listLineParsers      = []listParser{
+		{parseRFC3659ListLine, true},
+		{parseNetWareListLine, false},
+		{parseVMSListLine, false},
+		{parseLsListLine, false},
+		{parseDirListLine, false},
+	}
+)
+
+// RegisterListParser adds a parser for a further format of LIST lines, e.g. of
+// NetWare, VMS or MVS servers. Registered parsers are tried before the built-in
+// ones in the reverse order of their registration, so they can also replace
+// the parsing of a built-in format. Their times are regarded as local times of
+// the server. It is safe for concurrent use.
+func RegisterListParser(parser ListParser) {
+	listLineParsersMutex.Lock()
+	defer listLineParsersMutex.Unlock()
+	parsers := make([]listParser, 0, len(listLineParsers)+1)
+	parsers = append(parsers, listParser{parse: parser})
+	listLineParsers = append(parsers, listLineParsers...)
+}
+
+// ParseListLine parses the various non-standard format returned by the LIST
+// FTP command with the registered and the built-in parsers. Local times of the
+// server are regarded as UTC.
+func ParseListLine(line string) (*Entry, error) {
+	return ParseListLineIn(line, time.UTC)
+}
+
+// ParseMachineEntry parses the message of the reply to MLST (RFC 3659). The
+// facts of the path are in the line of the message starting with a space,
+// the name of the returned entry is the last element of the path.
+func ParseMachineEntry(message string) (*Entry, error) {
+	for _, line := range strings.Split(message, "\n") {
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+		e, err := parseRFC3659ListLine(strings.TrimPrefix(line, " "))
+		if err != nil {
+			return nil, err
+		}
+		if e.Name != "." && e.Name != ".." {
+			e.Name = path.Base(e.Name)
+		}
+		return e, nil
+	}
+	return nil, errors.New("MLST response without facts")
+}
+
+// ParseListLineIn parses the line like ParseListLine, local times of the server
+// are interpreted in the location, see DetectServerLocation. Without a location
+// they are regarded as UTC.
+func ParseListLineIn(line string, location *time.Location) (*Entry, error) {
+	if location == nil {
+		location = time.UTC
+	}
+	listLineParsersMutex.RLock()
+	parsers := listLineParsers
+	listLineParsersMutex.RUnlock()
+
+	for _, parser := range parsers {
+		e, err := parser.parse(line)
+		if err == ErrUnsupportedListLine {
+			// Try another format.
+			continue
+		}
+		if err == nil && e.Name == "" {
+			// A file without a name would be the listed directory itself.
+			return nil, ErrUnsupportedListLine
+		}
+		if err == nil && !parser.utc && location != time.UTC && !e.Time.IsZero() {
+			t := e.Time
+			e.Time = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), location)
+		}
+		return e, err
+	}
+	return nil, ErrUnsupportedListLine
+}
+
+// Accuracy of the offset of the time zone of a server
+const serverOffsetAccuracy = 15 * time.Minute
+
+// DetectServerLocation determines the time zone, in which the server lists the
+// times of files, by comparing the time listed for the remote file with its
+// time returned by MDTM, which is always in UTC. The file has to be modified
+// within the last months, so that LIST contains the time of the day. The
+// location can be used with ParseListLineIn and SetServerLocation of the
+// connections.
+func DetectServerLocation(conn ConnectionI, remotePath string) (*time.Location, error) {
+	entries, err := conn.List(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 || !entries[0].IsRegular() {
+		return nil, errors.New("No single file listed for " + remotePath + ".")
+	}
+	modTime, err := conn.ModTime(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	listTime := entries[0].Time
+	if listTime.Hour() == 0 && listTime.Minute() == 0 && listTime.Second() == 0 {
+		return nil, errors.New("No time of the day listed for " + remotePath + ".")
+	}
+
+	// The listed time is the local time of the server regarded as UTC
+	offset := listTime.Sub(modTime.UTC()).Round(serverOffsetAccuracy)
+	if offset == 0 {
+		return time.UTC, nil
+	}
+	return time.FixedZone("UTC"+formatOffset(offset), int(offset/time.Second)), nil
+}
+
+// Formats the offset of a time zone, e.g. "+01:00".
+func formatOffset(offset time.Duration) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	hours := int(offset / time.Hour)
+	minutes := int(offset % time.Hour / time.Minute)
+	return sign + fmt.Sprintf("%02d:%02d", hours, minutes)
+}
@@ -0,0 +1,292 @@
+package ftps_qftp_client
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns the time listed by ls with the time of the day, which is at most
+// six months ago.
+func lsTime(month time.Month, day, hour, minute int) time.Time {
+	t := time.Date(time.Now().Year(), month, day, hour, minute, 0, 0, time.UTC)
+	if t.After(time.Now().Add(maxZoneDifference)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+type line struct {
+	line      string
+	name      string
+	size      uint64
+	entryType EntryType
+	time      time.Time
+}
+
+type unsupportedLine struct {
+	line string
+	err  string
+}
+
+var listTests = []line{
+	// UNIX ls -l style
+	{"drwxr-xr-x    3 110      1002            3 Dec 02  2009 pub", "pub", 0, EntryTypeFolder, time.Date(2009, time.December, 2, 0, 0, 0, 0, time.UTC)},
+	{"drwxr-xr-x    3 110      1002            3 Dec 02  2009 p u b", "p u b", 0, EntryTypeFolder, time.Date(2009, time.December, 2, 0, 0, 0, 0, time.UTC)},
+	{"-rwxr-xr-x    3 110      1002            1234567 Dec 02  2009 fileName", "fileName", 1234567, EntryTypeFile, time.Date(2009, time.December, 2, 0, 0, 0, 0, time.UTC)},
+	{"lrwxrwxrwx   1 root     other          7 Jan 25 00:17 bin -> usr/bin", "bin", 0, EntryTypeLink, lsTime(time.January, 25, 0, 17)},
+
+	// Another ls style
+	{"drwxr-xr-x               folder        0 Aug 15 05:49 !!!-Tipp des Haus!", "!!!-Tipp des Haus!", 0, EntryTypeFolder, lsTime(time.August, 15, 5, 49)},
+	{"drwxrwxrwx               folder        0 Aug 11 20:32 P0RN", "P0RN", 0, EntryTypeFolder, lsTime(time.August, 11, 20, 32)},
+	{"-rw-r--r--        0   18446744073709551615 18446744073709551615 Nov 16  2006 VIDEO_TS.VOB", "VIDEO_TS.VOB", 18446744073709551615, EntryTypeFile, time.Date(2006, time.November, 16, 0, 0, 0, 0, time.UTC)},
+
+	// Microsoft's FTP servers for Windows
+	{"----------   1 owner    group         1803128 Jul 10 10:18 ls-lR.Z", "ls-lR.Z", 1803128, EntryTypeFile, lsTime(time.July, 10, 10, 18)},
+	{"d---------   1 owner    group               0 May  9 19:45 Softlib", "Softlib", 0, EntryTypeFolder, lsTime(time.May, 9, 19, 45)},
+
+	// WFTPD for MSDOS
+	{"-rwxrwxrwx   1 noone    nogroup      322 Aug 19  1996 message.ftp", "message.ftp", 322, EntryTypeFile, time.Date(1996, time.August, 19, 0, 0, 0, 0, time.UTC)},
+
+	// RFC3659 format: https://tools.ietf.org/html/rfc3659#section-7
+	{"modify=20150813224845;perm=fle;type=cdir;unique=119FBB87U4;UNIX.group=0;UNIX.mode=0755;UNIX.owner=0; .", ".", 0, EntryTypeFolder, time.Date(2015, time.August, 13, 22, 48, 45, 0, time.UTC)},
+	{"modify=20150813224845;perm=fle;type=pdir;unique=119FBB87U4;UNIX.group=0;UNIX.mode=0755;UNIX.owner=0; ..", "..", 0, EntryTypeFolder, time.Date(2015, time.August, 13, 22, 48, 45, 0, time.UTC)},
+	{"modify=20150806235817;perm=fle;type=dir;unique=1B20F360U4;UNIX.group=0;UNIX.mode=0755;UNIX.owner=0; movies", "movies", 0, EntryTypeFolder, time.Date(2015, time.August, 6, 23, 58, 17, 0, time.UTC)},
+	{"modify=20150814172949;perm=flcdmpe;type=dir;unique=85A0C168U4;UNIX.group=0;UNIX.mode=0777;UNIX.owner=0; _upload", "_upload", 0, EntryTypeFolder, time.Date(2015, time.August, 14, 17, 29, 49, 0, time.UTC)},
+	{"modify=20150813175250;perm=adfr;size=951;type=file;unique=119FBB87UE;UNIX.group=0;UNIX.mode=0644;UNIX.owner=0; welcome.msg", "welcome.msg", 951, EntryTypeFile, time.Date(2015, time.August, 13, 17, 52, 50, 0, time.UTC)},
+
+	// NetWare
+	{"d [R----F--] supervisor            512       Jan 16 18:53 login", "login", 0, EntryTypeFolder, lsTime(time.January, 16, 18, 53)},
+	{"- [R----F--] rhesus             214059       Oct 20 15:27 cx.exe", "cx.exe", 214059, EntryTypeFile, lsTime(time.October, 20, 15, 27)},
+
+	// OpenVMS, the size is given in blocks of 512 bytes
+	{"CII-MANUAL.TEX;1  213/216  29-JAN-1996 03:33:12  [ANONYMOU,ANONYMOUS]   (RWED,RWED,,)", "CII-MANUAL.TEX", 213 * 512, EntryTypeFile, time.Date(1996, time.January, 29, 3, 33, 12, 0, time.UTC)},
+	{"CORE.DIR;1          1    8-SEP-1996 16:09  [SYSTEM]  (RWE,RWE,RE,RE)", "CORE", 0, EntryTypeFolder, time.Date(1996, time.September, 8, 16, 9, 0, 0, time.UTC)},
+
+	// DOS DIR command output
+	{"08-07-15  07:50PM                  718 Post_PRR_20150901_1166_265118_13049.dat", "Post_PRR_20150901_1166_265118_13049.dat", 718, EntryTypeFile, time.Date(2015, time.August, 7, 19, 50, 0, 0, time.UTC)},
+	{"08-10-15  02:04PM       <DIR>          Billing", "Billing", 0, EntryTypeFolder, time.Date(2015, time.August, 10, 14, 4, 0, 0, time.UTC)},
+}
+
+// Not supported, we expect a specific error message
+var listTestsFail = []unsupportedLine{
+	{"drwxr-xr-x    3 110      1002            3 Dec 02  209 pub", "Invalid year format in time string"},
+	{"modify=20150806235817;invalid;UNIX.owner=0; movies", "Unsupported LIST line"},
+	{"Zrwxrwxrwx   1 root     other          7 Jan 25 00:17 bin -> usr/bin", "Unknown entry type"},
+	{"modify=20150806235817;type=file; ", "Unsupported LIST line"},
+	{"08-10-15  02:04PM       <DIR>", "Unsupported LIST line"},
+}
+
+func TestParseValidListLine(t *testing.T) {
+	for _, lt := range listTests {
+		entry, err := ParseListLine(lt.line)
+		if err != nil {
+			t.Errorf("ParseListLine(%v) returned err = %v", lt.line, err)
+			continue
+		}
+		if entry.Name != lt.name {
+			t.Errorf("ParseListLine(%v).Name = '%v', want '%v'", lt.line, entry.Name, lt.name)
+		}
+		if entry.Type != lt.entryType {
+			t.Errorf("ParseListLine(%v).EntryType = %v, want %v", lt.line, entry.Type, lt.entryType)
+		}
+		if entry.Size != lt.size {
+			t.Errorf("ParseListLine(%v).Size = %v, want %v", lt.line, entry.Size, lt.size)
+		}
+		if entry.Time.Unix() != lt.time.Unix() {
+			t.Errorf("ParseListLine(%v).Time = %v, want %v", lt.line, entry.Time, lt.time)
+		}
+	}
+}
+
+func TestParseUnsupportedListLine(t *testing.T) {
+	for _, lt := range listTestsFail {
+		_, err := ParseListLine(lt.line)
+		if err == nil {
+			t.Errorf("ParseListLine(%v) expected to fail", lt.line)
+		}
+		if err.Error() != lt.err {
+			t.Errorf("ParseListLine(%v) expected to fail with error: '%s'; was: '%s'", lt.line, lt.err, err.Error())
+		}
+	}
+}
+
+func TestParseListLineDetails(t *testing.T) {
+	tests := []struct {
+		line   string
+		mode   os.FileMode
+		perm   string
+		owner  string
+		group  string
+		target string
+	}{
+		{"drwxr-xr-x    3 110      1002            3 Dec 02  2009 pub", 0755, "", "110", "1002", ""},
+		{"lrwxrwxrwx   1 root     other          7 Jan 25 00:17 bin -> usr/bin", 0777, "", "root", "other", "usr/bin"},
+		{"-rwsr-xr-T   1 root     wheel        322 Aug 19  1996 su", 0754 | os.ModeSetuid | os.ModeSticky, "", "root", "wheel", ""},
+		{"modify=20150813175250;perm=adfr;size=951;type=file;UNIX.group=0;UNIX.mode=02644;UNIX.owner=0;UNIX.ownername=ftp; welcome.msg", 0644 | os.ModeSetgid, "adfr", "ftp", "0", ""},
+		{"modify=20150813175250;perm=adfr;type=OS.unix=slink:/usr/bin;UNIX.mode=0777; bin", 0777, "adfr", "", "", "/usr/bin"},
+		{"00README.TXT;1      2   30-DEC-1996 17:44  [SYSTEM]  (RWED,RWED,RE,)", 0750, "", "SYSTEM", "", ""},
+		{"CII-MANUAL.TEX;1  213/216  29-JAN-1996 03:33:12  [ANONYMOU,ANONYMOUS]   (RWED,RWED,,)", 0700, "", "ANONYMOUS", "ANONYMOU", ""},
+	}
+	for _, test := range tests {
+		entry, err := ParseListLine(test.line)
+		if err != nil {
+			t.Errorf("ParseListLine(%v) returned err = %v", test.line, err)
+			continue
+		}
+		if entry.Mode != test.mode || entry.Perm != test.perm || entry.Owner != test.owner ||
+			entry.Group != test.group || entry.Target != test.target {
+			t.Errorf("ParseListLine(%v) = %+v, want mode %v, perm %q, owner %q, group %q and target %q",
+				test.line, entry, test.mode, test.perm, test.owner, test.group, test.target)
+		}
+	}
+}
+
+func TestRegisterListParser(t *testing.T) {
+	defer func(parsers []listParser) {
+		listLineParsers = parsers
+	}(listLineParsers)
+
+	line := "CUSTOM:file.txt"
+	if _, err := ParseListLine(line); err != ErrUnsupportedListLine {
+		t.Fatalf("ParseListLine(%v) returned err = %v before registration", line, err)
+	}
+	RegisterListParser(func(line string) (*Entry, error) {
+		if !strings.HasPrefix(line, "CUSTOM:") {
+			return nil, ErrUnsupportedListLine
+		}
+		return &Entry{Name: strings.TrimPrefix(line, "CUSTOM:"), Type: EntryTypeFile}, nil
+	})
+
+	entry, err := ParseListLine(line)
+	if err != nil || entry.Name != "file.txt" {
+		t.Errorf("ParseListLine(%v) = %v, %v after registration", line, entry, err)
+	}
+	// The built-in formats are still parsed
+	if _, err = ParseListLine(listTests[0].line); err != nil {
+		t.Errorf("ParseListLine(%v) returned err = %v after registration", listTests[0].line, err)
+	}
+}
+
+func TestParseLocalizedMonth(t *testing.T) {
+	tests := []struct {
+		line  string
+		month time.Month
+	}{
+		{"-rw-r--r--   1 ftp      ftp           322 déc. 19  1996 message.ftp", time.December},
+		{"-rw-r--r--   1 ftp      ftp           322 Okt 19  1996 message.ftp", time.October},
+		{"-rw-r--r--   1 ftp      ftp           322 MRZ 19  1996 message.ftp", time.March},
+	}
+	for _, test := range tests {
+		entry, err := ParseListLine(test.line)
+		if err != nil || entry.Time.Month() != test.month {
+			t.Errorf("ParseListLine(%v) = %v, %v, want month %v", test.line, entry, err, test.month)
+		}
+	}
+
+	line := "-rw-r--r--   1 ftp      ftp           322 pro 19  1996 message.ftp"
+	if _, err := ParseListLine(line); err == nil {
+		t.Errorf("ParseListLine(%v) with unknown month succeeded", line)
+	}
+	RegisterMonthName("Pro", time.December)
+	if entry, err := ParseListLine(line); err != nil || entry.Time.Month() != time.December {
+		t.Errorf("ParseListLine(%v) = %v, %v after registration of the month", line, entry, err)
+	}
+}
+
+// locationConn lists a file in the local time of the server.
+type locationConn struct {
+	memoryConn
+	listed   time.Time
+	modified time.Time
+}
+
+func (c *locationConn) List(path string) ([]*Entry, error) {
+	return []*Entry{{Name: "file.txt", Type: EntryTypeFile, Time: c.listed}}, nil
+}
+
+func (c *locationConn) ModTime(path string) (time.Time, error) {
+	return c.modified, nil
+}
+
+func TestDetectServerLocation(t *testing.T) {
+	modified := time.Date(2020, time.March, 1, 10, 30, 12, 0, time.UTC)
+	// The server lists 12:30 in UTC+02:00, the seconds are not listed
+	conn := &locationConn{listed: time.Date(2020, time.March, 1, 12, 30, 0, 0, time.UTC), modified: modified}
+	location, err := DetectServerLocation(conn, "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := modified.In(location).Zone(); offset != 2*60*60 {
+		t.Errorf("detected offset %d s, want %d s", offset, 2*60*60)
+	}
+
+	entry, err := ParseListLineIn("-rw-r--r--   1 ftp      ftp           322 Mar 01  2020 file.txt", location)
+	if err != nil || !entry.Time.Equal(time.Date(2020, time.February, 29, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseListLineIn = %v, %v", entry, err)
+	}
+	// Times of RFC 3659 are always UTC
+	entry, err = ParseListLineIn("modify=20150813175250;type=file; welcome.msg", location)
+	if err != nil || !entry.Time.Equal(time.Date(2015, time.August, 13, 17, 52, 50, 0, time.UTC)) {
+		t.Errorf("ParseListLineIn = %v, %v", entry, err)
+	}
+	// Without a location the time is UTC
+	entry, err = ParseListLineIn("-rw-r--r--   1 ftp      ftp           322 Mar 01  2020 file.txt", nil)
+	if err != nil || !entry.Time.Equal(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseListLineIn without location = %v, %v", entry, err)
+	}
+}
+
+func TestSetTimeGuessesYear(t *testing.T) {
+	tomorrow := time.Now().Add(maxZoneDifference + 24*time.Hour)
+	e := &Entry{}
+	if err := e.SetTime([]string{tomorrow.Format("Jan"), tomorrow.Format("2"), "12:00"}); err != nil {
+		t.Fatal(err)
+	}
+	if e.Time.After(time.Now()) {
+		t.Errorf("SetTime returned %v in the future", e.Time)
+	}
+}
+
+func TestParseMachineEntry(t *testing.T) {
+	entry, err := ParseMachineEntry("Listing /pub/file.txt\n type=file;size=7;modify=20150813175250; /pub/file.txt\nEnd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "file.txt" || entry.Type != EntryTypeFile || entry.Size != 7 {
+		t.Errorf("ParseMachineEntry = %+v", entry)
+	}
+	if _, err = ParseMachineEntry("Listing /pub/file.txt\nEnd"); err == nil {
+		t.Error("ParseMachineEntry without facts succeeded")
+	}
+}
+
+func FuzzParseListLine(f *testing.F) {
+	for _, lt := range listTests {
+		f.Add(lt.line)
+	}
+	for _, lt := range listTestsFail {
+		f.Add(lt.line)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		entry, err := ParseListLine(line)
+		if err == nil && (entry == nil || entry.Name == "") {
+			t.Errorf("ParseListLine(%q) = %v without an error", line, entry)
+		}
+	})
+}
+
+func FuzzParseRFC3659ListLine(f *testing.F) {
+	for _, lt := range listTests {
+		if strings.Contains(lt.line, ";") {
+			f.Add(lt.line)
+		}
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		entry, err := parseRFC3659ListLine(line)
+		if err == nil && entry == nil {
+			t.Errorf("parseRFC3659ListLine(%q) returned neither an entry nor an error", line)
+		}
+	})
+}
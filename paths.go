@@ -0,0 +1,25 @@
+// Contains the helpers for remote paths.
+
+package ftps_qftp_client
+
+import (
+	"path"
+	"strings"
+)
+
+// JoinPath returns the remote path of remotePath relative to the remote
+// directory dir. An absolute remotePath is returned cleaned. Like at servers
+// with TVFS (RFC 3659) "/" separates the elements, repeated and trailing
+// separators are removed and "." and ".." are resolved, but not above the
+// root "/".
+func JoinPath(dir, remotePath string) string {
+	if IsAbsPath(remotePath) || dir == "" {
+		return path.Clean(remotePath)
+	}
+	return path.Join(dir, remotePath)
+}
+
+// IsAbsPath reports whether the remote path is absolute, i.e. starts with "/".
+func IsAbsPath(remotePath string) bool {
+	return strings.HasPrefix(remotePath, "/")
+}
@@ -0,0 +1,22 @@
+package ftps_qftp_client
+
+import (
+	"testing"
+)
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct{ dir, remotePath, expected string }{
+		{"/pub", "file.txt", "/pub/file.txt"},
+		{"/pub/", "sub//file.txt", "/pub/sub/file.txt"},
+		{"/pub", "../etc/./passwd", "/etc/passwd"},
+		{"/", "../..", "/"},
+		{"/pub", "/home/user/", "/home/user"},
+		{"", "sub/", "sub"},
+		{"/pub", ".", "/pub"},
+	}
+	for _, test := range tests {
+		if joined := JoinPath(test.dir, test.remotePath); joined != test.expected {
+			t.Errorf("JoinPath(%q, %q) = %q, want %q", test.dir, test.remotePath, joined, test.expected)
+		}
+	}
+}
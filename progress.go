@@ -0,0 +1,137 @@
+// Contains the progress reporting for parallel transfers.
+
+package ftps_qftp_client
+
+import (
+	"sync"
+	"time"
+)
+
+// TaskState describes the state of a TransferTask within a parallel transfer.
+type TaskState int8
+
+// The different states of a TransferTask
+const (
+	TaskPending TaskState = iota
+	TaskRunning
+	TaskSucceeded
+	TaskFailed
+)
+
+// ProgressInterval is the minimal interval between two progress reports,
+// which are caused only by transfered data. Starting and finishing tasks
+// are always reported.
+const ProgressInterval = 200 * time.Millisecond
+
+// Progress of a single task within a parallel transfer
+type TaskProgress struct {
+	Task  TransferTask
+	State TaskState
+	Bytes int64 // number of bytes transfered so far
+}
+
+// TransferProgress describes the overall progress of a parallel transfer.
+type TransferProgress struct {
+	TotalTasks     int
+	CompletedTasks int   // number of succeeded and failed tasks
+	FailedTasks    int   // number of failed tasks
+	Bytes          int64 // number of bytes transfered by all tasks so far
+	Tasks          []TaskProgress
+}
+
+// Collects the progress of the workers of a parallel transfer and reports it
+// to the callback. A nil progressTracker ignores all updates.
+type progressTracker struct {
+	mutex      sync.Mutex
+	callback   func(TransferProgress)
+	progress   TransferProgress
+	lastReport time.Time
+}
+
+// Creates a progressTracker for the tasks. If the callback is nil, the
+// progress is not tracked and nil is returned.
+func newProgressTracker(tasks []TransferTask, callback func(TransferProgress)) *progressTracker {
+	if callback == nil {
+		return nil
+	}
+	tracker := &progressTracker{callback: callback}
+	tracker.progress.TotalTasks = len(tasks)
+	tracker.progress.Tasks = make([]TaskProgress, len(tasks))
+	for i, task := range tasks {
+		tracker.progress.Tasks[i] = TaskProgress{Task: task, State: TaskPending}
+	}
+	return tracker
+}
+
+// Marks the task with the index as running.
+func (t *progressTracker) start(index int) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.progress.Tasks[index].State = TaskRunning
+	t.report(true)
+}
+
+// Adds transfered bytes to the task with the index.
+func (t *progressTracker) addBytes(index int, n int64) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.progress.Tasks[index].Bytes += n
+	t.progress.Bytes += n
+	t.report(false)
+}
+
+// Marks the task with the index as pending again for a further attempt.
+// The bytes of the failed attempt are not counted anymore.
+func (t *progressTracker) retry(index int) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	task := &t.progress.Tasks[index]
+	t.progress.Bytes -= task.Bytes
+	task.Bytes = 0
+	task.State = TaskPending
+	t.report(true)
+}
+
+// Marks the task with the index as finished according to its result.
+func (t *progressTracker) finish(index int, result TransferResult) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	task := &t.progress.Tasks[index]
+	// The result is authoritative for the number of bytes
+	t.progress.Bytes += result.Bytes - task.Bytes
+	task.Bytes = result.Bytes
+	task.State = TaskSucceeded
+	if result.Err != nil {
+		task.State = TaskFailed
+		t.progress.FailedTasks++
+	}
+	t.progress.CompletedTasks++
+	t.report(true)
+}
+
+// Calls the callback with a copy of the progress, if forced or the last report
+// is older than ProgressInterval. The caller must hold the mutex, so calls of
+// the callback are serialized.
+func (t *progressTracker) report(force bool) {
+	now := time.Now()
+	if !force && now.Sub(t.lastReport) < ProgressInterval {
+		return
+	}
+	t.lastReport = now
+	snapshot := t.progress
+	snapshot.Tasks = make([]TaskProgress, len(t.progress.Tasks))
+	copy(snapshot.Tasks, t.progress.Tasks)
+	t.callback(snapshot)
+}
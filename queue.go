@@ -0,0 +1,226 @@
+// Contains the queue, from which the workers of a parallel transfer take
+// their tasks.
+
+package ftps_qftp_client
+
+import (
+	"os"
+	"sort"
+	"sync"
+)
+
+// A task together with its position in the tasks of a Run
+type indexedTask struct {
+	index       int
+	task        TransferTask
+	size        int64  // weight of the task for balancing the workers, at least 1
+	attempts    int    // number of finished attempts to perform the task
+	lastWorker  int    // worker of the last attempt, -1 if not yet attempted
+	destination string // destination chosen by the first attempt, empty if not yet known
+}
+
+// taskQueue contains the pending tasks of a parallel transfer. Each worker has
+// its own list of tasks, which are distributed balanced by their bytes. A
+// worker takes the largest task of its list. If its list is empty, it steals
+// the largest task of the worker with the most pending bytes, so no worker is
+// idle while another one is busy with a large file and has tasks waiting.
+// Tasks with a higher priority are taken first, also from other workers.
+// Tasks failed with a transient error can be requeued, they are preferably
+// given to another worker than the one of the failed attempt.
+type taskQueue struct {
+	mutex         sync.Mutex
+	changed       *sync.Cond
+	pending       [][]indexedTask // pending tasks of each worker, sorted by decreasing priority and size
+	pendingBytes  []int64         // sum of the sizes of the pending tasks of each worker
+	running       int             // number of tasks taken and not yet finished
+	activeWorkers int             // number of workers able to take tasks
+}
+
+// Creates a queue containing the tasks for nrWorkers workers.
+func newTaskQueue(tasks []TransferTask, nrWorkers int) *taskQueue {
+	q := &taskQueue{activeWorkers: nrWorkers}
+	q.changed = sync.NewCond(&q.mutex)
+	q.pending = make([][]indexedTask, nrWorkers)
+	q.pendingBytes = make([]int64, nrWorkers)
+	if nrWorkers == 0 {
+		return q
+	}
+
+	sorted := make([]indexedTask, len(tasks))
+	for i, task := range tasks {
+		sorted[i] = indexedTask{index: i, task: task, size: taskSize(task), lastWorker: -1}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].before(sorted[j])
+	})
+	// Largest tasks first to the worker with the fewest bytes
+	for _, task := range sorted {
+		q.push(q.leastLoaded(-1), task)
+	}
+	return q
+}
+
+// Reports whether the task is to be taken before the other one.
+func (t indexedTask) before(other indexedTask) bool {
+	if t.task.Priority != other.task.Priority {
+		return t.task.Priority > other.task.Priority
+	}
+	return t.size > other.size
+}
+
+// Returns the weight of the task for balancing. Without a known size
+// each task weighs one byte.
+func taskSize(task TransferTask) int64 {
+	size := task.Size
+	if size <= 0 && task.Direction == Store {
+		if info, err := os.Stat(task.LocalPath); err == nil {
+			size = info.Size()
+		}
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// Returns the worker with the fewest pending bytes other than except.
+// The mutex has to be held or the queue not yet be shared.
+func (q *taskQueue) leastLoaded(except int) int {
+	worker := -1
+	for i, bytes := range q.pendingBytes {
+		if i != except && (worker < 0 || bytes < q.pendingBytes[worker]) {
+			worker = i
+		}
+	}
+	if worker < 0 {
+		return except
+	}
+	return worker
+}
+
+// Inserts the task into the list of the worker keeping the order.
+// The mutex has to be held or the queue not yet be shared.
+func (q *taskQueue) push(worker int, task indexedTask) {
+	list := q.pending[worker]
+	position := sort.Search(len(list), func(i int) bool {
+		return task.before(list[i])
+	})
+	list = append(list, indexedTask{})
+	copy(list[position+1:], list[position:])
+	list[position] = task
+	q.pending[worker] = list
+	q.pendingBytes[worker] += task.size
+}
+
+// Removes the task at the position from the list of the worker.
+// The mutex has to be held.
+func (q *taskQueue) remove(worker int, position int) indexedTask {
+	task := q.pending[worker][position]
+	q.pending[worker] = append(q.pending[worker][:position], q.pending[worker][position+1:]...)
+	q.pendingBytes[worker] -= task.size
+	q.running++
+	return task
+}
+
+// Returns the position of the largest task in the list of the owner, which
+// the worker may take, or -1 if there is none. Tasks failed at the worker are
+// left to the others, if there are others.
+func (q *taskQueue) takeable(owner int, worker int) int {
+	for i, task := range q.pending[owner] {
+		if task.lastWorker != worker || q.activeWorkers <= 1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// Takes the next task for the worker, from its own list or stolen from the
+// worker with the most pending bytes, if it has none or the other one has a
+// task with a higher priority. It blocks while only tasks, which could be
+// requeued, are running. It returns false if all tasks are finished.
+func (q *taskQueue) next(worker int) (indexedTask, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for {
+		if q.pendingTasks() == 0 && q.running == 0 {
+			return indexedTask{}, false
+		}
+
+		owner, ownerPosition := -1, -1
+		if position := q.takeable(worker, worker); position >= 0 {
+			owner, ownerPosition = worker, position
+		}
+		for other := range q.pending {
+			if other == worker {
+				continue
+			}
+			position := q.takeable(other, worker)
+			if position < 0 {
+				continue
+			}
+			if owner < 0 {
+				owner, ownerPosition = other, position
+				continue
+			}
+			priority := q.pending[other][position].task.Priority
+			ownerPriority := q.pending[owner][ownerPosition].task.Priority
+			if priority > ownerPriority ||
+				(priority == ownerPriority && owner != worker && q.pendingBytes[other] > q.pendingBytes[owner]) {
+				owner, ownerPosition = other, position
+			}
+		}
+		if owner >= 0 {
+			return q.remove(owner, ownerPosition), true
+		}
+		q.changed.Wait()
+	}
+}
+
+// Returns the number of pending tasks of all workers. The mutex has to be held.
+func (q *taskQueue) pendingTasks() int {
+	count := 0
+	for _, list := range q.pending {
+		count += len(list)
+	}
+	return count
+}
+
+// Marks a task taken with next as finished.
+func (q *taskQueue) done() {
+	q.mutex.Lock()
+	q.running--
+	q.mutex.Unlock()
+	q.changed.Broadcast()
+}
+
+// Puts a task taken with next back into the queue for a further attempt.
+// It is given to the least loaded worker other than the one of the last attempt.
+func (q *taskQueue) requeue(task indexedTask) {
+	q.mutex.Lock()
+	q.running--
+	q.push(q.leastLoaded(task.lastWorker), task)
+	q.mutex.Unlock()
+	q.changed.Broadcast()
+}
+
+// Removes a worker, which does not take further tasks.
+// Its pending tasks are left to be stolen by the others.
+func (q *taskQueue) leave() {
+	q.mutex.Lock()
+	q.activeWorkers--
+	q.mutex.Unlock()
+	q.changed.Broadcast()
+}
+
+// Removes and returns all pending tasks.
+func (q *taskQueue) drain() []indexedTask {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var left []indexedTask
+	for worker, list := range q.pending {
+		left = append(left, list...)
+		q.pending[worker] = nil
+		q.pendingBytes[worker] = 0
+	}
+	return left
+}
@@ -0,0 +1,87 @@
+package ftps_qftp_client
+
+import (
+	"testing"
+)
+
+func TestTaskQueueBalancesBytes(t *testing.T) {
+	tasks := []TransferTask{
+		{RemotePath: "small1", Direction: Retrieve, Size: 10},
+		{RemotePath: "large", Direction: Retrieve, Size: 10000},
+		{RemotePath: "small2", Direction: Retrieve, Size: 20},
+		{RemotePath: "medium", Direction: Retrieve, Size: 5000},
+		{RemotePath: "small3", Direction: Retrieve, Size: 30},
+	}
+	queue := newTaskQueue(tasks, 2)
+
+	// The large file alone outweighs all others
+	first, _ := queue.next(0)
+	if first.task.RemotePath != "large" {
+		t.Fatalf("worker 0 took %s first, want large", first.task.RemotePath)
+	}
+	var taken []string
+	for i := 0; i < 4; i++ {
+		next, available := queue.next(1)
+		if !available {
+			t.Fatal("queue empty before all tasks were taken")
+		}
+		taken = append(taken, next.task.RemotePath)
+		queue.done()
+	}
+	expected := []string{"medium", "small3", "small2", "small1"}
+	for i := range expected {
+		if taken[i] != expected[i] {
+			t.Fatalf("worker 1 took %v, want %v", taken, expected)
+		}
+	}
+	queue.done()
+	if _, available := queue.next(0); available {
+		t.Error("queue returned a task after all were finished")
+	}
+}
+
+func TestTaskQueueSteal(t *testing.T) {
+	tasks := []TransferTask{
+		{RemotePath: "a", Direction: Retrieve, Size: 100},
+		{RemotePath: "b", Direction: Retrieve, Size: 100},
+		{RemotePath: "c", Direction: Retrieve, Size: 90},
+		{RemotePath: "d", Direction: Retrieve, Size: 90},
+	}
+	queue := newTaskQueue(tasks, 2)
+
+	// Worker 1 never connects, worker 0 steals its tasks
+	queue.leave()
+	for i := 0; i < len(tasks); i++ {
+		if _, available := queue.next(0); !available {
+			t.Fatalf("only %d of %d tasks taken", i, len(tasks))
+		}
+		queue.done()
+	}
+	if left := queue.drain(); len(left) != 0 {
+		t.Errorf("%d tasks left", len(left))
+	}
+}
+
+func TestTaskQueuePriority(t *testing.T) {
+	tasks := []TransferTask{
+		{RemotePath: "bulk1", Direction: Retrieve, Size: 1000},
+		{RemotePath: "bulk2", Direction: Retrieve, Size: 1000},
+		{RemotePath: "bulk3", Direction: Retrieve, Size: 1000},
+		{RemotePath: "critical", Direction: Retrieve, Size: 10, Priority: 1},
+	}
+	queue := newTaskQueue(tasks, 2)
+
+	// The critical task is taken first, by whichever worker asks first
+	next, _ := queue.next(1)
+	if next.task.RemotePath != "critical" {
+		t.Errorf("took %s first, want critical", next.task.RemotePath)
+	}
+
+	// In the list of the other worker it is preferred to the own bulk files
+	queue.running--
+	queue.push(0, next)
+	next, _ = queue.next(1)
+	if next.task.RemotePath != "critical" {
+		t.Errorf("took %s from the other worker, want critical", next.task.RemotePath)
+	}
+}
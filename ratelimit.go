@@ -0,0 +1,192 @@
+// Contains the limitation of the bandwidth of transfers.
+
+package ftps_qftp_client
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateWindow limits the bandwidth daily between two times of day.
+type RateWindow struct {
+	// Start and end as time since midnight in the local time zone. A window
+	// with End before Start lasts over midnight, e.g. from 22:00 to 06:00.
+	Start time.Duration
+	End   time.Duration
+	// Maximal bandwidth in bytes per second, 0 for no limit
+	Limit int64
+}
+
+// RateSchedule limits the bandwidth of transfers depending on the time of
+// day, e.g. throttled during business hours and with full bandwidth at
+// night. The limit of a running transfer changes, when a window starts or
+// ends.
+type RateSchedule struct {
+	// The first window containing the time of day applies
+	Windows []RateWindow
+	// Maximal bandwidth outside of the windows, 0 for no limit
+	Default int64
+}
+
+// Limit returns the bandwidth in bytes per second at the time, 0 for no
+// limit. A nil schedule has no limit.
+func (s *RateSchedule) Limit(t time.Time) int64 {
+	if s == nil {
+		return 0
+	}
+	t = t.Local()
+	timeOfDay := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	for _, window := range s.Windows {
+		if window.Start <= window.End && timeOfDay >= window.Start && timeOfDay < window.End ||
+			window.Start > window.End && (timeOfDay >= window.Start || timeOfDay < window.End) {
+			return window.Limit
+		}
+	}
+	return s.Default
+}
+
+// ParseRateSchedule parses a schedule of windows like "08:00-18:00=512K"
+// separated by commas. A rate without window, e.g. "08:00-18:00=512K,4M",
+// is the default outside of the windows. The rates are bytes per second with
+// the optional binary suffixes K, M and G, 0 for no limit.
+func ParseRateSchedule(text string) (*RateSchedule, error) {
+	schedule := &RateSchedule{}
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		equals := strings.Index(part, "=")
+		if equals < 0 {
+			limit, err := parseRate(part)
+			if err != nil {
+				return nil, err
+			}
+			schedule.Default = limit
+			continue
+		}
+		times := strings.SplitN(part[:equals], "-", 2)
+		if len(times) != 2 {
+			return nil, errors.New("The window " + part[:equals] + " is no range like 08:00-18:00.")
+		}
+		var window RateWindow
+		var err error
+		if window.Start, err = parseTimeOfDay(times[0]); err != nil {
+			return nil, err
+		}
+		if window.End, err = parseTimeOfDay(times[1]); err != nil {
+			return nil, err
+		}
+		if window.Limit, err = parseRate(part[equals+1:]); err != nil {
+			return nil, err
+		}
+		schedule.Windows = append(schedule.Windows, window)
+	}
+	return schedule, nil
+}
+
+// Parses a time of day like "08:00" or "24:00".
+func parseTimeOfDay(text string) (time.Duration, error) {
+	fields := strings.Split(strings.TrimSpace(text), ":")
+	if len(fields) == 2 {
+		hours, errHours := strconv.Atoi(fields[0])
+		minutes, errMinutes := strconv.Atoi(fields[1])
+		if errHours == nil && errMinutes == nil && hours >= 0 && minutes >= 0 && minutes < 60 &&
+			hours*60+minutes <= 24*60 {
+			return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+		}
+	}
+	return 0, errors.New(text + " is no time of day like 08:00.")
+}
+
+// Parses a rate in bytes per second with an optional suffix K, M or G.
+func parseRate(original string) (int64, error) {
+	text := strings.TrimSpace(original)
+	factor := int64(1)
+	if text != "" {
+		switch strings.ToUpper(text[len(text)-1:]) {
+		case "K":
+			factor = 1 << 10
+		case "M":
+			factor = 1 << 20
+		case "G":
+			factor = 1 << 30
+		}
+		if factor != 1 {
+			text = text[:len(text)-1]
+		}
+	}
+	rate, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || rate < 0 {
+		return 0, errors.New(original + " is no rate in bytes per second like 512K.")
+	}
+	return rate * factor, nil
+}
+
+// Reads from the underlying reader with at most limit bytes per second.
+type rateLimitedReader struct {
+	reader   io.Reader
+	limit    int64         // bytes per second
+	schedule *RateSchedule // changes the limit with the time of day, nil for a fixed limit
+	start    time.Time
+	count    int64
+}
+
+// Wraps the reader into a rateLimitedReader, if the limit is positive.
+func limitRate(reader io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return reader
+	}
+	return &rateLimitedReader{reader: reader, limit: limit}
+}
+
+// Wraps the reader into a rateLimitedReader with the RateSchedule of the
+// task or, without one, with its RateLimit.
+func limitTaskRate(reader io.Reader, task TransferTask) io.Reader {
+	if task.RateSchedule != nil {
+		return &rateLimitedReader{reader: reader, schedule: task.RateSchedule}
+	}
+	return limitRate(reader, task.RateLimit)
+}
+
+// Read implements the io.Reader interface. It reads at most the bytes of a
+// tenth of a second, so the transfer is smooth, and sleeps till the average
+// rate since the first read is not above the limit. With a schedule the
+// average is measured again from the change of the limit on.
+func (r *rateLimitedReader) Read(buf []byte) (int, error) {
+	if r.schedule != nil {
+		if limit := r.schedule.Limit(time.Now()); limit != r.limit {
+			r.limit, r.start, r.count = limit, time.Time{}, 0
+		}
+		if r.limit <= 0 {
+			return r.reader.Read(buf)
+		}
+	}
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	chunk := r.limit / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+	if int64(len(buf)) > chunk {
+		buf = buf[:chunk]
+	}
+	n, err := r.reader.Read(buf)
+	r.count += int64(n)
+
+	if wait := r.expected() - time.Since(r.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// Returns the duration, in which the bytes read so far are transfered with
+// the limit. Whole seconds and the rest are computed separately, as
+// count * time.Second overflows int64 after about 9.2 GB.
+func (r *rateLimitedReader) expected() time.Duration {
+	seconds := r.count / r.limit
+	rest := r.count % r.limit
+	return time.Duration(seconds)*time.Second + time.Duration(rest*int64(time.Second)/r.limit)
+}
@@ -0,0 +1,104 @@
+package ftps_qftp_client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedReader(t *testing.T) {
+	data := make([]byte, 3000)
+	start := time.Now()
+	read, err := ioutil.ReadAll(limitRate(bytes.NewReader(data), 10000))
+	elapsed := time.Since(start)
+	if err != nil || len(read) != len(data) {
+		t.Fatalf("read %d bytes, %v", len(read), err)
+	}
+	if elapsed < 250*time.Millisecond {
+		t.Errorf("read 3000 bytes with 10000 bytes/s in %v", elapsed)
+	}
+}
+
+func TestRateLimitedReaderLargeCount(t *testing.T) {
+	r := &rateLimitedReader{limit: 1000000, count: 20000000000}
+	if expected := r.expected(); expected != 20000*time.Second {
+		t.Errorf("20 GB with 1 MB/s expected to take %v, want %v", expected, 20000*time.Second)
+	}
+}
+
+func TestParseRateSchedule(t *testing.T) {
+	schedule, err := ParseRateSchedule("08:00-18:00=512K, 22:00-06:00=0,4M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RateWindow{
+		{Start: 8 * time.Hour, End: 18 * time.Hour, Limit: 512 << 10},
+		{Start: 22 * time.Hour, End: 6 * time.Hour, Limit: 0},
+	}
+	if len(schedule.Windows) != len(want) || schedule.Windows[0] != want[0] || schedule.Windows[1] != want[1] {
+		t.Errorf("windows %v, want %v", schedule.Windows, want)
+	}
+	if schedule.Default != 4<<20 {
+		t.Errorf("default %d, want %d", schedule.Default, 4<<20)
+	}
+
+	for _, text := range []string{"08:00=1K", "8-18=1K", "08:00-25:00=1K", "08:00-18:00=fast", "-1"} {
+		if _, err = ParseRateSchedule(text); err == nil {
+			t.Errorf("%q parsed", text)
+		}
+	}
+}
+
+func TestRateScheduleLimit(t *testing.T) {
+	schedule, err := ParseRateSchedule("08:00-18:00=1K,22:00-06:00=0,2K")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2020, 5, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		at   time.Duration
+		want int64
+	}{
+		{8 * time.Hour, 1024},
+		{17*time.Hour + 59*time.Minute, 1024},
+		{18 * time.Hour, 2048},
+		{23 * time.Hour, 0},
+		{2 * time.Hour, 0},
+		{6 * time.Hour, 2048},
+	}
+	for _, test := range tests {
+		if limit := schedule.Limit(day.Add(test.at)); limit != test.want {
+			t.Errorf("limit at %v is %d, want %d", test.at, limit, test.want)
+		}
+	}
+	if limit := (*RateSchedule)(nil).Limit(day); limit != 0 {
+		t.Errorf("nil schedule has the limit %d", limit)
+	}
+}
+
+func TestRateLimitedReaderSchedule(t *testing.T) {
+	data := make([]byte, 3000)
+	task := NewTransferTask(Store, "local.txt", "remote.txt")
+	task.RateLimit = 1
+	task.RateSchedule = &RateSchedule{Default: 10000}
+	start := time.Now()
+	read, err := ioutil.ReadAll(limitTaskRate(bytes.NewReader(data), task))
+	elapsed := time.Since(start)
+	if err != nil || len(read) != len(data) {
+		t.Fatalf("read %d bytes, %v", len(read), err)
+	}
+	if elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("read 3000 bytes with 10000 bytes/s of the schedule in %v", elapsed)
+	}
+
+	// Without a limit at the time the data is read at full speed
+	task.RateSchedule = &RateSchedule{}
+	start = time.Now()
+	if _, err = ioutil.ReadAll(limitTaskRate(bytes.NewReader(make([]byte, 1<<20)), task)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed = time.Since(start); elapsed > time.Second {
+		t.Errorf("read without limit in %v", elapsed)
+	}
+}
@@ -0,0 +1,72 @@
+// Contains the accounting of the data received by the readers of Retr and RetrFrom.
+
+package ftps_qftp_client
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// ReceiveState tells how the data of a retrieved file ended.
+type ReceiveState int32
+
+const (
+	ReceiveRunning  = ReceiveState(0) // the data is still received
+	ReceiveFinished = ReceiveState(1) // the server finished sending the data
+	ReceiveReset    = ReceiveState(2) // the data connection was reset or closed before the end of the data
+)
+
+// ReceiveProgress is implemented by the readers returned by Retr and RetrFrom
+// of both clients. After a cancelled or failed transfer it tells, how many
+// bytes were received, so the transfer can be resumed at the offset of the
+// retrieve plus BytesReceived.
+type ReceiveProgress interface {
+	// BytesReceived returns the number of bytes returned by Read so far.
+	BytesReceived() int64
+	// ReceiveState returns, whether the data is finished or was reset.
+	ReceiveState() ReceiveState
+}
+
+// SizedReader is implemented by the readers of Retr and RetrFrom of both
+// clients. If the connection requests the size of files before retrieving
+// them (SetRetrSize), Size returns the number of bytes the server will send,
+// e.g. to preallocate the local file or to show the progress in percent.
+// Otherwise and if the server doesn't support SIZE it returns -1.
+type SizedReader interface {
+	Size() int64
+}
+
+// ReceiveCounter implements ReceiveProgress for the data readers of the
+// clients. Its methods can be called from several goroutines, e.g. while a
+// transfer is cancelled.
+type ReceiveCounter struct {
+	received int64 // accessed atomically
+	state    int32 // ReceiveState, accessed atomically
+}
+
+// Count records the result of a Read or a WriteTo of the data. A Read failing with another
+// error than io.EOF marks the data as reset.
+func (c *ReceiveCounter) Count(n int64, err error) {
+	atomic.AddInt64(&c.received, n)
+	if err == io.EOF {
+		atomic.CompareAndSwapInt32(&c.state, int32(ReceiveRunning), int32(ReceiveFinished))
+	} else if err != nil {
+		atomic.CompareAndSwapInt32(&c.state, int32(ReceiveRunning), int32(ReceiveReset))
+	}
+}
+
+// Interrupt marks the data as reset, if it is not yet finished. It is called
+// when the reader is closed.
+func (c *ReceiveCounter) Interrupt() {
+	atomic.CompareAndSwapInt32(&c.state, int32(ReceiveRunning), int32(ReceiveReset))
+}
+
+// BytesReceived implements the ReceiveProgress interface.
+func (c *ReceiveCounter) BytesReceived() int64 {
+	return atomic.LoadInt64(&c.received)
+}
+
+// ReceiveState implements the ReceiveProgress interface.
+func (c *ReceiveCounter) ReceiveState() ReceiveState {
+	return ReceiveState(atomic.LoadInt32(&c.state))
+}
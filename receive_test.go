@@ -0,0 +1,35 @@
+package ftps_qftp_client
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReceiveCounter(t *testing.T) {
+	var finished ReceiveCounter
+	finished.Count(10, nil)
+	finished.Count(5, io.EOF)
+	finished.Interrupt()
+	if finished.BytesReceived() != 15 || finished.ReceiveState() != ReceiveFinished {
+		t.Errorf("Finished data: %d bytes, state %d", finished.BytesReceived(), finished.ReceiveState())
+	}
+
+	var reset ReceiveCounter
+	reset.Count(10, nil)
+	if reset.ReceiveState() != ReceiveRunning {
+		t.Errorf("Running data has state %d", reset.ReceiveState())
+	}
+	reset.Count(3, errors.New("connection reset by peer"))
+	reset.Count(0, io.EOF)
+	if reset.BytesReceived() != 13 || reset.ReceiveState() != ReceiveReset {
+		t.Errorf("Reset data: %d bytes, state %d", reset.BytesReceived(), reset.ReceiveState())
+	}
+
+	var closed ReceiveCounter
+	closed.Count(7, nil)
+	closed.Interrupt()
+	if closed.BytesReceived() != 7 || closed.ReceiveState() != ReceiveReset {
+		t.Errorf("Closed data: %d bytes, state %d", closed.BytesReceived(), closed.ReceiveState())
+	}
+}
@@ -0,0 +1,58 @@
+// Contains the parsing of recursive directory listings returned by "LIST -R".
+
+package ftps_qftp_client
+
+import (
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// PathEntry is an entry of a recursive listing together with its path.
+type PathEntry struct {
+	Path  string // path of the entry joined with the listed directory
+	Entry *Entry
+}
+
+// ParseRecursiveListing parses the output of "LIST -R root" like the one of
+// "ls -lR". The listing of each subdirectory is introduced by a line with its
+// path and a colon, e.g. "./pub/sub:". It returns the entries of the whole
+// tree with their paths, which start with root. Local times of the server are
+// interpreted in the location and lines up to maxLineLength bytes are read,
+// see NewLineScanner.
+func ParseRecursiveListing(reader io.Reader, root string, location *time.Location, maxLineLength int) ([]*PathEntry, error) {
+	var entries []*PathEntry
+	dir := root
+	scanner := NewLineScanner(reader, maxLineLength)
+	for scanner.Scan() {
+		line := scanner.Text()
+		entry, err := ParseListLineIn(line, location)
+		if err == nil {
+			if entry.Name != "." && entry.Name != ".." {
+				entries = append(entries, &PathEntry{Path: path.Join(dir, entry.Name), Entry: entry})
+			}
+			continue
+		}
+		if strings.HasSuffix(line, ":") {
+			dir = recursiveListingDir(root, strings.TrimSuffix(line, ":"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Returns the path of the directory of a header of a recursive listing.
+// Servers list the directories relative to the listed one starting with "."
+// or like the listed one relative to the current directory or absolute.
+func recursiveListingDir(root string, header string) string {
+	switch {
+	case header == ".":
+		return root
+	case strings.HasPrefix(header, "./"):
+		return path.Join(root, header[2:])
+	}
+	return header
+}
@@ -0,0 +1,47 @@
+package ftps_qftp_client
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecursiveListing(t *testing.T) {
+	tests := []struct {
+		root    string
+		listing string
+	}{
+		{"pub", "total 2\n" +
+			"drwxr-xr-x    3 110      1002            3 Dec 02  2009 sub\n" +
+			"-rw-r--r--    1 110      1002           10 Dec 02  2009 a.txt\n" +
+			"\n" +
+			"./sub:\n" +
+			"total 1\n" +
+			"-rw-r--r--    1 110      1002           20 Dec 02  2009 b.txt\n"},
+		{"pub", "pub:\n" +
+			"drwxr-xr-x    3 110      1002            3 Dec 02  2009 sub\n" +
+			"-rw-r--r--    1 110      1002           10 Dec 02  2009 a.txt\n" +
+			"\n" +
+			"pub/sub:\n" +
+			"-rw-r--r--    1 110      1002           20 Dec 02  2009 b.txt\n"},
+	}
+	expected := []string{"pub/sub", "pub/a.txt", "pub/sub/b.txt"}
+	for _, test := range tests {
+		entries, err := ParseRecursiveListing(strings.NewReader(test.listing), test.root, time.UTC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != len(expected) {
+			t.Errorf("parsed %d entries, want %d", len(entries), len(expected))
+			continue
+		}
+		for i, entry := range entries {
+			if entry.Path != expected[i] {
+				t.Errorf("entry %d has path %s, want %s", i, entry.Path, expected[i])
+			}
+		}
+		if entries[2].Entry.Size != 20 {
+			t.Errorf("b.txt has size %d, want 20", entries[2].Entry.Size)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Contains helpers for files and directories on the server.
+
+package ftps_qftp_client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Exists reports whether a file or a directory exists at the remote path.
+// It uses MLST, if the server supports it. Otherwise files are probed with
+// SIZE, if the server supports it, or by listing them and directories by
+// changing into them. Errors other than the refusal of a missing path with
+// 550 are returned.
+func Exists(conn ConnectionI, remotePath string) (bool, error) {
+	capabilities := conn.Capabilities()
+	if capabilities.MLST {
+		_, err := conn.MachineEntry(remotePath)
+		if err != nil {
+			if isNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	if capabilities.Size {
+		// SIZE is refused with 550 for directories, too
+		_, err := conn.FileSize(remotePath)
+		if err == nil {
+			return true, nil
+		}
+		if !isNotFound(err) {
+			return false, err
+		}
+	} else if _, exists := remoteFileSize(conn, remotePath); exists {
+		return true, nil
+	}
+	return isRemoteDir(conn, remotePath)
+}
+
+// Stat returns the entry of the remote file or directory, e.g. to get its
+// os.FileInfo with Entry.FileInfo. It uses MLST, if the server supports it,
+// otherwise the parent directory is listed and the entry taken from it. A
+// missing path is reported like by the server as error with code 550.
+func Stat(conn ConnectionI, remotePath string) (*Entry, error) {
+	if conn.Capabilities().MLST {
+		return conn.MachineEntry(remotePath)
+	}
+
+	remotePath = path.Clean(remotePath)
+	name := path.Base(remotePath)
+	if name == "/" || name == "." || name == ".." {
+		// Not contained in the listing of a parent
+		isDir, err := isRemoteDir(conn, remotePath)
+		if err != nil {
+			return nil, err
+		}
+		if !isDir {
+			return nil, &textproto.Error{Code: 550, Msg: remotePath + ": No such file or directory."}
+		}
+		return &Entry{Name: name, Type: EntryTypeFolder}, nil
+	}
+	entries, err := listDir(conn, path.Dir(remotePath))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			return entry, nil
+		}
+	}
+	return nil, &textproto.Error{Code: 550, Msg: remotePath + ": No such file or directory."}
+}
+
+// MkdirAll creates the remote directory with all missing parents, like
+// "mkdir -p". Existing directories are kept.
+func MkdirAll(conn ConnectionI, remotePath string) error {
+	remotePath = path.Clean(remotePath)
+	isDir, err := isRemoteDir(conn, remotePath)
+	if err != nil || isDir {
+		return err
+	}
+
+	parent := path.Dir(remotePath)
+	if parent != remotePath {
+		if err = MkdirAll(conn, parent); err != nil {
+			return err
+		}
+	}
+	err = conn.MakeDir(remotePath)
+	if err != nil {
+		// Maybe created meanwhile by another connection
+		if isDir, _ := isRemoteDir(conn, remotePath); isDir {
+			return nil
+		}
+		return errors.New("Error while creating the remote directory " + remotePath + ". " + err.Error())
+	}
+	return nil
+}
+
+// Copy copies a remote file by streaming its retrieval on the source connection
+// into a store on the destination connection, so the data is not written to
+// a local file. The connections must differ, they may belong to the same or
+// to different servers.
+func Copy(source ConnectionI, sourcePath string, destination ConnectionI, destinationPath string) error {
+	if source == destination {
+		return errors.New("Copy of " + sourcePath + " needs two different connections.")
+	}
+	reader, err := source.Retr(sourcePath)
+	if err != nil {
+		return errors.New("Error while retrieving " + sourcePath + " for the copy. " + err.Error())
+	}
+	err = destination.Stor(destinationPath, reader)
+	closeErr := reader.Close()
+	if err != nil {
+		return errors.New("Error while storing the copy of " + sourcePath + " to " + destinationPath + ". " + err.Error())
+	}
+	if closeErr != nil {
+		return errors.New("Error while retrieving " + sourcePath + " for the copy. " + closeErr.Error())
+	}
+	return nil
+}
+
+// Touch sets the time of the last modification of the remote file to the
+// current time with MFMT, if the server supports it. A missing file is created
+// empty. Without MFMT zero bytes are stored behind the end of an existing file
+// with REST, which keeps its content and updates its time at most servers.
+func Touch(conn ConnectionI, remotePath string) error {
+	size, exists := remoteFileSize(conn, remotePath)
+	if !exists {
+		return conn.Stor(remotePath, bytes.NewReader(nil))
+	}
+	if conn.Capabilities().MFMT {
+		return conn.SetModTime(remotePath, time.Now())
+	}
+	return conn.StorFrom(remotePath, bytes.NewReader(nil), uint64(size))
+}
+
+// Truncate changes the size of the remote file. A larger size is filled with
+// zeros stored behind the end of the file with REST. STOR with REST does not
+// shorten the file at most servers, so for a smaller size the bytes to keep
+// are retrieved into a temporary file and stored again.
+func Truncate(conn ConnectionI, remotePath string, size int64) error {
+	if size < 0 {
+		return errors.New("Negative size " + strconv.FormatInt(size, 10) + " for " + remotePath + ".")
+	}
+	currentSize, exists := remoteFileSize(conn, remotePath)
+	if !exists {
+		return errors.New("Remote file " + remotePath + " does not exist.")
+	}
+	switch {
+	case size == currentSize:
+		return nil
+	case size > currentSize:
+		return conn.StorFrom(remotePath, io.LimitReader(zeroReader{}, size-currentSize), uint64(currentSize))
+	case size == 0:
+		return conn.Stor(remotePath, bytes.NewReader(nil))
+	}
+
+	temp, err := ioutil.TempFile("", "truncate")
+	if err != nil {
+		return errors.New("Error while creating a temporary file. " + err.Error())
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	reader, err := conn.Retr(remotePath)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(temp, reader, size)
+	if err == nil {
+		// The rest is read, so the transfer ends regularly
+		_, err = io.Copy(ioutil.Discard, reader)
+	}
+	closeErr := reader.Close()
+	if err != nil {
+		return errors.New("Error while retrieving " + remotePath + " for the truncation. " + err.Error())
+	}
+	if closeErr != nil {
+		return errors.New("Error while retrieving " + remotePath + " for the truncation. " + closeErr.Error())
+	}
+	if _, err = temp.Seek(0, io.SeekStart); err != nil {
+		return errors.New("Error while reading the temporary file. " + err.Error())
+	}
+	return conn.Stor(remotePath, temp)
+}
+
+// Reader returning an endless stream of zeros
+type zeroReader struct{}
+
+// Read implements the io.Reader interface.
+func (zeroReader) Read(buf []byte) (int, error) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	return len(buf), nil
+}
@@ -0,0 +1,197 @@
+package ftps_qftp_client
+
+import (
+	"net/textproto"
+	"path"
+	"testing"
+)
+
+func TestExists(t *testing.T) {
+	server := newMemoryServer()
+	server.dirs["/pub"] = true
+	server.files["/pub/file.txt"] = []byte("content")
+	conn := &memoryConn{server: server}
+
+	tests := map[string]bool{
+		"/pub":          true,
+		"/pub/file.txt": true,
+		"/pub/missing":  false,
+		"/missing/file": false,
+	}
+	for remotePath, expected := range tests {
+		exists, err := Exists(conn, remotePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != expected {
+			t.Errorf("Exists(%s) = %v, want %v", remotePath, exists, expected)
+		}
+	}
+}
+
+// mlstConn probes paths only with MLST.
+type mlstConn struct {
+	memoryConn
+}
+
+func (c *mlstConn) Capabilities() Capabilities {
+	return Capabilities{MLST: true}
+}
+
+func (c *mlstConn) ChangeDir(dir string) error {
+	panic("CWD used although MLST is supported")
+}
+
+func (c *mlstConn) MachineEntry(remotePath string) (*Entry, error) {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	if remotePath == "/denied" {
+		return nil, &textproto.Error{Code: 530, Msg: "Not logged in."}
+	}
+	if data, available := c.server.files[remotePath]; available {
+		return &Entry{Name: path.Base(remotePath), Type: EntryTypeFile, Size: uint64(len(data))}, nil
+	}
+	if c.server.dirs[remotePath] {
+		return &Entry{Name: path.Base(remotePath), Type: EntryTypeFolder}, nil
+	}
+	return nil, &textproto.Error{Code: 550, Msg: "No such file or directory."}
+}
+
+func TestExistsMLST(t *testing.T) {
+	server := newMemoryServer()
+	server.dirs["/pub"] = true
+	server.files["/pub/file.txt"] = []byte("content")
+	conn := &mlstConn{memoryConn{server: server}}
+
+	tests := map[string]bool{
+		"/pub":          true,
+		"/pub/file.txt": true,
+		"/pub/missing":  false,
+	}
+	for remotePath, expected := range tests {
+		exists, err := Exists(conn, remotePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != expected {
+			t.Errorf("Exists(%s) = %v, want %v", remotePath, exists, expected)
+		}
+	}
+	// Only a missing path is reported as not existing
+	if _, err := Exists(conn, "/denied"); err == nil {
+		t.Error("Exists hid the error of MLST")
+	}
+}
+
+func TestMkdirAll(t *testing.T) {
+	server := newMemoryServer()
+	server.dirs["/pub"] = true
+	conn := &memoryConn{server: server}
+
+	if err := MkdirAll(conn, "/pub/a/b/c/"); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"/pub/a", "/pub/a/b", "/pub/a/b/c"} {
+		if !server.dirs[dir] {
+			t.Errorf("directory %s not created", dir)
+		}
+	}
+	// Existing directories are kept
+	if err := MkdirAll(conn, "/pub/a/b"); err != nil {
+		t.Error(err)
+	}
+
+	server.files["/pub/file"] = []byte("content")
+	if err := MkdirAll(conn, "/pub/file/sub"); err == nil {
+		t.Error("MkdirAll below a file succeeded")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	source := newMemoryServer()
+	source.files["/pub/file.txt"] = []byte("content")
+	destination := newMemoryServer()
+
+	err := Copy(&memoryConn{server: source}, "/pub/file.txt", &memoryConn{server: destination}, "/copy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(destination.files["/copy.txt"]) != "content" {
+		t.Errorf("copied %q", destination.files["/copy.txt"])
+	}
+
+	if err = Copy(&memoryConn{server: source}, "/missing", &memoryConn{server: destination}, "/copy2.txt"); err == nil {
+		t.Error("Copy of a missing file succeeded")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	server := newMemoryServer()
+	server.files["/pub/file.txt"] = []byte("content")
+	conn := &memoryConn{server: server}
+
+	if err := Touch(conn, "/pub/lock"); err != nil {
+		t.Fatal(err)
+	}
+	if data, available := server.files["/pub/lock"]; !available || len(data) != 0 {
+		t.Errorf("touched file contains %q, %v", data, available)
+	}
+	if err := Touch(conn, "/pub/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if string(server.files["/pub/file.txt"]) != "content" {
+		t.Errorf("touched file changed to %q", server.files["/pub/file.txt"])
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	server := newMemoryServer()
+	server.files["/pub/file.txt"] = []byte("content")
+	conn := &memoryConn{server: server}
+
+	tests := []struct {
+		size    int64
+		content string
+	}{
+		{9, "content\x00\x00"},
+		{4, "cont"},
+		{4, "cont"},
+		{0, ""},
+	}
+	for _, test := range tests {
+		if err := Truncate(conn, "/pub/file.txt", test.size); err != nil {
+			t.Fatal(err)
+		}
+		if string(server.files["/pub/file.txt"]) != test.content {
+			t.Errorf("truncated to %d: %q, want %q", test.size, server.files["/pub/file.txt"], test.content)
+		}
+	}
+	if err := Truncate(conn, "/pub/missing", 0); err == nil {
+		t.Error("Truncate of a missing file succeeded")
+	}
+}
+
+func TestStat(t *testing.T) {
+	server := newMemoryServer()
+	server.dirs["/"] = true
+	server.dirs["/pub"] = true
+	server.files["/pub/file.txt"] = []byte("content")
+
+	for _, conn := range []ConnectionI{&memoryConn{server: server}, &mlstConn{memoryConn{server: server}}} {
+		entry, err := Stat(conn, "/pub/file.txt")
+		if err != nil || entry.Name != "file.txt" || entry.Type != EntryTypeFile || entry.Size != 7 {
+			t.Errorf("Stat(/pub/file.txt) = %+v, %v", entry, err)
+		}
+		entry, err = Stat(conn, "/pub")
+		if err != nil || entry.Name != "pub" || !entry.IsDir() {
+			t.Errorf("Stat(/pub) = %+v, %v", entry, err)
+		}
+		if _, err = Stat(conn, "/pub/missing"); !isNotFound(err) {
+			t.Errorf("Stat of a missing file returned %v", err)
+		}
+	}
+	entry, err := Stat(&memoryConn{server: server}, "/")
+	if err != nil || !entry.IsDir() {
+		t.Errorf("Stat(/) = %+v, %v", entry, err)
+	}
+}
@@ -0,0 +1,166 @@
+package ftps_qftp_client
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response is a complete reply of the server to a command.
+type Response struct {
+	Code     int
+	Message  string        // text of the reply without the codes, lines separated by "\n"
+	Lines    []string      // lines of the reply as sent by the server
+	Duration time.Duration // time between sending the command and receiving the reply
+}
+
+// String returns the reply as sent by the server.
+func (r *Response) String() string {
+	return strings.Join(r.Lines, "\n")
+}
+
+// Body returns the lines of a multiline reply between its first and its last
+// line, e.g. the features in the reply 211 to FEAT or the commands in the
+// reply 214 to HELP. The lines are returned without their leading space.
+func (r *Response) Body() []string {
+	if len(r.Lines) < 3 {
+		return nil
+	}
+	body := make([]string, 0, len(r.Lines)-2)
+	for _, line := range r.Lines[1 : len(r.Lines)-1] {
+		if len(line) >= 4 && strings.HasPrefix(line, r.Lines[0][:3]) && (line[3] == '-' || line[3] == ' ') {
+			// Some servers repeat the code in each line
+			line = line[4:]
+		}
+		body = append(body, strings.TrimLeft(line, " "))
+	}
+	return body
+}
+
+// CommandStats contains the timings of the commands sent on a connection, the
+// time between sending a command and receiving its first reply.
+type CommandStats struct {
+	Commands  int           // number of commands replied by the server
+	TotalTime time.Duration // sum of the times of all commands
+	MaxTime   time.Duration // time of the slowest command
+	LastTime  time.Duration // time of the last command
+}
+
+// AverageTime returns the average time of the commands.
+func (s CommandStats) AverageTime() time.Duration {
+	if s.Commands == 0 {
+		return 0
+	}
+	return s.TotalTime / time.Duration(s.Commands)
+}
+
+// CommandTimer collects the CommandStats of a connection. Its methods can be
+// called from several goroutines.
+type CommandTimer struct {
+	mutex  sync.Mutex
+	sentAt time.Time // sending of the command waiting for its first reply, zero if none
+	stats  CommandStats
+}
+
+// Sent records the sending of a command.
+func (t *CommandTimer) Sent() {
+	t.mutex.Lock()
+	t.sentAt = time.Now()
+	t.mutex.Unlock()
+}
+
+// Replied records the first reply to the command sent last and returns the
+// time since it was sent. Further replies to the command return 0.
+func (t *CommandTimer) Replied() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.sentAt.IsZero() {
+		return 0
+	}
+	duration := time.Since(t.sentAt)
+	t.sentAt = time.Time{}
+	t.stats.Commands++
+	t.stats.TotalTime += duration
+	t.stats.LastTime = duration
+	if duration > t.stats.MaxTime {
+		t.stats.MaxTime = duration
+	}
+	return duration
+}
+
+// Stats returns the timings collected so far.
+func (t *CommandTimer) Stats() CommandStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.stats
+}
+
+// LoginHook continues a login, which the server does not complete after USER
+// or PASS, e.g. for servers requiring ACCT or one-time passwords. It receives
+// the intermediate reply (3xx) and returns the next command to send, e.g.
+// "ACCT <account>" or "PASS <response>" computed from the challenge in the
+// reply. For an empty command the default is sent: PASS with the password
+// after 331.
+type LoginHook func(reply *Response) (string, error)
+
+// CommandLogger receives the dialogue on a control connection line by line,
+// e.g. for debugging. Commands are prefixed with "> ", replies with "< ".
+// The arguments of PASS and ACCT and the password are masked.
+type CommandLogger func(line string)
+
+// SessionHooks are called on the events of a session, so applications like
+// GUIs or daemons can react to them without polling. Each hook may be nil.
+// The hooks are called by the goroutine causing the event and should return
+// quickly, they must not use the connection themselves. The transfers of a
+// multiplexer of QUIC-FTP call them concurrently.
+type SessionHooks struct {
+	// OnConnect is called with the address of the server, when a further
+	// connection of the session was opened, e.g. for parallel transfers.
+	OnConnect func(addr string)
+	// OnLogin is called after the user was logged in.
+	OnLogin func(user string)
+	// OnTransferStart is called, when the server started the transfer of a
+	// file, with the command ("RETR" or "STOR") and the path of the file.
+	OnTransferStart func(command string, path string)
+	// OnTransferComplete is called at the end of a started transfer with the
+	// transferred bytes and the error of the transfer, nil if it succeeded.
+	OnTransferComplete func(command string, path string, bytes int64, err error)
+	// OnError is called once, when the control connection failed or the
+	// server closed the service.
+	OnError func(err error)
+}
+
+// Connected calls OnConnect, if it is set.
+func (h *SessionHooks) Connected(addr string) {
+	if h.OnConnect != nil {
+		h.OnConnect(addr)
+	}
+}
+
+// LoggedIn calls OnLogin, if it is set.
+func (h *SessionHooks) LoggedIn(user string) {
+	if h.OnLogin != nil {
+		h.OnLogin(user)
+	}
+}
+
+// TransferStarted calls OnTransferStart, if it is set.
+func (h *SessionHooks) TransferStarted(command string, path string) {
+	if h.OnTransferStart != nil {
+		h.OnTransferStart(command, path)
+	}
+}
+
+// TransferCompleted calls OnTransferComplete, if it is set.
+func (h *SessionHooks) TransferCompleted(command string, path string, bytes int64, err error) {
+	if h.OnTransferComplete != nil {
+		h.OnTransferComplete(command, path, bytes, err)
+	}
+}
+
+// Failed calls OnError, if it is set.
+func (h *SessionHooks) Failed(err error) {
+	if h.OnError != nil {
+		h.OnError(err)
+	}
+}
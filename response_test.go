@@ -0,0 +1,78 @@
+package ftps_qftp_client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResponseBody(t *testing.T) {
+	response := &Response{Code: 214, Lines: []string{
+		"214-The following commands are recognized.",
+		" ABOR ACCT ALLO",
+		"214-APPE CDUP",
+		"214 Help OK.",
+	}}
+	expected := []string{"ABOR ACCT ALLO", "APPE CDUP"}
+	if body := response.Body(); !reflect.DeepEqual(body, expected) {
+		t.Errorf("Body returned %q, expected %q", body, expected)
+	}
+
+	single := &Response{Code: 200, Lines: []string{"200 Ok."}}
+	if body := single.Body(); body != nil {
+		t.Errorf("Body of a single line returned %q", body)
+	}
+}
+
+func TestCommandTimer(t *testing.T) {
+	var timer CommandTimer
+	if duration := timer.Replied(); duration != 0 {
+		t.Errorf("Reply without command took %v", duration)
+	}
+	timer.Sent()
+	time.Sleep(time.Millisecond)
+	first := timer.Replied()
+	if first < time.Millisecond {
+		t.Errorf("Reply took %v, expected at least 1ms", first)
+	}
+	if duration := timer.Replied(); duration != 0 {
+		t.Errorf("Second reply to the same command took %v", duration)
+	}
+	timer.Sent()
+	second := timer.Replied()
+
+	stats := timer.Stats()
+	if stats.Commands != 2 || stats.TotalTime != first+second || stats.LastTime != second {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.MaxTime != first && stats.MaxTime != second {
+		t.Errorf("Unexpected maximal time %v", stats.MaxTime)
+	}
+	if stats.AverageTime() != (first+second)/2 {
+		t.Errorf("Unexpected average time %v", stats.AverageTime())
+	}
+}
+
+func TestSessionHooks(t *testing.T) {
+	// Unset hooks are skipped
+	var hooks SessionHooks
+	hooks.Connected("127.0.0.1:21")
+	hooks.LoggedIn("anonymous")
+	hooks.TransferStarted("RETR", "file")
+	hooks.TransferCompleted("RETR", "file", 0, nil)
+	hooks.Failed(ErrServiceClosing)
+
+	var events []string
+	hooks.OnLogin = func(user string) {
+		events = append(events, "login "+user)
+	}
+	hooks.OnTransferComplete = func(command string, path string, bytes int64, err error) {
+		events = append(events, command+" "+path)
+	}
+	hooks.LoggedIn("anonymous")
+	hooks.TransferCompleted("STOR", "file", 3, nil)
+	expected := []string{"login anonymous", "STOR file"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("The hooks received %q, expected %q", events, expected)
+	}
+}
@@ -0,0 +1,34 @@
+package ftps_qftp_client
+
+import "testing"
+
+func TestStatusClasses(t *testing.T) {
+	tests := []struct {
+		code                                                        int
+		preliminary, completion, intermediate, transient, permanent bool
+	}{
+		{StatusAboutToSend, true, false, false, false, false},
+		{StatusCommandOK, false, true, false, false, false},
+		{StatusUserOK, false, false, true, false, false},
+		{StatusNotAvailable, false, false, false, true, false},
+		{StatusFileUnavailable, false, false, false, false, true},
+		{99, false, false, false, false, false},
+		{600, false, false, false, false, false},
+	}
+	for _, test := range tests {
+		if IsPositivePreliminary(test.code) != test.preliminary || IsPositiveCompletion(test.code) != test.completion ||
+			IsPositiveIntermediate(test.code) != test.intermediate || IsTransient(test.code) != test.transient ||
+			IsPermanent(test.code) != test.permanent {
+			t.Errorf("wrong classification of %d", test.code)
+		}
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	if text := StatusText(StatusCommandOK); text != "Command okay." {
+		t.Errorf("StatusText(200) = %q", text)
+	}
+	if text := StatusText(299); text != "" {
+		t.Errorf("StatusText(299) = %q, want the empty string", text)
+	}
+}
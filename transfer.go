@@ -0,0 +1,601 @@
+// Contains the transfer-task model and the scheduler for parallel transfers,
+// which are shared by the FTPS- and the QUIC-FTP-client.
+// Store and receive of files is possible.
+
+package ftps_qftp_client
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type TransferDirction int8
+
+const (
+	Retrieve = TransferDirction(1)
+	Store    = TransferDirction(2)
+)
+
+// Task to inform a worker which transfer should be performed
+type TransferTask struct {
+	LocalPath  string
+	RemotePath string
+	Direction  TransferDirction
+	// Number of further attempts after a transient error, see IsTransientError
+	MaxRetries int
+	// Byte of the file, at which the transfer starts using REST, to resume a
+	// partial transfer. The destination has to contain the bytes before it.
+	Offset int64
+	// Expected number of bytes to transfer, 0 if unknown. The scheduler uses
+	// it to balance the connections, for store tasks without a size the one
+	// of the local file is used.
+	Size int64
+	// Handling of an existing file at the destination
+	Overwrite OverwritePolicy
+	// Delete the source file after a successful transfer, to move the file
+	DeleteSourceAfterSuccess bool
+	// Maximal bandwidth of the transfer in bytes per second, 0 for no limit
+	RateLimit int64
+	// Bandwidth of the transfer depending on the time of day, replaces the
+	// RateLimit if it is set
+	RateSchedule *RateSchedule
+	// Tasks with a higher priority are started first by the scheduler
+	Priority int
+	// Compare the checksum computed by the server with the one of the local
+	// file after the transfer, a mismatch fails with ErrChecksumMismatch
+	VerifyChecksum bool
+	// Compress the data with gzip before storing it and decompress it after
+	// retrieving it, e.g. to keep file.gz at the server for a local file, also
+	// if the server does not support MODE Z. The bytes of the result and the
+	// RateLimit refer to the compressed data. Such a transfer can neither be
+	// resumed nor verified with VerifyChecksum.
+	Gzip bool
+}
+
+// Creates a new TransferTask
+func NewTransferTask(direction TransferDirction, localpath string, remotepath string) TransferTask {
+	return TransferTask{LocalPath: localpath, RemotePath: remotepath, Direction: direction}
+}
+
+// ConnectionOpener opens a further connection for a worker of a parallel transfer.
+// The returned connection must be logged in and be in the remote directory the
+// paths of the tasks relate to. It is closed with Quit() by the worker.
+type ConnectionOpener func() (ConnectionI, error)
+
+// TransferScheduler distributes transfer tasks over parallel connections.
+type TransferScheduler struct {
+	// Number of parallel connections. Parallel < 0 means no limit,
+	// at least one connection is used.
+	Parallel int
+	// Opens the connection for each worker
+	OpenConn ConnectionOpener
+	// Optional callback, which receives the overall progress whenever a task
+	// starts or finishes and periodically while data is transfered.
+	// Calls are serialized, the callback should return quickly.
+	Progress func(TransferProgress)
+	// Expand tasks for directories into tasks for all files in the directory
+	// trees before dispatching, see ExpandDirectoryTasks
+	ExpandDirectories bool
+	// Optional journal to resume an interrupted transfer, see TransferJournal
+	Journal *TransferJournal
+	// Don't perform the tasks, just pass their operations to DryRunLog. Each
+	// task gets a result with Skipped set. Directories are still listed for
+	// ExpandDirectories, but not created.
+	DryRun    bool
+	DryRunLog DryRunLogger
+	// Optional bandwidth of each transfer depending on the time of day, used
+	// for the tasks without RateSchedule of their own
+	RateSchedule *RateSchedule
+}
+
+// NewTransferScheduler creates a TransferScheduler, which uses up to nrParallel
+// connections opened by openConn.
+func NewTransferScheduler(nrParallel int, openConn ConnectionOpener) *TransferScheduler {
+	return &TransferScheduler{Parallel: nrParallel, OpenConn: openConn}
+}
+
+// Result of a performed TransferTask
+type TransferResult struct {
+	Task     TransferTask
+	Err      error         // nil if the transfer was successful
+	Bytes    int64         // number of transfered bytes
+	Duration time.Duration // duration of the transfer
+	Attempts int           // number of attempts to perform the task
+	Skipped  bool          // not transfered, as completed by an earlier run or by the OverwritePolicy
+	// Path of the transfered file at the destination, differs from the one
+	// of the task with OverwriteRename
+	Destination string
+}
+
+// TransferResults contains the results of all tasks of a parallel transfer
+// in the order of the tasks.
+type TransferResults []TransferResult
+
+// Failed returns the tasks of all failed transfers, e.g. to retry them.
+func (results TransferResults) Failed() []TransferTask {
+	var failed []TransferTask
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result.Task)
+		}
+	}
+	return failed
+}
+
+// Bytes returns the number of bytes transfered by all tasks.
+func (results TransferResults) Bytes() int64 {
+	var bytes int64
+	for _, result := range results {
+		bytes += result.Bytes
+	}
+	return bytes
+}
+
+// Err combines the errors of all failed transfers. It returns nil if all
+// transfers were successful.
+func (results TransferResults) Err() error {
+	errorMessage := ""
+	for _, result := range results {
+		if result.Err != nil {
+			errorMessage = errorMessage + "\n" + result.Err.Error()
+		}
+	}
+	if errorMessage == "" {
+		return nil
+	}
+	return errors.New(errorMessage)
+}
+
+// Run performs the tasks in parallel connections and waits till all of them
+// are finished. It returns a result for each task in the order of the tasks.
+// The tasks are distributed over the connections balanced by their size,
+// idle connections take over waiting tasks of busy ones. Tasks with a higher
+// Priority are started before all others.
+// The connections are reused for several tasks, each task starts in the
+// directory its connection was opened in. If a task left the connection in
+// another directory, CWD changes back before the next task.
+// Tasks failed with a transient error (see IsTransientError) are requeued up
+// to their MaxRetries times, preferably for another connection.
+//
+// If the context is cancelled, no further tasks are started, running transfers
+// are aborted by closing their connections and Run returns after all workers
+// exited. The result of each task not completed contains the error of the context.
+// The progress of the tasks is recorded in the Journal, if it is set.
+//
+// With ExpandDirectories the results belong to the expanded tasks. If the
+// expansion fails, each task gets a result with the error.
+func (s *TransferScheduler) Run(ctx context.Context, tasks []TransferTask) TransferResults {
+	if s.ExpandDirectories && len(tasks) > 0 {
+		expanded, err := s.expandDirectoryTasks(tasks)
+		if err != nil {
+			results := make(TransferResults, len(tasks))
+			for i, task := range tasks {
+				results[i] = TransferResult{Task: task,
+					Err: errors.New("Transfer of " + task.LocalPath + " not performed. " + err.Error())}
+			}
+			return results
+		}
+		tasks = expanded
+	}
+	if s.DryRun {
+		return s.dryRun(tasks)
+	}
+
+	nrParallel := s.Parallel
+	// Not more connections than files to transfer or negative
+	if len(tasks) < nrParallel || nrParallel < 0 {
+		nrParallel = len(tasks)
+	}
+	if nrParallel == 0 && len(tasks) > 0 {
+		nrParallel = 1
+	}
+
+	queue := newTaskQueue(tasks, nrParallel)
+	results := make(TransferResults, len(tasks))
+	tracker := newProgressTracker(tasks, s.Progress)
+
+	// Start goroutines for parallel connections, each writes only the results of its tasks
+	var workers sync.WaitGroup
+	setupErrors := make(chan error, nrParallel)
+	for i := 0; i < nrParallel; i++ {
+		workers.Add(1)
+		go func(worker int) {
+			defer workers.Done()
+			defer queue.leave()
+			err := s.worker(ctx, worker, queue, results, tracker)
+			if err != nil {
+				setupErrors <- err
+			}
+		}(i)
+	}
+	workers.Wait()
+	close(setupErrors)
+
+	// Tasks are only left if no worker could open a connection
+	setupError := errors.New("No connection available.")
+	for err := range setupErrors {
+		setupError = err
+	}
+	for _, left := range queue.drain() {
+		results[left.index] = TransferResult{Task: left.task, Attempts: left.attempts,
+			Err: errors.New("Transfer of " + left.task.LocalPath + " not performed. " + setupError.Error())}
+		tracker.finish(left.index, results[left.index])
+	}
+	// Keep the offsets of the tasks not completed
+	s.Journal.Save()
+	return results
+}
+
+// Expands the directory tasks with a connection of its own.
+func (s *TransferScheduler) expandDirectoryTasks(tasks []TransferTask) ([]TransferTask, error) {
+	conn, err := s.OpenConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Quit()
+	return expandDirectoryTasks(conn, tasks, s.DryRun, s.DryRunLog)
+}
+
+// Runs the tasks of one parallel connection.
+// From the queue it gets the TransferTask to perform and
+// it writes the outcome to the results at the index of the task.
+// It returns the error, if the connection could not be opened.
+func (s *TransferScheduler) worker(ctx context.Context, worker int, queue *taskQueue, results TransferResults, tracker *progressTracker) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	conn, err := s.OpenConn()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// conn is replaced after transient errors
+		conn.Quit()
+	}()
+	// The tasks of the connection all start in the directory it was opened in
+	workDir, err := keepWorkingDir(conn)
+	if err != nil {
+		return err
+	}
+
+	for {
+		next, available := queue.next(worker)
+		if !available {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			// Cancelled, don't start further tasks
+			results[next.index] = TransferResult{Task: next.task, Attempts: next.attempts, Err: err}
+			tracker.finish(next.index, results[next.index])
+			queue.done()
+			continue
+		}
+		if s.Journal.Completed(next.task) {
+			results[next.index] = TransferResult{Task: next.task, Skipped: true}
+			tracker.finish(next.index, results[next.index])
+			queue.done()
+			continue
+		}
+
+		index := next.index
+		tracker.start(index)
+		if entry, available := s.Journal.Entry(next.task); available && next.attempts == 0 && entry.Destination != "" {
+			// An earlier run applied the OverwritePolicy, its file is continued
+			next.destination = entry.Destination
+		}
+		attemptTask := next.task
+		if next.destination != "" {
+			attemptTask = retryTask(next.task, next.destination)
+		}
+		if attemptTask.RateSchedule == nil {
+			attemptTask.RateSchedule = s.RateSchedule
+		}
+		var result TransferResult
+		var transfered int64
+		if err := workDir.restore(); err != nil {
+			// Relative paths would address other files
+			result.Err = err
+		} else {
+			offset := s.Journal.resumeOffset(conn, next.task, attemptTask)
+			if offset < next.task.Offset {
+				offset = next.task.Offset
+			}
+			transfered = offset
+			onDestination := func(destination string) {
+				s.Journal.setDestination(next.task, destination)
+			}
+			result = performTransferTaskContext(ctx, conn, attemptTask, offset, onDestination, func(n int64) {
+				tracker.addBytes(index, n)
+				transfered += n
+				// Errors of the journal are reported when the task is completed
+				s.Journal.record(next.task, transfered)
+			})
+		}
+		result.Task = next.task
+		if next.destination == "" {
+			next.destination = result.Destination
+		}
+		next.attempts++
+		result.Attempts = next.attempts
+		if result.Err == nil {
+			if err := s.Journal.complete(next.task, transfered); err != nil {
+				result.Err = err
+			}
+		}
+
+		if errors.Is(result.Err, ErrChecksumMismatch) {
+			// The transfered data is corrupt, don't resume it
+			s.Journal.record(next.task, 0)
+		}
+		if result.Err != nil && ctx.Err() == nil && IsTransientError(result.Err) && next.attempts <= next.task.MaxRetries {
+			next.lastWorker = worker
+			tracker.retry(index)
+			queue.requeue(next)
+
+			// The connection may be broken after a transient error, open a new one
+			conn.Close()
+			newConn, err := s.OpenConn()
+			if err != nil {
+				return err
+			}
+			conn = newConn
+			if workDir, err = keepWorkingDir(conn); err != nil {
+				return err
+			}
+			continue
+		}
+		results[index] = result
+		tracker.finish(index, result)
+		queue.done()
+	}
+}
+
+// Returns the task for a further attempt after a transient error. The
+// OverwritePolicy was applied by the first attempt, a file at the destination
+// is now the partial file of the failed attempt. So the destination chosen by
+// the first attempt is used again and its file is replaced, or with
+// OverwriteResume continued. Without a destination the first attempt failed
+// before applying the policy and the task is attempted again unchanged.
+func retryTask(task TransferTask, destination string) TransferTask {
+	if destination == "" {
+		return task
+	}
+	if task.Direction == Retrieve {
+		task.LocalPath = destination
+	} else {
+		task.RemotePath = destination
+	}
+	if task.Overwrite != OverwriteResume {
+		task.Overwrite = Overwrite
+	}
+	return task
+}
+
+// Executes a single task on the connection. If the context is cancelled while
+// the transfer is running, the connection is closed to abort the transfer.
+// onDestination and onBytes are called like by performTransferTask.
+func performTransferTaskContext(ctx context.Context, conn ConnectionI, task TransferTask, offset int64,
+	onDestination func(string), onBytes func(int64)) TransferResult {
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-finished:
+		}
+	}()
+	result := performTransferTask(conn, task, offset, onDestination, onBytes)
+	close(finished)
+
+	if result.Err != nil && ctx.Err() != nil {
+		result.Err = ctx.Err()
+	}
+	return result
+}
+
+// PerformTransferTask executes a single task on the connection.
+func PerformTransferTask(conn ConnectionI, task TransferTask) TransferResult {
+	return performTransferTask(conn, task, task.Offset, nil, nil)
+}
+
+// Executes a single task on the connection starting at the offset of the file.
+// Without an offset the OverwritePolicy of the task is applied, with one the
+// existing file at the destination is the part transfered before.
+// onDestination is called with the path at the destination before the data is
+// transfered and onBytes with the number of bytes of each chunk transfered,
+// if they are not nil.
+func performTransferTask(conn ConnectionI, task TransferTask, offset int64, onDestination func(string),
+	onBytes func(int64)) TransferResult {
+	result := TransferResult{Task: task}
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	destination := task
+	if offset == 0 {
+		var skip bool
+		destination, offset, skip, result.Err = applyOverwritePolicy(conn, task)
+		if result.Err != nil {
+			return result
+		}
+		if skip {
+			result.Skipped = true
+			return result
+		}
+	}
+	if task.Gzip && (offset > 0 || task.VerifyChecksum) {
+		result.Err = errors.New("The compressed transfer of " + task.LocalPath + " can neither be resumed nor verified.")
+		return result
+	}
+	if task.Direction == Retrieve {
+		result.Destination = destination.LocalPath
+	} else {
+		result.Destination = destination.RemotePath
+	}
+	if onDestination != nil {
+		onDestination(result.Destination)
+	}
+
+	switch task.Direction {
+	case Store:
+		result.Bytes, result.Err = storTask(conn, destination, offset, onBytes)
+	case Retrieve:
+		result.Bytes, result.Err = retrTask(conn, destination, offset, onBytes)
+	default:
+		result.Err = errors.New("Unknown direction for transfer.")
+	}
+	if result.Err == nil && task.VerifyChecksum {
+		result.Err = verifyChecksum(conn, destination.LocalPath, destination.RemotePath)
+	}
+	if result.Err == nil && task.DeleteSourceAfterSuccess {
+		result.Err = deleteSource(conn, task)
+	}
+	return result
+}
+
+// Counts the bytes read from the underlying reader and reports
+// them to onBytes, if it is not nil.
+type countingReader struct {
+	reader  io.Reader
+	count   int64
+	onBytes func(int64)
+}
+
+// Read implements the io.Reader interface.
+func (r *countingReader) Read(buf []byte) (int, error) {
+	n, err := r.reader.Read(buf)
+	r.count += int64(n)
+	if n > 0 && r.onBytes != nil {
+		r.onBytes(int64(n))
+	}
+	return n, err
+}
+
+// Stores a file at the server within a parallel transfer.
+// With an offset the transfer is resumed at the offset using REST.
+func storTask(conn ConnectionI, task TransferTask, offset int64, onBytes func(int64)) (int64, error) {
+	file, err := os.Open(task.LocalPath)
+	if err != nil {
+		return 0, errors.New("Error while opening the local file " + task.LocalPath + ". " + err.Error())
+	}
+	defer file.Close()
+
+	var source io.Reader = file
+	if task.Gzip {
+		compressed := CompressGzip(file)
+		// Stops the compression, if the store failed
+		defer compressed.Close()
+		source = compressed
+	}
+	reader := &countingReader{reader: limitTaskRate(source, task), onBytes: onBytes}
+	if offset > 0 {
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			return 0, errors.New("Error while seeking in the local file " + task.LocalPath + ". " + err.Error())
+		}
+		err = conn.StorFrom(task.RemotePath, reader, uint64(offset))
+	} else {
+		err = conn.Stor(task.RemotePath, reader)
+	}
+	if err != nil {
+		return reader.count, fmt.Errorf("Error while writing file %s to server. %w", task.LocalPath, err)
+	}
+	return reader.count, nil
+}
+
+// Receives a file at the server within a parallel transfer.
+// With an offset the transfer is resumed at the offset using REST.
+func retrTask(conn ConnectionI, task TransferTask, offset int64, onBytes func(int64)) (int64, error) {
+	if offset > 0 {
+		return resumeRetrTask(conn, task, offset, onBytes)
+	}
+
+	// Create and open the file
+	file, err := os.Create(task.LocalPath)
+	if err != nil {
+		return 0, errors.New("Error while creating the local file. " + err.Error())
+	}
+	defer file.Close()
+
+	// Retrieve the file and write it to the filesystem
+	reader, err := conn.Retr(task.RemotePath)
+	if err != nil {
+		return 0, err
+	}
+	return copyFromServer(conn, file, reader, task, onBytes)
+}
+
+// Receives the rest of a partially retrieved file starting at the offset.
+func resumeRetrTask(conn ConnectionI, task TransferTask, offset int64, onBytes func(int64)) (int64, error) {
+	file, err := os.OpenFile(task.LocalPath, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, errors.New("Error while opening the local file. " + err.Error())
+	}
+	defer file.Close()
+
+	// Truncate would extend a shorter file with zeros
+	info, err := file.Stat()
+	if err != nil {
+		return 0, errors.New("Error while reading the size of the local file. " + err.Error())
+	}
+	if info.Size() < offset {
+		return 0, errors.New("Local file " + task.LocalPath + " with " + strconv.FormatInt(info.Size(), 10) +
+			" bytes is shorter than the offset " + strconv.FormatInt(offset, 10) + ".")
+	}
+
+	// Data behind the offset may be incomplete
+	if err = file.Truncate(offset); err != nil {
+		return 0, errors.New("Error while truncating the local file. " + err.Error())
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return 0, errors.New("Error while seeking in the local file. " + err.Error())
+	}
+
+	reader, err := conn.RetrFrom(task.RemotePath, uint64(offset))
+	if err != nil {
+		return 0, err
+	}
+	return copyFromServer(conn, file, reader, task, onBytes)
+}
+
+// Copies the data of a retrieved file to the local file with the bandwidth
+// of the task and closes the reader from the server. With Gzip the data is
+// decompressed and the compressed bytes are returned.
+// The data is copied with the buffer size of the connection.
+func copyFromServer(conn ConnectionI, file *os.File, reader io.ReadCloser, task TransferTask, onBytes func(int64)) (int64, error) {
+	counter := &countingReader{reader: limitTaskRate(reader, task), onBytes: onBytes}
+	var source io.Reader = counter
+	if task.Gzip {
+		decompressed, err := gzip.NewReader(counter)
+		if err != nil {
+			reader.Close()
+			return counter.count, fmt.Errorf("Error while decompressing the file from the server. %w", err)
+		}
+		source = decompressed
+	}
+	written, err := connBufferPool(conn).Copy(file, source)
+	if task.Gzip {
+		written = counter.count
+	}
+	if err != nil {
+		closeErr := reader.Close()
+		if closeErr != nil {
+			return written, fmt.Errorf("Error while writing file to local file. %w Error while closing reader from server. %v", err, closeErr)
+		}
+		return written, fmt.Errorf("Error while writing file to local file. %w", err)
+	}
+
+	// Finalize retrieve of the file
+	err = reader.Close()
+	if err != nil {
+		return written, fmt.Errorf(" Error while closing reader from server. %w", err)
+	}
+	return written, nil
+}
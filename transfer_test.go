@@ -0,0 +1,521 @@
+package ftps_qftp_client
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryServer holds the remote files shared by all connections of a test.
+type memoryServer struct {
+	mutex sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func newMemoryServer() *memoryServer {
+	return &memoryServer{files: make(map[string][]byte), dirs: map[string]bool{"/": true}}
+}
+
+// memoryConn is a connection to a memoryServer implementing ConnectionI.
+type memoryConn struct {
+	server     *memoryServer
+	currentDir string
+	quit       bool
+}
+
+func (c *memoryConn) Login(user, password string) error       { return nil }
+func (c *memoryConn) AuthTLS() error                          { return nil }
+func (c *memoryConn) Feat() error                             { return nil }
+func (c *memoryConn) Features() map[string]string             { return map[string]string{} }
+func (c *memoryConn) NameList(path string) ([]string, error)  { return nil, nil }
+func (c *memoryConn) ChangeDirToParent() error                { return nil }
+func (c *memoryConn) Retr(path string) (io.ReadCloser, error) { return c.RetrFrom(path, 0) }
+func (c *memoryConn) Stor(path string, r io.Reader) error     { return c.StorFrom(path, r, 0) }
+func (c *memoryConn) Rename(from, to string) error            { return nil }
+func (c *memoryConn) RemoveDir(path string) error             { return nil }
+func (c *memoryConn) NoOp() error                             { return nil }
+func (c *memoryConn) Logout() error                           { return nil }
+func (c *memoryConn) Quit() error                             { c.quit = true; return nil }
+func (c *memoryConn) Close() error                            { return nil }
+
+func (c *memoryConn) CurrentDir() (string, error) {
+	if c.currentDir == "" {
+		return "/", nil
+	}
+	return c.currentDir, nil
+}
+
+func (c *memoryConn) ChangeDir(dir string) error {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	if !c.server.dirs[dir] {
+		return &textproto.Error{Code: 550, Msg: "Directory unavailable."}
+	}
+	c.currentDir = dir
+	return nil
+}
+
+func (c *memoryConn) MakeDir(dir string) error {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	if _, isFile := c.server.files[dir]; isFile || c.server.dirs[dir] {
+		return errors.New("550 Directory already exists.")
+	}
+	if !c.server.dirs[path.Dir(dir)] {
+		return errors.New("550 Parent directory unavailable.")
+	}
+	c.server.dirs[dir] = true
+	return nil
+}
+
+func (c *memoryConn) Capabilities() Capabilities { return Capabilities{} }
+func (c *memoryConn) MachineList(path string) ([]*Entry, error) {
+	return nil, errors.New("500 Unknown command.")
+}
+func (c *memoryConn) MachineEntry(path string) (*Entry, error) {
+	return nil, errors.New("500 Unknown command.")
+}
+func (c *memoryConn) Chmod(path string, mode os.FileMode) error {
+	return errors.New("500 Unknown command.")
+}
+func (c *memoryConn) AvailableSpace(path string) (int64, error) {
+	return 0, errors.New("500 Unknown command.")
+}
+func (c *memoryConn) SetModTime(path string, t time.Time) error {
+	return errors.New("500 Unknown command.")
+}
+func (c *memoryConn) FileSize(path string) (int64, error) {
+	return 0, errors.New("500 Unknown command.")
+}
+
+func (c *memoryConn) ModTime(path string) (time.Time, error) {
+	return time.Time{}, errors.New("502 Command not implemented.")
+}
+
+func (c *memoryConn) Checksum(path string) (Checksum, error) {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	data, available := c.server.files[path]
+	if !available {
+		return Checksum{}, errors.New("550 File unavailable.")
+	}
+	sum := md5.Sum(data)
+	return Checksum{Algorithm: "MD5", Value: hex.EncodeToString(sum[:])}, nil
+}
+
+func (c *memoryConn) SetTransferType(transferType TransferType) error {
+	if transferType != Binary {
+		return errors.New("504 Command not implemented for that parameter.")
+	}
+	return nil
+}
+
+func (c *memoryConn) Delete(path string) error {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	if _, available := c.server.files[path]; !available {
+		return errors.New("550 File unavailable.")
+	}
+	delete(c.server.files, path)
+	return nil
+}
+
+// List returns the files and directories directly in dir or the file itself.
+func (c *memoryConn) List(dir string) ([]*Entry, error) {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	if data, available := c.server.files[dir]; available {
+		return []*Entry{{Name: path.Base(dir), Type: EntryTypeFile, Size: uint64(len(data))}}, nil
+	}
+	if !c.server.dirs[dir] {
+		return nil, errors.New("550 Directory unavailable.")
+	}
+	var entries []*Entry
+	for name := range c.server.dirs {
+		if name != dir && path.Dir(name) == dir {
+			entries = append(entries, &Entry{Name: path.Base(name), Type: EntryTypeFolder})
+		}
+	}
+	for name, data := range c.server.files {
+		if path.Dir(name) == dir {
+			entries = append(entries, &Entry{Name: path.Base(name), Type: EntryTypeFile, Size: uint64(len(data))})
+		}
+	}
+	return entries, nil
+}
+
+func (c *memoryConn) RetrFrom(path string, offset uint64) (io.ReadCloser, error) {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	data, available := c.server.files[path]
+	if !available {
+		return nil, errors.New("550 File unavailable.")
+	}
+	return ioutil.NopCloser(bytes.NewReader(data[offset:])), nil
+}
+
+func (c *memoryConn) StorFrom(path string, r io.Reader, offset uint64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	c.server.files[path] = append(c.server.files[path][:offset], data...)
+	return nil
+}
+
+func (s *memoryServer) opener() ConnectionOpener {
+	return func() (ConnectionI, error) {
+		return &memoryConn{server: s}, nil
+	}
+}
+
+func TestTransferSchedulerRun(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.files["remote1.txt"] = []byte("remote file one")
+	server.files["remote2.txt"] = []byte("remote file two")
+	if err = ioutil.WriteFile(filepath.Join(localDir, "local1.txt"), []byte("local file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []TransferTask{
+		NewTransferTask(Store, filepath.Join(localDir, "local1.txt"), "local1.txt"),
+		NewTransferTask(Retrieve, filepath.Join(localDir, "remote1.txt"), "remote1.txt"),
+		NewTransferTask(Retrieve, filepath.Join(localDir, "remote2.txt"), "remote2.txt"),
+		NewTransferTask(Retrieve, filepath.Join(localDir, "missing.txt"), "missing.txt"),
+	}
+	results := NewTransferScheduler(2, server.opener()).Run(context.Background(), tasks)
+
+	if len(results) != len(tasks) {
+		t.Fatalf("Run returned %d results, want %d", len(results), len(tasks))
+	}
+	for i, result := range results {
+		if result.Task != tasks[i] {
+			t.Errorf("result %d belongs to task %v, want %v", i, result.Task, tasks[i])
+		}
+	}
+	if failed := results.Failed(); len(failed) != 1 || failed[0] != tasks[3] {
+		t.Errorf("Failed() = %v, want only the task of the missing file", failed)
+	}
+	if results.Bytes() != int64(len("local file")+len("remote file one")+len("remote file two")) {
+		t.Errorf("Bytes() = %d", results.Bytes())
+	}
+	if string(server.files["local1.txt"]) != "local file" {
+		t.Errorf("stored %q", server.files["local1.txt"])
+	}
+	data, err := ioutil.ReadFile(filepath.Join(localDir, "remote2.txt"))
+	if err != nil || string(data) != "remote file two" {
+		t.Errorf("retrieved %q, %v", data, err)
+	}
+}
+
+func TestTransferSchedulerNoConnection(t *testing.T) {
+	openConn := func() (ConnectionI, error) {
+		return nil, errors.New("connection refused")
+	}
+	tasks := []TransferTask{
+		NewTransferTask(Store, "a", "a"),
+		NewTransferTask(Store, "b", "b"),
+	}
+	results := NewTransferScheduler(-1, openConn).Run(context.Background(), tasks)
+
+	if len(results.Failed()) != len(tasks) {
+		t.Fatalf("expected all tasks to fail, got %v", results)
+	}
+	if err := results.Err(); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Err() = %v, want the error of the connection", err)
+	}
+}
+
+// blockingConn hangs in every Stor until it is closed.
+type blockingConn struct {
+	memoryConn
+	started chan struct{}
+	closed  chan struct{}
+}
+
+func (c *blockingConn) Stor(path string, r io.Reader) error {
+	c.started <- struct{}{}
+	<-c.closed
+	return errors.New("connection closed")
+}
+
+func (c *blockingConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestTransferSchedulerCancel(t *testing.T) {
+	localFile, err := ioutil.TempFile("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	localFile.Close()
+	defer os.Remove(localFile.Name())
+
+	started := make(chan struct{})
+	openConn := func() (ConnectionI, error) {
+		return &blockingConn{started: started, closed: make(chan struct{})}, nil
+	}
+	tasks := []TransferTask{
+		NewTransferTask(Store, localFile.Name(), "a"),
+		NewTransferTask(Store, localFile.Name(), "b"),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	results := NewTransferScheduler(1, openConn).Run(ctx, tasks)
+
+	for _, result := range results {
+		if result.Err != context.Canceled {
+			t.Errorf("result of %v has error %v, want %v", result.Task, result.Err, context.Canceled)
+		}
+	}
+}
+
+func TestTransferSchedulerProgress(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.files["remote.txt"] = []byte("remote file")
+	tasks := []TransferTask{
+		NewTransferTask(Retrieve, filepath.Join(localDir, "remote.txt"), "remote.txt"),
+		NewTransferTask(Retrieve, filepath.Join(localDir, "missing.txt"), "missing.txt"),
+	}
+
+	var reports []TransferProgress
+	scheduler := NewTransferScheduler(1, server.opener())
+	scheduler.Progress = func(progress TransferProgress) {
+		reports = append(reports, progress)
+	}
+	scheduler.Run(context.Background(), tasks)
+
+	if len(reports) == 0 {
+		t.Fatal("no progress reported")
+	}
+	last := reports[len(reports)-1]
+	if last.TotalTasks != 2 || last.CompletedTasks != 2 || last.FailedTasks != 1 {
+		t.Errorf("last progress = %+v", last)
+	}
+	if last.Bytes != int64(len("remote file")) {
+		t.Errorf("last progress has %d bytes, want %d", last.Bytes, len("remote file"))
+	}
+	if last.Tasks[0].State != TaskSucceeded || last.Tasks[1].State != TaskFailed {
+		t.Errorf("unexpected task states %v", last.Tasks)
+	}
+}
+
+// flakyServer fails the first attempts to retrieve a file with a transient error.
+type flakyServer struct {
+	*memoryServer
+	failures int
+}
+
+type flakyConn struct {
+	memoryConn
+	server *flakyServer
+}
+
+func (c *flakyConn) Retr(path string) (io.ReadCloser, error) {
+	c.server.mutex.Lock()
+	fail := c.server.failures > 0
+	c.server.failures--
+	c.server.mutex.Unlock()
+	if fail {
+		return nil, &textproto.Error{Code: 426, Msg: "Connection closed; transfer aborted."}
+	}
+	return c.memoryConn.Retr(path)
+}
+
+func TestTransferSchedulerRetry(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := &flakyServer{memoryServer: newMemoryServer(), failures: 2}
+	server.files["remote.txt"] = []byte("remote file")
+	openConn := func() (ConnectionI, error) {
+		return &flakyConn{memoryConn: memoryConn{server: server.memoryServer}, server: server}, nil
+	}
+
+	task := NewTransferTask(Retrieve, filepath.Join(localDir, "remote.txt"), "remote.txt")
+	task.MaxRetries = 1
+	results := NewTransferScheduler(2, openConn).Run(context.Background(), []TransferTask{task})
+	if results[0].Err == nil || results[0].Attempts != 2 {
+		t.Errorf("with one retry: err = %v after %d attempts, want failure after 2", results[0].Err, results[0].Attempts)
+	}
+
+	server.failures = 2
+	task.MaxRetries = 2
+	results = NewTransferScheduler(2, openConn).Run(context.Background(), []TransferTask{task})
+	if results[0].Err != nil || results[0].Attempts != 3 {
+		t.Errorf("with two retries: err = %v after %d attempts, want success after 3", results[0].Err, results[0].Attempts)
+	}
+}
+
+// partialServer breaks the first retrieval of a file after half of its data.
+type partialServer struct {
+	*memoryServer
+	broken bool
+}
+
+type partialConn struct {
+	memoryConn
+	server *partialServer
+}
+
+func (c *partialConn) Retr(path string) (io.ReadCloser, error) {
+	c.server.mutex.Lock()
+	broken := c.server.broken
+	c.server.broken = false
+	c.server.mutex.Unlock()
+	if !broken {
+		return c.memoryConn.Retr(path)
+	}
+	data := c.server.files[path]
+	return ioutil.NopCloser(io.MultiReader(bytes.NewReader(data[:len(data)/2]), failingReader{})), nil
+}
+
+// failingReader fails like a broken data connection.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestTransferSchedulerRetryOverwritePolicy(t *testing.T) {
+	for _, policy := range []OverwritePolicy{OverwriteSkip, OverwriteRename} {
+		localDir, err := ioutil.TempDir("", "transfertest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(localDir)
+
+		server := &partialServer{memoryServer: newMemoryServer(), broken: true}
+		server.files["big.txt"] = []byte("0123456789")
+		openConn := func() (ConnectionI, error) {
+			return &partialConn{memoryConn: memoryConn{server: server.memoryServer}, server: server}, nil
+		}
+
+		localPath := filepath.Join(localDir, "big.txt")
+		task := NewTransferTask(Retrieve, localPath, "big.txt")
+		task.Overwrite = policy
+		task.MaxRetries = 1
+		results := NewTransferScheduler(1, openConn).Run(context.Background(), []TransferTask{task})
+		if results[0].Err != nil || results[0].Skipped || results[0].Attempts != 2 {
+			t.Errorf("policy %d: err = %v, skipped = %v after %d attempts, want success after 2", policy, results[0].Err, results[0].Skipped, results[0].Attempts)
+		}
+		if results[0].Destination != localPath {
+			t.Errorf("policy %d: destination = %q, want %q", policy, results[0].Destination, localPath)
+		}
+		if data, _ := ioutil.ReadFile(localPath); string(data) != "0123456789" {
+			t.Errorf("policy %d: local file contains %q", policy, data)
+		}
+		if _, err = os.Stat(filepath.Join(localDir, "big_1.txt")); err == nil {
+			t.Errorf("policy %d: retry transfered to big_1.txt", policy)
+		}
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	transient := []error{
+		&textproto.Error{Code: 421, Msg: "Service not available"},
+		fmt.Errorf("Error while writing file. %w", &textproto.Error{Code: 451, Msg: "Local error"}),
+		io.ErrUnexpectedEOF,
+		fmt.Errorf("Transfer of a failed. %w", ErrChecksumMismatch),
+	}
+	for _, err := range transient {
+		if !IsTransientError(err) {
+			t.Errorf("IsTransientError(%v) = false, want true", err)
+		}
+	}
+	permanent := []error{
+		nil,
+		&textproto.Error{Code: 550, Msg: "File unavailable"},
+		errors.New("File with this name already exists in local folder."),
+	}
+	for _, err := range permanent {
+		if IsTransientError(err) {
+			t.Errorf("IsTransientError(%v) = true, want false", err)
+		}
+	}
+}
+
+func TestTransferTaskOffset(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.files["remote.txt"] = []byte("0123456789")
+	server.files["stored.txt"] = []byte("abc")
+	localPath := filepath.Join(localDir, "remote.txt")
+	if err = ioutil.WriteFile(localPath, []byte("0123"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	storePath := filepath.Join(localDir, "stored.txt")
+	if err = ioutil.WriteFile(storePath, []byte("abcdef"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	retrieve := NewTransferTask(Retrieve, localPath, "remote.txt")
+	retrieve.Offset = 4
+	store := NewTransferTask(Store, storePath, "stored.txt")
+	store.Offset = 3
+	results := NewTransferScheduler(2, server.opener()).Run(context.Background(), []TransferTask{retrieve, store})
+	if err = results.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if results.Bytes() != 6+3 {
+		t.Errorf("transfered %d bytes, want only the ones behind the offsets", results.Bytes())
+	}
+	data, err := ioutil.ReadFile(localPath)
+	if err != nil || string(data) != "0123456789" {
+		t.Errorf("retrieved %q, %v", data, err)
+	}
+	if string(server.files["stored.txt"]) != "abcdef" {
+		t.Errorf("stored %q", server.files["stored.txt"])
+	}
+
+	// An offset behind the end of the local file must not fill it with zeros
+	retrieve.Offset = 20
+	result := PerformTransferTask(&memoryConn{server: server}, retrieve)
+	if result.Err == nil {
+		t.Error("retrieve with an offset behind the local file succeeded")
+	}
+	if data, _ = ioutil.ReadFile(localPath); string(data) != "0123456789" {
+		t.Errorf("local file changed to %q", data)
+	}
+}
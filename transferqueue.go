@@ -0,0 +1,289 @@
+// Contains the queue of transfers for services, which run transfer tasks
+// added at any time in the background.
+
+package ftps_qftp_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// QueueItem is a task of a Queue with the ID returned by Add.
+type QueueItem struct {
+	ID   int
+	Task TransferTask
+}
+
+// QueueResult is the result of a task of a Queue, which was finished or
+// cancelled.
+type QueueResult struct {
+	ID     int
+	Result TransferResult
+}
+
+// ErrQueueClosed is returned by the methods of a Queue after Close.
+var ErrQueueClosed = errors.New("The queue is closed.")
+
+// Queue runs transfer tasks, which can be added at any time, in the
+// background with a TransferScheduler, e.g. in services with long-running
+// transfer workloads. The pending tasks are run in batches, tasks added while
+// a batch runs are started with the next batch.
+//
+// With a file the pending and running tasks are persisted, so a queue opened
+// again with the same file, e.g. after a restart, continues them. The
+// progress of the tasks is recorded in a TransferJournal in the file with the
+// suffix ".journal", so interrupted files are resumed with REST.
+//
+// Its methods can be called from several goroutines.
+type Queue struct {
+	scheduler *TransferScheduler
+	path      string // file of the persisted tasks, empty for none
+	mutex     sync.Mutex
+	wake      chan struct{} // signals the runner, that the state changed
+	idle      *sync.Cond    // broadcast when a batch finished or the queue was paused or closed
+	nextID    int
+	pending   []QueueItem
+	running   []QueueItem        // tasks of the running batch
+	cancelled map[int]bool       // running tasks cancelled by Cancel
+	interrupt context.CancelFunc // interrupts the running batch, nil while none runs
+	results   []QueueResult
+	paused    bool
+	closed    bool
+	stopped   chan struct{} // closed when the runner exited
+}
+
+// OpenQueue creates a queue running its tasks with the scheduler. The
+// scheduler must not expand directories, as the results are assigned to the
+// tasks, the tasks of directories can be expanded with ExpandDirectoryTasks
+// before. With a filename the tasks persisted in the file are queued again
+// and the Journal of the scheduler is set to the one of the queue. A paused
+// queue does not start tasks till Resume.
+func OpenQueue(scheduler *TransferScheduler, filename string, paused bool) (*Queue, error) {
+	if scheduler.ExpandDirectories || scheduler.DryRun {
+		return nil, errors.New("The scheduler of a queue must neither expand directories nor perform a dry run.")
+	}
+	q := &Queue{scheduler: scheduler, path: filename, wake: make(chan struct{}, 1),
+		cancelled: make(map[int]bool), paused: paused, stopped: make(chan struct{})}
+	q.idle = sync.NewCond(&q.mutex)
+	if filename != "" {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.New("Error while reading the queue " + filename + ". " + err.Error())
+		}
+		if err == nil {
+			if err = json.Unmarshal(data, &q.pending); err != nil {
+				return nil, errors.New("Error while parsing the queue " + filename + ". " + err.Error())
+			}
+		}
+		for _, item := range q.pending {
+			if item.ID >= q.nextID {
+				q.nextID = item.ID + 1
+			}
+		}
+		journal, err := OpenTransferJournal(filename + ".journal")
+		if err != nil {
+			return nil, err
+		}
+		scheduler.Journal = journal
+	}
+	go q.run()
+	return q, nil
+}
+
+// Add appends the tasks to the queue and returns their IDs.
+func (q *Queue) Add(tasks ...TransferTask) ([]int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = q.nextID
+		q.pending = append(q.pending, QueueItem{ID: q.nextID, Task: task})
+		q.nextID++
+	}
+	q.signal()
+	return ids, q.persist()
+}
+
+// Pause stops starting tasks and interrupts the running ones, which are
+// queued again in front of the pending tasks and resumed after Resume.
+func (q *Queue) Pause() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.paused = true
+	if q.interrupt != nil {
+		q.interrupt()
+	}
+	q.idle.Broadcast()
+}
+
+// Resume starts the pending tasks again after Pause.
+func (q *Queue) Resume() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.paused = false
+	q.signal()
+}
+
+// Cancel removes the task with the ID from the queue. A running task is
+// aborted by interrupting its batch, the other interrupted tasks of the batch
+// are queued again and resumed. The cancelled task gets a result with the
+// error context.Canceled.
+func (q *Queue) Cancel(id int) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, item := range q.pending {
+		if item.ID == id {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.results = append(q.results, QueueResult{ID: id, Result: TransferResult{Task: item.Task, Err: context.Canceled}})
+			return q.persist()
+		}
+	}
+	for _, item := range q.running {
+		if item.ID == id {
+			q.cancelled[id] = true
+			q.interrupt()
+			return nil
+		}
+	}
+	return errors.New("The queue contains no task with the ID " + strconv.Itoa(id) + ".")
+}
+
+// Pending returns the tasks, which are not yet started.
+func (q *Queue) Pending() []QueueItem {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]QueueItem(nil), q.pending...)
+}
+
+// Running returns the tasks of the running batch.
+func (q *Queue) Running() []QueueItem {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]QueueItem(nil), q.running...)
+}
+
+// Results returns the results of the finished and cancelled tasks in the
+// order, in which they finished.
+func (q *Queue) Results() []QueueResult {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]QueueResult(nil), q.results...)
+}
+
+// Wait blocks till all tasks are finished or the queue is paused or closed.
+func (q *Queue) Wait() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for !q.closed && !q.paused && (len(q.pending) > 0 || len(q.running) > 0) {
+		q.idle.Wait()
+	}
+}
+
+// Close interrupts the running tasks and stops the queue. The pending and
+// the interrupted tasks stay in the file of the queue.
+func (q *Queue) Close() error {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return ErrQueueClosed
+	}
+	q.closed = true
+	if q.interrupt != nil {
+		q.interrupt()
+	}
+	q.signal()
+	q.idle.Broadcast()
+	q.mutex.Unlock()
+	<-q.stopped
+	return nil
+}
+
+// Wakes up the runner. The mutex has to be held.
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Runs the pending tasks in batches till the queue is closed.
+func (q *Queue) run() {
+	defer close(q.stopped)
+	for {
+		q.mutex.Lock()
+		for !q.closed && (q.paused || len(q.pending) == 0) {
+			q.mutex.Unlock()
+			<-q.wake
+			q.mutex.Lock()
+		}
+		if q.closed {
+			q.mutex.Unlock()
+			return
+		}
+		q.running = q.pending
+		q.pending = nil
+		ctx, interrupt := context.WithCancel(context.Background())
+		q.interrupt = interrupt
+		tasks := make([]TransferTask, len(q.running))
+		for i, item := range q.running {
+			tasks[i] = item.Task
+		}
+		q.mutex.Unlock()
+
+		results := q.scheduler.Run(ctx, tasks)
+
+		q.mutex.Lock()
+		interrupted := ctx.Err() != nil
+		interrupt()
+		// The tasks not completed before an interruption are resumed later
+		var requeued []QueueItem
+		for i, item := range q.running {
+			result := results[i]
+			if interrupted && !q.cancelled[item.ID] && result.Err != nil {
+				requeued = append(requeued, item)
+				continue
+			}
+			q.results = append(q.results, QueueResult{ID: item.ID, Result: result})
+		}
+		q.pending = append(requeued, q.pending...)
+		q.running = nil
+		q.interrupt = nil
+		q.cancelled = make(map[int]bool)
+		q.persist()
+		if len(q.pending) == 0 && !q.closed {
+			// The entries of the finished tasks must not skip tasks added later
+			q.scheduler.Journal.Remove()
+		}
+		q.idle.Broadcast()
+		q.mutex.Unlock()
+	}
+}
+
+// Writes the pending and the running tasks to the file of the queue, so an
+// interruption leaves a complete file. The mutex has to be held.
+func (q *Queue) persist() error {
+	if q.path == "" {
+		return nil
+	}
+	items := append(append([]QueueItem{}, q.running...), q.pending...)
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := q.path + ".tmp"
+	if err = ioutil.WriteFile(tempPath, data, 0644); err != nil {
+		return errors.New("Error while writing the queue " + q.path + ". " + err.Error())
+	}
+	if err = os.Rename(tempPath, q.path); err != nil {
+		return errors.New("Error while writing the queue " + q.path + ". " + err.Error())
+	}
+	return nil
+}
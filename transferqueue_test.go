@@ -0,0 +1,148 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueueRun(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "queuetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.files["remote1.txt"] = []byte("remote file one")
+	server.files["remote2.txt"] = []byte("remote file two")
+	queuePath := filepath.Join(localDir, "queue.json")
+	queue, err := OpenQueue(NewTransferScheduler(2, server.opener()), queuePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := queue.Add(NewTransferTask(Retrieve, filepath.Join(localDir, "local1.txt"), "remote1.txt"),
+		NewTransferTask(Retrieve, filepath.Join(localDir, "local2.txt"), "remote2.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Wait()
+	if err = queue.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	results := queue.Results()
+	if len(results) != 2 || results[0].ID != ids[0] || results[1].ID != ids[1] {
+		t.Fatalf("results %v, want the IDs %v", results, ids)
+	}
+	for _, result := range results {
+		if result.Result.Err != nil {
+			t.Errorf("task %d failed: %v", result.ID, result.Result.Err)
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(localDir, "local2.txt"))
+	if err != nil || string(data) != "remote file two" {
+		t.Errorf("retrieved %q, %v", data, err)
+	}
+	data, err = ioutil.ReadFile(queuePath)
+	if err != nil || string(data) != "[]" {
+		t.Errorf("queue file contains %q, %v, want no tasks", data, err)
+	}
+	if _, err = os.Stat(queuePath + ".journal"); !os.IsNotExist(err) {
+		t.Errorf("journal of the finished queue was not removed: %v", err)
+	}
+	if _, err = queue.Add(NewTransferTask(Retrieve, "local.txt", "remote.txt")); err != ErrQueueClosed {
+		t.Errorf("Add after Close returned %v, want %v", err, ErrQueueClosed)
+	}
+}
+
+func TestQueuePauseReopen(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "queuetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+	localPath := filepath.Join(localDir, "local.txt")
+	if err = ioutil.WriteFile(localPath, []byte("local file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{}, 1)
+	openConn := func() (ConnectionI, error) {
+		return &blockingConn{started: started, closed: make(chan struct{})}, nil
+	}
+	queuePath := filepath.Join(localDir, "queue.json")
+	queue, err := OpenQueue(NewTransferScheduler(1, openConn), queuePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := queue.Add(NewTransferTask(Store, localPath, "remote.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	queue.Pause()
+	queue.Wait()
+	if err = queue.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pending := queue.Pending(); len(pending) != 1 || pending[0].ID != ids[0] {
+		t.Fatalf("pending tasks after Pause: %v", pending)
+	}
+	if results := queue.Results(); len(results) != 0 {
+		t.Errorf("interrupted task has the results %v", results)
+	}
+
+	// A restarted service continues the interrupted task
+	server := newMemoryServer()
+	queue, err = OpenQueue(NewTransferScheduler(1, server.opener()), queuePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Wait()
+	queue.Close()
+	results := queue.Results()
+	if len(results) != 1 || results[0].ID != ids[0] || results[0].Result.Err != nil {
+		t.Fatalf("results after reopening: %v", results)
+	}
+	if string(server.files["remote.txt"]) != "local file" {
+		t.Errorf("stored %q", server.files["remote.txt"])
+	}
+}
+
+func TestQueueCancel(t *testing.T) {
+	server := newMemoryServer()
+	queue, err := OpenQueue(NewTransferScheduler(1, server.opener()), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	ids, err := queue.Add(NewTransferTask(Retrieve, "local1.txt", "remote1.txt"),
+		NewTransferTask(Retrieve, "local2.txt", "remote2.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = queue.Cancel(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = queue.Cancel(ids[0]); err == nil {
+		t.Error("cancelled task was cancelled again")
+	}
+	if pending := queue.Pending(); len(pending) != 1 || pending[0].ID != ids[1] {
+		t.Errorf("pending tasks %v, want the ID %d", pending, ids[1])
+	}
+	results := queue.Results()
+	if len(results) != 1 || results[0].ID != ids[0] || results[0].Result.Err != context.Canceled {
+		t.Errorf("results %v, want the cancelled task", results)
+	}
+}
+
+func TestOpenQueueExpandDirectories(t *testing.T) {
+	scheduler := NewTransferScheduler(1, newMemoryServer().opener())
+	scheduler.ExpandDirectories = true
+	if _, err := OpenQueue(scheduler, "", false); err == nil {
+		t.Error("queue with expanding scheduler opened")
+	}
+}
@@ -0,0 +1,22 @@
+// Contains the representation types of transfered files.
+
+package ftps_qftp_client
+
+// TransferType is the representation type of the transfered data (RFC 959).
+type TransferType int8
+
+const (
+	// Transfer the data unchanged (TYPE I)
+	Binary TransferType = iota
+	// Transfer text with CRLF line endings on the data connection, they are
+	// converted to LF locally (TYPE A)
+	ASCII
+)
+
+// String returns the parameter of the TYPE command for the transfer type.
+func (t TransferType) String() string {
+	if t == ASCII {
+		return "A"
+	}
+	return "I"
+}
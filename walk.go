@@ -0,0 +1,254 @@
+// Contains the traversal of remote directory trees.
+
+package ftps_qftp_client
+
+import (
+	"errors"
+	"path"
+	"sync"
+)
+
+// SkipDir can be returned by a WalkFunc to skip the directory of the entry
+// or, if the entry is no directory, the remaining entries of its directory.
+var SkipDir = errors.New("skip this directory")
+
+// WalkFunc is called by Walk for each entry in the remote tree. The path is
+// the root joined with the path of the entry below it. If listing a directory
+// failed, WalkFunc is called with the error for the directory, the entry is
+// nil if the directory is the root. If WalkFunc returns an error other than
+// SkipDir, Walk stops and returns the error.
+type WalkFunc func(path string, entry *Entry, err error) error
+
+// Walk walks the remote file tree below root with MLSD or, if the server does
+// not support it, with LIST commands and calls fn
+// for each file, directory and link in it, directories before their content.
+// Links are not followed.
+func Walk(conn ConnectionI, root string, fn WalkFunc) error {
+	return walk(connLister{conn}, root, fn)
+}
+
+// ParallelWalk walks the remote file tree below root like Walk, but lists the
+// subdirectories of a directory concurrently with up to nrParallel
+// connections opened by openConn. fn is called in the same order as by Walk
+// and never concurrently. Directories skipped by fn may have been listed
+// nevertheless. The connections are closed before ParallelWalk returns.
+// It fails without calling fn, if no connection could be opened.
+func ParallelWalk(openConn ConnectionOpener, nrParallel int, root string, fn WalkFunc) error {
+	lister, err := newParallelLister(openConn, nrParallel)
+	if err != nil {
+		return err
+	}
+	defer lister.stop()
+	return walk(lister, root, fn)
+}
+
+// Lists the directories of a walk.
+type dirLister interface {
+	// Starts listing the directories, which are likely listed next
+	prefetch(dirs []string)
+	list(dir string) ([]*Entry, error)
+}
+
+// Lists the directories one after another with a single connection.
+type connLister struct {
+	conn ConnectionI
+}
+
+func (l connLister) prefetch(dirs []string) {}
+
+func (l connLister) list(dir string) ([]*Entry, error) {
+	return listDir(l.conn, dir)
+}
+
+// Walks the tree below root with the directories listed by lister.
+func walk(lister dirLister, root string, fn WalkFunc) error {
+	entries, err := lister.list(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkEntries(lister, root, entries, fn)
+	}
+	if err == SkipDir {
+		return nil
+	}
+	return err
+}
+
+// Calls fn for the entries of the directory and descends into subdirectories.
+func walkEntries(lister dirLister, dir string, entries []*Entry, fn WalkFunc) error {
+	var subDirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name != "." && entry.Name != ".." {
+			subDirs = append(subDirs, path.Join(dir, entry.Name))
+		}
+	}
+	lister.prefetch(subDirs)
+
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		entryPath := path.Join(dir, entry.Name)
+		err := fn(entryPath, entry, nil)
+		if err == SkipDir {
+			if entry.IsDir() {
+				continue
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			continue
+		}
+
+		subEntries, err := lister.list(entryPath)
+		if err != nil {
+			err = fn(entryPath, entry, err)
+		} else {
+			err = walkEntries(lister, entryPath, subEntries, fn)
+		}
+		if err != nil && err != SkipDir {
+			return err
+		}
+	}
+	return nil
+}
+
+// Listing of a directory by a worker of a parallelLister
+type dirListing struct {
+	dir     string
+	done    chan struct{} // closed when entries and err are set
+	entries []*Entry
+	err     error
+}
+
+// Lists the directories concurrently with a worker for each connection.
+type parallelLister struct {
+	jobs     chan *dirListing
+	stopped  chan struct{}
+	workers  sync.WaitGroup
+	mutex    sync.Mutex
+	listings map[string]*dirListing // started listings not yet taken by list
+}
+
+// Opens up to nrParallel connections concurrently and starts a worker for
+// each one opened. It fails like openConnections.
+func newParallelLister(openConn ConnectionOpener, nrParallel int) (*parallelLister, error) {
+	conns, err := openConnections(openConn, nrParallel)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &parallelLister{jobs: make(chan *dirListing), stopped: make(chan struct{}),
+		listings: make(map[string]*dirListing)}
+	for _, conn := range conns {
+		l.workers.Add(1)
+		go l.work(conn)
+	}
+	return l, nil
+}
+
+// Opens up to nrParallel connections concurrently and returns the ones
+// opened. It fails with the error of the last connection, if none could be
+// opened.
+func openConnections(openConn ConnectionOpener, nrParallel int) ([]ConnectionI, error) {
+	if nrParallel < 1 {
+		nrParallel = 1
+	}
+	conns := make(chan ConnectionI, nrParallel)
+	openErrors := make(chan error, nrParallel)
+	var opening sync.WaitGroup
+	for i := 0; i < nrParallel; i++ {
+		opening.Add(1)
+		go func() {
+			defer opening.Done()
+			conn, err := openConn()
+			if err != nil {
+				openErrors <- err
+				return
+			}
+			conns <- conn
+		}()
+	}
+	opening.Wait()
+	close(conns)
+	close(openErrors)
+	if len(conns) == 0 {
+		return nil, <-openErrors
+	}
+	opened := make([]ConnectionI, 0, len(conns))
+	for conn := range conns {
+		opened = append(opened, conn)
+	}
+	return opened, nil
+}
+
+// Lists the directories of the jobs with the connection till the lister
+// is stopped.
+func (l *parallelLister) work(conn ConnectionI) {
+	defer l.workers.Done()
+	defer conn.Quit()
+	workDir, workDirErr := keepWorkingDir(conn)
+	for {
+		select {
+		case listing := <-l.jobs:
+			// Relative directories are listed from the directory the connection was opened in
+			listing.err = workDirErr
+			if listing.err == nil {
+				listing.err = workDir.restore()
+			}
+			if listing.err == nil {
+				listing.entries, listing.err = listDir(conn, listing.dir)
+			}
+			close(listing.done)
+		case <-l.stopped:
+			return
+		}
+	}
+}
+
+// Starts the listing of the directories not yet started. The jobs are passed
+// to the workers by a goroutine of its own, so the walk is not blocked.
+func (l *parallelLister) prefetch(dirs []string) {
+	var started []*dirListing
+	l.mutex.Lock()
+	for _, dir := range dirs {
+		if _, available := l.listings[dir]; !available {
+			listing := &dirListing{dir: dir, done: make(chan struct{})}
+			l.listings[dir] = listing
+			started = append(started, listing)
+		}
+	}
+	l.mutex.Unlock()
+	if len(started) == 0 {
+		return
+	}
+	go func() {
+		for _, listing := range started {
+			select {
+			case l.jobs <- listing:
+			case <-l.stopped:
+				return
+			}
+		}
+	}()
+}
+
+// Waits for the listing of the directory, which is started if it wasn't.
+func (l *parallelLister) list(dir string) ([]*Entry, error) {
+	l.prefetch([]string{dir})
+	l.mutex.Lock()
+	listing := l.listings[dir]
+	delete(l.listings, dir)
+	l.mutex.Unlock()
+	<-listing.done
+	return listing.entries, listing.err
+}
+
+// Stops the workers, closes their connections and waits till they exited.
+func (l *parallelLister) stop() {
+	close(l.stopped)
+	l.workers.Wait()
+}
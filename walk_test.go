@@ -0,0 +1,110 @@
+package ftps_qftp_client
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	server := newMemoryServer()
+	server.dirs["/tree"] = true
+	server.dirs["/tree/sub"] = true
+	server.dirs["/tree/skipped"] = true
+	server.files["/tree/a.txt"] = []byte("a")
+	server.files["/tree/sub/b.txt"] = []byte("b")
+	server.files["/tree/skipped/c.txt"] = []byte("c")
+
+	var visited []string
+	err := Walk(&memoryConn{server: server}, "/tree", func(path string, entry *Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		visited = append(visited, path)
+		if path == "/tree/skipped" {
+			return SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(visited)
+	expected := []string{"/tree/a.txt", "/tree/skipped", "/tree/sub", "/tree/sub/b.txt"}
+	if len(visited) != len(expected) {
+		t.Fatalf("visited %v, want %v", visited, expected)
+	}
+	for i := range expected {
+		if visited[i] != expected[i] {
+			t.Errorf("visited %v, want %v", visited, expected)
+			break
+		}
+	}
+
+	err = Walk(&memoryConn{server: server}, "/missing", func(path string, entry *Entry, err error) error {
+		return err
+	})
+	if err == nil {
+		t.Error("Walk of a missing directory returned no error")
+	}
+}
+
+func TestParallelWalk(t *testing.T) {
+	server := newMemoryServer()
+	server.dirs["/tree"] = true
+	for _, dir := range []string{"a", "b", "c", "d"} {
+		server.dirs["/tree/"+dir] = true
+		server.dirs["/tree/"+dir+"/sub"] = true
+		server.files["/tree/"+dir+"/sub/file.txt"] = []byte(dir)
+	}
+	server.files["/tree/top.txt"] = []byte("top")
+
+	var serial []string
+	err := Walk(&memoryConn{server: server}, "/tree", func(path string, entry *Entry, err error) error {
+		serial = append(serial, path)
+		if path == "/tree/b" {
+			return SkipDir
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opened int32
+	var parallel []string
+	err = ParallelWalk(func() (ConnectionI, error) {
+		atomic.AddInt32(&opened, 1)
+		return &memoryConn{server: server}, nil
+	}, 3, "/tree", func(path string, entry *Entry, err error) error {
+		parallel = append(parallel, path)
+		if path == "/tree/b" {
+			return SkipDir
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened != 3 {
+		t.Errorf("Opened %d connections, expected 3", opened)
+	}
+	// The memory server lists in random order
+	sort.Strings(serial)
+	sort.Strings(parallel)
+	if !reflect.DeepEqual(parallel, serial) {
+		t.Errorf("ParallelWalk visited %v, Walk %v", parallel, serial)
+	}
+
+	err = ParallelWalk(func() (ConnectionI, error) {
+		return nil, errors.New("530 Login incorrect.")
+	}, 2, "/tree", func(path string, entry *Entry, err error) error {
+		t.Errorf("Called for %s without connection", path)
+		return nil
+	})
+	if err == nil {
+		t.Error("ParallelWalk without connection returned no error")
+	}
+}
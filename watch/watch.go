@@ -0,0 +1,396 @@
+// Package watch uploads the files of a local directory tree to a remote
+// directory, as soon as they are created or changed, like a hot folder:
+//
+//	watcher, err := watch.New(c, "/srv/outgoing", "/incoming", watch.Options{Delete: true})
+//	...
+//	defer watcher.Close()
+//
+// The local tree is monitored with fsnotify. A file is uploaded, after it was
+// not changed for the debounce time, so files still written are not uploaded
+// several times. Renames within the tree are performed at the server instead
+// of uploading the file again and with Delete removed files are deleted at
+// the server too.
+//
+// The package is optional, the other packages of the client do not depend
+// on fsnotify.
+package watch
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is the time a file must not change before it is uploaded,
+// if the options choose no other one.
+const DefaultDebounce = 2 * time.Second
+
+// EventType is the kind of an operation of the Watcher at the server.
+type EventType int8
+
+const (
+	// A file was uploaded
+	EventUpload EventType = iota
+	// A directory was created
+	EventMakeDir
+	// A file or directory was renamed
+	EventRename
+	// A file or directory was deleted
+	EventDelete
+	// Watching the local tree failed, e.g. the queue of the kernel overflowed
+	EventError
+)
+
+// Event reports an operation of the Watcher to the Report function of its
+// options.
+type Event struct {
+	Type          EventType
+	LocalPath     string
+	RemotePath    string
+	OldRemotePath string // the previous name of a renamed file or directory
+	Bytes         int64  // bytes uploaded
+	Err           error  // nil if the operation succeeded
+}
+
+// Options configure a Watcher.
+type Options struct {
+	// Time a file must not change before it is uploaded, DefaultDebounce if 0.
+	// A renamed file must appear under its new name within this time, else it
+	// is taken as removed.
+	Debounce time.Duration
+	// Delete the files and directories at the server, which are removed
+	// from the local tree
+	Delete bool
+	// Called with each operation at the server, optional. It is called from
+	// the goroutine of the watcher and delays the following operations.
+	Report func(Event)
+}
+
+// Watcher uploads the changes of a local directory tree to a remote
+// directory, see the package documentation.
+type Watcher struct {
+	conn      ftps_qftp_client.ConnectionI
+	localDir  string
+	remoteDir string
+	options   Options
+	notify    *fsnotify.Watcher
+	known     map[string]fileState // local paths present at the server
+	changed   map[string]time.Time // files to upload with the time of their last change
+	moved     []movedPath          // renamed paths, whose new name is not yet known
+	closing   chan struct{}
+	stopped   chan struct{} // closed when the goroutine of the watcher exited
+}
+
+// State of a local file or directory, with which renames are recognized
+type fileState struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+// File or directory renamed at the time
+type movedPath struct {
+	localPath string
+	state     fileState
+	time      time.Time
+}
+
+// New starts watching the local directory. Files and directories created or
+// changed afterwards are uploaded to the corresponding paths below the remote
+// directory, the files existing before are taken as already present at the
+// server. They can be mirrored before with ftps_qftp_client.PlanMirror.
+//
+// The watcher uses the connection from its own goroutine, so it must not be
+// used otherwise till Close.
+func New(conn ftps_qftp_client.ConnectionI, localDir string, remoteDir string, options Options) (*Watcher, error) {
+	if options.Debounce <= 0 {
+		options.Debounce = DefaultDebounce
+	}
+	info, err := os.Stat(localDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(localDir + " is no directory.")
+	}
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.New("Error while watching " + localDir + ". " + err.Error())
+	}
+	w := &Watcher{conn: conn, localDir: filepath.Clean(localDir), remoteDir: remoteDir, options: options,
+		notify: notify, known: make(map[string]fileState), changed: make(map[string]time.Time),
+		closing: make(chan struct{}), stopped: make(chan struct{})}
+	if err = w.addTree(w.localDir, false); err != nil {
+		notify.Close()
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops watching. The changes still within the debounce time are
+// uploaded before.
+func (w *Watcher) Close() error {
+	close(w.closing)
+	<-w.stopped
+	return w.notify.Close()
+}
+
+// Handles the events of the local tree till the watcher is closed.
+func (w *Watcher) run() {
+	defer close(w.stopped)
+	interval := w.options.Debounce / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-w.notify.Events:
+			w.handle(event, time.Now())
+		case err := <-w.notify.Errors:
+			w.report(Event{Type: EventError, LocalPath: w.localDir, Err: err})
+		case now := <-ticker.C:
+			w.flush(now, false)
+		case <-w.closing:
+			w.flush(time.Now(), true)
+			return
+		}
+	}
+}
+
+// Records the change of the event.
+func (w *Watcher) handle(event fsnotify.Event, now time.Time) {
+	localPath := event.Name
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Lstat(localPath)
+		if err != nil {
+			// Removed meanwhile
+			return
+		}
+		state := stateOf(info)
+		if w.renameMoved(localPath, state) {
+			return
+		}
+		if info.IsDir() {
+			w.addTree(localPath, true)
+		} else if info.Mode().IsRegular() {
+			w.changed[localPath] = now
+		}
+	case event.Has(fsnotify.Write):
+		w.changed[localPath] = now
+	case event.Has(fsnotify.Rename), event.Has(fsnotify.Remove):
+		delete(w.changed, localPath)
+		state, known := w.known[localPath]
+		if !known {
+			return
+		}
+		if event.Has(fsnotify.Rename) {
+			// The new name follows with Create, if it is within the tree
+			w.moved = append(w.moved, movedPath{localPath: localPath, state: state, time: now})
+		} else {
+			w.remove(localPath)
+		}
+	}
+}
+
+// Uploads the files not changed for the debounce time and takes the renamed
+// paths without new name as removed. With all the remaining ones are handled
+// too.
+func (w *Watcher) flush(now time.Time, all bool) {
+	var moved []movedPath
+	for _, m := range w.moved {
+		if !all && now.Sub(m.time) < w.options.Debounce {
+			moved = append(moved, m)
+			continue
+		}
+		w.remove(m.localPath)
+	}
+	w.moved = moved
+
+	var ready []string
+	for localPath, changed := range w.changed {
+		if all || now.Sub(changed) >= w.options.Debounce {
+			ready = append(ready, localPath)
+		}
+	}
+	sort.Strings(ready)
+	for _, localPath := range ready {
+		delete(w.changed, localPath)
+		w.upload(localPath)
+	}
+}
+
+// Uploads the local file.
+func (w *Watcher) upload(localPath string) {
+	info, err := os.Stat(localPath)
+	if err != nil || !info.Mode().IsRegular() {
+		// Removed meanwhile
+		return
+	}
+	remotePath := w.remotePath(localPath)
+	event := Event{Type: EventUpload, LocalPath: localPath, RemotePath: remotePath}
+	if event.Err = ftps_qftp_client.MkdirAll(w.conn, path.Dir(remotePath)); event.Err == nil {
+		result := ftps_qftp_client.PerformTransferTask(w.conn,
+			ftps_qftp_client.NewTransferTask(ftps_qftp_client.Store, localPath, remotePath))
+		event.Bytes, event.Err = result.Bytes, result.Err
+	}
+	if event.Err == nil {
+		w.known[localPath] = stateOf(info)
+	}
+	w.report(event)
+}
+
+// Renames the path at the server, if it was renamed locally to the path. It
+// reports whether a renamed path with the state was found.
+func (w *Watcher) renameMoved(localPath string, state fileState) bool {
+	for i, m := range w.moved {
+		if m.state != state {
+			continue
+		}
+		w.moved = append(w.moved[:i], w.moved[i+1:]...)
+		event := Event{Type: EventRename, LocalPath: localPath, RemotePath: w.remotePath(localPath),
+			OldRemotePath: w.remotePath(m.localPath)}
+		if event.Err = ftps_qftp_client.MkdirAll(w.conn, path.Dir(event.RemotePath)); event.Err == nil {
+			event.Err = w.conn.Rename(event.OldRemotePath, event.RemotePath)
+		}
+		w.report(event)
+		if event.Err != nil {
+			// Transfer it under the new name instead
+			w.remove(m.localPath)
+			if state.isDir {
+				w.addTree(localPath, true)
+			} else {
+				w.changed[localPath] = time.Now()
+			}
+			return true
+		}
+
+		for _, knownPath := range w.knownBelow(m.localPath) {
+			knownState := w.known[knownPath]
+			delete(w.known, knownPath)
+			w.known[localPath+strings.TrimPrefix(knownPath, m.localPath)] = knownState
+		}
+		if state.isDir {
+			// The watches of the directories are bound to their old names
+			for _, dir := range w.knownBelow(localPath) {
+				if w.known[dir].isDir {
+					w.notify.Remove(m.localPath + strings.TrimPrefix(dir, localPath))
+				}
+			}
+			w.addTree(localPath, false)
+		}
+		return true
+	}
+	return false
+}
+
+// Forgets the local path and the paths below it. With the option Delete
+// they are deleted at the server, the content of directories before them.
+func (w *Watcher) remove(localPath string) {
+	below := w.knownBelow(localPath)
+	for _, knownPath := range below {
+		delete(w.changed, knownPath)
+	}
+	if !w.options.Delete {
+		for _, knownPath := range below {
+			delete(w.known, knownPath)
+		}
+		return
+	}
+	for i := len(below) - 1; i >= 0; i-- {
+		knownPath := below[i]
+		event := Event{Type: EventDelete, LocalPath: knownPath, RemotePath: w.remotePath(knownPath)}
+		if w.known[knownPath].isDir {
+			event.Err = w.conn.RemoveDir(event.RemotePath)
+		} else {
+			event.Err = w.conn.Delete(event.RemotePath)
+		}
+		delete(w.known, knownPath)
+		w.report(event)
+	}
+}
+
+// Returns the known paths, which are the local path or below it, sorted so
+// directories come before their content.
+func (w *Watcher) knownBelow(localPath string) []string {
+	var below []string
+	for knownPath := range w.known {
+		if knownPath == localPath || strings.HasPrefix(knownPath, localPath+string(filepath.Separator)) {
+			below = append(below, knownPath)
+		}
+	}
+	sort.Strings(below)
+	return below
+}
+
+// Watches the local directory and its subdirectories. With upload the
+// directories are created at the server and the files are uploaded, else
+// they are taken as present at the server.
+func (w *Watcher) addTree(localDir string, upload bool) error {
+	return filepath.Walk(localDir, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if localPath != localDir {
+				// Removed meanwhile
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			if upload {
+				w.changed[localPath] = time.Now()
+			} else {
+				w.known[localPath] = stateOf(info)
+			}
+			return nil
+		}
+		if err = w.notify.Add(localPath); err != nil {
+			return errors.New("Error while watching " + localPath + ". " + err.Error())
+		}
+		if upload {
+			event := Event{Type: EventMakeDir, LocalPath: localPath, RemotePath: w.remotePath(localPath)}
+			event.Err = ftps_qftp_client.MkdirAll(w.conn, event.RemotePath)
+			w.report(event)
+			if event.Err != nil {
+				return nil
+			}
+		}
+		if localPath != w.localDir {
+			w.known[localPath] = stateOf(info)
+		}
+		return nil
+	})
+}
+
+// Returns the remote path of a local path within the tree.
+func (w *Watcher) remotePath(localPath string) string {
+	relativePath, err := filepath.Rel(w.localDir, localPath)
+	if err != nil {
+		relativePath = filepath.Base(localPath)
+	}
+	return path.Join(w.remoteDir, filepath.ToSlash(relativePath))
+}
+
+// Passes the event to the Report function of the options.
+func (w *Watcher) report(event Event) {
+	if w.options.Report != nil {
+		w.options.Report(event)
+	}
+}
+
+// Returns the state of the file or directory.
+func stateOf(info os.FileInfo) fileState {
+	return fileState{isDir: info.IsDir(), size: info.Size(), modTime: info.ModTime()}
+}
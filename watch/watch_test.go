@@ -0,0 +1,234 @@
+package watch
+
+import (
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/attenberger/ftps_qftp-client"
+)
+
+// memoryConn keeps the remote files and directories in memory. The methods
+// not used by the watcher are left to the embedded nil interface.
+type memoryConn struct {
+	ftps_qftp_client.ConnectionI
+	mutex      sync.Mutex
+	files      map[string]string
+	dirs       map[string]bool
+	currentDir string
+}
+
+func newMemoryConn() *memoryConn {
+	return &memoryConn{files: make(map[string]string), dirs: map[string]bool{"/": true}, currentDir: "/"}
+}
+
+func (c *memoryConn) CurrentDir() (string, error) {
+	return c.currentDir, nil
+}
+
+func (c *memoryConn) ChangeDir(dir string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.dirs[dir] {
+		return &textproto.Error{Code: ftps_qftp_client.StatusFileUnavailable, Msg: "No such directory."}
+	}
+	c.currentDir = dir
+	return nil
+}
+
+func (c *memoryConn) MakeDir(dir string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.dirs[dir] = true
+	return nil
+}
+
+func (c *memoryConn) RemoveDir(dir string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.dirs, dir)
+	return nil
+}
+
+func (c *memoryConn) Stor(remotePath string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.files[remotePath] = string(data)
+	return nil
+}
+
+func (c *memoryConn) Delete(remotePath string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.files, remotePath)
+	return nil
+}
+
+func (c *memoryConn) Rename(from, to string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for name, data := range c.files {
+		if name == from || path.Dir(name) == from {
+			delete(c.files, name)
+			c.files[to+name[len(from):]] = data
+		}
+	}
+	if c.dirs[from] {
+		delete(c.dirs, from)
+		c.dirs[to] = true
+	}
+	return nil
+}
+
+func (c *memoryConn) file(remotePath string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, exists := c.files[remotePath]
+	return data, exists
+}
+
+// Returns the next reported event of the type.
+func nextEvent(t *testing.T, events chan Event, eventType EventType) Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Err != nil {
+				t.Fatalf("event %v failed: %v", event.Type, event.Err)
+			}
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no event %v reported", eventType)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "watchtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+	if err = ioutil.WriteFile(filepath.Join(localDir, "old.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := newMemoryConn()
+	events := make(chan Event, 100)
+	watcher, err := New(conn, localDir, "/incoming", Options{Debounce: 50 * time.Millisecond, Delete: true,
+		Report: func(event Event) { events <- event }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	// Created and written files are uploaded once
+	newPath := filepath.Join(localDir, "new.txt")
+	if err = ioutil.WriteFile(newPath, []byte("new file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	event := nextEvent(t, events, EventUpload)
+	if event.RemotePath != "/incoming/new.txt" || event.Bytes != int64(len("new file")) {
+		t.Errorf("upload %+v", event)
+	}
+	if data, _ := conn.file("/incoming/new.txt"); data != "new file" {
+		t.Errorf("uploaded %q", data)
+	}
+
+	// Files in new directories are uploaded
+	if err = os.MkdirAll(filepath.Join(localDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, events, EventMakeDir)
+	if err = ioutil.WriteFile(filepath.Join(localDir, "sub", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if event = nextEvent(t, events, EventUpload); event.RemotePath != "/incoming/sub/a.txt" {
+		t.Errorf("upload %+v", event)
+	}
+
+	// Renamed files are renamed at the server
+	if err = os.Rename(newPath, filepath.Join(localDir, "renamed.txt")); err != nil {
+		t.Fatal(err)
+	}
+	event = nextEvent(t, events, EventRename)
+	if event.OldRemotePath != "/incoming/new.txt" || event.RemotePath != "/incoming/renamed.txt" {
+		t.Errorf("rename %+v", event)
+	}
+	if data, _ := conn.file("/incoming/renamed.txt"); data != "new file" {
+		t.Errorf("renamed file contains %q", data)
+	}
+
+	// Removed files are deleted, also the ones existing before
+	if err = os.Remove(filepath.Join(localDir, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if event = nextEvent(t, events, EventDelete); event.RemotePath != "/incoming/old.txt" {
+		t.Errorf("delete %+v", event)
+	}
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "watchtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	conn := newMemoryConn()
+	var uploads int
+	watcher, err := New(conn, localDir, "/", Options{Debounce: time.Hour, Report: func(event Event) {
+		if event.Type == EventUpload {
+			uploads++
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filepath.Join(localDir, "growing.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		file.WriteString("line\n")
+		time.Sleep(10 * time.Millisecond)
+	}
+	file.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// The changes within the debounce time are uploaded by Close
+	if err = watcher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if uploads != 1 {
+		t.Errorf("file uploaded %d times, want 1", uploads)
+	}
+	if data, _ := conn.file("/growing.txt"); data != "line\nline\nline\nline\nline\n" {
+		t.Errorf("uploaded %q", data)
+	}
+}
+
+func TestNewNoDirectory(t *testing.T) {
+	file, err := ioutil.TempFile("", "watchtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	if _, err = New(newMemoryConn(), file.Name(), "/", Options{}); err == nil {
+		t.Error("file watched as directory")
+	}
+}
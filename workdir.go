@@ -0,0 +1,49 @@
+// Contains the restoration of the working directory of reused connections.
+
+package ftps_qftp_client
+
+import "fmt"
+
+// Working directory of a connection, which performs several tasks one after
+// the other, e.g. a connection of a TransferScheduler. A task may leave the
+// connection in another directory, e.g. if it changed into a directory and
+// could not change back. Relative paths of the following tasks would then
+// silently address other files, so the directory is restored before each
+// task.
+type workingDir struct {
+	conn ConnectionI
+	dir  string // absolute path of the directory the connection was opened in
+}
+
+// Records the current directory of the connection.
+func keepWorkingDir(conn ConnectionI) (*workingDir, error) {
+	dir, err := currentDir(conn)
+	if err != nil {
+		return nil, fmt.Errorf("Error while determining the working directory. %w", err)
+	}
+	return &workingDir{conn: conn, dir: dir}, nil
+}
+
+// Changes back to the recorded directory, if the connection is in another
+// one.
+func (w *workingDir) restore() error {
+	dir, err := currentDir(w.conn)
+	if err == nil && dir == w.dir {
+		return nil
+	}
+	if err = w.conn.ChangeDir(w.dir); err != nil {
+		return fmt.Errorf("Error while changing back to the working directory %s. %w", w.dir, err)
+	}
+	return nil
+}
+
+// Returns the current directory of the connection. The backends track it, so
+// it is taken from AbsPath without PWD, if the connection provides it.
+func currentDir(conn ConnectionI) (string, error) {
+	if tracking, ok := conn.(interface{ AbsPath(string) (string, error) }); ok {
+		if dir, err := tracking.AbsPath("."); err == nil {
+			return dir, nil
+		}
+	}
+	return conn.CurrentDir()
+}
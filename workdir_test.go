@@ -0,0 +1,78 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// wanderingConn leaves the current directory after each retrieval, like a
+// task changing into a directory without changing back.
+type wanderingConn struct {
+	memoryConn
+	retrievedIn []string
+}
+
+func (c *wanderingConn) Retr(path string) (io.ReadCloser, error) {
+	dir, _ := c.CurrentDir()
+	c.retrievedIn = append(c.retrievedIn, dir)
+	if err := c.ChangeDir("/elsewhere"); err != nil {
+		return nil, err
+	}
+	return c.memoryConn.Retr(path)
+}
+
+func TestTransferSchedulerRestoresWorkingDir(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "transfertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	server := newMemoryServer()
+	server.dirs["/elsewhere"] = true
+	server.files["one.txt"] = []byte("one")
+	server.files["two.txt"] = []byte("two")
+	conn := &wanderingConn{memoryConn: memoryConn{server: server}}
+	openConn := func() (ConnectionI, error) {
+		return conn, nil
+	}
+
+	tasks := []TransferTask{
+		NewTransferTask(Retrieve, filepath.Join(localDir, "one.txt"), "one.txt"),
+		NewTransferTask(Retrieve, filepath.Join(localDir, "two.txt"), "two.txt"),
+	}
+	results := NewTransferScheduler(1, openConn).Run(context.Background(), tasks)
+	if err = results.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.retrievedIn) != 2 || conn.retrievedIn[0] != "/" || conn.retrievedIn[1] != "/" {
+		t.Errorf("The files were retrieved in the directories %q, expected both in /", conn.retrievedIn)
+	}
+}
+
+func TestWorkingDirRestoreFails(t *testing.T) {
+	server := newMemoryServer()
+	server.dirs["/gone"] = true
+	conn := &memoryConn{server: server}
+	if err := conn.ChangeDir("/gone"); err != nil {
+		t.Fatal(err)
+	}
+	workDir, err := keepWorkingDir(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unchanged directories need no CWD
+	delete(server.dirs, "/gone")
+	if err = workDir.restore(); err != nil {
+		t.Errorf("restore in the kept directory returned %v", err)
+	}
+	conn.currentDir = "/"
+	if err = workDir.restore(); !isNotFound(err) {
+		t.Errorf("restore into a removed directory returned %v, expected the reply 550", err)
+	}
+}